@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/tdeslauriers/carapace/pkg/config"
+	"github.com/tdeslauriers/silhouette/internal/server"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+// runCheck scans the database for orphans and invariant violations and prints the findings.
+// With --repair, safe fixes are applied.  It returns an error if any finding is left unrepaired
+// so the command can be used as a scheduled job.
+func runCheck(args []string) error {
+
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "apply safe fixes for the problems found")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	def := config.SvcDefinition{
+		ServiceName: "silhouette",
+		Tls:         config.MutualTls,
+		Requires: config.Requires{
+			Db:          true,
+			IndexSecret: true,
+			AesSecret:   true,
+		},
+	}
+
+	cfg, err := config.Load(def)
+	if err != nil {
+		return fmt.Errorf("failed to load %s integrity check configuration: %v", def.ServiceName, err)
+	}
+
+	db, err := server.ConnectDb(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	indexer, err := server.NewIndexer(cfg)
+	if err != nil {
+		return err
+	}
+
+	cryptor, err := server.NewCryptor(cfg)
+	if err != nil {
+		return err
+	}
+
+	// the primary address rules come from the server's settings, so the check reports what the server would not allow
+	settings, err := server.LoadSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load %s settings: %v", def.ServiceName, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report, err := storage.NewIntegrityChecker(db, indexer, cryptor, settings.AddressPrimaryPerType).CheckIntegrity(ctx, *repair)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tTABLE\tUUID\tPROFILE\tREPAIRED\tDETAIL")
+	for _, f := range report.Findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", f.Kind, f.Table, f.Uuid, f.ProfileUuid, f.Repaired, f.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("scanned %d profiles, %d addresses, %d phones: %d findings, %d unrepaired\n",
+		report.ProfilesScanned, report.AddressesScanned, report.PhonesScanned,
+		len(report.Findings), report.Unrepaired())
+
+	if report.Unrepaired() > 0 {
+		return fmt.Errorf("%d integrity problems need attention", report.Unrepaired())
+	}
+
+	return nil
+}
@@ -24,6 +24,27 @@ func main() {
 		With(slog.String(definitions.PackageKey, definitions.PackageMain)).
 		With(slog.String(definitions.ComponentKey, definitions.ComponentMain))
 
+	// run a subcommand if one is given, ie, `silhouette migrate up`
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigrate(os.Args[2:]); err != nil {
+				logger.Error("failed to run migrate command", "err", err.Error())
+				os.Exit(1)
+			}
+			return
+		case "check":
+			if err := runCheck(os.Args[2:]); err != nil {
+				logger.Error("failed to run integrity check", "err", err.Error())
+				os.Exit(1)
+			}
+			return
+		default:
+			logger.Error(fmt.Sprintf("unknown command %q", os.Args[1]))
+			os.Exit(1)
+		}
+	}
+
 	// service definition and requirements
 	def := config.SvcDefinition{
 		ServiceName: "silhouette",
@@ -34,6 +55,9 @@ func main() {
 			AesSecret:        true,
 			S2sVerifyingKey:  true,
 			UserVerifyingKey: true,
+
+			// impersonation notices are posted over the s2s client's mutual tls
+			S2sClient: os.Getenv("SILHOUETTE_IMPERSONATION_NOTIFY_URL") != "",
 		},
 	}
 
@@ -44,8 +68,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// load silhouette specific settings
+	settings, err := server.LoadSettings()
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to load %s profile service settings", def.ServiceName), "err", err.Error())
+		os.Exit(1)
+	}
+
 	// create the server
-	srv, err := server.New(config)
+	srv, err := server.New(config, settings)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to create %s profile service server", def.ServiceName), "err", err.Error())
 		os.Exit(1)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tdeslauriers/carapace/pkg/config"
+	"github.com/tdeslauriers/silhouette/internal/server"
+	"github.com/tdeslauriers/silhouette/internal/storage/migrate"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/migrations"
+)
+
+// runMigrate applies, rolls back or reports on the schema migrations embedded in the binary.
+// Only the database configuration is required.
+func runMigrate(args []string) error {
+
+	def := config.SvcDefinition{
+		ServiceName: "silhouette",
+		Tls:         config.MutualTls,
+		Requires: config.Requires{
+			Db: true,
+		},
+	}
+
+	cfg, err := config.Load(def)
+	if err != nil {
+		return fmt.Errorf("failed to load %s migration configuration: %v", def.ServiceName, err)
+	}
+
+	db, err := server.ConnectDb(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.NewMigrator(db, migrations.Files)
+	if err != nil {
+		return fmt.Errorf("failed to load schema migrations: %v", err)
+	}
+
+	// stop between statements if interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return migrate.RunCommand(ctx, migrator, args, os.Stdout)
+}
@@ -0,0 +1,359 @@
+package address
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+)
+
+// address request field names, as they are named in the api, used to report field errors
+const (
+	FieldUsername       = "username"
+	FieldStreetAddress  = "street_address"
+	FieldStreetAddress2 = "street_address_2"
+	FieldCity           = "city"
+	FieldStateProvince  = "state_province"
+	FieldPostalCode     = "postal_code"
+	FieldCountry        = "country"
+	FieldValidFrom      = "valid_from"
+	FieldValidTo        = "valid_to"
+	FieldPromoteOnStart = "promote_on_start"
+	FieldAddressType    = "address_type"
+)
+
+// countriesJson is the address rules table, keyed by ISO 3166-1 alpha-2 code.
+// Supporting a new country is a matter of adding its entry.
+//
+//go:embed countries.json
+var countriesJson []byte
+
+// CountryRules are the address rules for a single country.
+type CountryRules struct {
+	// Code is the ISO 3166-1 alpha-2 code, set from the key of the rules table.
+	Code string `json:"-"`
+
+	Name string `json:"name"`
+
+	// Aliases are other names accepted in place of the code, eg, "USA" or "United Kingdom".
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Required are the fields that must be present in addition to street address, city, and country,
+	// which every address requires.
+	Required []string `json:"required"`
+
+	// PostalPattern is matched against the normalized postal code, if one is present.
+	PostalPattern string `json:"postal_pattern,omitempty"`
+
+	// Subdivisions are the valid states/provinces, code to name.  When present, the
+	// state_province field must be one of them and is normalized to its code.
+	Subdivisions map[string]string `json:"subdivisions,omitempty"`
+
+	// Uppercase are the fields stored in upper case.
+	Uppercase []string `json:"uppercase,omitempty"`
+
+	// Abbreviations are street address words, lower case, mapped to their standard abbreviation.
+	Abbreviations map[string]string `json:"abbreviations,omitempty"`
+
+	// Label is the mailing label layout, one template per line, see FormatAddress.
+	Label []string `json:"label,omitempty"`
+
+	postal          *regexp.Regexp
+	subdivisionKeys map[string]string // normalized code or name -> code
+}
+
+var (
+	// countries is the parsed rules table, keyed by alpha-2 code
+	countries map[string]*CountryRules
+
+	// countryKeys maps normalized codes, names, and aliases to alpha-2 codes
+	countryKeys map[string]string
+
+	// stateProvinceRegex is applied to free-text states/provinces of countries without a subdivision list
+	stateProvinceRegex = regexp.MustCompile(`^[a-zA-Z0-9\s.'-]{1,50}$`)
+)
+
+func init() {
+	var err error
+	if countries, countryKeys, err = loadCountryRules(countriesJson); err != nil {
+		// the table is embedded at build time, so this is a programming error
+		panic(fmt.Sprintf("failed to load embedded country rules: %v", err))
+	}
+}
+
+// loadCountryRules parses the rules table and indexes the names each country can be referred to by.
+func loadCountryRules(data []byte) (map[string]*CountryRules, map[string]string, error) {
+
+	var rules map[string]*CountryRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[string]string, len(rules)*4)
+	for code, r := range rules {
+		if len(code) != 2 || code != strings.ToUpper(code) {
+			return nil, nil, fmt.Errorf("country code %q is not an upper case ISO 3166-1 alpha-2 code", code)
+		}
+		r.Code = code
+
+		if r.PostalPattern != "" {
+			re, err := regexp.Compile(r.PostalPattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid postal pattern for %s: %v", code, err)
+			}
+			r.postal = re
+		}
+
+		r.subdivisionKeys = make(map[string]string, len(r.Subdivisions)*2)
+		for sub, name := range r.Subdivisions {
+			r.subdivisionKeys[lookupKey(sub)] = sub
+			r.subdivisionKeys[lookupKey(name)] = sub
+		}
+
+		for _, name := range append([]string{code, r.Name}, r.Aliases...) {
+			if existing, ok := keys[lookupKey(name)]; ok && existing != code {
+				return nil, nil, fmt.Errorf("country name %q is used by both %s and %s", name, existing, code)
+			}
+			keys[lookupKey(name)] = code
+		}
+	}
+
+	return rules, keys, nil
+}
+
+// LookupCountry returns the rules for a country by its alpha-2 code, name, or one of its aliases.
+// Matching ignores case, periods, and extra whitespace.
+func LookupCountry(country string) (*CountryRules, bool) {
+	code, ok := countryKeys[lookupKey(country)]
+	if !ok {
+		return nil, false
+	}
+	return countries[code], true
+}
+
+// SupportedCountries returns the alpha-2 codes of every country in the rules table, sorted.
+func SupportedCountries() []string {
+	codes := make([]string, 0, len(countries))
+	for code := range countries {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// lookupKey folds a name to the form used to match it: upper case, periods removed, single spaced.
+func lookupKey(s string) string {
+	return strings.ToUpper(collapseSpace(strings.ReplaceAll(s, ".", "")))
+}
+
+// collapseSpace trims a value and reduces each run of inner whitespace to a single space.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// requires reports whether the country requires a field beyond the fields every address requires.
+func (r *CountryRules) requires(field string) bool {
+	for _, f := range r.Required {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// uppercases reports whether the country stores a field in upper case.
+func (r *CountryRules) uppercases(field string) bool {
+	for _, f := range r.Uppercase {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// abbreviate replaces street address words with their standard abbreviation, keeping any trailing punctuation.
+func (r *CountryRules) abbreviate(line string) string {
+
+	if len(r.Abbreviations) == 0 {
+		return line
+	}
+
+	words := strings.Fields(line)
+	for i, w := range words {
+		word := strings.TrimRight(w, ".,")
+		if abbr, ok := r.Abbreviations[strings.ToLower(word)]; ok {
+			words[i] = abbr + w[len(word):]
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// AddressFields are the location fields of an address request.
+type AddressFields struct {
+	StreetAddress   string
+	StreetAddress_2 string
+	City            string
+	StateProvince   string
+	PostalCode      string
+	Country         string
+}
+
+// NormalizeCmd validates an AddressUpsert request model against the rules for its country
+// and returns its location fields in their normalized form:
+// the country as its alpha-2 code, a listed subdivision as its code, standard street abbreviations,
+// and upper case where the country calls for it.
+// A country not in the rules table is held to the generic address validation instead, and kept as given.
+// Every invalid field is reported, as FieldErrors.
+func NormalizeCmd(cmd AddressUpsert) (*AddressFields, error) {
+
+	var errs FieldErrors
+
+	// validate email
+	if err := validate.ValidateEmail(cmd.GetUsername()); err != nil {
+		errs = append(errs, FieldError{Field: FieldUsername, Description: err.Error()})
+	}
+
+	fields := &AddressFields{
+		StreetAddress:   collapseSpace(cmd.GetStreetAddress()),
+		StreetAddress_2: collapseSpace(cmd.GetStreetAddress_2()),
+		City:            collapseSpace(cmd.GetCity()),
+		StateProvince:   collapseSpace(cmd.GetStateProvince()),
+		PostalCode:      collapseSpace(cmd.GetPostalCode()),
+		Country:         collapseSpace(cmd.GetCountry()),
+	}
+
+	// look up country rules: the remaining location rules depend on them
+	rules, ok := LookupCountry(fields.Country)
+	switch {
+	case fields.Country == "":
+		errs = append(errs, FieldError{Field: FieldCountry, Description: "country is required"})
+	case !ok:
+		errs = append(errs, validateGeneric(fields)...)
+	default:
+		fields.Country = rules.Code
+		fields.StreetAddress = rules.abbreviate(fields.StreetAddress)
+		fields.StreetAddress_2 = rules.abbreviate(fields.StreetAddress_2)
+		errs = append(errs, rules.normalize(fields)...)
+	}
+
+	// validate address line 1
+	if err := validate.ValidateStreetAddress(fields.StreetAddress); err != nil {
+		errs = append(errs, FieldError{Field: FieldStreetAddress, Description: err.Error()})
+	}
+
+	// validate address line 2, if present
+	if err := validate.ValidateStreetAddress2(fields.StreetAddress_2); err != nil {
+		errs = append(errs, FieldError{Field: FieldStreetAddress2, Description: err.Error()})
+	}
+
+	// validate city
+	if err := validate.ValidateCity(fields.City); err != nil {
+		errs = append(errs, FieldError{Field: FieldCity, Description: err.Error()})
+	}
+
+	// validate effective dates, if present
+	errs = append(errs, validateEffectiveDates(cmd)...)
+
+	if _, ok := api.AddressType_name[int32(cmd.GetAddressType())]; !ok {
+		errs = append(errs, FieldError{Field: FieldAddressType, Description: "invalid address type"})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return fields, nil
+}
+
+// validateGeneric applies the generic state, postal code, and country validation to the address fields of a
+// country without rules, returning any field that breaks it.
+func validateGeneric(fields *AddressFields) FieldErrors {
+
+	var errs FieldErrors
+
+	// validate state
+	if err := validate.ValidateState(fields.StateProvince); err != nil {
+		errs = append(errs, FieldError{Field: FieldStateProvince, Description: err.Error()})
+	}
+
+	// validate postal code
+	if err := validate.ValidateZipCode(fields.PostalCode); err != nil {
+		errs = append(errs, FieldError{Field: FieldPostalCode, Description: err.Error()})
+	}
+
+	// validate country
+	if err := validate.ValidateCountry(fields.Country); err != nil {
+		errs = append(errs, FieldError{Field: FieldCountry, Description: err.Error()})
+	}
+
+	return errs
+}
+
+// normalize applies the country's state/province, postal code, and upper case rules to
+// address fields in place, returning any field that breaks them.
+func (r *CountryRules) normalize(fields *AddressFields) FieldErrors {
+
+	var errs FieldErrors
+
+	// state/province
+	switch {
+	case fields.StateProvince == "":
+		if r.requires(FieldStateProvince) {
+			errs = append(errs, FieldError{Field: FieldStateProvince, Description: fmt.Sprintf("state/province is required for %s", r.Code)})
+		}
+	case len(r.Subdivisions) > 0:
+		code, ok := r.subdivisionKeys[lookupKey(fields.StateProvince)]
+		if !ok {
+			errs = append(errs, FieldError{
+				Field:       FieldStateProvince,
+				Description: fmt.Sprintf("%q is not a state/province of %s", fields.StateProvince, r.Code),
+			})
+			break
+		}
+		fields.StateProvince = code
+	case !stateProvinceRegex.MatchString(fields.StateProvince):
+		errs = append(errs, FieldError{
+			Field:       FieldStateProvince,
+			Description: "state/province must be 1-50 characters and contain only letters, numbers, spaces, periods, apostrophes, and hyphens",
+		})
+	}
+
+	// postal code
+	if r.uppercases(FieldPostalCode) {
+		fields.PostalCode = strings.ToUpper(fields.PostalCode)
+	}
+
+	switch {
+	case fields.PostalCode == "":
+		if r.requires(FieldPostalCode) {
+			errs = append(errs, FieldError{Field: FieldPostalCode, Description: fmt.Sprintf("postal code is required for %s", r.Code)})
+		}
+	case r.postal != nil && !r.postal.MatchString(fields.PostalCode):
+		errs = append(errs, FieldError{
+			Field:       FieldPostalCode,
+			Description: fmt.Sprintf("%q is not a valid postal code for %s", fields.PostalCode, r.Code),
+		})
+	}
+
+	// remaining upper case rules
+	if r.uppercases(FieldStreetAddress) {
+		fields.StreetAddress = strings.ToUpper(fields.StreetAddress)
+		fields.StreetAddress_2 = strings.ToUpper(fields.StreetAddress_2)
+	}
+
+	if r.uppercases(FieldCity) {
+		fields.City = strings.ToUpper(fields.City)
+	}
+
+	if r.uppercases(FieldStateProvince) && len(r.Subdivisions) == 0 {
+		fields.StateProvince = strings.ToUpper(fields.StateProvince)
+	}
+
+	return errs
+}
@@ -0,0 +1,289 @@
+package address
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// addressRequest returns a valid create request for a US address, for the test to change.
+func addressRequest(change func(*api.CreateAddressRequest)) *api.CreateAddressRequest {
+	req := &api.CreateAddressRequest{
+		Username:        testUser,
+		StreetAddress:   "1 Main St",
+		StreetAddress_2: proto.String(""),
+		City:            "Springfield",
+		StateProvince:   "IL",
+		PostalCode:      "62701",
+		Country:         "US",
+	}
+	if change != nil {
+		change(req)
+	}
+	return req
+}
+
+func TestNormalizeCmd(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		change func(*api.CreateAddressRequest)
+		want   AddressFields
+	}{
+		{
+			name:   "valid address is unchanged",
+			change: nil,
+			want:   AddressFields{"1 Main St", "", "Springfield", "IL", "62701", "US"},
+		},
+		{
+			name: "whitespace is collapsed and street words abbreviated",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress = "  1   Main  street "
+				r.StreetAddress_2 = proto.String("Suite 4, Oak avenue.")
+				r.City = " Springfield  "
+			},
+			want: AddressFields{"1 Main St", "Ste 4, Oak Ave.", "Springfield", "IL", "62701", "US"},
+		},
+		{
+			name:   "country alias is stored as its code",
+			change: func(r *api.CreateAddressRequest) { r.Country = "u.s.a." },
+			want:   AddressFields{"1 Main St", "", "Springfield", "IL", "62701", "US"},
+		},
+		{
+			name:   "country name matching ignores case and spacing",
+			change: func(r *api.CreateAddressRequest) { r.Country = "united  states of america" },
+			want:   AddressFields{"1 Main St", "", "Springfield", "IL", "62701", "US"},
+		},
+		{
+			name:   "subdivision name is stored as its code",
+			change: func(r *api.CreateAddressRequest) { r.StateProvince = "illinois" },
+			want:   AddressFields{"1 Main St", "", "Springfield", "IL", "62701", "US"},
+		},
+		{
+			name:   "subdivision code matching ignores case",
+			change: func(r *api.CreateAddressRequest) { r.StateProvince = "il" },
+			want:   AddressFields{"1 Main St", "", "Springfield", "IL", "62701", "US"},
+		},
+		{
+			name:   "zip plus four",
+			change: func(r *api.CreateAddressRequest) { r.PostalCode = "62701-1234" },
+			want:   AddressFields{"1 Main St", "", "Springfield", "IL", "62701-1234", "US"},
+		},
+		{
+			name: "canadian postal code is upper cased",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress, r.City, r.StateProvince, r.PostalCode, r.Country = "24 Sussex drive", "Ottawa", "Ontario", "k1m 1m4", "Canada"
+			},
+			want: AddressFields{"24 Sussex Dr", "", "Ottawa", "ON", "K1M 1M4", "CA"},
+		},
+		{
+			name: "uk postal code is upper cased, without a state",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress, r.City, r.StateProvince, r.PostalCode, r.Country = "10 Downing Street", "London", "", "sw1a 2aa", "UK"
+			},
+			want: AddressFields{"10 Downing Street", "", "London", "", "SW1A 2AA", "GB"},
+		},
+		{
+			name: "french city is upper cased",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress, r.City, r.StateProvince, r.PostalCode, r.Country = "55 Rue du Faubourg", "paris", "", "75008", "France"
+			},
+			want: AddressFields{"55 Rue du Faubourg", "", "PARIS", "", "75008", "FR"},
+		},
+		{
+			name: "free text state is upper cased where the country calls for it",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress, r.City, r.StateProvince, r.PostalCode, r.Country = "Via del Corso 1", "Roma", "rm", "00186", "Italia"
+			},
+			want: AddressFields{"Via del Corso 1", "", "Roma", "RM", "00186", "IT"},
+		},
+		{
+			name: "postal code optional where not required",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress, r.City, r.StateProvince, r.PostalCode, r.Country = "1 Grafton Street", "Dublin", "", "", "Ireland"
+			},
+			want: AddressFields{"1 Grafton Street", "", "Dublin", "", "", "IE"},
+		},
+		{
+			name: "country not in the table is validated generically and kept as given",
+			change: func(r *api.CreateAddressRequest) {
+				r.StreetAddress, r.City, r.StateProvince, r.PostalCode, r.Country = "1 Kenyatta street", "Nairobi", "NB", "00100", "Kenya"
+			},
+			want: AddressFields{"1 Kenyatta street", "", "Nairobi", "NB", "00100", "Kenya"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeCmd(addressRequest(tc.change))
+			if err != nil {
+				t.Fatalf("NormalizeCmd() err = %v", err)
+			}
+			if *got != tc.want {
+				t.Errorf("NormalizeCmd() = %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCmdErrors(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		change     func(*api.CreateAddressRequest)
+		wantFields []string
+	}{
+		{"missing country", func(r *api.CreateAddressRequest) { r.Country = "" }, []string{FieldCountry}},
+		{"unknown subdivision", func(r *api.CreateAddressRequest) { r.StateProvince = "Narnia" }, []string{FieldStateProvince}},
+		{"subdivision of another country", func(r *api.CreateAddressRequest) { r.StateProvince = "ON" }, []string{FieldStateProvince}},
+		{"required state missing", func(r *api.CreateAddressRequest) { r.StateProvince = "" }, []string{FieldStateProvince}},
+		{"required postal code missing", func(r *api.CreateAddressRequest) { r.PostalCode = "" }, []string{FieldPostalCode}},
+		{"postal code too short", func(r *api.CreateAddressRequest) { r.PostalCode = "6270" }, []string{FieldPostalCode}},
+		{"postal code of another country", func(r *api.CreateAddressRequest) { r.PostalCode = "K1M 1M4" }, []string{FieldPostalCode}},
+		{
+			name: "canadian postal code with an invalid letter",
+			change: func(r *api.CreateAddressRequest) {
+				r.City, r.StateProvince, r.PostalCode, r.Country = "Ottawa", "ON", "D1M 1M4", "CA"
+			},
+			wantFields: []string{FieldPostalCode},
+		},
+		{
+			name: "dutch postal code out of order",
+			change: func(r *api.CreateAddressRequest) {
+				r.City, r.StateProvince, r.PostalCode, r.Country = "Amsterdam", "", "AB 1234", "Netherlands"
+			},
+			wantFields: []string{FieldPostalCode},
+		},
+		{
+			name: "free text state with invalid characters",
+			change: func(r *api.CreateAddressRequest) {
+				r.City, r.StateProvince, r.PostalCode, r.Country = "Tokyo", "Tokyo!", "100-0001", "JP"
+			},
+			wantFields: []string{FieldStateProvince},
+		},
+		{
+			name: "generic state must be a code",
+			change: func(r *api.CreateAddressRequest) {
+				r.City, r.StateProvince, r.PostalCode, r.Country = "Nairobi", "Nairobi", "00100", "Kenya"
+			},
+			wantFields: []string{FieldStateProvince},
+		},
+		{
+			name: "generic postal code must be a zip code",
+			change: func(r *api.CreateAddressRequest) {
+				r.City, r.StateProvince, r.PostalCode, r.Country = "Nairobi", "NB", "", "Kenya"
+			},
+			wantFields: []string{FieldPostalCode},
+		},
+		{
+			name: "generic country must be a name",
+			change: func(r *api.CreateAddressRequest) {
+				r.City, r.StateProvince, r.PostalCode, r.Country = "Nairobi", "NB", "00100", "K3nya!"
+			},
+			wantFields: []string{FieldCountry},
+		},
+		{
+			name: "every invalid field is reported",
+			change: func(r *api.CreateAddressRequest) {
+				r.Username, r.City, r.StateProvince, r.PostalCode = "not-an-email", "", "Narnia", "abc"
+			},
+			wantFields: []string{FieldUsername, FieldStateProvince, FieldPostalCode, FieldCity},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			_, err := NormalizeCmd(addressRequest(tc.change))
+
+			var fieldErrs FieldErrors
+			if !errors.As(err, &fieldErrs) {
+				t.Fatalf("NormalizeCmd() err = %v, want FieldErrors", err)
+			}
+
+			var got []string
+			for _, fe := range fieldErrs {
+				got = append(got, fe.Field)
+			}
+			if !slices.Equal(got, tc.wantFields) {
+				t.Errorf("NormalizeCmd() invalid fields = %v, want %v (err: %v)", got, tc.wantFields, err)
+			}
+		})
+	}
+}
+
+func TestLookupCountry(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		country  string
+		wantCode string
+	}{
+		{"code", "DE", "DE"},
+		{"lower case code", "de", "DE"},
+		{"name", "Germany", "DE"},
+		{"alias", "Deutschland", "DE"},
+		{"alias with periods", "U.K.", "GB"},
+		{"alias with extra spaces", " Great   Britain ", "GB"},
+		{"not in the table", "Kenya", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, ok := LookupCountry(tc.country)
+			if ok != (tc.wantCode != "") {
+				t.Fatalf("LookupCountry(%q) ok = %v, want %v", tc.country, ok, tc.wantCode != "")
+			}
+			if ok && rules.Code != tc.wantCode {
+				t.Errorf("LookupCountry(%q) = %s, want %s", tc.country, rules.Code, tc.wantCode)
+			}
+		})
+	}
+
+	codes := SupportedCountries()
+	if len(codes) != len(countries) || !sort.StringsAreSorted(codes) {
+		t.Errorf("SupportedCountries() = %v, want every code, sorted", codes)
+	}
+}
+
+func TestLoadCountryRules(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"valid", `{"US": {"name": "United States", "required": [], "postal_pattern": "^\\d{5}$", "subdivisions": {"IL": "Illinois"}}}`, false},
+		{"malformed json", `{"US": `, true},
+		{"lower case code", `{"us": {"name": "United States", "required": []}}`, true},
+		{"three letter code", `{"USA": {"name": "United States", "required": []}}`, true},
+		{"invalid postal pattern", `{"US": {"name": "United States", "required": [], "postal_pattern": "^[0-9"}}`, true},
+		{"alias shared by two countries", `{
+			"GB": {"name": "United Kingdom", "aliases": ["Britain"], "required": []},
+			"FR": {"name": "France", "aliases": ["Britain"], "required": []}
+		}`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			rules, keys, err := loadCountryRules([]byte(tc.json))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("loadCountryRules() err = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			us := rules["US"]
+			if us.Code != "US" || keys["UNITED STATES"] != "US" || us.subdivisionKeys["ILLINOIS"] != "IL" || us.postal == nil {
+				t.Errorf("loadCountryRules() did not index the rules: %+v, keys %v", us, keys)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package address
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,6 +12,7 @@ import (
 	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
 	api "github.com/tdeslauriers/silhouette/api/v1"
 	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
 	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -49,10 +51,8 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
 	// prepare req fields for use
 	username := strings.TrimSpace(req.GetUsername())
@@ -63,10 +63,11 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 		return nil, status.Error(codes.PermissionDenied, "access denied")
 	}
 
-	// validate fields
-	if err := ValidateCmd(req); err != nil {
+	// validate and normalize fields against the rules for the address's country
+	fields, err := NormalizeCmd(req)
+	if err != nil {
 		log.Error("invalid create-address request", "err", err.Error())
-		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid create-address request: %s", err.Error()))
+		return nil, InvalidArgumentStatus("invalid create-address request", err)
 	}
 
 	// get the porfile record to validate user exists in the service
@@ -78,15 +79,31 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to look up profile for %s", username))
 	}
 
+	// reject an address the user already has, however it was formatted, so it does not use up their quota
+	existing, err := as.addressStore.FindDuplicateAddress(ctx, username, &sqlc.Address{
+		AddressLine1: sql.NullString{String: fields.StreetAddress, Valid: fields.StreetAddress != ""},
+		AddressLine2: sql.NullString{String: fields.StreetAddress_2, Valid: fields.StreetAddress_2 != ""},
+		Zip:          sql.NullString{String: fields.PostalCode, Valid: fields.PostalCode != ""},
+		Country:      sql.NullString{String: fields.Country, Valid: fields.Country != ""},
+	})
+	switch {
+	case err == nil:
+		log.Error(fmt.Sprintf("duplicate address record for %s - existing slug %s", username, existing.Slug))
+		return nil, alreadyExistsStatus(existing.Slug)
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Error(fmt.Sprintf("failed to check for duplicate address records for %s", username), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check for duplicate address records for %s", username))
+	}
+
 	// check how many address records currently exist for the user
-	// only allowed to have 3 address records, including non-current records
+	// only allowed a limited number of address records, including non-current records
 	addressCount, err := as.addressStore.CountAddresses(ctx, username)
 	if err != nil {
 		log.Error(fmt.Sprintf("failed to get address count for %s", username), "err", err.Error())
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get address count for %s", username))
 	}
 
-	if addressCount >= 3 {
+	if addressCount >= storage.RecordQuota {
 		log.Error(fmt.Sprintf("address record limit reached for %s - count %d", username, addressCount))
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("address record limit reached for %s", username))
 	}
@@ -106,19 +123,24 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 	}
 
 	// prepare fields
-	streetAddress := strings.TrimSpace(req.GetStreetAddress())
-	city := strings.TrimSpace(req.GetCity())
-	stateProvince := strings.TrimSpace(req.GetStateProvince())
-	postalCode := strings.TrimSpace(req.GetPostalCode())
-	country := strings.TrimSpace(req.GetCountry())
+	streetAddress := fields.StreetAddress
+	streetAddress_2 := fields.StreetAddress_2
+	city := fields.City
+	stateProvince := fields.StateProvince
+	postalCode := fields.PostalCode
+	country := fields.Country
 
-	var streetAddress_2 string
-	if len(req.GetStreetAddress_2()) > 0 {
-		streetAddress_2 = strings.TrimSpace(req.GetStreetAddress_2())
-	}
+	addressType := ConvertToSqlString(req.GetAddressType())
 
 	now := time.Now().UTC()
 
+	// a dated record is current while now is within its range, regardless of the requested flag
+	validFrom, validTo := EffectiveRange(req.GetValidFrom(), req.GetValidTo())
+	isCurrent := req.GetIsCurrent()
+	if IsDated(validFrom, validTo) {
+		isCurrent = InRange(validFrom, validTo, now)
+	}
+
 	toAdd := &sqlc.Address{
 		Uuid: id.String(),
 		Slug: slug.String(),
@@ -129,9 +151,14 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 		State:        sql.NullString{String: stateProvince, Valid: stateProvince != ""},
 		Zip:          sql.NullString{String: postalCode, Valid: postalCode != ""},
 		Country:      sql.NullString{String: country, Valid: country != ""},
-		IsCurrent:    req.GetIsCurrent(),
-		UpdatedAt:    now,
-		CreatedAt:    now,
+		AddressType:  addressType,
+		IsCurrent:    isCurrent,
+		ValidFrom:    validFrom,
+		ValidTo:      validTo,
+		// promotion only applies to a future start date, which is checked in cmd validation
+		PromoteOnStart: req.GetPromoteOnStart(),
+		UpdatedAt:      now,
+		CreatedAt:      now,
 	}
 
 	// need to check if the new record is set to primary and
@@ -148,18 +175,18 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 		log.Error(fmt.Sprintf("invalid address record for %s - non-current record cannot be primary", username))
 		return nil, status.Error(codes.InvalidArgument, "invalid address record - non-current record cannot be primary")
 	case toAdd.IsCurrent && req.GetIsPrimary():
-		// user should not have current primary address records
+		// user should not have another current primary address record, or of the same type if primary is tracked per type
 
 		// get count of how many primary address records exist for the user
-		count, err := as.addressStore.CountPrimaryAddresses(ctx, username)
+		count, err := as.addressStore.CountPrimaryAddresses(ctx, username, addressType)
 		if err != nil {
 			log.Error(fmt.Sprintf("failed to get primary address count for %s", username), "err", err.Error())
 			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get primary address count for %s", username))
 		}
 
 		if count > 0 {
-			log.Error(fmt.Sprintf("primary address record already exists for %s - cannot create another primary record", username))
-			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("primary address record already exists for %s - cannot create another primary record", username))
+			log.Error(fmt.Sprintf("%s address record already exists for %s - cannot create another primary record", as.primaryLabel(addressType), username))
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("%s address record already exists for %s - cannot create another primary record", as.primaryLabel(addressType), username))
 		}
 
 		toAdd.IsPrimary = true
@@ -172,7 +199,7 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 	}
 
 	// persist address record
-	if err := as.addressStore.CreateAddress(ctx, toAdd); err != nil {
+	if err := as.addressStore.CreateAddress(ctx, username, toAdd); err != nil {
 		log.Error(fmt.Sprintf("failed to create address record for %s", username), "err", err.Error())
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create address record for %s", username))
 	}
@@ -202,5 +229,9 @@ func (as *addressServer) CreateAddress(ctx context.Context, req *api.CreateAddre
 		IsPrimary:       toAdd.IsPrimary,
 		UpdatedAt:       timestamppb.New(toAdd.UpdatedAt),
 		CreatedAt:       timestamppb.New(toAdd.CreatedAt),
+		ValidFrom:       NullTimestamp(toAdd.ValidFrom),
+		ValidTo:         NullTimestamp(toAdd.ValidTo),
+		PromoteOnStart:  toAdd.PromoteOnStart,
+		AddressType:     req.GetAddressType(),
 	}, nil
 }
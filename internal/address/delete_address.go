@@ -16,7 +16,8 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-// DeleteAddress deletes an address record from the database, returning an empty response if successful
+// DeleteAddress soft deletes an address record, returning an empty response if successful.
+// The record can be restored with RestoreAddress until the restore window passes.
 func (s *addressServer) DeleteAddress(ctx context.Context, req *api.DeleteAddressRequest) (*emptypb.Empty, error) {
 
 	// get telemetry context
@@ -48,10 +49,8 @@ func (s *addressServer) DeleteAddress(ctx context.Context, req *api.DeleteAddres
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
 	// authorize the request
 	if err := auth.AuthorizeRequest(authCtx, req.GetUsername()); err != nil {
@@ -84,25 +83,14 @@ func (s *addressServer) DeleteAddress(ctx context.Context, req *api.DeleteAddres
 		}
 	}
 
-	// delete the xref record
-	if err := s.xrefStore.RemoveAddressXrefByAddress(ctx, address.Uuid); err != nil {
-		log.Error("failed to delete address xref record", "err", err.Error())
-		return nil, status.Error(codes.Internal, "failed to delete address xref record")
-	}
-
-	log.Info(
-		fmt.Sprintf("successfully deleted address xref record for address slug %s and user %s",
-			req.GetSlug(),
-			req.GetUsername()),
-	)
-
-	// delete the address record
+	// tombstone the address record: the xref is kept so the record can be restored
+	// within the restore window, after which the purge job removes both
 	if err := s.addressStore.DeleteAddress(ctx, address.Uuid); err != nil {
 		log.Error("failed to delete address record", "err", err.Error())
 		return nil, status.Error(codes.Internal, "failed to delete address record")
 	}
 
-	log.Info(fmt.Sprintf("successfully deleted address record for address slug %s", req.GetSlug()))
+	log.Info(fmt.Sprintf("successfully tombstoned address record for address slug %s and user %s", req.GetSlug(), req.GetUsername()))
 
 	return &emptypb.Empty{}, nil
 }
@@ -0,0 +1,138 @@
+package address
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EffectiveRange converts an address request's optional effective dates to nullable times,
+// truncated to the second since that is the precision they are stored at.
+func EffectiveRange(from, to *timestamppb.Timestamp) (validFrom, validTo sql.NullTime) {
+
+	if from != nil {
+		validFrom = sql.NullTime{Time: from.AsTime().UTC().Truncate(time.Second), Valid: true}
+	}
+
+	if to != nil {
+		validTo = sql.NullTime{Time: to.AsTime().UTC().Truncate(time.Second), Valid: true}
+	}
+
+	return validFrom, validTo
+}
+
+// IsDated reports whether an address has an effective range, ie, either end of it is set.
+func IsDated(validFrom, validTo sql.NullTime) bool {
+	return validFrom.Valid || validTo.Valid
+}
+
+// InRange reports whether t is within an effective range: from validFrom, inclusive, until validTo, exclusive.
+// An unset date leaves that end of the range open.
+func InRange(validFrom, validTo sql.NullTime, t time.Time) bool {
+	return (!validFrom.Valid || !t.Before(validFrom.Time)) &&
+		(!validTo.Valid || t.Before(validTo.Time))
+}
+
+// CurrentAt reports whether an address was current at t.  A dated address is current while t is in its range.
+// An undated address only has its is_current flag, so a must be the record as it stood at t, see AddressAt.
+func CurrentAt(a *sqlc.Address, t time.Time) bool {
+
+	if a.CreatedAt.After(t) {
+		return false
+	}
+
+	if IsDated(a.ValidFrom, a.ValidTo) {
+		return InRange(a.ValidFrom, a.ValidTo, t)
+	}
+
+	return a.IsCurrent
+}
+
+// AddressAt rebuilds an address record as it stood at t from the record and its prior versions superseded
+// after t, oldest first.  A version holds the record's state until it was superseded, so the state at t is the
+// oldest version superseded after t, or the record itself if none were.  Returns nil if the record was created after t.
+func AddressAt(a *sqlc.Address, versions []*sqlc.AddressHistory, t time.Time) *sqlc.Address {
+
+	if a.CreatedAt.After(t) {
+		return nil
+	}
+
+	for _, v := range versions {
+		if !v.SupersededAt.After(t) {
+			continue
+		}
+
+		return &sqlc.Address{
+			Uuid:           a.Uuid,
+			Slug:           a.Slug,
+			AddressLine1:   v.AddressLine1,
+			AddressLine2:   v.AddressLine2,
+			City:           v.City,
+			State:          v.State,
+			Zip:            v.Zip,
+			Country:        v.Country,
+			AddressType:    v.AddressType,
+			IsCurrent:      v.IsCurrent,
+			IsPrimary:      v.IsPrimary,
+			ValidFrom:      v.ValidFrom,
+			ValidTo:        v.ValidTo,
+			PromoteOnStart: v.PromoteOnStart,
+			UpdatedAt:      v.UpdatedAt,
+			CreatedAt:      a.CreatedAt,
+		}
+	}
+
+	return a
+}
+
+// NullTimestamp converts a nullable time to a protobuf timestamp, or nil if it is not set.
+func NullTimestamp(t sql.NullTime) *timestamppb.Timestamp {
+	if !t.Valid {
+		return nil
+	}
+	return timestamppb.New(t.Time)
+}
+
+// sameTime reports whether two nullable times are both unset, or both set to the same instant.
+func sameTime(a, b sql.NullTime) bool {
+	return a.Valid == b.Valid && (!a.Valid || a.Time.Equal(b.Time))
+}
+
+// formatTime formats a nullable time for the audit log, or returns an empty string if it is not set.
+func formatTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
+
+// validateEffectiveDates validates the optional effective range and scheduled promotion of an address request.
+func validateEffectiveDates(cmd AddressUpsert) FieldErrors {
+
+	if cmd.GetValidFrom() != nil {
+		if err := cmd.GetValidFrom().CheckValid(); err != nil {
+			return FieldErrors{{Field: FieldValidFrom, Description: fmt.Sprintf("invalid valid_from: %v", err)}}
+		}
+	}
+
+	if cmd.GetValidTo() != nil {
+		if err := cmd.GetValidTo().CheckValid(); err != nil {
+			return FieldErrors{{Field: FieldValidTo, Description: fmt.Sprintf("invalid valid_to: %v", err)}}
+		}
+	}
+
+	validFrom, validTo := EffectiveRange(cmd.GetValidFrom(), cmd.GetValidTo())
+	if validFrom.Valid && validTo.Valid && !validTo.Time.After(validFrom.Time) {
+		return FieldErrors{{Field: FieldValidTo, Description: "valid_to must be after valid_from"}}
+	}
+
+	// a promotion is scheduled for the start date, so the start date must still be ahead
+	if cmd.GetPromoteOnStart() && (!validFrom.Valid || !validFrom.Time.After(time.Now().UTC())) {
+		return FieldErrors{{Field: FieldPromoteOnStart, Description: "promote_on_start requires a valid_from date in the future"}}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package address
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+func TestInRange(t *testing.T) {
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	set := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+
+	tests := []struct {
+		name      string
+		validFrom sql.NullTime
+		validTo   sql.NullTime
+		at        time.Time
+		want      bool
+	}{
+		{"before start", set(from), set(to), from.Add(-time.Second), false},
+		{"at start is inclusive", set(from), set(to), from, true},
+		{"within", set(from), set(to), from.Add(24 * time.Hour), true},
+		{"just before end", set(from), set(to), to.Add(-time.Nanosecond), true},
+		{"at end is exclusive", set(from), set(to), to, false},
+		{"after end", set(from), set(to), to.Add(time.Second), false},
+		{"open start", sql.NullTime{}, set(to), time.Time{}, true},
+		{"open start at end", sql.NullTime{}, set(to), to, false},
+		{"open end", set(from), sql.NullTime{}, from.AddDate(100, 0, 0), true},
+		{"open end before start", set(from), sql.NullTime{}, from.Add(-time.Nanosecond), false},
+		{"fully open", sql.NullTime{}, sql.NullTime{}, from, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := InRange(tc.validFrom, tc.validTo, tc.at); got != tc.want {
+				t.Errorf("InRange() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCurrentAt(t *testing.T) {
+
+	created := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		address sqlc.Address
+		at      time.Time
+		want    bool
+	}{
+		{"undated current", sqlc.Address{IsCurrent: true, CreatedAt: created}, created.AddDate(1, 0, 0), true},
+		{"undated not current", sqlc.Address{IsCurrent: false, CreatedAt: created}, created.AddDate(1, 0, 0), false},
+		{"undated at creation", sqlc.Address{IsCurrent: true, CreatedAt: created}, created, true},
+		{"undated before creation", sqlc.Address{IsCurrent: true, CreatedAt: created}, created.Add(-time.Second), false},
+		{"dated uses the range, not the flag", sqlc.Address{
+			IsCurrent: false, CreatedAt: created,
+			ValidFrom: sql.NullTime{Time: from, Valid: true}, ValidTo: sql.NullTime{Time: to, Valid: true},
+		}, from, true},
+		{"dated flag ignored after end", sqlc.Address{
+			IsCurrent: true, CreatedAt: created,
+			ValidFrom: sql.NullTime{Time: from, Valid: true}, ValidTo: sql.NullTime{Time: to, Valid: true},
+		}, to, false},
+		{"dated range before creation", sqlc.Address{
+			CreatedAt: from.AddDate(0, 1, 0),
+			ValidFrom: sql.NullTime{Time: from, Valid: true},
+		}, from, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CurrentAt(&tc.address, tc.at); got != tc.want {
+				t.Errorf("CurrentAt() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddressAt(t *testing.T) {
+
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	moved := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	ended := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the user lived at 1 Main St as their primary address, moved to 2 Elm St, then marked it not current
+	live := &sqlc.Address{
+		Uuid:         "address-uuid",
+		Slug:         "address-slug",
+		AddressLine1: sql.NullString{String: "2 Elm St", Valid: true},
+		IsCurrent:    false,
+		UpdatedAt:    ended,
+		CreatedAt:    created,
+	}
+	versions := []*sqlc.AddressHistory{
+		{Uuid: "v1", AddressUuid: "address-uuid", AddressLine1: sql.NullString{String: "1 Main St", Valid: true}, IsCurrent: true, IsPrimary: true, UpdatedAt: created, CreatedAt: created, SupersededAt: moved},
+		{Uuid: "v2", AddressUuid: "address-uuid", AddressLine1: sql.NullString{String: "2 Elm St", Valid: true}, IsCurrent: true, UpdatedAt: moved, CreatedAt: created, SupersededAt: ended},
+	}
+
+	tests := []struct {
+		name        string
+		at          time.Time
+		wantNil     bool
+		wantStreet  string
+		wantCurrent bool
+		wantPrimary bool
+	}{
+		{"before creation", created.Add(-time.Second), true, "", false, false},
+		{"at creation", created, false, "1 Main St", true, true},
+		{"before the move", moved.Add(-time.Second), false, "1 Main St", true, true},
+		{"at the move the next version holds", moved, false, "2 Elm St", true, false},
+		{"before it ended", ended.Add(-time.Second), false, "2 Elm St", true, false},
+		{"at the last change the record holds", ended, false, "2 Elm St", false, false},
+		{"today", ended.AddDate(1, 0, 0), false, "2 Elm St", false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// the store returns only the versions superseded after the time asked for
+			var after []*sqlc.AddressHistory
+			for _, v := range versions {
+				if v.SupersededAt.After(tc.at) {
+					after = append(after, v)
+				}
+			}
+
+			for _, given := range [][]*sqlc.AddressHistory{after, versions} {
+				got := AddressAt(live, given, tc.at)
+				if tc.wantNil {
+					if got != nil {
+						t.Errorf("AddressAt() = %+v, want nil", got)
+					}
+					continue
+				}
+
+				if got == nil {
+					t.Fatal("AddressAt() = nil")
+				}
+				if got.AddressLine1.String != tc.wantStreet || got.IsPrimary != tc.wantPrimary || CurrentAt(got, tc.at) != tc.wantCurrent {
+					t.Errorf("AddressAt() = %q primary %v current %v, want %q primary %v current %v",
+						got.AddressLine1.String, got.IsPrimary, CurrentAt(got, tc.at), tc.wantStreet, tc.wantPrimary, tc.wantCurrent)
+				}
+				if got.Uuid != live.Uuid || got.Slug != live.Slug || !got.CreatedAt.Equal(created) {
+					t.Errorf("AddressAt() lost the record's identity: %+v", got)
+				}
+			}
+		})
+	}
+}
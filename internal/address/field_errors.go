@@ -0,0 +1,57 @@
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FieldError is a validation failure of a single request field.
+type FieldError struct {
+	Field       string
+	Description string
+}
+
+// FieldErrors are every validation failure of a request model.
+type FieldErrors []FieldError
+
+// Error implements the error interface, listing each failure as field: description.
+func (fe FieldErrors) Error() string {
+	msgs := make([]string, 0, len(fe))
+	for _, e := range fe {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", e.Field, e.Description))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// InvalidArgumentStatus builds an InvalidArgument status error for a failed validation.
+// Field errors are attached as BadRequest field violations so callers can map each one back to its input.
+func InvalidArgumentStatus(msg string, err error) error {
+
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("%s: %s", msg, err.Error()))
+
+	var fieldErrs FieldErrors
+	if !errors.As(err, &fieldErrs) {
+		return st.Err()
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, fe := range fieldErrs {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Description: fe.Description,
+		})
+	}
+
+	detailed, detailErr := st.WithDetails(badRequest)
+	if detailErr != nil {
+		// the message still lists every field error
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -0,0 +1,101 @@
+package address
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FormatAddress renders a user's address record as mailing label lines in the layout for its country.
+func (s *addressServer) FormatAddress(ctx context.Context, req *api.FormatAddressRequest) (*api.FormatAddressResponse, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetSlug())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid address slug", "err", "address slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "address slug must be a valid UUID")
+	}
+
+	// get the decrypted address record
+	record, err := s.addressStore.GetAddress(ctx, slug, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("address slug %s record not found for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("address record not found for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to get address record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get address record for slug: %s", slug))
+	}
+
+	lines := FormatAddress(
+		&AddressFields{
+			StreetAddress:   record.AddressLine1.String,
+			StreetAddress_2: record.AddressLine2.String,
+			City:            record.City.String,
+			StateProvince:   record.State.String,
+			PostalCode:      record.Zip.String,
+			Country:         record.Country.String,
+		},
+		FormatOptions{
+			Uppercase:      req.GetUppercase(),
+			IncludeCountry: req.GetIncludeCountry(),
+		},
+	)
+
+	log.Info(fmt.Sprintf("successfully formatted address label - slug %s for %s", slug, username))
+
+	return &api.FormatAddressResponse{
+		Lines: lines,
+		Text:  strings.Join(lines, "\n"),
+	}, nil
+}
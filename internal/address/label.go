@@ -0,0 +1,89 @@
+package address
+
+import (
+	"strings"
+)
+
+// defaultLabel is the mailing label layout for a country without one in the rules table.
+var defaultLabel = []string{
+	"{street_address}",
+	"{street_address_2}",
+	"{city} {state_province} {postal_code}",
+}
+
+// FormatOptions are the options for rendering a mailing label.
+type FormatOptions struct {
+	// Uppercase renders every line in upper case, as postal services prefer for machine reading.
+	Uppercase bool
+
+	// IncludeCountry appends the country name as the last line, as international mail requires.
+	IncludeCountry bool
+}
+
+// FormatAddress renders address fields as mailing label lines using the layout for the address's country,
+// eg, postal code before city in DE, or postal code, prefecture, and city before the street in JP.
+// A line whose fields are all empty is left out.  An address whose country is not in the rules table,
+// such as one stored before country validation, uses a default layout and its country as stored.
+func FormatAddress(fields *AddressFields, opts FormatOptions) []string {
+
+	layout := defaultLabel
+	country := fields.Country
+	if rules, ok := LookupCountry(fields.Country); ok {
+		country = rules.Name
+		if len(rules.Label) > 0 {
+			layout = rules.Label
+		}
+	}
+
+	replacer := strings.NewReplacer(
+		"{street_address}", fields.StreetAddress,
+		"{street_address_2}", fields.StreetAddress_2,
+		"{city}", fields.City,
+		"{state_province}", fields.StateProvince,
+		"{postal_code}", fields.PostalCode,
+	)
+
+	lines := make([]string, 0, len(layout)+1)
+	for _, tmpl := range layout {
+		// a line is left out when none of its fields are present
+		if replacer.Replace(tmpl) == placeholderText(tmpl) {
+			continue
+		}
+
+		if line := tidyLine(replacer.Replace(tmpl)); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if opts.IncludeCountry && country != "" {
+		lines = append(lines, country)
+	}
+
+	if opts.Uppercase {
+		for i := range lines {
+			lines[i] = strings.ToUpper(lines[i])
+		}
+	}
+
+	return lines
+}
+
+// placeholderText returns a template's literal text with its placeholders removed,
+// ie, what the template renders to when every field is empty.
+func placeholderText(tmpl string) string {
+	return strings.NewReplacer(
+		"{street_address}", "",
+		"{street_address_2}", "",
+		"{city}", "",
+		"{state_province}", "",
+		"{postal_code}", "",
+	).Replace(tmpl)
+}
+
+// tidyLine removes the separators left around empty fields, eg, "Dublin, " becomes "Dublin".
+func tidyLine(line string) string {
+	line = collapseSpace(line)
+	line = strings.ReplaceAll(line, " ,", ",")
+	line = strings.ReplaceAll(line, ",,", ",")
+	return strings.Trim(line, " ,-")
+}
@@ -0,0 +1,115 @@
+package address
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFormatAddressLayouts(t *testing.T) {
+
+	tests := []struct {
+		country string
+		fields  AddressFields
+		want    []string
+	}{
+		{"AT", AddressFields{"Stephansplatz 1", "", "Wien", "", "1010", "AT"}, []string{"Stephansplatz 1", "1010 Wien"}},
+		{"AU", AddressFields{"1 Macquarie St", "", "Sydney", "NSW", "2000", "AU"}, []string{"1 Macquarie St", "Sydney NSW 2000"}},
+		{"BE", AddressFields{"Rue de la Loi 16", "", "Bruxelles", "", "1000", "BE"}, []string{"Rue de la Loi 16", "1000 Bruxelles"}},
+		{"BR", AddressFields{"Av. Paulista 1000", "Apto 12", "São Paulo", "SP", "01310-100", "BR"}, []string{"Av. Paulista 1000", "Apto 12", "São Paulo - SP", "01310-100"}},
+		{"CA", AddressFields{"24 Sussex Dr", "", "Ottawa", "ON", "K1M 1M4", "CA"}, []string{"24 Sussex Dr", "Ottawa ON K1M 1M4"}},
+		{"CH", AddressFields{"Bundesplatz 3", "", "Bern", "", "3005", "CH"}, []string{"Bundesplatz 3", "3005 Bern"}},
+		{"DE", AddressFields{"Platz der Republik 1", "", "Berlin", "", "11011", "DE"}, []string{"Platz der Republik 1", "11011 Berlin"}},
+		{"DK", AddressFields{"Christiansborg Slotsplads 1", "", "København K", "", "1218", "DK"}, []string{"Christiansborg Slotsplads 1", "1218 København K"}},
+		{"ES", AddressFields{"Calle de Alcalá 1", "", "Madrid", "Madrid", "28014", "ES"}, []string{"Calle de Alcalá 1", "28014 Madrid", "Madrid"}},
+		{"FI", AddressFields{"Mannerheimintie 30", "", "Helsinki", "", "00100", "FI"}, []string{"Mannerheimintie 30", "00100 Helsinki"}},
+		{"FR", AddressFields{"55 Rue du Faubourg Saint-Honoré", "", "Paris", "", "75008", "FR"}, []string{"55 Rue du Faubourg Saint-Honoré", "75008 Paris"}},
+		{"GB", AddressFields{"10 Downing St", "", "London", "", "SW1A 2AA", "GB"}, []string{"10 Downing St", "London", "SW1A 2AA"}},
+		{"IE", AddressFields{"1 Main St", "", "Galway", "Co. Galway", "H91 E2K3", "IE"}, []string{"1 Main St", "Galway", "Co. Galway", "H91 E2K3"}},
+		{"IN", AddressFields{"1 Janpath", "", "New Delhi", "Delhi", "110001", "IN"}, []string{"1 Janpath", "New Delhi 110001", "Delhi"}},
+		{"IT", AddressFields{"Via del Corso 1", "", "Roma", "RM", "00186", "IT"}, []string{"Via del Corso 1", "00186 Roma RM"}},
+		{"JP", AddressFields{"1-1 Chiyoda", "", "Chiyoda-ku", "Tokyo", "100-0001", "JP"}, []string{"〒100-0001", "Tokyo Chiyoda-ku", "1-1 Chiyoda"}},
+		{"MX", AddressFields{"Av. Juárez 1", "", "Ciudad de México", "CDMX", "06010", "MX"}, []string{"Av. Juárez 1", "06010 Ciudad de México, CDMX"}},
+		{"NL", AddressFields{"Dam 1", "", "Amsterdam", "", "1012 JS", "NL"}, []string{"Dam 1", "1012 JS Amsterdam"}},
+		{"NO", AddressFields{"Karl Johans gate 1", "", "Oslo", "", "0154", "NO"}, []string{"Karl Johans gate 1", "0154 Oslo"}},
+		{"NZ", AddressFields{"1 Queen St", "", "Auckland", "", "1010", "NZ"}, []string{"1 Queen St", "Auckland 1010"}},
+		{"PL", AddressFields{"ul. Wiejska 4", "", "Warszawa", "", "00-902", "PL"}, []string{"ul. Wiejska 4", "00-902 Warszawa"}},
+		{"PT", AddressFields{"Rua Augusta 1", "", "Lisboa", "", "1100-048", "PT"}, []string{"Rua Augusta 1", "1100-048 Lisboa"}},
+		{"SE", AddressFields{"Drottninggatan 1", "", "Stockholm", "", "111 51", "SE"}, []string{"Drottninggatan 1", "111 51 Stockholm"}},
+		{"US", AddressFields{"1 Main St", "Apt 2", "Springfield", "IL", "62701", "US"}, []string{"1 Main St", "Apt 2", "Springfield, IL 62701"}},
+	}
+
+	covered := make(map[string]bool, len(tests))
+	for _, tc := range tests {
+		covered[tc.country] = true
+		t.Run(tc.country, func(t *testing.T) {
+			if got := FormatAddress(&tc.fields, FormatOptions{}); !slices.Equal(got, tc.want) {
+				t.Errorf("FormatAddress() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// every country in the rules table has a case, so a new layout cannot go untested
+	for _, code := range SupportedCountries() {
+		if !covered[code] {
+			t.Errorf("no label test case for %s", code)
+		}
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		fields AddressFields
+		opts   FormatOptions
+		want   []string
+	}{
+		{
+			name:   "unknown country uses the default layout and the country as stored",
+			fields: AddressFields{"1 Rue Principale", "", "Luxembourg", "", "L-1111", "Luxembourg"},
+			opts:   FormatOptions{IncludeCountry: true},
+			want:   []string{"1 Rue Principale", "Luxembourg L-1111", "Luxembourg"},
+		},
+		{
+			name:   "missing country uses the default layout",
+			fields: AddressFields{"1 Main St", "", "Springfield", "IL", "62701", ""},
+			opts:   FormatOptions{IncludeCountry: true},
+			want:   []string{"1 Main St", "Springfield IL 62701"},
+		},
+		{
+			name:   "known country is named from the rules table",
+			fields: AddressFields{"Platz der Republik 1", "", "Berlin", "", "11011", "de"},
+			opts:   FormatOptions{IncludeCountry: true},
+			want:   []string{"Platz der Republik 1", "11011 Berlin", "Germany"},
+		},
+		{
+			name:   "uppercase",
+			fields: AddressFields{"10 Downing St", "", "London", "", "SW1A 2AA", "GB"},
+			opts:   FormatOptions{Uppercase: true, IncludeCountry: true},
+			want:   []string{"10 DOWNING ST", "LONDON", "SW1A 2AA", "UNITED KINGDOM"},
+		},
+		{
+			name:   "separators around empty fields are removed",
+			fields: AddressFields{"Av. Juárez 1", "", "Ciudad de México", "", "06010", "MX"},
+			want:   []string{"Av. Juárez 1", "06010 Ciudad de México"},
+		},
+		{
+			name:   "line with only literal text is left out",
+			fields: AddressFields{"1-1 Chiyoda", "", "Chiyoda-ku", "Tokyo", "", "JP"},
+			want:   []string{"Tokyo Chiyoda-ku", "1-1 Chiyoda"},
+		},
+		{
+			name:   "line with only a separator left is left out",
+			fields: AddressFields{"Av. Paulista 1000", "", "", "", "01310-100", "BR"},
+			want:   []string{"Av. Paulista 1000", "01310-100"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := FormatAddress(&tc.fields, tc.opts); !slices.Equal(got, tc.want) {
+				t.Errorf("FormatAddress() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
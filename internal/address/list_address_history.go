@@ -0,0 +1,120 @@
+package address
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListAddressHistory returns the decrypted prior versions of a user's address record, newest first.
+func (s *addressServer) ListAddressHistory(ctx context.Context, req *api.ListAddressHistoryRequest) (*api.ListAddressHistoryResponse, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetSlug())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid address slug", "err", "address slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "address slug must be a valid UUID")
+	}
+
+	// confirm the record exists and belongs to the user so an unknown slug is
+	// not mistaken for a record that has never been updated
+	if _, err := s.addressStore.GetAddress(ctx, slug, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("address slug %s record not found for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("address record not found for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to get address record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get address record for slug: %s", slug))
+	}
+
+	// get the decrypted prior versions
+	history, err := s.addressStore.GetAddressHistory(ctx, slug, username)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to get address history for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get address history for slug: %s", slug))
+	}
+
+	versions := make([]*api.AddressVersion, 0, len(history))
+	for _, h := range history {
+		versions = append(versions, &api.AddressVersion{
+			Version: h.Uuid,
+			Address: &api.Address{
+				Uuid:            h.AddressUuid,
+				Slug:            h.Slug,
+				StreetAddress:   h.AddressLine1.String,
+				StreetAddress_2: proto.String(h.AddressLine2.String),
+				City:            h.City.String,
+				StateProvince:   h.State.String,
+				PostalCode:      h.Zip.String,
+				Country:         h.Country.String,
+				IsCurrent:       h.IsCurrent,
+				IsPrimary:       h.IsPrimary,
+				UpdatedAt:       timestamppb.New(h.UpdatedAt),
+				CreatedAt:       timestamppb.New(h.CreatedAt),
+				ValidFrom:       NullTimestamp(h.ValidFrom),
+				ValidTo:         NullTimestamp(h.ValidTo),
+				PromoteOnStart:  h.PromoteOnStart,
+				AddressType:     ConvertAddressType(h.AddressType),
+			},
+			SupersededAt: timestamppb.New(h.SupersededAt),
+		})
+	}
+
+	log.Info(fmt.Sprintf("successfully retrieved %d address versions - slug %s for %s", len(versions), slug, username))
+
+	return &api.ListAddressHistoryResponse{
+		Versions: versions,
+	}, nil
+}
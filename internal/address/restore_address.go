@@ -0,0 +1,141 @@
+package address
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RestoreAddress restores an address record deleted within the restore window.
+// The restored record is not primary, counts against the user's address limit,
+// and is rejected as AlreadyExists if the user has since added the same address again.
+func (s *addressServer) RestoreAddress(ctx context.Context, req *api.RestoreAddressRequest) (*api.Address, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetSlug())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid address slug", "err", "address slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "address slug must be a valid UUID")
+	}
+
+	// get the tombstone, to check it against the user's live records before it is restored
+	deletedAfter := time.Now().UTC().Add(-s.restoreWindow)
+	deleted, err := s.addressStore.GetDeletedAddress(ctx, slug, username, deletedAfter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("no deleted address slug %s found within the restore window for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("no deleted address record found within the restore window for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to get deleted address record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get deleted address record for slug: %s", slug))
+	}
+
+	// reject restoring an address the user has since added again
+	existing, err := s.addressStore.FindDuplicateAddress(ctx, username, deleted)
+	switch {
+	case err == nil:
+		log.Error(fmt.Sprintf("duplicate address record for %s - cannot restore slug %s over existing slug %s", username, slug, existing.Slug))
+		return nil, alreadyExistsStatus(existing.Slug)
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Error(fmt.Sprintf("failed to check for duplicate address records for %s", username), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check for duplicate address records for %s", username))
+	}
+
+	// the restored record counts against the address limit like a new record would
+	addressCount, err := s.addressStore.CountAddresses(ctx, username)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to get address count for %s", username), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get address count for %s", username))
+	}
+
+	if addressCount >= storage.RecordQuota {
+		log.Error(fmt.Sprintf("address record limit reached for %s - count %d", username, addressCount))
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("address record limit reached for %s", username))
+	}
+
+	// restore the record if it was deleted within the restore window
+	address, err := s.addressStore.RestoreAddress(ctx, slug, username, deletedAfter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("no deleted address slug %s found within the restore window for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("no deleted address record found within the restore window for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to restore address record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to restore address record for slug: %s", slug))
+	}
+
+	log.Info(fmt.Sprintf("successfully restored address record - slug %s for %s", slug, username))
+
+	return &api.Address{
+		Uuid:            address.Uuid,
+		Slug:            address.Slug,
+		StreetAddress:   address.AddressLine1.String,
+		StreetAddress_2: proto.String(address.AddressLine2.String),
+		City:            address.City.String,
+		StateProvince:   address.State.String,
+		PostalCode:      address.Zip.String,
+		Country:         address.Country.String,
+		IsCurrent:       address.IsCurrent,
+		IsPrimary:       address.IsPrimary,
+		UpdatedAt:       timestamppb.New(address.UpdatedAt),
+		CreatedAt:       timestamppb.New(address.CreatedAt),
+		ValidFrom:       NullTimestamp(address.ValidFrom),
+		ValidTo:         NullTimestamp(address.ValidTo),
+		PromoteOnStart:  address.PromoteOnStart,
+		AddressType:     ConvertAddressType(address.AddressType),
+	}, nil
+}
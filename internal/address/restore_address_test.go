@@ -0,0 +1,46 @@
+package address
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRestoreAddress(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		otherLive string // street of the user's other live address
+		deletedAt time.Time
+		wantCode  codes.Code
+	}{
+		{"restored", "2 Elm St", time.Now().UTC().Add(-time.Hour), codes.OK},
+		{"added again since it was deleted", "1 MAIN ST.", time.Now().UTC().Add(-time.Hour), codes.AlreadyExists},
+		{"outside the restore window", "2 Elm St", time.Now().UTC().Add(-31 * 24 * time.Hour), codes.NotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store := newFakeAddressStore()
+			server := newTestServer(store)
+
+			deleted := testAddress("address-uuid", testSlug, "1 Main St")
+			deleted.DeletedAt = sql.NullTime{Time: tc.deletedAt, Valid: true}
+			store.add(testUser, deleted)
+			store.add(testUser, testAddress("other-uuid", "other-slug", tc.otherLive))
+
+			_, err := server.RestoreAddress(userContext(testUser), &api.RestoreAddressRequest{Username: testUser, Slug: testSlug})
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("RestoreAddress() code = %v, want %v (err: %v)", status.Code(err), tc.wantCode, err)
+			}
+			if restored := !store.addresses[testSlug].DeletedAt.Valid; restored != (tc.wantCode == codes.OK) {
+				t.Errorf("restored = %v, want %v", restored, tc.wantCode == codes.OK)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package address
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// RevertAddress reverts an address record to one of its prior versions.  The version is applied
+// through UpdateAddress, so it is held to the same validation and primary rules as any other update,
+// and the state it replaces is kept in the record's history.
+func (s *addressServer) RevertAddress(ctx context.Context, req *api.RevertAddressRequest) (*api.Address, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetSlug())
+	version := strings.TrimSpace(req.GetVersion())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid address slug", "err", "address slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "address slug must be a valid UUID")
+	}
+
+	// validate the version
+	if err := validate.ValidateUuid(version); err != nil {
+		log.Error("invalid address version", "err", "address version must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "address version must be a valid UUID")
+	}
+
+	// get the version, which must belong to the user's address
+	prior, err := s.addressStore.GetAddressVersion(ctx, slug, username, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("address version %s not found for slug %s and user %s", version, slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("address version not found: %s", version))
+		}
+		log.Error(fmt.Sprintf("failed to get address version %s for slug %s", version, slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get address version: %s", version))
+	}
+
+	// apply the version as an ordinary update
+	// errors are already logged and mapped to status codes by UpdateAddress
+	address, err := s.UpdateAddress(ctx, &api.UpdateAddressRequest{
+		Username:        username,
+		Slug:            slug,
+		AddressUuid:     prior.AddressUuid,
+		StreetAddress:   prior.AddressLine1.String,
+		StreetAddress_2: proto.String(prior.AddressLine2.String),
+		City:            prior.City.String,
+		StateProvince:   prior.State.String,
+		PostalCode:      prior.Zip.String,
+		Country:         prior.Country.String,
+		IsCurrent:       prior.IsCurrent,
+		IsPrimary:       prior.IsPrimary,
+		ValidFrom:       NullTimestamp(prior.ValidFrom),
+		ValidTo:         NullTimestamp(prior.ValidTo),
+		PromoteOnStart:  prior.PromoteOnStart,
+		AddressType:     ConvertAddressType(prior.AddressType),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to revert address slug %s to version %s", slug, version), "err", err.Error())
+		return nil, err
+	}
+
+	log.Info(fmt.Sprintf("successfully reverted address slug %s to version %s for %s", slug, version, username))
+
+	return address, nil
+}
@@ -0,0 +1,178 @@
+package address
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testUser = "user@example.com"
+	testSlug = "6f1c1e5e-8c1a-4a47-9d1e-3f7a2b9c0d11"
+)
+
+// seedAddressWithHistory stores a home address which was moved from 1 Main St to 2 Elm St.
+func seedAddressWithHistory(t *testing.T, server *addressServer, store *fakeAddressStore) {
+
+	created := time.Now().UTC().Add(-48 * time.Hour)
+	store.add(testUser, sqlc.Address{
+		Uuid:         "address-uuid",
+		Slug:         testSlug,
+		AddressLine1: sql.NullString{String: "1 Main St", Valid: true},
+		City:         sql.NullString{String: "Springfield", Valid: true},
+		State:        sql.NullString{String: "IL", Valid: true},
+		Zip:          sql.NullString{String: "62701", Valid: true},
+		Country:      sql.NullString{String: "US", Valid: true},
+		AddressType:  "HOME",
+		IsCurrent:    true,
+		UpdatedAt:    created,
+		CreatedAt:    created,
+	})
+
+	if _, err := server.UpdateAddress(userContext(testUser), &api.UpdateAddressRequest{
+		Username:        testUser,
+		Slug:            testSlug,
+		StreetAddress:   "2 Elm St",
+		StreetAddress_2: proto.String(""),
+		City:            "Springfield",
+		StateProvince:   "IL",
+		PostalCode:      "62701",
+		Country:         "US",
+		IsCurrent:       true,
+		AddressType:     api.AddressType_ADDRESS_TYPE_HOME,
+	}); err != nil {
+		t.Fatalf("UpdateAddress() err = %v", err)
+	}
+}
+
+func TestListAddressHistory(t *testing.T) {
+
+	store := newFakeAddressStore()
+	server := newTestServer(store)
+	seedAddressWithHistory(t, server, store)
+
+	resp, err := server.ListAddressHistory(userContext(testUser), &api.ListAddressHistoryRequest{Username: testUser, Slug: testSlug})
+	if err != nil {
+		t.Fatalf("ListAddressHistory() err = %v", err)
+	}
+
+	if len(resp.GetVersions()) != 1 {
+		t.Fatalf("ListAddressHistory() returned %d versions, want 1", len(resp.GetVersions()))
+	}
+	version := resp.GetVersions()[0]
+	if version.GetAddress().GetStreetAddress() != "1 Main St" || version.GetAddress().GetAddressType() != api.AddressType_ADDRESS_TYPE_HOME {
+		t.Errorf("ListAddressHistory() version = %v, want the record before the update", version.GetAddress())
+	}
+	if version.GetSupersededAt() == nil || version.GetVersion() == "" {
+		t.Errorf("ListAddressHistory() version missing its id or superseded time: %v", version)
+	}
+
+	// another user's slug is not found, rather than listed as having no history
+	_, err = server.ListAddressHistory(userContext("other@example.com"), &api.ListAddressHistoryRequest{Username: "other@example.com", Slug: testSlug})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ListAddressHistory() for another user's slug code = %v, want NotFound", status.Code(err))
+	}
+
+	// other users may not list a user's history
+	_, err = server.ListAddressHistory(userContext("other@example.com"), &api.ListAddressHistoryRequest{Username: testUser, Slug: testSlug})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListAddressHistory() by another user code = %v, want PermissionDenied", status.Code(err))
+	}
+}
+
+func TestRevertAddress(t *testing.T) {
+
+	store := newFakeAddressStore()
+	server := newTestServer(store)
+	seedAddressWithHistory(t, server, store)
+
+	version := store.history[testSlug][0].Uuid
+
+	reverted, err := server.RevertAddress(userContext(testUser), &api.RevertAddressRequest{Username: testUser, Slug: testSlug, Version: version})
+	if err != nil {
+		t.Fatalf("RevertAddress() err = %v", err)
+	}
+
+	if reverted.GetStreetAddress() != "1 Main St" || store.addresses[testSlug].AddressLine1.String != "1 Main St" {
+		t.Errorf("RevertAddress() = %q, stored %q, want 1 Main St", reverted.GetStreetAddress(), store.addresses[testSlug].AddressLine1.String)
+	}
+
+	// reverting is an update, so the state it replaced is kept and can be reverted to in turn
+	history := store.history[testSlug]
+	if len(history) != 2 || history[0].AddressLine1.String != "2 Elm St" {
+		t.Fatalf("expected the reverted state to be kept in the history, got %d versions", len(history))
+	}
+
+	if _, err := server.RevertAddress(userContext(testUser), &api.RevertAddressRequest{Username: testUser, Slug: testSlug, Version: history[0].Uuid}); err != nil {
+		t.Fatalf("RevertAddress() to the reverted state err = %v", err)
+	}
+	if store.addresses[testSlug].AddressLine1.String != "2 Elm St" {
+		t.Errorf("expected the revert to be undone, got %q", store.addresses[testSlug].AddressLine1.String)
+	}
+}
+
+func TestRevertAddressErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		user     string
+		username string
+		slug     string
+		version  string
+		wantCode codes.Code
+	}{
+		{"unknown version", testUser, testUser, testSlug, "9b0c2d6e-1f3a-4c5b-8d7e-6a5b4c3d2e1f", codes.NotFound},
+		{"invalid version", testUser, testUser, testSlug, "not-a-uuid", codes.InvalidArgument},
+		{"invalid slug", testUser, testUser, "not-a-uuid", "", codes.InvalidArgument},
+		{"another user's version", "other@example.com", "other@example.com", testSlug, "", codes.NotFound},
+		{"another user's record", "other@example.com", testUser, testSlug, "", codes.PermissionDenied},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store := newFakeAddressStore()
+			server := newTestServer(store)
+			seedAddressWithHistory(t, server, store)
+			updates := store.updates
+
+			version := tc.version
+			if version == "" {
+				version = store.history[testSlug][0].Uuid
+			}
+
+			_, err := server.RevertAddress(userContext(tc.user), &api.RevertAddressRequest{Username: tc.username, Slug: tc.slug, Version: version})
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("RevertAddress() code = %v, want %v (err: %v)", status.Code(err), tc.wantCode, err)
+			}
+			if store.updates != updates {
+				t.Error("expected a failed revert not to update the record")
+			}
+		})
+	}
+}
+
+func TestRevertAddressDuplicate(t *testing.T) {
+
+	store := newFakeAddressStore()
+	server := newTestServer(store)
+	seedAddressWithHistory(t, server, store)
+
+	// since moving, the user added their old address again as another record
+	store.add(testUser, testAddress("other-uuid", "other-slug", "1 Main St"))
+	updates := store.updates
+
+	_, err := server.RevertAddress(userContext(testUser), &api.RevertAddressRequest{Username: testUser, Slug: testSlug, Version: store.history[testSlug][0].Uuid})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("RevertAddress() code = %v, want AlreadyExists (err: %v)", status.Code(err), err)
+	}
+	if store.updates != updates {
+		t.Error("expected a revert onto a duplicate not to update the record")
+	}
+}
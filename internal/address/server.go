@@ -1,12 +1,18 @@
 package address
 
 import (
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
-	"github.com/tdeslauriers/carapace/pkg/validate"
 	api "github.com/tdeslauriers/silhouette/api/v1"
 	"github.com/tdeslauriers/silhouette/internal/definitions"
 	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // addressServer is the gRPC server implementaiton for the Address service
@@ -15,6 +21,12 @@ type addressServer struct {
 	profileStore storage.ProfileStore
 	xrefStore    storage.XrefStore
 
+	// restoreWindow is how long a deleted record can be restored
+	restoreWindow time.Duration
+
+	// primaryPerType allows a user one primary address of each address type rather than one in all
+	primaryPerType bool
+
 	logger *slog.Logger
 
 	api.UnimplementedAddressesServer
@@ -26,6 +38,8 @@ func NewAddressServer(
 	addressSql storage.AddressStore,
 	profileSql storage.ProfileStore,
 	xrefSql storage.XrefStore,
+	restoreWindow time.Duration,
+	primaryPerType bool,
 ) api.AddressesServer {
 
 	return &addressServer{
@@ -33,12 +47,24 @@ func NewAddressServer(
 		profileStore: profileSql,
 		xrefStore:    xrefSql,
 
+		restoreWindow:  restoreWindow,
+		primaryPerType: primaryPerType,
+
 		logger: slog.Default().
 			With(slog.String(definitions.ComponentKey, definitions.ComponentAddressServer)).
 			With(slog.String(definitions.PackageKey, definitions.PackageAddress)),
 	}
 }
 
+// primaryLabel describes the primary address a record of the given type competes with, for error messages,
+// ie, the primary address of its type if primary is tracked per type.
+func (as *addressServer) primaryLabel(addressType string) string {
+	if as.primaryPerType {
+		return fmt.Sprintf("primary %s", addressType)
+	}
+	return "primary"
+}
+
 // AddressUpsert provides functions to access data in an address record creation or update operations request models
 type AddressUpsert interface {
 	GetStreetAddress() string
@@ -48,47 +74,60 @@ type AddressUpsert interface {
 	GetPostalCode() string
 	GetCountry() string
 	GetUsername() string
+	GetValidFrom() *timestamppb.Timestamp
+	GetValidTo() *timestamppb.Timestamp
+	GetPromoteOnStart() bool
+	GetAddressType() api.AddressType
 }
 
-// ValidateCmd validates the fields of an AddressUpsert request model
-func ValidateCmd(cmd AddressUpsert) error {
+// ConvertAddressType converts a string representation of an address type to the corresponding v1.AddressType enum value.
+func ConvertAddressType(at string) api.AddressType {
 
-	// validate email
-	if err := validate.ValidateEmail(cmd.GetUsername()); err != nil {
-		return err
-	}
+	// captialize string
+	at = strings.TrimSpace(strings.ToUpper(at))
 
-	// validate address line 1
-	if err := validate.ValidateStreetAddress(cmd.GetStreetAddress()); err != nil {
-		return err
+	// check for enum prefix
+	if !strings.HasPrefix(at, "ADDRESS_TYPE_") {
+		at = "ADDRESS_TYPE_" + at
 	}
 
-	// validate address line 2, if present
-	if len(cmd.GetStreetAddress_2()) > 0 {
-		if err := validate.ValidateStreetAddress(cmd.GetStreetAddress_2()); err != nil {
-			return err
-		}
+	atEnum, ok := api.AddressType_value[at]
+	if !ok {
+		// defaults to unspecified
+		return api.AddressType_ADDRESS_TYPE_UNSPECIFIED
 	}
 
-	// validate city
-	if err := validate.ValidateCity(cmd.GetCity()); err != nil {
-		return err
-	}
+	return api.AddressType(atEnum)
+}
 
-	// validate state
-	if err := validate.ValidateState(cmd.GetStateProvince()); err != nil {
-		return err
-	}
+// ConvertToSqlString converts an address type to its stored form, ie, without the enum prefix.
+func ConvertToSqlString(at api.AddressType) string {
 
-	// validate postal code
-	if err := validate.ValidateZipCode(cmd.GetPostalCode()); err != nil {
-		return err
+	addressType := at.String()
+
+	// if has prefix, remove
+	if after, ok := strings.CutPrefix(addressType, "ADDRESS_TYPE_"); ok {
+		addressType = after
 	}
 
-	// validate country
-	if err := validate.ValidateCountry(cmd.GetCountry()); err != nil {
-		return err
+	return addressType
+}
+
+// alreadyExistsStatus builds an AlreadyExists status error for a duplicate address record.  The slug of the
+// existing record is in the message and in ResourceInfo details so callers can use it in place of the duplicate.
+func alreadyExistsStatus(slug string) error {
+
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("address record already exists - slug: %s", slug))
+
+	detailed, err := st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "address",
+		ResourceName: slug,
+		Description:  "duplicate of an existing address record",
+	})
+	if err != nil {
+		// the message still carries the slug
+		return st.Err()
 	}
 
-	return nil
+	return detailed.Err()
 }
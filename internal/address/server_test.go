@@ -0,0 +1,211 @@
+package address
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/tdeslauriers/carapace/pkg/connect"
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/auth/authtest"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// fakeAddressStore is an in-memory storage.AddressStore holding plaintext records by slug.  Only the
+// methods the handlers under test call are implemented; the embedded interface panics on the rest.
+type fakeAddressStore struct {
+	storage.AddressStore
+
+	owners    map[string]string                 // username by slug
+	addresses map[string]*sqlc.Address          // live records by slug
+	history   map[string][]*sqlc.AddressHistory // prior versions by slug, newest first
+	updates   int
+
+	// primaryPerType counts primary records of the given type only, as the store does when so configured
+	primaryPerType bool
+}
+
+func newFakeAddressStore() *fakeAddressStore {
+	return &fakeAddressStore{
+		owners:    make(map[string]string),
+		addresses: make(map[string]*sqlc.Address),
+		history:   make(map[string][]*sqlc.AddressHistory),
+	}
+}
+
+// add stores a copy of a user's record.
+func (f *fakeAddressStore) add(username string, address sqlc.Address) {
+	f.owners[address.Slug] = username
+	f.addresses[address.Slug] = &address
+}
+
+func (f *fakeAddressStore) GetAddress(ctx context.Context, slug, username string) (*sqlc.Address, error) {
+	if f.owners[slug] != username || f.addresses[slug] == nil || f.addresses[slug].DeletedAt.Valid {
+		return nil, sql.ErrNoRows
+	}
+	address := *f.addresses[slug]
+	return &address, nil
+}
+
+func (f *fakeAddressStore) CountAddresses(ctx context.Context, username string) (int64, error) {
+	var count int64
+	for slug, a := range f.addresses {
+		if f.owners[slug] == username && !a.DeletedAt.Valid {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// FindDuplicateAddress compares the fingerprinted fields with case and punctuation folded away, as the store does.
+func (f *fakeAddressStore) FindDuplicateAddress(ctx context.Context, username string, address *sqlc.Address) (*sqlc.Address, error) {
+
+	fold := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToUpper(r)
+			}
+			return -1
+		}, s)
+	}
+	same := func(a, b sql.NullString) bool { return fold(a.String) == fold(b.String) }
+
+	for slug, a := range f.addresses {
+		if f.owners[slug] != username || a.DeletedAt.Valid || a.Uuid == address.Uuid {
+			continue
+		}
+		if same(a.AddressLine1, address.AddressLine1) && same(a.AddressLine2, address.AddressLine2) &&
+			same(a.Zip, address.Zip) && same(a.Country, address.Country) {
+			duplicate := *a
+			return &duplicate, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeAddressStore) GetDeletedAddress(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Address, error) {
+	a := f.addresses[slug]
+	if f.owners[slug] != username || a == nil || !a.DeletedAt.Valid || a.DeletedAt.Time.Before(deletedAfter) {
+		return nil, sql.ErrNoRows
+	}
+	deleted := *a
+	return &deleted, nil
+}
+
+func (f *fakeAddressStore) RestoreAddress(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Address, error) {
+	if _, err := f.GetDeletedAddress(ctx, slug, username, deletedAfter); err != nil {
+		return nil, err
+	}
+	f.addresses[slug].DeletedAt = sql.NullTime{}
+	f.updates++
+	return f.GetAddress(ctx, slug, username)
+}
+
+func (f *fakeAddressStore) CountPrimaryAddresses(ctx context.Context, username, addressType string) (int64, error) {
+	var count int64
+	for slug, a := range f.addresses {
+		if f.owners[slug] == username && a.IsPrimary && (!f.primaryPerType || a.AddressType == addressType) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeAddressStore) UpdateAddress(ctx context.Context, username string, address *sqlc.Address) error {
+
+	previous := f.addresses[address.Slug]
+	f.history[address.Slug] = slices.Insert(f.history[address.Slug], 0, &sqlc.AddressHistory{
+		Uuid:           uuid.NewString(),
+		AddressUuid:    previous.Uuid,
+		Slug:           previous.Slug,
+		AddressLine1:   previous.AddressLine1,
+		AddressLine2:   previous.AddressLine2,
+		City:           previous.City,
+		State:          previous.State,
+		Zip:            previous.Zip,
+		Country:        previous.Country,
+		AddressType:    previous.AddressType,
+		IsCurrent:      previous.IsCurrent,
+		IsPrimary:      previous.IsPrimary,
+		ValidFrom:      previous.ValidFrom,
+		ValidTo:        previous.ValidTo,
+		PromoteOnStart: previous.PromoteOnStart,
+		UpdatedAt:      previous.UpdatedAt,
+		CreatedAt:      previous.CreatedAt,
+		SupersededAt:   address.UpdatedAt,
+	})
+
+	updated := *address
+	updated.CreatedAt = previous.CreatedAt
+	f.addresses[address.Slug] = &updated
+	f.updates++
+	return nil
+}
+
+func (f *fakeAddressStore) GetAddressHistory(ctx context.Context, slug, username string) ([]*sqlc.AddressHistory, error) {
+	if f.owners[slug] != username {
+		return nil, nil
+	}
+	return f.history[slug], nil
+}
+
+func (f *fakeAddressStore) GetAddressVersion(ctx context.Context, slug, username, version string) (*sqlc.AddressHistory, error) {
+	if f.owners[slug] != username {
+		return nil, sql.ErrNoRows
+	}
+	for _, h := range f.history[slug] {
+		if h.Uuid == version {
+			return h, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// testAddress returns a current, non-primary Springfield home address created two days ago.
+func testAddress(uuid, slug, street string) sqlc.Address {
+	created := time.Now().UTC().Add(-48 * time.Hour)
+	return sqlc.Address{
+		Uuid:         uuid,
+		Slug:         slug,
+		AddressLine1: sql.NullString{String: street, Valid: true},
+		City:         sql.NullString{String: "Springfield", Valid: true},
+		State:        sql.NullString{String: "IL", Valid: true},
+		Zip:          sql.NullString{String: "62701", Valid: true},
+		Country:      sql.NullString{String: "US", Valid: true},
+		AddressType:  "HOME",
+		IsCurrent:    true,
+		UpdatedAt:    created,
+		CreatedAt:    created,
+	}
+}
+
+// newTestServer returns an address server backed by the store, with a discarded log.
+func newTestServer(store storage.AddressStore) *addressServer {
+	return &addressServer{
+		addressStore:  store,
+		restoreWindow: 30 * 24 * time.Hour,
+		logger:        slog.New(slog.DiscardHandler),
+	}
+}
+
+// userContext returns a request context for a user accessing their own records through the gateway,
+// as the auth and telemetry interceptors would build it.
+func userContext(username string) context.Context {
+
+	ctx := context.WithValue(context.Background(), connect.TelemetryKey, &exo.GrpcTelemetry{})
+
+	return authtest.NewContext(ctx, &auth.AuthContext{
+		RequiredScopes:    []string{"w:silhouette:address:*"},
+		UserClaims:        &jwt.Claims{Subject: username},
+		SvcClaims:         &jwt.Claims{Subject: "gateway"},
+		SelfAccessAllowed: true,
+	})
+}
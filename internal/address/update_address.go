@@ -52,10 +52,8 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
 	// prepare username and slug parameter fields
 	username := strings.TrimSpace(req.GetUsername())
@@ -67,10 +65,11 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		return nil, status.Error(codes.PermissionDenied, "access denied")
 	}
 
-	// validate request fields
-	if err := ValidateCmd(req); err != nil {
+	// validate and normalize request fields against the rules for the address's country
+	fields, err := NormalizeCmd(req)
+	if err != nil {
 		log.Error("invalid update address request", "err", err.Error())
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+		return nil, InvalidArgumentStatus("invalid update address request", err)
 	}
 
 	// validate slug since not accounted for in cmd validation
@@ -95,15 +94,22 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 	}
 
 	// prepare fields
-	streetAddress := strings.TrimSpace(req.GetStreetAddress())
-	city := strings.TrimSpace(req.GetCity())
-	stateProvince := strings.TrimSpace(req.GetStateProvince())
-	postalCode := strings.TrimSpace(req.GetPostalCode())
-	country := strings.TrimSpace(req.GetCountry())
-
-	var streetAddress_2 string
-	if len(req.GetStreetAddress_2()) > 0 {
-		streetAddress_2 = strings.TrimSpace(req.GetStreetAddress_2())
+	streetAddress := fields.StreetAddress
+	streetAddress_2 := fields.StreetAddress_2
+	city := fields.City
+	stateProvince := fields.StateProvince
+	postalCode := fields.PostalCode
+	country := fields.Country
+
+	addressType := ConvertToSqlString(req.GetAddressType())
+
+	now := time.Now().UTC()
+
+	// a dated record is current while now is within its range, regardless of the requested flag
+	validFrom, validTo := EffectiveRange(req.GetValidFrom(), req.GetValidTo())
+	isCurrent := req.GetIsCurrent()
+	if IsDated(validFrom, validTo) {
+		isCurrent = InRange(validFrom, validTo, now)
 	}
 
 	// check if update necessary
@@ -113,8 +119,12 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		stateProvince == record.State.String &&
 		postalCode == record.Zip.String &&
 		country == record.Country.String &&
-		req.GetIsCurrent() == record.IsCurrent &&
-		req.GetIsPrimary() == record.IsPrimary {
+		addressType == record.AddressType &&
+		isCurrent == record.IsCurrent &&
+		req.GetIsPrimary() == record.IsPrimary &&
+		sameTime(validFrom, record.ValidFrom) &&
+		sameTime(validTo, record.ValidTo) &&
+		req.GetPromoteOnStart() == record.PromoteOnStart {
 
 		log.Warn(fmt.Sprintf("no update necessary, no changes to address record - slug: %s", slug))
 		return &api.Address{
@@ -130,9 +140,37 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 			IsPrimary:       record.IsPrimary,
 			CreatedAt:       timestamppb.New(record.CreatedAt),
 			UpdatedAt:       timestamppb.New(record.UpdatedAt),
+			ValidFrom:       NullTimestamp(record.ValidFrom),
+			ValidTo:         NullTimestamp(record.ValidTo),
+			PromoteOnStart:  record.PromoteOnStart,
+			AddressType:     ConvertAddressType(record.AddressType),
 		}, nil
 	}
 
+	// reject moving the record onto an address the user already has, however it was formatted.
+	// only the fields in the fingerprint can make it a duplicate, so other updates are not checked.
+	if streetAddress != record.AddressLine1.String ||
+		streetAddress_2 != record.AddressLine2.String ||
+		postalCode != record.Zip.String ||
+		country != record.Country.String {
+
+		existing, err := as.addressStore.FindDuplicateAddress(ctx, username, &sqlc.Address{
+			Uuid:         record.Uuid,
+			AddressLine1: sql.NullString{String: streetAddress, Valid: streetAddress != ""},
+			AddressLine2: sql.NullString{String: streetAddress_2, Valid: streetAddress_2 != ""},
+			Zip:          sql.NullString{String: postalCode, Valid: postalCode != ""},
+			Country:      sql.NullString{String: country, Valid: country != ""},
+		})
+		switch {
+		case err == nil:
+			log.Error(fmt.Sprintf("duplicate address record for %s - cannot update slug %s to match existing slug %s", username, slug, existing.Slug))
+			return nil, alreadyExistsStatus(existing.Slug)
+		case !errors.Is(err, sql.ErrNoRows):
+			log.Error(fmt.Sprintf("failed to check for duplicate address records for %s during update of slug %s", username, slug), "err", err.Error())
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check for duplicate address records for %s", username))
+		}
+	}
+
 	// build updated record
 	updated := &sqlc.Address{
 		Uuid: record.Uuid,
@@ -144,15 +182,22 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		State:        sql.NullString{String: stateProvince, Valid: stateProvince != ""},
 		Zip:          sql.NullString{String: postalCode, Valid: postalCode != ""},
 		Country:      sql.NullString{String: country, Valid: country != ""},
-		IsCurrent:    req.GetIsCurrent(), // final state is checked below is_primary validation
-		UpdatedAt:    time.Now().UTC(),
+		AddressType:  addressType,
+		IsCurrent:    isCurrent, // final state is checked below is_primary validation
+		ValidFrom:    validFrom,
+		ValidTo:      validTo,
+		// promotion only applies to a future start date, which is checked in cmd validation
+		PromoteOnStart: req.GetPromoteOnStart(),
+		UpdatedAt:      now,
 		// CreatedAt not needed for update
 	}
 
 	// if request sets primary as true and record is not currently primary,
-	// validate there are no other primary address records for the user
+	// validate there are no other primary address records for the user.
+	// if primary is tracked per type, a primary record changing type is validated the same way
+	typeChanged := as.primaryPerType && addressType != record.AddressType
 	switch {
-	case req.GetIsPrimary() && record.IsPrimary:
+	case req.GetIsPrimary() && record.IsPrimary && !typeChanged:
 		// do nothing - record is already primary and remains primary
 		updated.IsPrimary = true
 	case !req.GetIsPrimary() && !record.IsPrimary:
@@ -162,17 +207,17 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		// if primary is being removed, set to false, this
 		// is allowed without validation since user can have multiple non-primary records
 		updated.IsPrimary = false
-	case req.GetIsPrimary() && !record.IsPrimary:
+	case req.GetIsPrimary() && (!record.IsPrimary || typeChanged):
 
-		count, err := as.addressStore.CountPrimaryAddresses(ctx, username)
+		count, err := as.addressStore.CountPrimaryAddresses(ctx, username, addressType)
 		if err != nil {
 			log.Error(fmt.Sprintf("failed to get primary address count for user %s during update of slug %s", username, slug), "err", err.Error())
 			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get primary address count for user %s during update of slug %s", username, slug))
 		}
 
 		if count > 0 {
-			log.Error(fmt.Sprintf("primary address record already exists for user %s - cannot update slug %s to primary", username, slug))
-			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("primary address record already exists for user %s - cannot update slug %s to primary", username, slug))
+			log.Error(fmt.Sprintf("%s address record already exists for user %s - cannot update slug %s to primary", as.primaryLabel(addressType), username, slug))
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("%s address record already exists for user %s - cannot update slug %s to primary", as.primaryLabel(addressType), username, slug))
 		}
 
 		updated.IsPrimary = true
@@ -186,7 +231,7 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 	}
 
 	// update persistence layer
-	if err := as.addressStore.UpdateAddress(ctx, updated); err != nil {
+	if err := as.addressStore.UpdateAddress(ctx, username, updated); err != nil {
 		log.Error(fmt.Sprintf("failed to update address record for slug %s", slug), "err", err.Error())
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update address record - slug: %s", slug))
 	}
@@ -236,10 +281,38 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		)
 	}
 
-	if req.GetIsCurrent() != record.IsCurrent {
+	if addressType != record.AddressType {
+		updatedFields = append(updatedFields,
+			slog.String("address_type_previous", record.AddressType),
+			slog.String("address_type_updated", addressType),
+		)
+	}
+
+	if isCurrent != record.IsCurrent {
 		updatedFields = append(updatedFields,
 			slog.Bool("is_current_previous", record.IsCurrent),
-			slog.Bool("is_current_updated", req.GetIsCurrent()),
+			slog.Bool("is_current_updated", isCurrent),
+		)
+	}
+
+	if !sameTime(validFrom, record.ValidFrom) {
+		updatedFields = append(updatedFields,
+			slog.String("valid_from_previous", formatTime(record.ValidFrom)),
+			slog.String("valid_from_updated", formatTime(validFrom)),
+		)
+	}
+
+	if !sameTime(validTo, record.ValidTo) {
+		updatedFields = append(updatedFields,
+			slog.String("valid_to_previous", formatTime(record.ValidTo)),
+			slog.String("valid_to_updated", formatTime(validTo)),
+		)
+	}
+
+	if req.GetPromoteOnStart() != record.PromoteOnStart {
+		updatedFields = append(updatedFields,
+			slog.Bool("promote_on_start_previous", record.PromoteOnStart),
+			slog.Bool("promote_on_start_updated", req.GetPromoteOnStart()),
 		)
 	}
 
@@ -266,5 +339,9 @@ func (as *addressServer) UpdateAddress(ctx context.Context, req *api.UpdateAddre
 		IsPrimary:       updated.IsPrimary,
 		CreatedAt:       timestamppb.New(record.CreatedAt),
 		UpdatedAt:       timestamppb.New(updated.UpdatedAt),
+		ValidFrom:       NullTimestamp(updated.ValidFrom),
+		ValidTo:         NullTimestamp(updated.ValidTo),
+		PromoteOnStart:  updated.PromoteOnStart,
+		AddressType:     req.GetAddressType(),
 	}, nil
 }
@@ -0,0 +1,196 @@
+package address
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUpdateAddressPrimary(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		primaryPerType bool
+		addressType    api.AddressType
+		wantCode       codes.Code
+	}{
+		{"one primary per user", false, api.AddressType_ADDRESS_TYPE_BILLING, codes.InvalidArgument},
+		{"one primary per user of the same type", false, api.AddressType_ADDRESS_TYPE_SHIPPING, codes.InvalidArgument},
+		{"per type allows another type", true, api.AddressType_ADDRESS_TYPE_BILLING, codes.OK},
+		{"per type rejects the same type", true, api.AddressType_ADDRESS_TYPE_SHIPPING, codes.InvalidArgument},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store := newFakeAddressStore()
+			store.primaryPerType = tc.primaryPerType
+			server := newTestServer(store)
+			server.primaryPerType = tc.primaryPerType
+
+			// the user has a primary shipping address, and a billing address to make primary
+			created := time.Now().UTC().Add(-48 * time.Hour)
+			address := sqlc.Address{
+				AddressLine1: sql.NullString{String: "1 Main St", Valid: true},
+				City:         sql.NullString{String: "Springfield", Valid: true},
+				State:        sql.NullString{String: "IL", Valid: true},
+				Zip:          sql.NullString{String: "62701", Valid: true},
+				Country:      sql.NullString{String: "US", Valid: true},
+				IsCurrent:    true,
+				UpdatedAt:    created,
+				CreatedAt:    created,
+			}
+			shipping := address
+			shipping.Uuid, shipping.Slug = "shipping-uuid", "shipping-slug"
+			shipping.AddressType, shipping.IsPrimary = "SHIPPING", true
+			store.add(testUser, shipping)
+
+			billing := address
+			billing.Uuid, billing.Slug = "billing-uuid", testSlug
+			billing.AddressLine1 = sql.NullString{String: "2 Elm St", Valid: true}
+			billing.AddressType = "BILLING"
+			store.add(testUser, billing)
+
+			_, err := server.UpdateAddress(userContext(testUser), &api.UpdateAddressRequest{
+				Username:        testUser,
+				Slug:            testSlug,
+				StreetAddress:   "2 Elm St",
+				StreetAddress_2: proto.String(""),
+				City:            "Springfield",
+				StateProvince:   "IL",
+				PostalCode:      "62701",
+				Country:         "US",
+				IsCurrent:       true,
+				IsPrimary:       true,
+				AddressType:     tc.addressType,
+			})
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("UpdateAddress() code = %v, want %v (err: %v)", status.Code(err), tc.wantCode, err)
+			}
+			if store.addresses[testSlug].IsPrimary != (tc.wantCode == codes.OK) {
+				t.Errorf("stored is_primary = %v, want %v", store.addresses[testSlug].IsPrimary, tc.wantCode == codes.OK)
+			}
+		})
+	}
+}
+
+func TestUpdateAddressPrimaryTypeChange(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		primaryPerType bool
+		wantCode       codes.Code
+	}{
+		// with one primary per user, the primary record may change type freely
+		{"one primary per user", false, codes.OK},
+		// with primary per type, it competes with the primary of its new type
+		{"per type", true, codes.InvalidArgument},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store := newFakeAddressStore()
+			store.primaryPerType = tc.primaryPerType
+			server := newTestServer(store)
+			server.primaryPerType = tc.primaryPerType
+
+			created := time.Now().UTC().Add(-48 * time.Hour)
+			address := sqlc.Address{
+				AddressLine1: sql.NullString{String: "1 Main St", Valid: true},
+				City:         sql.NullString{String: "Springfield", Valid: true},
+				State:        sql.NullString{String: "IL", Valid: true},
+				Zip:          sql.NullString{String: "62701", Valid: true},
+				Country:      sql.NullString{String: "US", Valid: true},
+				IsCurrent:    true,
+				IsPrimary:    true,
+				UpdatedAt:    created,
+				CreatedAt:    created,
+			}
+
+			// a primary home address, and a primary billing address when primary is tracked per type
+			home := address
+			home.Uuid, home.Slug, home.AddressType = "home-uuid", testSlug, "HOME"
+			store.add(testUser, home)
+			if tc.primaryPerType {
+				billing := address
+				billing.Uuid, billing.Slug, billing.AddressType = "billing-uuid", "billing-slug", "BILLING"
+				billing.AddressLine1 = sql.NullString{String: "2 Elm St", Valid: true}
+				store.add(testUser, billing)
+			}
+
+			_, err := server.UpdateAddress(userContext(testUser), &api.UpdateAddressRequest{
+				Username:        testUser,
+				Slug:            testSlug,
+				StreetAddress:   "1 Main St",
+				StreetAddress_2: proto.String(""),
+				City:            "Springfield",
+				StateProvince:   "IL",
+				PostalCode:      "62701",
+				Country:         "US",
+				IsCurrent:       true,
+				IsPrimary:       true,
+				AddressType:     api.AddressType_ADDRESS_TYPE_BILLING,
+			})
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("UpdateAddress() code = %v, want %v (err: %v)", status.Code(err), tc.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestUpdateAddressDuplicate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		street   string
+		city     string
+		wantCode codes.Code
+	}{
+		{"another record's address, formatted differently", "2 elm st.", "Springfield", codes.AlreadyExists},
+		{"the record's own address, formatted differently", "1 main st.", "Shelbyville", codes.OK},
+		{"a new address", "3 Oak St", "Springfield", codes.OK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store := newFakeAddressStore()
+			server := newTestServer(store)
+			store.add(testUser, testAddress("address-uuid", testSlug, "1 Main St"))
+			store.add(testUser, testAddress("other-uuid", "other-slug", "2 Elm St"))
+
+			_, err := server.UpdateAddress(userContext(testUser), &api.UpdateAddressRequest{
+				Username:        testUser,
+				Slug:            testSlug,
+				StreetAddress:   tc.street,
+				StreetAddress_2: proto.String(""),
+				City:            tc.city,
+				StateProvince:   "IL",
+				PostalCode:      "62701",
+				Country:         "US",
+				IsCurrent:       true,
+				AddressType:     api.AddressType_ADDRESS_TYPE_HOME,
+			})
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("UpdateAddress() code = %v, want %v (err: %v)", status.Code(err), tc.wantCode, err)
+			}
+
+			if tc.wantCode == codes.AlreadyExists {
+				if !strings.Contains(status.Convert(err).Message(), "other-slug") {
+					t.Errorf("UpdateAddress() err = %v, want the existing slug", err)
+				}
+				if store.updates != 0 {
+					t.Error("expected a duplicate not to be stored")
+				}
+			}
+		})
+	}
+}
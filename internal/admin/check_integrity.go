@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// findingKinds maps storage finding kinds to the api enum
+var findingKinds = map[storage.FindingKind]api.IntegrityFindingKind{
+	storage.FindingOrphanAddress:     api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_ORPHAN_ADDRESS,
+	storage.FindingOrphanPhone:       api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_ORPHAN_PHONE,
+	storage.FindingDuplicatePrimary:  api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_DUPLICATE_PRIMARY,
+	storage.FindingPrimaryNotCurrent: api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_PRIMARY_NOT_CURRENT,
+	storage.FindingDecryptFailure:    api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_DECRYPT_FAILURE,
+	storage.FindingOverQuota:         api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_OVER_QUOTA,
+	storage.FindingUserIndexMismatch: api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_USER_INDEX_MISMATCH,
+	storage.FindingFingerprintStale:  api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_FINGERPRINT_STALE,
+	storage.FindingPhoneIndexStale:   api.IntegrityFindingKind_INTEGRITY_FINDING_KIND_PHONE_INDEX_STALE,
+}
+
+// CheckIntegrity scans the database for orphans and invariant violations,
+// optionally applying safe repairs.
+func (s *adminServer) CheckIntegrity(ctx context.Context, req *api.CheckIntegrityRequest) (*api.IntegrityReport, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// authorize the request: self access is not allowed, so scopes are required
+	if err := auth.AuthorizeRequest(authCtx, authCtx.UserClaims.Subject); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	log.Info(fmt.Sprintf("running integrity check, repair: %t", req.GetRepair()))
+
+	report, err := s.integrityChecker.CheckIntegrity(ctx, req.GetRepair())
+	if err != nil {
+		log.Error("failed to run integrity check", "err", err.Error())
+		return nil, status.Error(codes.Internal, "failed to run integrity check")
+	}
+
+	// convert the findings to the api type
+	findings := make([]*api.IntegrityFinding, 0, len(report.Findings))
+	for _, f := range report.Findings {
+		findings = append(findings, &api.IntegrityFinding{
+			Kind:        findingKinds[f.Kind],
+			Table:       f.Table,
+			Uuid:        f.Uuid,
+			ProfileUuid: f.ProfileUuid,
+			Detail:      f.Detail,
+			Repaired:    f.Repaired,
+		})
+
+		if f.Repaired {
+			log.Warn(fmt.Sprintf("integrity repair applied: %s on %s %s", f.Kind, f.Table, f.Uuid))
+		}
+	}
+
+	log.Info(fmt.Sprintf("integrity check complete: %d findings, %d unrepaired", len(report.Findings), report.Unrepaired()))
+
+	return &api.IntegrityReport{
+		Findings:         findings,
+		ProfilesScanned:  int32(report.ProfilesScanned),
+		AddressesScanned: int32(report.AddressesScanned),
+		PhonesScanned:    int32(report.PhonesScanned),
+		Repair:           report.Repair,
+		CheckedAt:        timestamppb.New(report.CheckedAt),
+	}, nil
+}
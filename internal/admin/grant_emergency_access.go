@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxJustificationLength is the longest justification which can be stored.
+const maxJustificationLength = 1024
+
+// GrantEmergencyAccess grants a named operator time-boxed, break-glass read access to every profile.
+func (s *adminServer) GrantEmergencyAccess(ctx context.Context, req *api.GrantEmergencyAccessRequest) (*api.EmergencyGrant, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// authorize the request: self access is not allowed, so scopes are required
+	if err := auth.AuthorizeRequest(authCtx, authCtx.UserClaims.Subject); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	operator, justification, duration, err := s.validateGrant(req)
+	if err != nil {
+		log.Error("invalid grant-emergency-access request", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// break-glass access needs a second person to approve it
+	if strings.EqualFold(operator, authCtx.UserClaims.Subject) {
+		log.Error(fmt.Sprintf("%s attempted to grant emergency access to themselves", authCtx.UserClaims.Subject),
+			"audit", "break_glass_grant_denied")
+		return nil, status.Error(codes.PermissionDenied, "emergency access cannot be granted to oneself")
+	}
+
+	grant := &storage.EmergencyGrant{
+		Operator:          operator,
+		Justification:     justification,
+		GrantedBy:         authCtx.UserClaims.Subject,
+		RequestingService: authCtx.SvcClaims.Subject,
+		ExpiresAt:         time.Now().UTC().Add(duration),
+	}
+
+	if err := s.emergencyGrants.Grant(ctx, grant); err != nil {
+		log.Error(fmt.Sprintf("failed to grant emergency access to %s", operator), "err", err.Error())
+		return nil, status.Error(codes.Internal, "failed to grant emergency access")
+	}
+
+	// logged as an error, as every use of the grant is, so it stands out in the audit log
+	log.Error(fmt.Sprintf("granted break-glass emergency access to %s until %s", operator, grant.ExpiresAt.Format(time.RFC3339)),
+		"audit", "break_glass_grant",
+		"grant_id", grant.Id,
+		"operator", operator,
+		"justification", justification,
+	)
+
+	return &api.EmergencyGrant{
+		GrantId:   grant.Id,
+		Operator:  operator,
+		ExpiresAt: timestamppb.New(grant.ExpiresAt),
+	}, nil
+}
+
+// validateGrant validates the operator, justification and duration of a request.
+func (s *adminServer) validateGrant(req *api.GrantEmergencyAccessRequest) (string, string, time.Duration, error) {
+
+	operator := strings.TrimSpace(req.GetOperator())
+	if err := validate.ValidateEmail(operator); err != nil {
+		return "", "", 0, fmt.Errorf("invalid operator: %v", err)
+	}
+
+	justification := strings.TrimSpace(req.GetJustification())
+	if justification == "" || len(justification) > maxJustificationLength || strings.ContainsFunc(justification, unicode.IsControl) {
+		return "", "", 0, fmt.Errorf("justification must be between 1 and %d printable characters", maxJustificationLength)
+	}
+
+	if req.GetDuration() == nil {
+		return "", "", 0, fmt.Errorf("duration is required")
+	}
+
+	if err := req.GetDuration().CheckValid(); err != nil {
+		return "", "", 0, fmt.Errorf("invalid duration: %v", err)
+	}
+
+	duration := req.GetDuration().AsDuration()
+	if duration <= 0 || duration > s.maxEmergencyAccess {
+		return "", "", 0, fmt.Errorf("duration must be positive and at most %s", s.maxEmergencyAccess)
+	}
+
+	return operator, justification, duration, nil
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"log/slog"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+// adminServer is the gRPC server implementation for the Admin service.
+type adminServer struct {
+	integrityChecker storage.IntegrityChecker
+	emergencyGrants  auth.EmergencyGrants
+
+	// maxEmergencyAccess is the longest break-glass grant which may be made
+	maxEmergencyAccess time.Duration
+
+	logger *slog.Logger
+
+	api.UnimplementedAdminServer
+}
+
+// NewAdminServer creates a new instance of the Admin gRPC server.
+func NewAdminServer(
+	integrityChecker storage.IntegrityChecker,
+	emergencyGrants auth.EmergencyGrants,
+	maxEmergencyAccess time.Duration,
+) api.AdminServer {
+
+	return &adminServer{
+		integrityChecker:   integrityChecker,
+		emergencyGrants:    emergencyGrants,
+		maxEmergencyAccess: maxEmergencyAccess,
+		logger: slog.Default().
+			With(slog.String(definitions.ComponentKey, definitions.ComponentAdminServer)).
+			With(slog.String(definitions.PackageKey, definitions.PackageAdmin)),
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ValidateAuthConfigs checks that every method of every registered gRPC service declares a valid auth_config,
+// so that a misconfigured method stops the service from starting rather than failing at request time.
+// Every problem found is returned, joined, rather than only the first.
+// Each service a method's allowed_services names must map to at least one service subject, or no service could call it.
+func ValidateAuthConfigs(services map[string]grpc.ServiceInfo, subjects ServiceSubjects) error {
+
+	var errs []error
+	for svcName := range services {
+
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(svcName))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find descriptor for service %s: %w", svcName, err))
+			continue
+		}
+
+		svcDesc, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			errs = append(errs, fmt.Errorf("descriptor for service %s is not a ServiceDescriptor", svcName))
+			continue
+		}
+
+		if err := validateService(svcDesc, subjects); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateService checks the auth_config of every method of a service.
+func validateService(svcDesc protoreflect.ServiceDescriptor, subjects ServiceSubjects) error {
+
+	var errs []error
+	methods := svcDesc.Methods()
+	for i := 0; i < methods.Len(); i++ {
+
+		methodDesc := methods.Get(i)
+
+		authConfig, err := methodAuthConfig(methodDesc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := validateAuthConfig(authConfig); err != nil {
+			errs = append(errs, fmt.Errorf("invalid auth_config for method %s: %w", methodDesc.FullName(), err))
+			continue
+		}
+
+		for _, svc := range authConfig.GetAllowedServices() {
+			if len(subjects[svc]) == 0 {
+				errs = append(errs, fmt.Errorf("allowed service %s of method %s is not mapped to any service subject", svc, methodDesc.FullName()))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// methodAuthConfig returns the auth_config option of a method.
+func methodAuthConfig(methodDesc protoreflect.MethodDescriptor) (*api.AuthConfig, error) {
+
+	opts := methodDesc.Options()
+	if opts == nil || !proto.HasExtension(opts, api.E_AuthConfig) {
+		return nil, fmt.Errorf("no authentication configuration extension found for method %s", methodDesc.FullName())
+	}
+
+	authConfig, ok := proto.GetExtension(opts, api.E_AuthConfig).(*api.AuthConfig)
+	if !ok || authConfig == nil {
+		return nil, fmt.Errorf("failed to cast extension to AuthConfig for method %s", methodDesc.FullName())
+	}
+
+	return authConfig, nil
+}
+
+// validateAuthConfig checks an auth_config for missing or contradictory options.
+func validateAuthConfig(authConfig *api.AuthConfig) error {
+
+	if len(authConfig.GetRequiredScopes()) == 0 {
+		return errors.New("required_scopes is empty")
+	}
+
+	for _, scope := range authConfig.GetRequiredScopes() {
+		if scope == "" {
+			return errors.New("required_scopes contains an empty scope")
+		}
+	}
+
+	for _, svc := range authConfig.GetAllowedServices() {
+		if svc == "" {
+			return errors.New("allowed_services contains an empty service")
+		}
+	}
+
+	// self access compares the requested user to the user token, which s2s only requests do not have
+	if authConfig.GetS2SOnlyAllowed() && authConfig.GetSelfAccessAllowed() {
+		return errors.New("s2s_only_allowed and self_access_allowed are mutually exclusive")
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"testing"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// TestServiceAuthConfigs checks every service in the api declares a valid auth_config on
+// every method, so a misconfigured rpc fails the build rather than the service's startup.
+func TestServiceAuthConfigs(t *testing.T) {
+
+	// the service names the api's allowed_services use
+	subjects := ServiceSubjects{"identity": {"shaw": true}}
+
+	files := []protoreflect.FileDescriptor{
+		api.File_address_proto,
+		api.File_admin_proto,
+		api.File_phone_proto,
+		api.File_profile_proto,
+		api.File_revocation_proto,
+	}
+
+	for _, file := range files {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			if err := validateService(services.Get(i), subjects); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	// a method restricted to a service no subject maps to could never be called
+	services := api.File_profile_proto.Services()
+	for i := 0; i < services.Len(); i++ {
+		if err := validateService(services.Get(i), ServiceSubjects{}); err == nil {
+			t.Errorf("expected unmapped allowed services of %s to be rejected", services.Get(i).FullName())
+		}
+	}
+}
+
+func TestValidateAuthConfig(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  *api.AuthConfig
+		wantErr bool
+	}{
+		{"valid", &api.AuthConfig{RequiredScopes: []string{"w:silhouette:address:*"}, SelfAccessAllowed: true}, false},
+		{"valid s2s only", &api.AuthConfig{RequiredScopes: []string{"w:silhouette:s2s:profile:*"}, S2SOnlyAllowed: true}, false},
+		{"no scopes", &api.AuthConfig{SelfAccessAllowed: true}, true},
+		{"empty scope", &api.AuthConfig{RequiredScopes: []string{"w:silhouette:address:*", ""}}, true},
+		{"empty allowed service", &api.AuthConfig{RequiredScopes: []string{"w:silhouette:s2s:profile:*"}, S2SOnlyAllowed: true, AllowedServices: []string{"identity", ""}}, true},
+		{"s2s only with self access", &api.AuthConfig{RequiredScopes: []string{"w:silhouette:s2s:profile:*"}, S2SOnlyAllowed: true, SelfAccessAllowed: true}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateAuthConfig(tc.config); (err != nil) != tc.wantErr {
+				t.Errorf("validateAuthConfig() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -11,12 +11,15 @@ import (
 
 	"github.com/tdeslauriers/carapace/pkg/jwt"
 	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth/internal/authctx"
 	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/keyring"
+	"github.com/tdeslauriers/silhouette/internal/storage"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 )
@@ -27,10 +30,24 @@ type AuthInterceptor interface {
 }
 
 // NewAuthInterceptor creates a new instance of AuthInterceptor.
-func NewAuthInterceptor(s2s, iam jwt.Verifier) AuthInterceptor {
+// If certBindings is empty, service tokens are not bound to the client certificate.
+// If notifier is nil, users are not notified when an actor acts for them.
+func NewAuthInterceptor(
+	s2s, iam keyring.Keyring,
+	revocations Revocations,
+	certBindings CertBindings,
+	serviceSubjects ServiceSubjects,
+	notifier ImpersonationNotifier,
+	emergencyGrants EmergencyGrants,
+) AuthInterceptor {
 	return &authInterceptor{
-		s2s: s2s,
-		iam: iam,
+		s2s:             s2s,
+		iam:             iam,
+		revocations:     revocations,
+		certBindings:    certBindings,
+		serviceSubjects: serviceSubjects,
+		notifier:        notifier,
+		emergencyGrants: emergencyGrants,
 
 		logger: slog.Default().
 			With(slog.String(definitions.PackageKey, definitions.PackageAuth)).
@@ -41,8 +58,15 @@ func NewAuthInterceptor(s2s, iam jwt.Verifier) AuthInterceptor {
 // AuthInterceptor is the concrete implementation of the AuthInterceptor interface,
 // a gRPC server interceptor for handling authentication and authorization.
 type authInterceptor struct {
-	s2s jwt.Verifier
-	iam jwt.Verifier
+	s2s          keyring.Keyring
+	iam          keyring.Keyring
+	revocations  Revocations
+	certBindings CertBindings
+	notifier     ImpersonationNotifier
+
+	serviceSubjects ServiceSubjects
+
+	emergencyGrants EmergencyGrants
 
 	logger *slog.Logger
 }
@@ -76,13 +100,36 @@ func (a *authInterceptor) Unary() grpc.UnaryServerInterceptor {
 			return nil, status.Error(codes.Unauthenticated, "missing service-authorization header")
 		}
 
-		// dont need to check for self-access-allowed, so can use BuildAuthorized from carapace
-		authedSvc, err := a.s2s.BuildAuthorized(authConfig.RequiredScopes, svcToken[0])
+		// dont need to check for self-access-allowed, so can use BuildAuthorized from carapace.
+		// BuildAuthorized matches scopes literally, so it is given the token's own scopes which
+		// cover the required scopes, and it verifies the token holds one of them.
+		authedSvc, svcKeyId, err := a.s2s.BuildAuthorizedKey(svcAllowedScopes(authConfig, svcToken[0]), svcToken[0])
 		if err != nil {
 			a.logger.Error("failed to authorize service token", "err", err.Error())
 			return nil, status.Error(codes.Unauthenticated, "unauthorized")
 		}
 
+		// check the service token has not been revoked
+		if err := a.revocations.CheckTokenIds(ctx, authedSvc.Claims.Jti, sessionId(svcToken[0])); err != nil {
+			return nil, a.revocationError(fmt.Sprintf("service token for %s", authedSvc.Claims.Subject), err)
+		}
+
+		// check the service token was presented by the service it was issued to,
+		// so a stolen token cannot be replayed from another client with a valid certificate
+		if err := a.checkCertBinding(ctx, authedSvc.Claims.Subject); err != nil {
+			return nil, err
+		}
+
+		// check the calling service is allowed to call the method, if the method restricts its callers
+		if !isAllowedService(a.serviceSubjects, authConfig.AllowedServices, authedSvc.Claims.Subject) {
+			a.logger.Error(fmt.Sprintf("service %s is not allowed to call %s", authedSvc.Claims.Subject, info.FullMethod),
+				"audit", "service_not_allowed",
+				"requesting_service", authedSvc.Claims.Subject,
+				"method", info.FullMethod,
+			)
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		}
+
 		// get the access token from the metadata/headers
 		accessToken := md.Get("authorization")
 
@@ -100,6 +147,16 @@ func (a *authInterceptor) Unary() grpc.UnaryServerInterceptor {
 				return nil, status.Error(codes.Unauthenticated, "unauthorized")
 			}
 
+			// acting for a user requires the actor's user token
+			if len(md.Get(ActAsHeader)) > 0 {
+				a.logger.Error(fmt.Sprintf("service %s sent an act-as header without an access token", authedSvc.Claims.Subject),
+					"audit", "impersonation",
+					"requesting_service", authedSvc.Claims.Subject,
+					"method", info.FullMethod,
+				)
+				return nil, status.Error(codes.Unauthenticated, "unauthorized")
+			}
+
 			// add the required scopes, authorized user, and service to the context for
 			// downstream handlers to access and and determin authorization
 			ctx = withAuthContext(ctx, &AuthContext{
@@ -107,6 +164,8 @@ func (a *authInterceptor) Unary() grpc.UnaryServerInterceptor {
 				UserClaims:        nil, // no user claims for service-only requests
 				SvcClaims:         &authedSvc.Claims,
 				SelfAccessAllowed: authConfig.SelfAccessAllowed,
+				ExactScopeMatch:   authConfig.ExactScopeMatch,
+				SvcKeyId:          svcKeyId,
 			})
 
 			return handler(ctx, req)
@@ -121,7 +180,8 @@ func (a *authInterceptor) Unary() grpc.UnaryServerInterceptor {
 		}
 
 		// verify signature
-		if err := a.iam.VerifySignature(userJot.BaseString, userJot.Signature); err != nil {
+		userKeyId, err := a.iam.VerifySignatureKey(userJot.BaseString, userJot.Signature)
+		if err != nil {
 			a.logger.Error("failed to verify access token signature", "err", err.Error())
 			return nil, status.Error(codes.Unauthenticated, "unauthorized")
 		}
@@ -154,19 +214,108 @@ func (a *authInterceptor) Unary() grpc.UnaryServerInterceptor {
 			return nil, status.Error(codes.PermissionDenied, "forbidden")
 		}
 
+		// check the access token has not been revoked, by id or by the user's revoked-after time
+		if err := a.revocations.CheckTokenIds(ctx, userJot.Claims.Jti, sessionId(trimmed)); err != nil {
+			return nil, a.revocationError(fmt.Sprintf("access token for %s", userJot.Claims.Subject), err)
+		}
+
+		if err := a.revocations.CheckUser(ctx, userJot.Claims.Subject, time.Unix(userJot.Claims.IssuedAt, 0)); err != nil {
+			return nil, a.revocationError(fmt.Sprintf("access token for %s", userJot.Claims.Subject), err)
+		}
+
+		// check if the user is acting for another user, and if they may
+		impersonation, err := a.impersonation(md, &userJot.Claims, authConfig, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
 		// add the required scopes, authorized user, and service to the context for
 		// downstream handlers to access and and determin authorization
-		ctx = withAuthContext(ctx, &AuthContext{
+		authCtx := &AuthContext{
 			RequiredScopes:    authConfig.RequiredScopes,
 			UserClaims:        &userJot.Claims,
 			SvcClaims:         &authedSvc.Claims,
 			SelfAccessAllowed: authConfig.SelfAccessAllowed,
-		})
+			ExactScopeMatch:   authConfig.ExactScopeMatch,
+			SvcKeyId:          svcKeyId,
+			UserKeyId:         userKeyId,
+			Impersonation:     impersonation,
+		}
+
+		// a break-glass grant is looked up by AuthorizeRequest, and only if neither the user's scopes
+		// nor self access authorize the request.  A grant is never combined with impersonation.
+		if impersonation == nil && coveredByEmergencyAccess(authConfig.RequiredScopes, authConfig.ExactScopeMatch) {
+			authCtx.lookupEmergencyGrant = func() *storage.EmergencyGrant {
+
+				// a failed lookup denies the grant, not the request, which has already been denied otherwise
+				grant, err := a.emergencyGrants.Active(ctx, userJot.Claims.Subject)
+				if err != nil {
+					a.logger.Error(fmt.Sprintf("failed to look up emergency access grant for %s", userJot.Claims.Subject), "err", err.Error())
+					return nil
+				}
+				return grant
+			}
+		}
+
+		// the user acted for is only notified once the handler has authorized the request for them
+		if impersonation != nil && a.notifier != nil {
+			authCtx.notifyImpersonation = func() { a.notifier.Notify(impersonation, info.FullMethod) }
+		}
 
-		return handler(ctx, req)
+		return handler(withAuthContext(ctx, authCtx), req)
 	}
 }
 
+// checkCertBinding is a helper function which checks the client certificate of the request is bound to
+// the service token subject.  Mismatches are audited.  The check is skipped if no bindings are configured.
+func (a *authInterceptor) checkCertBinding(ctx context.Context, subject string) error {
+
+	if len(a.certBindings) == 0 {
+		return nil
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+
+	cert, err := peerCertificate(ctx)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("failed to bind service token for %s to client certificate", subject),
+			"audit", "cert_binding_denied",
+			"requesting_service", subject,
+			"peer_addr", addr,
+			"err", err.Error(),
+		)
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	if !a.certBindings.Bound(cert, subject) {
+		a.logger.Error(fmt.Sprintf("service token for %s presented with a client certificate not bound to it", subject),
+			"audit", "cert_binding_denied",
+			"requesting_service", subject,
+			"peer_addr", addr,
+			"peer_identities", strings.Join(certIdentities(cert), ","),
+		)
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	return nil
+}
+
+// revocationError is a helper function which logs a failed revocation check and returns its status:
+// a revoked token is unauthenticated, and a failed lookup is an internal error since the token cannot be trusted.
+func (a *authInterceptor) revocationError(token string, err error) error {
+
+	if errors.Is(err, ErrTokenRevoked) {
+		a.logger.Error(fmt.Sprintf("%s has been revoked", token))
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	a.logger.Error(fmt.Sprintf("failed to check revocation of %s", token), "err", err.Error())
+	return status.Error(codes.Internal, "failed to check token revocation")
+}
+
 // getAuthConfig is a helper function which returns the authentication configuration for the calling gRPC method.
 func (a *authInterceptor) getAuthConfig(fullMethod string) (*api.AuthConfig, error) {
 
@@ -190,22 +339,28 @@ func (a *authInterceptor) getAuthConfig(fullMethod string) (*api.AuthConfig, err
 		return nil, fmt.Errorf("method %s not found in service %s", methodName, svcName)
 	}
 
-	// get the authentication configuration from the method options
-	opts := methodDesc.Options()
-	if opts == nil {
-		return nil, fmt.Errorf("no authentication configuration found for method %s in service %s", methodName, svcName)
+	// get the authentication configuration from the method options.
+	// Every registered method is checked at startup by ValidateAuthConfigs, so this should not fail.
+	return methodAuthConfig(methodDesc)
+}
+
+// svcAllowedScopes is a helper function which returns the scopes of a service token which cover the method's
+// required scopes, for carapace's literal scope check.  The token is not trusted here, it is only read:
+// its signature is verified by BuildAuthorized.  If the token cannot be read or has no covering scope,
+// the required scopes are returned so BuildAuthorized rejects the token with the appropriate error.
+func svcAllowedScopes(authConfig *api.AuthConfig, token string) []string {
+
+	jot, err := jwt.BuildTokenFromRaw(strings.TrimPrefix(strings.TrimSpace(token), "Bearer "))
+	if err != nil {
+		return authConfig.RequiredScopes
 	}
 
-	// get the extension/additional method options -> extenion field
-	if proto.HasExtension(opts, api.E_AuthConfig) {
-		ext := proto.GetExtension(opts, api.E_AuthConfig)
-		if authConfig, ok := ext.(*api.AuthConfig); ok {
-			return authConfig, nil
-		}
-		return nil, fmt.Errorf("failed to cast extension to AuthConfig for method %s in service %s", methodName, svcName)
+	covering := coveringScopes(authConfig.RequiredScopes, jot.Claims.MapScopes(), authConfig.ExactScopeMatch)
+	if len(covering) == 0 {
+		return authConfig.RequiredScopes
 	}
 
-	return nil, fmt.Errorf("no authentication configuration extension found for method %s in service %s", methodName, svcName)
+	return covering
 }
 
 // parseFullMethod is a helper function which parses the full gRPC method string into service and method components.
@@ -228,50 +383,118 @@ func (a *authInterceptor) parseFullMethod(fullMethod string) (service, method st
 	return service, method
 }
 
+// isAllowedService checks if a calling service's subject maps to one of the method's allowed services,
+// or the method allows any service.
+func isAllowedService(subjects ServiceSubjects, allowedServices []string, subject string) bool {
+
+	if len(allowedServices) == 0 {
+		return true
+	}
+
+	for _, allowed := range allowedServices {
+		if subjects[allowed][subject] {
+			return true
+		}
+	}
+
+	return false
+}
+
 // hasRequiredAudience checks if the user has the required audience to access the resource
 func hasRequiredAudience(requiredAudience string, userAudience map[string]bool) bool {
 
 	return userAudience[requiredAudience]
 }
 
-// HasRequiredScopes checks if the user any one of the required scopes to access the resource
-func hasRequiredScopes(requiredScopes []string, userScopes map[string]bool) bool {
+// HasRequiredScopes checks if the user has a scope covering any one of the required scopes to access the resource.
+// Wildcard scopes cover the scopes beneath them, eg, "w:silhouette:*" covers "w:silhouette:address:*",
+// unless exact is set, in which case a required scope must be granted literally.
+func hasRequiredScopes(requiredScopes []string, userScopes map[string]bool, exact bool) bool {
 
-	// check if the user has any one of the required scopes
-	// return true on first match
+	// check for a literal match first since it is a map lookup
+	// return true on first match.  An empty scope, eg, from a token with
+	// no scopes claim, is never a match.
 	for _, scope := range requiredScopes {
-		if userScopes[scope] {
+		if scope != "" && userScopes[scope] {
 			return true
 		}
 	}
 
+	if exact {
+		return false
+	}
+
+	// check if any granted wildcard covers a required scope
+	for granted := range userScopes {
+		for _, required := range requiredScopes {
+			if scopeCovers(granted, required) {
+				return true
+			}
+		}
+	}
+
 	return false
 }
 
 // AuthContext holds authentication and authorization information for a request
 type AuthContext struct {
-	RequiredScopes    []string    // required scopes for the called method
-	SvcClaims         *jwt.Claims // jwt claims for service tokens
-	UserClaims        *jwt.Claims // jwt claims for user tokens
-	SelfAccessAllowed bool        // indicates if the user is allowed to access their own resources
-	S2sOnlyAllowed    bool        // indicates if service-only access is allowed (no user context required)
+	RequiredScopes    []string                // required scopes for the called method
+	SvcClaims         *jwt.Claims             // jwt claims for service tokens
+	UserClaims        *jwt.Claims             // jwt claims for user tokens
+	SelfAccessAllowed bool                    // indicates if the user is allowed to access their own resources
+	S2sOnlyAllowed    bool                    // indicates if service-only access is allowed (no user context required)
+	ExactScopeMatch   bool                    // indicates if required scopes must be granted literally, ie, wildcards do not cover them
+	SvcKeyId          string                  // id of the key which verified the service token, empty for a single configured key
+	UserKeyId         string                  // id of the key which verified the user token, empty for a single configured key
+	Impersonation     *Impersonation          // the real actor and the user they are acting for, nil if not impersonating
+	EmergencyGrant    *storage.EmergencyGrant // the user's break-glass grant, looked up only if nothing else authorizes the request
+
+	notifyImpersonation  func()                         // notifies the user acted for, called by AuthorizeRequest once it allows the impersonation
+	lookupEmergencyGrant func() *storage.EmergencyGrant // looks up EmergencyGrant, nil if a grant could not authorize the method
 }
 
-// contextKey is a private type to prevent collisions with other packages
-type contextKey string
+// AuditFields returns the actors of a request for the audit log: the requesting service, the user, and,
+// if the user is acting for another user, that user and the reason.  The ids of the keys which verified
+// the tokens are included when a keyring is configured, so a rollover can be traced request by request.
+func (a *AuthContext) AuditFields() []any {
 
-const authContextKey contextKey = "auth-context"
+	var fields []any
+	if a.UserClaims != nil {
+		fields = append(fields, "actor", a.UserClaims.Subject)
+	}
+
+	if a.SvcClaims != nil {
+		fields = append(fields, "requesting_service", a.SvcClaims.Subject)
+	}
+
+	if a.SvcKeyId != "" {
+		fields = append(fields, "service_key_id", a.SvcKeyId)
+	}
+
+	if a.UserKeyId != "" {
+		fields = append(fields, "user_key_id", a.UserKeyId)
+	}
+
+	if a.Impersonation != nil {
+		fields = append(fields,
+			"on_behalf_of", a.Impersonation.Target,
+			"impersonation_reason", a.Impersonation.Reason,
+		)
+	}
+
+	return fields
+}
 
 // withAuthContext adds the AuthContext to the context
 func withAuthContext(ctx context.Context, authCtx *AuthContext) context.Context {
 
-	return context.WithValue(ctx, authContextKey, authCtx)
+	return context.WithValue(ctx, authctx.Key, authCtx)
 }
 
 // getAuthContext retrieves the AuthContext from the context
 func GetAuthContext(ctx context.Context) (*AuthContext, error) {
 
-	authCtx, ok := ctx.Value(authContextKey).(*AuthContext)
+	authCtx, ok := ctx.Value(authctx.Key).(*AuthContext)
 	if !ok {
 		return nil, fmt.Errorf("auth-context does not exist in context")
 	}
@@ -284,17 +507,59 @@ func GetAuthContext(ctx context.Context) (*AuthContext, error) {
 // This impl will also check if the request params include a "username" field and if so,
 // will check if the username in the request matches the authorized user's username in the
 // token claims when self-access is allowed and no other scopes are present.
+// When the user is acting for another user, only self access is checked, against the user acted for:
+// the actor's own scopes do not apply, so impersonation cannot reach beyond the target's own resources.
+// If neither the user's scopes nor self access authorize the request, an unexpired break-glass grant
+// may, and every such use is audited.
 func AuthorizeRequest(auth *AuthContext, requestedUsername string) error {
 
+	if auth.Impersonation != nil {
+		if !auth.SelfAccessAllowed {
+			return errors.New("impersonation is only allowed for self access")
+		}
+
+		requestedUsername = strings.TrimSpace(requestedUsername)
+		if !isSafeForComparison(requestedUsername) {
+			return errors.New("requested username is not valid/safe for comparison")
+		}
+
+		if !strings.EqualFold(auth.Impersonation.Target, requestedUsername) {
+			return errors.New("for impersonation, requested username does not match the user acted for")
+		}
+
+		if auth.notifyImpersonation != nil {
+			auth.notifyImpersonation()
+		}
+
+		return nil
+	}
+
 	userScopes := auth.UserClaims.MapScopes()
 
 	// check if user has any of the required scopes
 	if len(userScopes) > 0 {
-		if hasRequiredScopes(auth.RequiredScopes, userScopes) {
+		if hasRequiredScopes(auth.RequiredScopes, userScopes, auth.ExactScopeMatch) {
+			return nil
+		}
+	}
+
+	if err := authorizeSelfAccess(auth, requestedUsername); err != nil {
+
+		// fall back to a break-glass grant last, so its use is only audited when nothing else authorizes the request
+		if hasEmergencyAccess(auth) {
+			auditEmergencyAccess(auth, requestedUsername)
 			return nil
 		}
+
+		return err
 	}
 
+	return nil
+}
+
+// authorizeSelfAccess checks if self access is allowed and the requested username is the authorized user's.
+func authorizeSelfAccess(auth *AuthContext, requestedUsername string) error {
+
 	// if user does not have required scopes, check if self access is allowed and
 	// deny access if it is not allowed
 	if !auth.SelfAccessAllowed {
@@ -317,6 +582,22 @@ func AuthorizeRequest(auth *AuthContext, requestedUsername string) error {
 	return nil
 }
 
+// hasEmergencyAccess checks if the user has an unexpired break-glass grant which covers the required scopes.
+// The grant is looked up on the first call, so requests authorized otherwise never query it.
+func hasEmergencyAccess(auth *AuthContext) bool {
+
+	if auth.EmergencyGrant == nil && auth.lookupEmergencyGrant != nil {
+		auth.EmergencyGrant = auth.lookupEmergencyGrant()
+		auth.lookupEmergencyGrant = nil
+	}
+
+	if auth.EmergencyGrant == nil || !time.Now().Before(auth.EmergencyGrant.ExpiresAt) {
+		return false
+	}
+
+	return coveredByEmergencyAccess(auth.RequiredScopes, auth.ExactScopeMatch)
+}
+
 // isSafeForComparison checks if a string is safe for comparison in authorization checks, such as
 // usernames or other lookup/upsert parameter fields.
 func isSafeForComparison(s string) bool {
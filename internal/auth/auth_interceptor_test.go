@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+func TestAuditFields(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		authCtx *AuthContext
+		want    []any
+	}{
+		{
+			name:    "service only, single configured key",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "shaw"}},
+			want:    []any{"requesting_service", "shaw"},
+		},
+		{
+			name: "user and service verified by a keyring",
+			authCtx: &AuthContext{
+				SvcClaims:  &jwt.Claims{Subject: "gateway"},
+				UserClaims: &jwt.Claims{Subject: "user@example.com"},
+				SvcKeyId:   "s2s-2026-10",
+				UserKeyId:  "iam-2026-09",
+			},
+			want: []any{"actor", "user@example.com", "requesting_service", "gateway", "service_key_id", "s2s-2026-10", "user_key_id", "iam-2026-09"},
+		},
+		{
+			name: "impersonating",
+			authCtx: &AuthContext{
+				SvcClaims:     &jwt.Claims{Subject: "gateway"},
+				UserClaims:    &jwt.Claims{Subject: "admin@example.com"},
+				UserKeyId:     "iam-2026-09",
+				Impersonation: &Impersonation{Actor: "admin@example.com", Target: "user@example.com", Reason: "ticket 42"},
+			},
+			want: []any{"actor", "admin@example.com", "requesting_service", "gateway", "user_key_id", "iam-2026-09", "on_behalf_of", "user@example.com", "impersonation_reason", "ticket 42"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.authCtx.AuditFields(); !slices.Equal(got, tc.want) {
+				t.Errorf("AuditFields() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsAllowedService(t *testing.T) {
+
+	subjects := ServiceSubjects{
+		"identity": {"shaw": true, "shaw-next": true},
+		"gateway":  {"gateway": true},
+	}
+
+	tests := []struct {
+		name            string
+		allowedServices []string
+		subject         string
+		want            bool
+	}{
+		{"no allowed services allows any service", nil, "gateway", true},
+		{"empty allowed services allows any service", []string{}, "anyone", true},
+		{"allowed", []string{"identity"}, "shaw", true},
+		{"any subject of the service allowed", []string{"identity"}, "shaw-next", true},
+		{"one of several services allowed", []string{"identity", "gateway"}, "gateway", true},
+		{"disallowed", []string{"identity"}, "gateway", false},
+		{"service name is not a subject", []string{"identity"}, "identity", false},
+		{"unmapped service allows no one", []string{"billing"}, "billing", false},
+		{"empty subject", []string{"identity"}, "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isAllowedService(subjects, tc.allowedServices, tc.subject); got != tc.want {
+				t.Errorf("isAllowedService(%v, %q) = %v, want %v", tc.allowedServices, tc.subject, got, tc.want)
+			}
+		})
+	}
+
+	// without any mapping, a restricted method allows no one
+	if isAllowedService(nil, []string{"identity"}, "shaw") {
+		t.Error("expected no service to be allowed without service subjects")
+	}
+}
@@ -0,0 +1,16 @@
+// Package authtest builds request contexts for tests of handlers which read the auth.AuthContext.
+// It must only be imported by tests: production requests get their AuthContext from the auth interceptor.
+package authtest
+
+import (
+	"context"
+
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/auth/internal/authctx"
+)
+
+// NewContext adds the AuthContext to the context, as the auth interceptor would for an authorized request.
+func NewContext(ctx context.Context, authCtx *auth.AuthContext) context.Context {
+
+	return context.WithValue(ctx, authctx.Key, authCtx)
+}
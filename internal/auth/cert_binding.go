@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// CertBindings maps the identities of client certificates, ie, their DNS and URI SANs and CN,
+// to the service token subjects a client presenting that certificate may use.
+// An empty CertBindings disables the check, which the server only allows when binding is explicitly disabled.
+type CertBindings map[string]map[string]bool
+
+// ParseCertBindings parses a comma separated list of certificate identity to service subject pairs,
+// eg, "identity.svc.cluster.local=identity,spiffe://home/gateway=gateway".  A certificate identity
+// may be bound to several subjects, and a subject to several identities, by repeating them.
+// A pair listed twice is rejected, since it is most likely a mistyped binding.
+func ParseCertBindings(s string) (CertBindings, error) {
+
+	bindings, err := parsePairs(s, "<certificate identity>=<service subject>")
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate binding: %v", err)
+	}
+
+	return bindings, nil
+}
+
+// Bound reports whether any of a certificate's identities is bound to a service subject.
+func (b CertBindings) Bound(cert *x509.Certificate, subject string) bool {
+
+	for _, identity := range certIdentities(cert) {
+		if b[identity][subject] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// certIdentities returns the identities of a certificate a binding may name: its DNS and URI SANs, and its CN.
+func certIdentities(cert *x509.Certificate) []string {
+
+	identities := make([]string, 0, len(cert.DNSNames)+len(cert.URIs)+1)
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+
+	return identities
+}
+
+// peerCertificate returns the verified leaf certificate the client presented in the mutual tls handshake.
+func peerCertificate(ctx context.Context) (*x509.Certificate, error) {
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("no peer in context")
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, errors.New("peer did not connect over tls")
+	}
+
+	// only trust a certificate which chains to the configured ca
+	if len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, errors.New("peer presented no verified client certificate")
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0], nil
+}
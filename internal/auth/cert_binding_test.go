@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func TestParseCertBindings(t *testing.T) {
+
+	testCases := []struct {
+		name    string
+		in      string
+		want    CertBindings
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: CertBindings{},
+		},
+		{
+			name: "single pair",
+			in:   "identity.svc.cluster.local=identity",
+			want: CertBindings{"identity.svc.cluster.local": {"identity": true}},
+		},
+		{
+			name: "spaces and empty entries ignored",
+			in:   " identity.svc.cluster.local = identity , ,gateway=gateway,",
+			want: CertBindings{
+				"identity.svc.cluster.local": {"identity": true},
+				"gateway":                    {"gateway": true},
+			},
+		},
+		{
+			name: "identity bound to several subjects",
+			in:   "gateway=gateway,gateway=shaw",
+			want: CertBindings{"gateway": {"gateway": true, "shaw": true}},
+		},
+		{
+			name: "uri san split on the last equals sign",
+			in:   "spiffe://home/gateway?env=prod=gateway",
+			want: CertBindings{"spiffe://home/gateway?env=prod": {"gateway": true}},
+		},
+		{
+			name:    "missing separator",
+			in:      "identity.svc.cluster.local",
+			wantErr: true,
+		},
+		{
+			name:    "missing identity",
+			in:      "=identity",
+			wantErr: true,
+		},
+		{
+			name:    "missing subject",
+			in:      "identity.svc.cluster.local=",
+			wantErr: true,
+		},
+		{
+			name:    "blank subject",
+			in:      "identity.svc.cluster.local= ",
+			wantErr: true,
+		},
+		{
+			name:    "malformed entry after a valid one",
+			in:      "gateway=gateway,shaw",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate pair",
+			in:      "gateway=gateway,gateway=gateway",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate pair differing only in spaces",
+			in:      "gateway=gateway, gateway = gateway",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseCertBindings(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseCertBindings(%q) = %v, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCertBindings(%q) error: %v", tc.in, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseCertBindings(%q) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCertBindingsBound(t *testing.T) {
+
+	bindings := CertBindings{
+		"identity.svc.cluster.local": {"identity": true},
+		"spiffe://home/gateway":      {"gateway": true},
+		"shaw":                       {"shaw": true},
+	}
+
+	spiffe, err := url.Parse("spiffe://home/gateway")
+	if err != nil {
+		t.Fatalf("failed to parse uri: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		cert    *x509.Certificate
+		subject string
+		want    bool
+	}{
+		{
+			name:    "dns san bound",
+			cert:    &x509.Certificate{DNSNames: []string{"other.svc.cluster.local", "identity.svc.cluster.local"}},
+			subject: "identity",
+			want:    true,
+		},
+		{
+			name:    "uri san bound",
+			cert:    &x509.Certificate{URIs: []*url.URL{spiffe}},
+			subject: "gateway",
+			want:    true,
+		},
+		{
+			name:    "cn bound",
+			cert:    &x509.Certificate{Subject: pkix.Name{CommonName: "shaw"}},
+			subject: "shaw",
+			want:    true,
+		},
+		{
+			name: "cn bound alongside unbound sans",
+			cert: &x509.Certificate{
+				DNSNames: []string{"shaw.svc.cluster.local"},
+				Subject:  pkix.Name{CommonName: "shaw"},
+			},
+			subject: "shaw",
+			want:    true,
+		},
+		{
+			name:    "identity bound to another subject",
+			cert:    &x509.Certificate{DNSNames: []string{"identity.svc.cluster.local"}},
+			subject: "gateway",
+			want:    false,
+		},
+		{
+			name:    "unknown identity",
+			cert:    &x509.Certificate{DNSNames: []string{"attacker.svc.cluster.local"}, Subject: pkix.Name{CommonName: "attacker"}},
+			subject: "identity",
+			want:    false,
+		},
+		{
+			name:    "subject named only in the organization",
+			cert:    &x509.Certificate{Subject: pkix.Name{Organization: []string{"shaw"}}},
+			subject: "shaw",
+			want:    false,
+		},
+		{
+			name:    "no identities",
+			cert:    &x509.Certificate{},
+			subject: "identity",
+			want:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := bindings.Bound(tc.cert, tc.subject); got != tc.want {
+				t.Errorf("Bound(%v, %q) = %v, want %v", certIdentities(tc.cert), tc.subject, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPeerCertificate(t *testing.T) {
+
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "identity"}}
+	ca := &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}}
+
+	tlsPeer := func(state tls.ConnectionState) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	}
+
+	testCases := []struct {
+		name    string
+		ctx     context.Context
+		want    *x509.Certificate
+		wantErr bool
+	}{
+		{
+			name: "verified chain",
+			ctx:  tlsPeer(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf, ca}}}),
+			want: leaf,
+		},
+		{
+			name:    "no peer",
+			ctx:     context.Background(),
+			wantErr: true,
+		},
+		{
+			name:    "not tls",
+			ctx:     peer.NewContext(context.Background(), &peer.Peer{}),
+			wantErr: true,
+		},
+		{
+			name:    "no verified chains",
+			ctx:     tlsPeer(tls.ConnectionState{}),
+			wantErr: true,
+		},
+		{
+			name:    "presented but unverified certificate",
+			ctx:     tlsPeer(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}),
+			wantErr: true,
+		},
+		{
+			name:    "empty verified chain",
+			ctx:     tlsPeer(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := peerCertificate(tc.ctx)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("peerCertificate() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("peerCertificate() error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("peerCertificate() = %v, want the leaf certificate", got.Subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+// EmergencyAccessScopes are the scopes a break-glass grant stands in for: read access to every profile,
+// and their addresses and phones.  They never cover s2s or exact match methods, or any write.
+var EmergencyAccessScopes = []string{
+	"r:silhouette:profile:*",
+	"r:silhouette:address:*",
+	"r:silhouette:phone:*",
+	"r:silhouette:admin:*",
+}
+
+// emergencyAccessScopes is EmergencyAccessScopes as a set, for hasRequiredScopes.
+var emergencyAccessScopes = func() map[string]bool {
+	scopes := make(map[string]bool, len(EmergencyAccessScopes))
+	for _, scope := range EmergencyAccessScopes {
+		scopes[scope] = true
+	}
+	return scopes
+}()
+
+// coveredByEmergencyAccess checks if a break-glass grant would authorize a method's required scopes.
+func coveredByEmergencyAccess(requiredScopes []string, exact bool) bool {
+	return hasRequiredScopes(requiredScopes, emergencyAccessScopes, exact)
+}
+
+// EmergencyGrants looks up and creates break-glass grants.
+// An operator's grant is honored at once on the replica which made it, and within the cache ttl on the others.
+// Its expiry is checked on every use, so caching never extends it.
+type EmergencyGrants interface {
+
+	// Grant persists a new grant, setting its id.
+	Grant(ctx context.Context, grant *storage.EmergencyGrant) error
+
+	// Active returns an operator's unexpired grant, or nil if they have none.
+	Active(ctx context.Context, operator string) (*storage.EmergencyGrant, error)
+}
+
+// NewEmergencyGrants creates a new instance of EmergencyGrants, returning a pointer to the concrete implementation.
+func NewEmergencyGrants(store storage.EmergencyAccessStore, ttl time.Duration) EmergencyGrants {
+	return &emergencyGrants{
+		store:  store,
+		grants: newTtlCache[*storage.EmergencyGrant](ttl),
+		now:    time.Now,
+	}
+}
+
+var _ EmergencyGrants = (*emergencyGrants)(nil)
+
+// emergencyGrants is the concrete implementation of the EmergencyGrants interface.
+type emergencyGrants struct {
+	store storage.EmergencyAccessStore
+
+	grants *ttlCache[*storage.EmergencyGrant] // each operator's grant, which is nil if they had none
+
+	now func() time.Time
+}
+
+// Grant persists the grant, then caches it if it lasts longer than the operator's cached grant.
+func (g *emergencyGrants) Grant(ctx context.Context, grant *storage.EmergencyGrant) error {
+
+	if err := g.store.SaveGrant(ctx, grant); err != nil {
+		return err
+	}
+
+	now := g.now()
+	cached, ok := g.grants.get(grant.Operator, now)
+	if !ok || cached == nil || grant.ExpiresAt.After(cached.ExpiresAt) {
+		g.grants.set(grant.Operator, grant, now)
+	}
+
+	return nil
+}
+
+// Active returns the operator's cached grant, looking it up if it is not cached.
+func (g *emergencyGrants) Active(ctx context.Context, operator string) (*storage.EmergencyGrant, error) {
+
+	now := g.now()
+
+	grant, ok := g.grants.get(operator, now)
+	if !ok {
+
+		var err error
+		grant, err = g.store.GetActiveGrant(ctx, operator)
+		if err != nil {
+			return nil, err
+		}
+
+		g.grants.set(operator, grant, now)
+	}
+
+	if grant == nil || !now.Before(grant.ExpiresAt) {
+		return nil, nil
+	}
+
+	return grant, nil
+}
+
+// auditEmergencyAccess logs a use of a break-glass grant.  It is logged as an error, not info, so it
+// stands out in the audit log and alerts on error rates catch it.
+func auditEmergencyAccess(auth *AuthContext, requestedUsername string) {
+
+	// the logger is built on use since AuthorizeRequest has none, and the default may change at startup
+	logger := slog.Default().
+		With(slog.String(definitions.PackageKey, definitions.PackageAuth)).
+		With(slog.String(definitions.ComponentKey, definitions.ComponentEmergencyAccess))
+
+	logger.Error(
+		fmt.Sprintf("break-glass emergency access used by %s", auth.UserClaims.Subject),
+		append(auth.AuditFields(),
+			"audit", "break_glass_access",
+			"grant_id", auth.EmergencyGrant.Id,
+			"justification", auth.EmergencyGrant.Justification,
+			"grant_expires_at", auth.EmergencyGrant.ExpiresAt.UTC().Format(time.RFC3339),
+			"required_scopes", auth.RequiredScopes,
+			"requested_username", requestedUsername,
+		)...,
+	)
+}
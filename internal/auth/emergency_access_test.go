@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+func TestAuthorizeRequestEmergencyAccess(t *testing.T) {
+
+	active := &storage.EmergencyGrant{Id: "grant", Operator: "operator@example.com", Justification: "incident 7", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &storage.EmergencyGrant{Id: "grant", Operator: "operator@example.com", Justification: "incident 7", ExpiresAt: time.Now().Add(-time.Second)}
+
+	tests := []struct {
+		name     string
+		required []string
+		self     bool
+		exact    bool
+		grant    *storage.EmergencyGrant
+		wantErr  bool
+	}{
+		{"no grant", []string{"r:silhouette:profile:*"}, true, false, nil, true},
+		{"read profile", []string{"r:silhouette:profile:*"}, true, false, active, false},
+		{"list profiles", []string{"r:silhouette:admin:*"}, false, false, active, false},
+		{"read address history", []string{"r:silhouette:address:*"}, true, false, active, false},
+		{"expired", []string{"r:silhouette:profile:*"}, true, false, expired, true},
+		{"write", []string{"w:silhouette:profile:*"}, true, false, active, true},
+		{"admin write", []string{"w:silhouette:admin:*"}, false, false, active, true},
+		{"s2s read", []string{"r:silhouette:s2s:profile:*"}, false, false, active, true},
+		{"exact match", []string{"r:silhouette:s2s:profile:find_by_phone"}, false, true, active, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			authCtx := &AuthContext{
+				RequiredScopes:    tc.required,
+				UserClaims:        &jwt.Claims{Subject: "operator@example.com"},
+				SvcClaims:         &jwt.Claims{Subject: "gateway"},
+				SelfAccessAllowed: tc.self,
+				ExactScopeMatch:   tc.exact,
+				EmergencyGrant:    tc.grant,
+			}
+
+			err := AuthorizeRequest(authCtx, "user@example.com")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("AuthorizeRequest() err = %v, want err %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// fakeEmergencyAccessStore is an in-memory storage.EmergencyAccessStore which counts lookups.
+type fakeEmergencyAccessStore struct {
+	grants  map[string]*storage.EmergencyGrant
+	lookups int
+}
+
+func (f *fakeEmergencyAccessStore) SaveGrant(ctx context.Context, grant *storage.EmergencyGrant) error {
+	grant.Id = "saved"
+	f.grants[grant.Operator] = grant
+	return nil
+}
+
+func (f *fakeEmergencyAccessStore) GetActiveGrant(ctx context.Context, operator string) (*storage.EmergencyGrant, error) {
+	f.lookups++
+	if grant, ok := f.grants[operator]; ok && time.Now().Before(grant.ExpiresAt) {
+		return grant, nil
+	}
+	return nil, nil
+}
+
+func TestEmergencyGrantsCache(t *testing.T) {
+
+	ctx := context.Background()
+	store := &fakeEmergencyAccessStore{grants: make(map[string]*storage.EmergencyGrant)}
+	grants := NewEmergencyGrants(store, time.Minute).(*emergencyGrants)
+
+	now := time.Now()
+	grants.now = func() time.Time { return now }
+
+	// a miss is cached too
+	for i := 0; i < 2; i++ {
+		if grant, err := grants.Active(ctx, "operator@example.com"); err != nil || grant != nil {
+			t.Fatalf("Active() = %v, %v, want no grant", grant, err)
+		}
+	}
+	if store.lookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", store.lookups)
+	}
+
+	// a grant made on this replica is honored at once
+	if err := grants.Grant(ctx, &storage.EmergencyGrant{Operator: "operator@example.com", ExpiresAt: now.Add(30 * time.Second)}); err != nil {
+		t.Fatalf("Grant() err = %v", err)
+	}
+	if grant, _ := grants.Active(ctx, "operator@example.com"); grant == nil || grant.Id != "saved" {
+		t.Fatalf("Active() = %v, want the new grant", grant)
+	}
+
+	// the grant expires when it says, even though its cache entry has not
+	now = now.Add(31 * time.Second)
+	if grant, _ := grants.Active(ctx, "operator@example.com"); grant != nil {
+		t.Errorf("Active() = %v, want the grant to have expired", grant)
+	}
+	if store.lookups != 1 {
+		t.Errorf("expected the cached entry to be used, got %d lookups", store.lookups)
+	}
+}
+
+func TestAuthorizeRequestLooksUpGrantLazily(t *testing.T) {
+
+	active := &storage.EmergencyGrant{Id: "grant", Operator: "operator@example.com", Justification: "incident 7", ExpiresAt: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		name        string
+		scopes      string
+		requested   string
+		wantLookups int
+		wantErr     bool
+	}{
+		{"authorized by scope", "r:silhouette:profile:*", "user@example.com", 0, false},
+		{"authorized by self access", "", "operator@example.com", 0, false},
+		{"authorized by the grant", "", "user@example.com", 1, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			var lookups int
+			authCtx := &AuthContext{
+				RequiredScopes:       []string{"r:silhouette:profile:*"},
+				UserClaims:           &jwt.Claims{Subject: "operator@example.com", Scopes: tc.scopes},
+				SelfAccessAllowed:    true,
+				lookupEmergencyGrant: func() *storage.EmergencyGrant { lookups++; return active },
+			}
+
+			if err := AuthorizeRequest(authCtx, tc.requested); (err != nil) != tc.wantErr {
+				t.Fatalf("AuthorizeRequest() err = %v, want err %v", err, tc.wantErr)
+			}
+
+			// a handler authorizing twice does not look the grant up again
+			_ = AuthorizeRequest(authCtx, tc.requested)
+			if lookups != tc.wantLookups {
+				t.Errorf("grant looked up %d times, want %d", lookups, tc.wantLookups)
+			}
+		})
+	}
+}
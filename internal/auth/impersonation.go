@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tdeslauriers/carapace/pkg/connect"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ActAsHeader is the metadata header naming the user an actor is acting for.
+	ActAsHeader = "act-as"
+
+	// ActAsReasonHeader is the metadata header giving the actor's reason for acting for the user.
+	ActAsReasonHeader = "act-as-reason"
+
+	// ImpersonateScope is the scope an actor's user token needs to act for another user.
+	// It must be granted literally: no wildcard covers it.
+	ImpersonateScope = "w:silhouette:admin:impersonate"
+
+	// maxReasonLength is the longest reason an actor may give.
+	maxReasonLength = 512
+
+	// notifyTimeout is how long a webhook has to accept an impersonation notice.
+	notifyTimeout = 10 * time.Second
+)
+
+// Impersonation records a real actor acting for a target user, eg, support staff fixing a user's address.
+type Impersonation struct {
+	Actor  string // the real actor, ie, the subject of the user token
+	Target string // the user the actor is acting for
+	Reason string // why the actor is acting for the user
+}
+
+// impersonation is a helper function which reads the act-as headers of a request, if any, and validates that the
+// actor may act for the target user on the method.  Every attempt, allowed or denied, is audited.
+// It returns nil if the request does not use act-as.
+func (a *authInterceptor) impersonation(md metadata.MD, userClaims *jwt.Claims, authConfig *api.AuthConfig, method string) (*Impersonation, error) {
+
+	actAs := md.Get(ActAsHeader)
+	if len(actAs) == 0 {
+		return nil, nil
+	}
+
+	log := a.logger.With(
+		"audit", "impersonation",
+		"actor", userClaims.Subject,
+		"on_behalf_of", strings.TrimSpace(actAs[0]),
+		"method", method,
+	)
+
+	if len(actAs) > 1 {
+		log.Error("impersonation denied: more than one act-as header")
+		return nil, status.Error(codes.InvalidArgument, "only one act-as header is allowed")
+	}
+
+	// the dedicated scope must be granted literally, so broad admin wildcards do not imply impersonation
+	if !hasRequiredScopes([]string{ImpersonateScope}, userClaims.MapScopes(), true) {
+		log.Error("impersonation denied: actor does not have the impersonation scope")
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	// impersonation is authorized as the target's own access, so only self access methods allow it
+	if !authConfig.SelfAccessAllowed {
+		log.Error("impersonation denied: method does not allow self access")
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	target := strings.TrimSpace(actAs[0])
+	if err := validate.ValidateEmail(target); err != nil {
+		log.Error("impersonation denied: invalid act-as username", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, "invalid act-as username")
+	}
+
+	if strings.EqualFold(target, userClaims.Subject) {
+		log.Error("impersonation denied: actor cannot act for themselves")
+		return nil, status.Error(codes.InvalidArgument, "act-as username must not be the actor")
+	}
+
+	var reason string
+	if reasons := md.Get(ActAsReasonHeader); len(reasons) == 1 {
+		reason = strings.TrimSpace(reasons[0])
+	}
+	// reasons are written to the audit log, so no control characters, eg, newlines forging log lines
+	if reason == "" || len(reason) > maxReasonLength || strings.ContainsFunc(reason, unicode.IsControl) {
+		log.Error("impersonation denied: missing or invalid reason")
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("a single act-as-reason of at most %d printable characters is required", maxReasonLength))
+	}
+
+	log.Warn(fmt.Sprintf("%s is acting for %s", userClaims.Subject, target), "impersonation_reason", reason)
+
+	return &Impersonation{
+		Actor:  userClaims.Subject,
+		Target: target,
+		Reason: reason,
+	}, nil
+}
+
+// ImpersonationNotifier tells a user that someone acted for them.
+type ImpersonationNotifier interface {
+
+	// Notify sends a notification of an impersonation without blocking the request.  Failures are logged.
+	// It is called once the request has been authorized for the user acted for, not when the headers are read.
+	Notify(impersonation *Impersonation, method string)
+}
+
+// NewWebhookNotifier creates an ImpersonationNotifier which posts each impersonation as json to an https webhook,
+// eg, of a notification service which emails the user, over the service's mutual tls client.
+// An actor acting for the same user repeatedly only notifies them once per window.
+func NewWebhookNotifier(url string, client connect.TlsClient, window time.Duration) ImpersonationNotifier {
+	return &webhookNotifier{
+		url:     url,
+		client:  client,
+		limiter: ratelimit.NewLimiter(1, window),
+
+		logger: slog.Default().
+			With(slog.String(definitions.PackageKey, definitions.PackageAuth)).
+			With(slog.String(definitions.ComponentKey, definitions.ComponentAuthInterceptor)),
+	}
+}
+
+var _ ImpersonationNotifier = (*webhookNotifier)(nil)
+
+// webhookNotifier is the concrete implementation of the ImpersonationNotifier interface.
+type webhookNotifier struct {
+	url     string
+	client  connect.TlsClient
+	limiter ratelimit.Limiter
+
+	logger *slog.Logger
+}
+
+// impersonationNotice is the json body posted to the webhook.
+type impersonationNotice struct {
+	Username string    `json:"username"`
+	Actor    string    `json:"actor"`
+	Reason   string    `json:"reason"`
+	Method   string    `json:"method"`
+	At       time.Time `json:"at"`
+}
+
+// Notify posts the impersonation to the webhook in the background.
+func (n *webhookNotifier) Notify(impersonation *Impersonation, method string) {
+
+	if !n.limiter.Allow(impersonation.Actor + "|" + impersonation.Target) {
+		return
+	}
+
+	body, err := json.Marshal(impersonationNotice{
+		Username: impersonation.Target,
+		Actor:    impersonation.Actor,
+		Reason:   impersonation.Reason,
+		Method:   method,
+		At:       time.Now().UTC(),
+	})
+	if err != nil {
+		n.logger.Error("failed to marshal impersonation notice", "err", err.Error())
+		return
+	}
+
+	go func() {
+
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+		if err != nil {
+			n.logger.Error("failed to build impersonation notice request", "err", err.Error())
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			n.logger.Error(fmt.Sprintf("failed to notify %s of impersonation by %s", impersonation.Target, impersonation.Actor), "err", err.Error())
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			n.logger.Error(fmt.Sprintf("failed to notify %s of impersonation by %s", impersonation.Target, impersonation.Actor),
+				"err", fmt.Sprintf("webhook returned %s", resp.Status))
+		}
+	}()
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestImpersonation(t *testing.T) {
+
+	admin := &jwt.Claims{Subject: "admin@example.com", Scopes: ImpersonateScope + " r:silhouette:*"}
+	selfAccess := &api.AuthConfig{RequiredScopes: []string{"w:silhouette:address:*"}, SelfAccessAllowed: true}
+
+	tests := []struct {
+		name       string
+		md         metadata.MD
+		claims     *jwt.Claims
+		authConfig *api.AuthConfig
+		wantCode   codes.Code
+		wantTarget string
+	}{
+		{"no act-as", metadata.Pairs(), admin, selfAccess, codes.OK, ""},
+		{"valid", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, "ticket 42"), admin, selfAccess, codes.OK, "user@example.com"},
+		{"missing scope", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, "ticket 42"),
+			&jwt.Claims{Subject: "admin@example.com", Scopes: "w:silhouette:*"}, selfAccess, codes.PermissionDenied, ""},
+		{"wildcard does not grant scope", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, "ticket 42"),
+			&jwt.Claims{Subject: "admin@example.com", Scopes: "w:silhouette:admin:*"}, selfAccess, codes.PermissionDenied, ""},
+		{"method without self access", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, "ticket 42"), admin,
+			&api.AuthConfig{RequiredScopes: []string{"r:silhouette:admin:*"}}, codes.PermissionDenied, ""},
+		{"missing reason", metadata.Pairs(ActAsHeader, "user@example.com"), admin, selfAccess, codes.InvalidArgument, ""},
+		{"blank reason", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, "  "), admin, selfAccess, codes.InvalidArgument, ""},
+		{"reason with newline", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, "ok\nforged"), admin, selfAccess, codes.InvalidArgument, ""},
+		{"reason too long", metadata.Pairs(ActAsHeader, "user@example.com", ActAsReasonHeader, strings.Repeat("a", maxReasonLength+1)), admin, selfAccess, codes.InvalidArgument, ""},
+		{"invalid target", metadata.Pairs(ActAsHeader, "not-an-email", ActAsReasonHeader, "ticket 42"), admin, selfAccess, codes.InvalidArgument, ""},
+		{"self", metadata.Pairs(ActAsHeader, "Admin@example.com", ActAsReasonHeader, "ticket 42"), admin, selfAccess, codes.InvalidArgument, ""},
+		{"two targets", metadata.Pairs(ActAsHeader, "user@example.com", ActAsHeader, "other@example.com", ActAsReasonHeader, "ticket 42"), admin, selfAccess, codes.InvalidArgument, ""},
+	}
+
+	a := &authInterceptor{logger: slog.New(slog.DiscardHandler)}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			got, err := a.impersonation(tc.md, tc.claims, tc.authConfig, "/api.v1.Addresses/UpdateAddress")
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("impersonation() code = %v, want %v (err: %v)", code, tc.wantCode, err)
+			}
+
+			if tc.wantTarget == "" {
+				if got != nil {
+					t.Errorf("impersonation() = %+v, want nil", got)
+				}
+				return
+			}
+
+			if got == nil || got.Target != tc.wantTarget || got.Actor != tc.claims.Subject || got.Reason == "" {
+				t.Errorf("impersonation() = %+v, want actor %s acting for %s", got, tc.claims.Subject, tc.wantTarget)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequestImpersonation(t *testing.T) {
+
+	authCtx := &AuthContext{
+		RequiredScopes:    []string{"w:silhouette:address:*"},
+		UserClaims:        &jwt.Claims{Subject: "admin@example.com", Scopes: ImpersonateScope + " w:silhouette:*"},
+		SelfAccessAllowed: true,
+		Impersonation:     &Impersonation{Actor: "admin@example.com", Target: "user@example.com", Reason: "ticket 42"},
+	}
+
+	if err := AuthorizeRequest(authCtx, "user@example.com"); err != nil {
+		t.Errorf("expected access to the user acted for, got %v", err)
+	}
+
+	// the actor's own scopes must not extend the impersonation to other users, or back to the actor
+	for _, username := range []string{"other@example.com", "admin@example.com"} {
+		if err := AuthorizeRequest(authCtx, username); err == nil {
+			t.Errorf("expected access to %s to be denied while impersonating", username)
+		}
+	}
+
+	authCtx.SelfAccessAllowed = false
+	if err := AuthorizeRequest(authCtx, "user@example.com"); err == nil {
+		t.Error("expected impersonation to be denied when self access is not allowed")
+	}
+}
+
+func TestAuthorizeRequestNotifiesImpersonation(t *testing.T) {
+
+	var notified int
+	authCtx := &AuthContext{
+		RequiredScopes:      []string{"w:silhouette:address:*"},
+		UserClaims:          &jwt.Claims{Subject: "admin@example.com", Scopes: ImpersonateScope},
+		SelfAccessAllowed:   true,
+		Impersonation:       &Impersonation{Actor: "admin@example.com", Target: "user@example.com", Reason: "ticket 42"},
+		notifyImpersonation: func() { notified++ },
+	}
+
+	// a request the handler denies must not tell the user someone acted for them
+	if err := AuthorizeRequest(authCtx, "other@example.com"); err == nil {
+		t.Fatal("expected access to another user to be denied while impersonating")
+	}
+	if notified != 0 {
+		t.Fatalf("notified %d times before the request was authorized", notified)
+	}
+
+	if err := AuthorizeRequest(authCtx, "user@example.com"); err != nil {
+		t.Fatalf("expected access to the user acted for, got %v", err)
+	}
+	if notified != 1 {
+		t.Errorf("notified %d times, want once the request was authorized", notified)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+
+	received := make(chan impersonationNotice, 2)
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notice impersonationNotice
+		if err := json.NewDecoder(r.Body).Decode(&notice); err != nil {
+			t.Errorf("failed to decode notice: %v", err)
+		}
+		received <- notice
+	}))
+	defer webhook.Close()
+
+	notifier := NewWebhookNotifier(webhook.URL, webhook.Client(), time.Hour)
+	impersonation := &Impersonation{Actor: "admin@example.com", Target: "user@example.com", Reason: "ticket 42"}
+
+	notifier.Notify(impersonation, "/api.v1.Addresses/UpdateAddress")
+
+	select {
+	case notice := <-received:
+		if notice.Username != "user@example.com" || notice.Actor != "admin@example.com" || notice.Reason != "ticket 42" || notice.Method != "/api.v1.Addresses/UpdateAddress" {
+			t.Errorf("notice = %+v, want the impersonation", notice)
+		}
+	case <-time.After(notifyTimeout):
+		t.Fatal("webhook was not called")
+	}
+
+	// the same actor acting for the same user again within the window is not notified
+	notifier.Notify(impersonation, "/api.v1.Addresses/UpdateAddress")
+
+	select {
+	case notice := <-received:
+		t.Errorf("expected no notice within the window, got %+v", notice)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,9 @@
+// Package authctx holds the context key the auth interceptor stores the AuthContext under.
+// It is internal to the auth package so only auth and its test helpers can set it.
+package authctx
+
+// contextKey is a private type to prevent collisions with other packages
+type contextKey string
+
+// Key is the context key of the AuthContext.
+const Key contextKey = "auth-context"
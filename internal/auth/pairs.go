@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parsePairs parses a comma separated list of key=value pairs into the set of values of each key.
+// A key may map to several values, and a value to several keys, by repeating them.
+// Form names the pairs in errors, eg, "<certificate identity>=<service subject>".
+// A pair listed twice is rejected, since it is most likely a mistyped entry.
+func parsePairs(s, form string) (map[string]map[string]bool, error) {
+
+	pairs := make(map[string]map[string]bool)
+	for _, pair := range strings.Split(s, ",") {
+
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// split on the last '=' since uri sans may contain one
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("%q must be %s", pair, form)
+		}
+
+		key := strings.TrimSpace(pair[:i])
+		value := strings.TrimSpace(pair[i+1:])
+		if key == "" || value == "" {
+			return nil, fmt.Errorf("%q must be %s", pair, form)
+		}
+
+		if pairs[key][value] {
+			return nil, fmt.Errorf("%q is listed twice", pair)
+		}
+
+		if pairs[key] == nil {
+			pairs[key] = make(map[string]bool)
+		}
+		pairs[key][value] = true
+	}
+
+	return pairs, nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"unicode"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RedactInterceptor is a gRPC server interceptor which redacts sensitive response fields,
+// ie, fields with a sensitive_scope option, that the calling service does not have the scope for.
+type RedactInterceptor interface {
+	Unary() grpc.UnaryServerInterceptor
+}
+
+// NewRedactInterceptor creates a new instance of RedactInterceptor.
+func NewRedactInterceptor() RedactInterceptor {
+	return &redactInterceptor{}
+}
+
+var _ RedactInterceptor = (*redactInterceptor)(nil)
+
+// redactInterceptor is the concrete implementation of the RedactInterceptor interface.
+type redactInterceptor struct {
+	// sensitivities caches the sensitivity of each field by full name, since options do not change at runtime
+	sensitivities sync.Map
+}
+
+// sensitivity is the sensitive_scope and redaction options of a field.
+type sensitivity struct {
+	scope     string // empty if the field is not sensitive
+	redaction api.Redaction
+}
+
+// Unary redacts the response of unary RPCs.  It must run after the auth interceptor, which sets the auth context.
+// If there is no auth context every sensitive field is redacted.
+func (r *redactInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+
+		msg, ok := resp.(proto.Message)
+		if !ok || msg == nil {
+			return resp, nil
+		}
+
+		// field scopes are checked against the calling service's token
+		var svcScopes map[string]bool
+		if authCtx, err := GetAuthContext(ctx); err == nil && authCtx.SvcClaims != nil {
+			svcScopes = authCtx.SvcClaims.MapScopes()
+		}
+
+		r.redact(msg.ProtoReflect(), svcScopes)
+
+		return resp, nil
+	}
+}
+
+// redact redacts the sensitive fields of a message, and of the messages nested in it, in place.
+func (r *redactInterceptor) redact(m protoreflect.Message, scopes map[string]bool) {
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+
+		// field scopes must be granted literally: a method wildcard like "r:silhouette:*" must not unmask pii
+		if s := r.sensitivity(fd); s.scope != "" && !hasRequiredScopes([]string{s.scope}, scopes, true) {
+			redactField(m, fd, v, s.redaction)
+			return true
+		}
+
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				r.redact(list.Get(i).Message(), scopes)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				r.redact(mv.Message(), scopes)
+				return true
+			})
+		case fd.Message() != nil && !fd.IsMap():
+			r.redact(v.Message(), scopes)
+		}
+
+		return true
+	})
+}
+
+// sensitivity returns the sensitivity options of a field.
+func (r *redactInterceptor) sensitivity(fd protoreflect.FieldDescriptor) sensitivity {
+
+	if cached, ok := r.sensitivities.Load(fd.FullName()); ok {
+		return cached.(sensitivity)
+	}
+
+	var s sensitivity
+	if opts := fd.Options(); opts != nil {
+		if proto.HasExtension(opts, api.E_SensitiveScope) {
+			s.scope, _ = proto.GetExtension(opts, api.E_SensitiveScope).(string)
+		}
+		if proto.HasExtension(opts, api.E_Redaction) {
+			s.redaction, _ = proto.GetExtension(opts, api.E_Redaction).(api.Redaction)
+		}
+	}
+
+	r.sensitivities.Store(fd.FullName(), s)
+	return s
+}
+
+// redactField applies a redaction to a populated field.  Masking only applies to string fields;
+// any other field is cleared.
+func redactField(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value, redaction api.Redaction) {
+
+	if redaction != api.Redaction_REDACTION_MASK_LAST_FOUR || fd.Kind() != protoreflect.StringKind || fd.IsMap() {
+		m.Clear(fd)
+		return
+	}
+
+	if fd.IsList() {
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			list.Set(i, protoreflect.ValueOfString(maskLastFour(list.Get(i).String())))
+		}
+		return
+	}
+
+	m.Set(fd, protoreflect.ValueOfString(maskLastFour(v.String())))
+}
+
+// maskLastFour replaces every letter and digit of a value with '*' except the last four, keeping
+// separators, eg, "555-010-1234" becomes "***-***-1234".  At most half of the letters and digits
+// are left unmasked, so a short value is never shown in full.
+func maskLastFour(s string) string {
+
+	runes := []rune(s)
+
+	var count int
+	for _, c := range runes {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			count++
+		}
+	}
+
+	keep := min(4, count/2)
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		runes[i] = '*'
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// testProfile returns a profile with an address and a phone, each with every sensitive field set.
+func testProfile() *api.Profile {
+	return &api.Profile{
+		Username: "user@example.com",
+		Address: []*api.Address{{
+			StreetAddress:   "1 Main St",
+			StreetAddress_2: proto.String("Apt 4"),
+			City:            "Springfield",
+		}},
+		Phone: []*api.Phone{{
+			CountryCode:         "1",
+			PhoneNumber:         "2125550123",
+			E164:                "+12125550123",
+			NationalFormat:      "(212) 555-0123",
+			InternationalFormat: "+1 212-555-0123",
+		}},
+	}
+}
+
+// redactedProfile returns testProfile as a service without the pii scopes sees it.
+func redactedProfile(addressVisible, phoneVisible bool) *api.Profile {
+
+	p := testProfile()
+	if !addressVisible {
+		p.Address[0].StreetAddress = ""
+		p.Address[0].StreetAddress_2 = nil
+	}
+	if !phoneVisible {
+		p.Phone[0].PhoneNumber = "******0123"
+		p.Phone[0].E164 = "+*******0123"
+		p.Phone[0].NationalFormat = "(***) ***-0123"
+		p.Phone[0].InternationalFormat = "+* ***-***-0123"
+	}
+	return p
+}
+
+func TestRedactInterceptor(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		authCtx *AuthContext
+		resp    proto.Message
+		want    proto.Message
+	}{
+		{
+			name:    "service with both pii scopes sees everything",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "gateway", Scopes: "r:silhouette:profile:* r:silhouette:pii:address r:silhouette:pii:phone"}},
+			resp:    testProfile(),
+			want:    testProfile(),
+		},
+		{
+			name:    "address scope only",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "gallery", Scopes: "r:silhouette:pii:address"}},
+			resp:    testProfile(),
+			want:    redactedProfile(true, false),
+		},
+		{
+			name:    "phone scope only",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "sms", Scopes: "r:silhouette:pii:phone"}},
+			resp:    testProfile(),
+			want:    redactedProfile(false, true),
+		},
+		{
+			name:    "wildcards do not unmask field scopes",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "gallery", Scopes: "r:silhouette:* r:silhouette:pii:*"}},
+			resp:    testProfile(),
+			want:    redactedProfile(false, false),
+		},
+		{
+			name: "the user token's scopes do not count",
+			authCtx: &AuthContext{
+				SvcClaims:  &jwt.Claims{Subject: "gallery", Scopes: "r:silhouette:profile:*"},
+				UserClaims: &jwt.Claims{Subject: "user@example.com", Scopes: "r:silhouette:pii:address r:silhouette:pii:phone"},
+			},
+			resp: testProfile(),
+			want: redactedProfile(false, false),
+		},
+		{
+			name: "no auth context redacts everything",
+			resp: testProfile(),
+			want: redactedProfile(false, false),
+		},
+		{
+			name:    "repeated string field is cleared",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "gallery"}},
+			resp:    &api.FormatAddressResponse{Lines: []string{"1 Main St", "Springfield IL 62701"}, Text: "1 Main St\nSpringfield IL 62701"},
+			want:    &api.FormatAddressResponse{},
+		},
+		{
+			name:    "profiles nested in batch results",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "gallery"}},
+			resp: &api.BatchGetProfilesResponse{Results: []*api.BatchProfileResult{
+				{Username: "user@example.com", Result: &api.BatchProfileResult_Profile{Profile: testProfile()}},
+				{Username: "missing@example.com", Result: &api.BatchProfileResult_Error{Error: &api.BatchProfileError{Message: "not found"}}},
+			}},
+			want: &api.BatchGetProfilesResponse{Results: []*api.BatchProfileResult{
+				{Username: "user@example.com", Result: &api.BatchProfileResult_Profile{Profile: redactedProfile(false, false)}},
+				{Username: "missing@example.com", Result: &api.BatchProfileResult_Error{Error: &api.BatchProfileError{Message: "not found"}}},
+			}},
+		},
+		{
+			name:    "unset fields stay unset",
+			authCtx: &AuthContext{SvcClaims: &jwt.Claims{Subject: "gallery"}},
+			resp:    &api.Profile{Username: "user@example.com", Address: []*api.Address{{City: "Springfield"}}},
+			want:    &api.Profile{Username: "user@example.com", Address: []*api.Address{{City: "Springfield"}}},
+		},
+	}
+
+	interceptor := NewRedactInterceptor().Unary()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctx := context.Background()
+			if tc.authCtx != nil {
+				ctx = withAuthContext(ctx, tc.authCtx)
+			}
+
+			handler := func(context.Context, interface{}) (interface{}, error) { return tc.resp, nil }
+			resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+			if err != nil {
+				t.Fatalf("interceptor err = %v", err)
+			}
+
+			if !proto.Equal(resp.(proto.Message), tc.want) {
+				t.Errorf("response = %v, want %v", resp, tc.want)
+			}
+		})
+	}
+}
+
+func TestMaskLastFour(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"555-010-1234", "***-***-1234"},
+		{"+1 212-555-0123", "+* ***-***-0123"},
+		{"2125550123", "******0123"},
+		{"12345678", "****5678"},
+		// short values never show more than half of their letters and digits
+		{"123456", "***456"},
+		{"1234", "**34"},
+		{"123", "**3"},
+		{"1", "*"},
+		{"", ""},
+		{"--", "--"},
+		{"ab-12", "**-12"},
+		{"ünï-1234", "***-*234"},
+	}
+
+	for _, tc := range tests {
+		if got := maskLastFour(tc.in); got != tc.want {
+			t.Errorf("maskLastFour(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
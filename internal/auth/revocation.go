@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+// ErrTokenRevoked is returned when a token has been revoked.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// ErrUserRevocationDisabled is returned when a user's tokens are revoked while user revocation is disabled,
+// since the revocation would not be enforced.
+var ErrUserRevocationDisabled = errors.New("user revocation is disabled")
+
+// Revocations checks tokens against the revocation deny list, and adds to it.
+// Lookups are cached in memory for a ttl, so a revocation made on another replica can take up to
+// the ttl to be enforced here; a revocation made on this replica is enforced at once.
+type Revocations interface {
+
+	// CheckTokenIds returns ErrTokenRevoked if any of a token's ids, ie, its jti or session id, has been revoked.
+	// Empty ids are ignored.
+	CheckTokenIds(ctx context.Context, tokenIds ...string) error
+
+	// CheckUser returns ErrTokenRevoked if a user's token was issued before the user's revoked-after time.
+	// It always passes if user revocation is disabled.
+	CheckUser(ctx context.Context, username string, issuedAt time.Time) error
+
+	// UserRevocationEnabled reports whether CheckUser enforces users' revoked-after times.
+	UserRevocationEnabled() bool
+
+	// RevokeTokens revokes tokens by jti or session id until they would have expired anyway.
+	RevokeTokens(ctx context.Context, tokenIds []string, expiresAt time.Time) error
+
+	// RevokeUser revokes every token of a user issued before revokedAfter.
+	// It returns ErrUserRevocationDisabled if user revocation is disabled.
+	RevokeUser(ctx context.Context, username string, revokedAfter time.Time) error
+}
+
+// NewRevocations creates a new instance of Revocations, returning a pointer to the concrete implementation.
+// If userRevocation is false, users' revoked-after times are neither looked up nor set.
+func NewRevocations(store storage.RevocationStore, ttl time.Duration, userRevocation bool) Revocations {
+	return &revocations{
+		store:          store,
+		userRevocation: userRevocation,
+		tokens:         newTtlCache[bool](ttl),
+		users:          newTtlCache[time.Time](ttl),
+		now:            time.Now,
+	}
+}
+
+var _ Revocations = (*revocations)(nil)
+
+// revocations is the concrete implementation of the Revocations interface.
+type revocations struct {
+	store          storage.RevocationStore
+	userRevocation bool
+
+	tokens *ttlCache[bool]      // whether each token id is on the deny list
+	users  *ttlCache[time.Time] // each user's revoked-after time, which is zero if there is none
+
+	now func() time.Time
+}
+
+// CheckTokenIds checks a token's ids against the cache, looking up any which are not cached.
+func (r *revocations) CheckTokenIds(ctx context.Context, tokenIds ...string) error {
+
+	now := r.now()
+
+	var lookups []string
+	for _, id := range tokenIds {
+		if id == "" {
+			continue
+		}
+		revoked, ok := r.tokens.get(id, now)
+		if !ok {
+			lookups = append(lookups, id)
+			continue
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	if len(lookups) == 0 {
+		return nil
+	}
+
+	revoked, err := r.store.FindRevokedTokens(ctx, lookups)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range lookups {
+		r.tokens.set(id, revoked[id], now)
+	}
+
+	for _, id := range lookups {
+		if revoked[id] {
+			return ErrTokenRevoked
+		}
+	}
+
+	return nil
+}
+
+// CheckUser checks a token's issued at time against the user's cached revoked-after time,
+// looking it up if it is not cached.
+func (r *revocations) CheckUser(ctx context.Context, username string, issuedAt time.Time) error {
+
+	if !r.userRevocation {
+		return nil
+	}
+
+	now := r.now()
+
+	revokedAfter, ok := r.users.get(username, now)
+	if !ok {
+
+		stored, err := r.store.GetUserRevocation(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		revokedAfter = time.Time{}
+		if stored != nil {
+			revokedAfter = *stored
+		}
+
+		r.users.set(username, revokedAfter, now)
+	}
+
+	// issued at times are whole seconds, so a token issued in the same second as the revocation,
+	// eg, when the user logs straight back in, is not revoked
+	if issuedAt.Before(revokedAfter.Truncate(time.Second)) {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// UserRevocationEnabled reports whether users' revoked-after times are enforced.
+func (r *revocations) UserRevocationEnabled() bool {
+	return r.userRevocation
+}
+
+// RevokeTokens persists the revocations, then caches them until the tokens expire, since a revoked
+// token id is never re-admitted.
+func (r *revocations) RevokeTokens(ctx context.Context, tokenIds []string, expiresAt time.Time) error {
+
+	if err := r.store.RevokeTokens(ctx, tokenIds, expiresAt); err != nil {
+		return err
+	}
+
+	now := r.now()
+	for _, id := range tokenIds {
+		r.tokens.setUntil(id, true, now, expiresAt)
+	}
+
+	return nil
+}
+
+// RevokeUser persists the user's revoked-after time, then drops the cached one so it is read back,
+// since the store keeps the later of the new and any existing time.
+func (r *revocations) RevokeUser(ctx context.Context, username string, revokedAfter time.Time) error {
+
+	if !r.userRevocation {
+		return ErrUserRevocationDisabled
+	}
+
+	if err := r.store.RevokeUser(ctx, username, revokedAfter); err != nil {
+		return err
+	}
+
+	r.users.delete(username)
+
+	return nil
+}
+
+// sessionId returns the sid claim of a token, which is empty if it has none.
+// Carapace does not parse the sid, so the claims segment is decoded here.
+// The token must already have been verified.
+func sessionId(token string) string {
+
+	segments := strings.Split(strings.TrimPrefix(strings.TrimSpace(token), "Bearer "), ".")
+	if len(segments) != 3 {
+		return ""
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Sid string `json:"sid"`
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return ""
+	}
+
+	return claims.Sid
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeRevocationStore is an in-memory storage.RevocationStore which counts lookups.
+type fakeRevocationStore struct {
+	tokens map[string]time.Time // token id to expiry
+	users  map[string]time.Time // username to revoked-after time
+	err    error
+
+	tokenLookups int
+	userLookups  int
+}
+
+func newFakeRevocationStore() *fakeRevocationStore {
+	return &fakeRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+func (f *fakeRevocationStore) RevokeTokens(ctx context.Context, tokenIds []string, expiresAt time.Time) error {
+	for _, id := range tokenIds {
+		f.tokens[id] = expiresAt
+	}
+	return nil
+}
+
+func (f *fakeRevocationStore) FindRevokedTokens(ctx context.Context, tokenIds []string) (map[string]bool, error) {
+	f.tokenLookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	revoked := make(map[string]bool)
+	for _, id := range tokenIds {
+		if _, ok := f.tokens[id]; ok {
+			revoked[id] = true
+		}
+	}
+	return revoked, nil
+}
+
+func (f *fakeRevocationStore) RevokeUser(ctx context.Context, username string, revokedAfter time.Time) error {
+	if revokedAfter.After(f.users[username]) {
+		f.users[username] = revokedAfter
+	}
+	return nil
+}
+
+func (f *fakeRevocationStore) GetUserRevocation(ctx context.Context, username string) (*time.Time, error) {
+	f.userLookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if revokedAfter, ok := f.users[username]; ok {
+		return &revokedAfter, nil
+	}
+	return nil, nil
+}
+
+func TestCheckTokenIds(t *testing.T) {
+
+	ctx := context.Background()
+	store := newFakeRevocationStore()
+	store.tokens["revoked-jti"] = time.Now().Add(time.Hour)
+	r := NewRevocations(store, time.Minute, true).(*revocations)
+
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		tokenIds []string
+		want     error
+	}{
+		{"jti hit", []string{"revoked-jti"}, ErrTokenRevoked},
+		{"jti miss", []string{"valid-jti"}, nil},
+		{"session id hit", []string{"valid-jti", "revoked-jti"}, ErrTokenRevoked},
+		{"empty ids ignored", []string{"", ""}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := r.CheckTokenIds(ctx, tc.tokenIds...); !errors.Is(err, tc.want) {
+				t.Errorf("CheckTokenIds(%v) = %v, want %v", tc.tokenIds, err, tc.want)
+			}
+		})
+	}
+
+	// hits and misses were cached, and empty ids never looked up
+	lookups := store.tokenLookups
+	if err := r.CheckTokenIds(ctx, "valid-jti"); err != nil {
+		t.Errorf("CheckTokenIds() cached miss = %v, want nil", err)
+	}
+	if err := r.CheckTokenIds(ctx, "revoked-jti"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckTokenIds() cached hit = %v, want %v", err, ErrTokenRevoked)
+	}
+	if store.tokenLookups != lookups {
+		t.Errorf("expected cached ids not to be looked up, got %d more lookups", store.tokenLookups-lookups)
+	}
+
+	// a revocation on another replica is enforced once the cached miss expires
+	store.tokens["valid-jti"] = now.Add(time.Hour)
+	if err := r.CheckTokenIds(ctx, "valid-jti"); err != nil {
+		t.Errorf("CheckTokenIds() within the ttl = %v, want the cached miss", err)
+	}
+	now = now.Add(time.Minute)
+	if err := r.CheckTokenIds(ctx, "valid-jti"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckTokenIds() after the ttl = %v, want %v", err, ErrTokenRevoked)
+	}
+
+	// a revocation on this replica is enforced at once, and until the token expires
+	if err := r.CheckTokenIds(ctx, "local-jti"); err != nil {
+		t.Fatalf("CheckTokenIds() = %v, want nil", err)
+	}
+	if err := r.RevokeTokens(ctx, []string{"local-jti"}, now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeTokens() = %v", err)
+	}
+	now = now.Add(30 * time.Minute)
+	lookups = store.tokenLookups
+	if err := r.CheckTokenIds(ctx, "local-jti"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckTokenIds() after revoking = %v, want %v", err, ErrTokenRevoked)
+	}
+	if store.tokenLookups != lookups {
+		t.Error("expected the revocation to be cached until the token expires")
+	}
+
+	// a failed lookup is returned, not treated as a miss
+	store.err = errors.New("db down")
+	if err := r.CheckTokenIds(ctx, "unseen-jti"); err == nil || errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckTokenIds() with a failed lookup = %v, want the lookup error", err)
+	}
+}
+
+func TestCheckUser(t *testing.T) {
+
+	ctx := context.Background()
+	revokedAfter := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		stored   time.Time
+		issuedAt time.Time
+		want     error
+	}{
+		{"issued before", revokedAfter, revokedAfter.Add(-time.Second), ErrTokenRevoked},
+		{"issued at", revokedAfter, revokedAfter, nil},
+		{"issued after", revokedAfter, revokedAfter.Add(time.Second), nil},
+		{"issued in the same second as a sub-second revocation", revokedAfter.Add(900 * time.Millisecond), revokedAfter, nil},
+		{"issued the second before a sub-second revocation", revokedAfter.Add(900 * time.Millisecond), revokedAfter.Add(-time.Second), ErrTokenRevoked},
+		{"never revoked", time.Time{}, revokedAfter, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store := newFakeRevocationStore()
+			if !tc.stored.IsZero() {
+				store.users["user@example.com"] = tc.stored
+			}
+			r := NewRevocations(store, time.Minute, true)
+
+			if err := r.CheckUser(ctx, "user@example.com", tc.issuedAt); !errors.Is(err, tc.want) {
+				t.Errorf("CheckUser() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckUserCache(t *testing.T) {
+
+	ctx := context.Background()
+	store := newFakeRevocationStore()
+	r := NewRevocations(store, time.Minute, true).(*revocations)
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	issuedAt := now.Add(-time.Hour)
+
+	// a user who was never revoked is cached too
+	for i := 0; i < 2; i++ {
+		if err := r.CheckUser(ctx, "user@example.com", issuedAt); err != nil {
+			t.Fatalf("CheckUser() = %v, want nil", err)
+		}
+	}
+	if store.userLookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", store.userLookups)
+	}
+
+	// a revocation on another replica is enforced once the cached time expires
+	store.users["user@example.com"] = now
+	if err := r.CheckUser(ctx, "user@example.com", issuedAt); err != nil {
+		t.Errorf("CheckUser() within the ttl = %v, want the cached time", err)
+	}
+	now = now.Add(time.Minute)
+	if err := r.CheckUser(ctx, "user@example.com", issuedAt); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckUser() after the ttl = %v, want %v", err, ErrTokenRevoked)
+	}
+
+	// a revocation on this replica is enforced at once
+	if err := r.RevokeUser(ctx, "user@example.com", now); err != nil {
+		t.Fatalf("RevokeUser() = %v", err)
+	}
+	if err := r.CheckUser(ctx, "user@example.com", now.Add(-time.Second)); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckUser() after revoking = %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+func TestUserRevocationDisabled(t *testing.T) {
+
+	ctx := context.Background()
+	store := newFakeRevocationStore()
+	store.users["user@example.com"] = time.Now()
+	r := NewRevocations(store, time.Minute, false)
+
+	if r.UserRevocationEnabled() {
+		t.Error("expected user revocation to be disabled")
+	}
+
+	if err := r.CheckUser(ctx, "user@example.com", time.Now().Add(-time.Hour)); err != nil {
+		t.Errorf("CheckUser() = %v, want nil while disabled", err)
+	}
+	if store.userLookups != 0 {
+		t.Errorf("expected no lookups while disabled, got %d", store.userLookups)
+	}
+
+	if err := r.RevokeUser(ctx, "user@example.com", time.Now()); !errors.Is(err, ErrUserRevocationDisabled) {
+		t.Errorf("RevokeUser() = %v, want %v", err, ErrUserRevocationDisabled)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import "strings"
+
+const (
+	// scopeSeparator separates the segments of a scope, eg, "w:silhouette:address:*".
+	scopeSeparator = ":"
+
+	// scopeWildcard is the final segment of a scope which covers every scope beneath it.
+	scopeWildcard = "*"
+
+	// minWildcardSegments is the fewest segments a wildcard scope must name before the wildcard,
+	// ie, the action and the service, so that "*" or "w:*" never cover other services' scopes.
+	minWildcardSegments = 2
+
+	// s2sSegment names the namespace of service to service scopes, eg, "w:silhouette:s2s:revocation:*".
+	// A wildcard must name it to cover scopes within it, so user facing wildcards never reach s2s methods.
+	s2sSegment = "s2s"
+)
+
+// scopeCovers reports whether a granted scope covers a required scope.  A scope covers itself, and
+// a scope ending in a wildcard segment covers every scope beneath its other segments, eg,
+// "w:silhouette:*" covers "w:silhouette:address:*" and "w:silhouette:address:create".
+// The action segment must always match, so a read scope never covers a write scope.
+// A wildcard does not cover across the s2s segment, eg, "r:silhouette:*" does not cover
+// "r:silhouette:s2s:profile:find_by_phone", but "r:silhouette:s2s:*" does.
+// A wildcard anywhere but the final segment is matched literally.
+func scopeCovers(granted, required string) bool {
+
+	if granted == "" || required == "" {
+		return false
+	}
+
+	if granted == required {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(granted, scopeSeparator+scopeWildcard)
+	if !ok {
+		return false
+	}
+
+	segments := strings.Split(prefix, scopeSeparator)
+	if len(segments) < minWildcardSegments {
+		return false
+	}
+
+	for _, segment := range segments {
+		if segment == "" || segment == scopeWildcard {
+			return false
+		}
+	}
+
+	rest, ok := strings.CutPrefix(required, prefix+scopeSeparator)
+	if !ok {
+		return false
+	}
+
+	for _, segment := range strings.Split(rest, scopeSeparator) {
+		if segment == s2sSegment {
+			return false
+		}
+	}
+
+	return true
+}
+
+// coveringScopes returns the granted scopes which cover any one of the required scopes.
+// If exact is set, wildcards are not expanded and a required scope must be granted literally.
+func coveringScopes(requiredScopes []string, grantedScopes map[string]bool, exact bool) []string {
+
+	var covering []string
+	for granted := range grantedScopes {
+		for _, required := range requiredScopes {
+			if (granted != "" && granted == required) || (!exact && scopeCovers(granted, required)) {
+				covering = append(covering, granted)
+				break
+			}
+		}
+	}
+
+	return covering
+}
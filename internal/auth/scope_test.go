@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestScopeCovers(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		granted  string
+		required string
+		want     bool
+	}{
+		{"exact", "w:silhouette:address:*", "w:silhouette:address:*", true},
+		{"exact without wildcard", "r:silhouette:s2s:profile:find_by_phone", "r:silhouette:s2s:profile:find_by_phone", true},
+		{"service wildcard covers resource wildcard", "w:silhouette:*", "w:silhouette:address:*", true},
+		{"service wildcard covers action", "w:silhouette:*", "w:silhouette:address:create", true},
+		{"resource wildcard covers action", "w:silhouette:address:*", "w:silhouette:address:create", true},
+		{"service wildcard covers nested", "r:silhouette:*", "r:silhouette:s2s:profile:find_by_phone", false},
+		{"service wildcard does not cover s2s wildcard", "w:silhouette:*", "w:silhouette:s2s:revocation:*", false},
+		{"service wildcard does not cover s2s namespace", "w:silhouette:*", "w:silhouette:s2s:*", false},
+		{"s2s wildcard covers s2s scopes", "r:silhouette:s2s:*", "r:silhouette:s2s:profile:find_by_phone", true},
+		{"s2s resource wildcard covers s2s action", "w:silhouette:s2s:revocation:*", "w:silhouette:s2s:revocation:revoke", true},
+		{"s2s wildcard does not cover user scopes", "r:silhouette:s2s:*", "r:silhouette:profile:*", false},
+		{"service wildcard covers resource named like s2s", "r:silhouette:*", "r:silhouette:s2sx:profile", true},
+		{"narrower does not cover wider", "w:silhouette:address:*", "w:silhouette:*", false},
+		{"action does not cover resource wildcard", "w:silhouette:address:create", "w:silhouette:address:*", false},
+		{"sibling resource", "w:silhouette:address:*", "w:silhouette:phone:*", false},
+		{"read does not cover write", "r:silhouette:*", "w:silhouette:address:*", false},
+		{"write does not cover read", "w:silhouette:*", "r:silhouette:address:*", false},
+		{"other service", "w:silhouette:*", "w:shaw:address:*", false},
+		{"segment prefix is not a parent", "w:silhouette:*", "w:silhouettes:address:*", false},
+		{"wildcard does not cover its own prefix", "w:silhouette:*", "w:silhouette", false},
+		{"bare wildcard", "*", "w:silhouette:address:*", false},
+		{"action wildcard", "w:*", "w:silhouette:address:*", false},
+		{"wildcard action segment", "*:silhouette:*", "w:silhouette:address:*", false},
+		{"wildcard in middle is literal", "w:*:address:*", "w:silhouette:address:create", false},
+		{"empty segment", "w::*", "w::address", false},
+		{"empty granted", "", "w:silhouette:address:*", false},
+		{"empty required", "w:silhouette:*", "", false},
+		{"both empty", "", "", false},
+		{"case sensitive", "W:SILHOUETTE:*", "w:silhouette:address:*", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := scopeCovers(tc.granted, tc.required); got != tc.want {
+				t.Errorf("scopeCovers(%q, %q) = %v, want %v", tc.granted, tc.required, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHasRequiredScopes(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		required []string
+		granted  map[string]bool
+		exact    bool
+		want     bool
+	}{
+		{"literal", []string{"w:silhouette:address:*"}, map[string]bool{"w:silhouette:address:*": true}, false, true},
+		{"wildcard", []string{"w:silhouette:address:*"}, map[string]bool{"w:silhouette:*": true}, false, true},
+		{"any one of required", []string{"r:silhouette:phone:*", "r:silhouette:address:*"}, map[string]bool{"r:silhouette:address:*": true}, false, true},
+		{"unrelated grants", []string{"w:silhouette:address:*"}, map[string]bool{"r:silhouette:*": true, "w:silhouette:phone:*": true}, false, false},
+		{"no grants", []string{"w:silhouette:address:*"}, nil, false, false},
+		{"no required scopes", nil, map[string]bool{"w:silhouette:*": true}, false, false},
+		{"empty scope", []string{""}, map[string]bool{"": true}, false, false},
+		{"exact literal", []string{"r:silhouette:s2s:profile:find_by_phone"}, map[string]bool{"r:silhouette:s2s:profile:find_by_phone": true}, true, true},
+		{"exact ignores wildcard", []string{"r:silhouette:s2s:profile:find_by_phone"}, map[string]bool{"r:silhouette:*": true, "r:silhouette:s2s:*": true}, true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hasRequiredScopes(tc.required, tc.granted, tc.exact); got != tc.want {
+				t.Errorf("hasRequiredScopes(%v, %v, %v) = %v, want %v", tc.required, tc.granted, tc.exact, got, tc.want)
+			}
+		})
+	}
+}
+
+// scopeSegments are the segments the property tests build scopes from.
+var scopeSegments = []string{"r", "w", "silhouette", "shaw", "s2s", "profile", "address", "phone", "admin", "create", "*", ""}
+
+// genScope builds a scope of one to five segments from a seed, so that the
+// property tests produce related scopes rather than unrelated random strings.
+func genScope(seed []uint8) string {
+
+	if len(seed) == 0 {
+		return ""
+	}
+
+	n := int(seed[0])%5 + 1
+	segments := make([]string, 0, n)
+	for i := 1; i <= n && i < len(seed); i++ {
+		segments = append(segments, scopeSegments[int(seed[i])%len(scopeSegments)])
+	}
+
+	return strings.Join(segments, scopeSeparator)
+}
+
+func TestScopeCoversProperties(t *testing.T) {
+
+	// every non-empty scope covers itself
+	reflexive := func(seed []uint8) bool {
+		s := genScope(seed)
+		return s == "" || scopeCovers(s, s)
+	}
+
+	// a valid wildcard covers any scope extending its prefix, unless the extension crosses into s2s
+	extends := func(prefixSeed, suffixSeed []uint8) bool {
+		prefix := genScope(prefixSeed)
+		suffix := genScope(suffixSeed)
+		if suffix == "" || !validWildcardPrefix(prefix) {
+			return true
+		}
+		return scopeCovers(prefix+":*", prefix+":"+suffix) != slices.Contains(strings.Split(suffix, ":"), "s2s")
+	}
+
+	// if a covers b and b covers c, a covers c
+	transitive := func(aSeed, bSeed, cSeed []uint8) bool {
+		a, b, c := genScope(aSeed), genScope(bSeed), genScope(cSeed)
+		return !scopeCovers(a, b) || !scopeCovers(b, c) || scopeCovers(a, c)
+	}
+
+	// two distinct scopes never cover each other
+	antisymmetric := func(aSeed, bSeed []uint8) bool {
+		a, b := genScope(aSeed), genScope(bSeed)
+		return a == b || !scopeCovers(a, b) || !scopeCovers(b, a)
+	}
+
+	// a scope only covers scopes of the same action
+	sameAction := func(aSeed, bSeed []uint8) bool {
+		a, b := genScope(aSeed), genScope(bSeed)
+		return !scopeCovers(a, b) || firstSegment(a) == firstSegment(b)
+	}
+
+	// hasRequiredScopes agrees with checking every granted scope against every required scope
+	agrees := func(grantedSeeds, requiredSeeds [][]uint8) bool {
+		granted := make(map[string]bool, len(grantedSeeds))
+		for _, seed := range grantedSeeds {
+			granted[genScope(seed)] = true
+		}
+		required := make([]string, 0, len(requiredSeeds))
+		for _, seed := range requiredSeeds {
+			required = append(required, genScope(seed))
+		}
+
+		var want bool
+		for g := range granted {
+			for _, r := range required {
+				want = want || scopeCovers(g, r)
+			}
+		}
+
+		return hasRequiredScopes(required, granted, false) == want
+	}
+
+	props := map[string]any{
+		"reflexive":     reflexive,
+		"extends":       extends,
+		"transitive":    transitive,
+		"antisymmetric": antisymmetric,
+		"same action":   sameAction,
+		"agrees":        agrees,
+	}
+
+	for name, prop := range props {
+		t.Run(name, func(t *testing.T) {
+			if err := quick.Check(prop, &quick.Config{MaxCount: 5000}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func FuzzScopeCovers(f *testing.F) {
+
+	f.Add("w:silhouette:*", "w:silhouette:address:create")
+	f.Add("r:silhouette:*", "w:silhouette:address:*")
+	f.Add("w:silhouette:address:*", "w:silhouette:*")
+	f.Add("*", "w:silhouette:address:*")
+	f.Add("w:*:address:*", "w:silhouette:address:*")
+	f.Add("w::*", "w::address")
+	f.Add("", "")
+
+	f.Fuzz(func(t *testing.T, granted, required string) {
+
+		covers := scopeCovers(granted, required)
+
+		// the empty scope is never granted nor required
+		if (granted == "" || required == "") && covers {
+			t.Fatalf("scopeCovers(%q, %q): empty scope matched", granted, required)
+		}
+
+		if granted != "" && !scopeCovers(granted, granted) {
+			t.Fatalf("scopeCovers(%q, %q): scope does not cover itself", granted, granted)
+		}
+
+		if !covers || granted == required {
+			return
+		}
+
+		// anything but a literal match must be a valid wildcard over a scope beneath it
+		prefix, ok := strings.CutSuffix(granted, ":*")
+		if !ok || !validWildcardPrefix(prefix) {
+			t.Fatalf("scopeCovers(%q, %q): matched without a valid wildcard", granted, required)
+		}
+
+		if !strings.HasPrefix(required, prefix+":") {
+			t.Fatalf("scopeCovers(%q, %q): required scope is not beneath %q", granted, required, prefix)
+		}
+
+		if firstSegment(granted) != firstSegment(required) {
+			t.Fatalf("scopeCovers(%q, %q): action segments differ", granted, required)
+		}
+
+		if slices.Contains(strings.Split(strings.TrimPrefix(required, prefix+":"), ":"), "s2s") {
+			t.Fatalf("scopeCovers(%q, %q): wildcard crosses the s2s segment", granted, required)
+		}
+
+		if scopeCovers(required, granted) {
+			t.Fatalf("scopeCovers(%q, %q): distinct scopes cover each other", granted, required)
+		}
+	})
+}
+
+// validWildcardPrefix reports whether a prefix may precede a wildcard segment:
+// at least the action and service, none of them empty or a wildcard.
+func validWildcardPrefix(prefix string) bool {
+
+	segments := strings.Split(prefix, ":")
+	if len(segments) < 2 {
+		return false
+	}
+
+	for _, segment := range segments {
+		if segment == "" || segment == "*" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// firstSegment returns the action segment of a scope.
+func firstSegment(scope string) string {
+	action, _, _ := strings.Cut(scope, ":")
+	return action
+}
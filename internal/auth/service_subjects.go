@@ -0,0 +1,20 @@
+package auth
+
+import "fmt"
+
+// ServiceSubjects maps the service names a method's allowed_services lists, eg, "identity",
+// to the service token subjects of the deployment that runs that service, eg, "shaw".
+// Keeping the subjects out of the api lets a deployment name its services as it likes.
+type ServiceSubjects map[string]map[string]bool
+
+// ParseServiceSubjects parses a comma separated list of service name to service subject pairs, eg, "identity=shaw".
+// A name may map to several subjects, eg, while a service is renamed, by repeating it.
+func ParseServiceSubjects(s string) (ServiceSubjects, error) {
+
+	subjects, err := parsePairs(s, "<service name>=<service subject>")
+	if err != nil {
+		return nil, fmt.Errorf("invalid service subject: %v", err)
+	}
+
+	return subjects, nil
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServiceSubjects(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		in      string
+		want    ServiceSubjects
+		wantErr bool
+	}{
+		{"empty", "", ServiceSubjects{}, false},
+		{"single", "identity=shaw", ServiceSubjects{"identity": {"shaw": true}}, false},
+		{"several subjects", "identity=shaw, identity=shaw-next", ServiceSubjects{"identity": {"shaw": true, "shaw-next": true}}, false},
+		{"several services", "identity=shaw,gateway=gateway", ServiceSubjects{"identity": {"shaw": true}, "gateway": {"gateway": true}}, false},
+		{"missing subject", "identity=", nil, true},
+		{"missing name", "=shaw", nil, true},
+		{"no separator", "identity", nil, true},
+		{"duplicate", "identity=shaw,identity=shaw", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseServiceSubjects(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseServiceSubjects(%q) error = %v, wantErr %v", tc.in, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseServiceSubjects(%q) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
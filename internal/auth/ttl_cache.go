@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache is an in-memory cache of lookups by key, whose entries expire a ttl after they are set.
+// It is safe for concurrent use.
+type ttlCache[V any] struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]ttlEntry[V]
+	lastSweep time.Time
+}
+
+// ttlEntry is a cached value and when it expires.
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// newTtlCache creates an empty cache whose entries expire after the ttl.
+func newTtlCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		entries: make(map[string]ttlEntry[V]),
+	}
+}
+
+// get returns the value cached for a key, and false if there is none or it has expired.
+func (c *ttlCache[V]) get(key string, now time.Time) (V, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		var zero V
+		return zero, false
+	}
+
+	return entry.value, true
+}
+
+// set caches a value for a key until the ttl has passed.
+func (c *ttlCache[V]) set(key string, value V, now time.Time) {
+	c.setUntil(key, value, now, now.Add(c.ttl))
+}
+
+// setUntil caches a value for a key until it expires, which may be before or after the ttl has passed.
+func (c *ttlCache[V]) setUntil(key string, value V, now, expires time.Time) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(now)
+	c.entries[key] = ttlEntry[V]{value: value, expires: expires}
+}
+
+// delete drops the value cached for a key, so the next get misses.
+func (c *ttlCache[V]) delete(key string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// sweep drops expired entries, at most once per ttl so setting entries stays cheap.
+// The caller must hold the lock.
+func (c *ttlCache[V]) sweep(now time.Time) {
+
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
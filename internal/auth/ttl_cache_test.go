@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTtlCache(t *testing.T) {
+
+	cache := newTtlCache[string](time.Minute)
+	now := time.Now()
+
+	if _, ok := cache.get("key", now); ok {
+		t.Fatal("expected an empty cache to miss")
+	}
+
+	cache.set("key", "value", now)
+	if value, ok := cache.get("key", now.Add(59*time.Second)); !ok || value != "value" {
+		t.Errorf("get() within the ttl = %q, %v, want value", value, ok)
+	}
+	if _, ok := cache.get("key", now.Add(time.Minute)); ok {
+		t.Error("expected the entry to expire after the ttl")
+	}
+
+	// an entry may outlive the ttl
+	cache.setUntil("long", "value", now, now.Add(time.Hour))
+	if _, ok := cache.get("long", now.Add(30*time.Minute)); !ok {
+		t.Error("expected the entry to be kept until it expires")
+	}
+
+	cache.delete("long")
+	if _, ok := cache.get("long", now); ok {
+		t.Error("expected a deleted entry to miss")
+	}
+
+	// expired entries are swept when entries are set, at most once per ttl
+	cache.set("later", "value", now.Add(2*time.Minute))
+	if _, ok := cache.entries["key"]; ok {
+		t.Error("expected the expired entry to be swept")
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("cache holds %d entries, want 1", len(cache.entries))
+	}
+}
@@ -11,23 +11,34 @@ const (
 const (
 	PackageKey = "package"
 
-	PackageAddress = "address"
-	PackageAuth    = "auth"
-	PackageMain    = "main"
-	PackagePhone   = "phone"
-	PackageProfile = "profile"
-	PackageServer  = "server"
+	PackageAddress    = "address"
+	PackageAdmin      = "admin"
+	PackageAuth       = "auth"
+	PackageKeyring    = "keyring"
+	PackageMain       = "main"
+	PackageMigrate    = "migrate"
+	PackagePhone      = "phone"
+	PackageProfile    = "profile"
+	PackageRevocation = "revocation"
+	PackageSchedule   = "schedule"
+	PackageServer     = "server"
 )
 
 // component names
 const (
 	ComponentKey = "component"
 
-	ComponentAddressServer   = "address_server"
-	ComponentAuthInterceptor = "auth_interceptor"
-	ComponentMain            = "main"
-	ComponentPhoneServer     = "phone_server"
-	ComponentProfileServer   = "profile_server"
-	ComponentServer          = "silhouette server"
+	ComponentAddressServer    = "address_server"
+	ComponentAdminServer      = "admin_server"
+	ComponentAuthInterceptor  = "auth_interceptor"
+	ComponentEffectiveDates   = "effective_dates"
+	ComponentEmergencyAccess  = "emergency_access"
+	ComponentKeyring          = "keyring"
+	ComponentMain             = "main"
+	ComponentMigrator         = "migrator"
+	ComponentPhoneServer      = "phone_server"
+	ComponentProfileServer    = "profile_server"
+	ComponentPurge            = "purge"
+	ComponentRevocationServer = "revocation_server"
+	ComponentServer           = "silhouette server"
 )
-
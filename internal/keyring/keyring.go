@@ -0,0 +1,420 @@
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+)
+
+const (
+	// currentKeyFile and nextKeyFile are the key files read from a keys directory.
+	currentKeyFile = "current.pem"
+	nextKeyFile    = "next.pem"
+
+	// kidHeader is the pem header holding a key's id, matched against the token's kid header.
+	kidHeader = "Kid"
+)
+
+// Keyring verifies jwt signatures against a current key and, during a rollover, a next key.
+// A token's kid header selects the key; a token without one is tried against the current key, then the next.
+// It satisfies carapace's jwt.Verifier so it can replace a single key verifier.
+type Keyring interface {
+	jwt.Verifier
+
+	// VerifySignatureKey verifies a signature against a message, ie, a token's base string,
+	// returning the id of the key which verified it.
+	VerifySignatureKey(msg string, sig []byte) (string, error)
+
+	// BuildAuthorizedKey builds a jwt from a token ONLY if it is authorized, as BuildAuthorized,
+	// returning the id of the key which verified it.
+	BuildAuthorizedKey(allowedScopes []string, token string) (*jwt.Token, string, error)
+
+	// Watch reloads the keys every interval if their source has changed, until the context is cancelled.
+	// A source which fails to load is logged and the keys already loaded are kept.
+	Watch(ctx context.Context, interval time.Duration)
+}
+
+// NewStaticKeyring creates a Keyring holding a single key without an id, which never reloads.
+// The key verifies every token, whatever its kid, so it behaves as a single key verifier.
+func NewStaticKeyring(svcName string, pubKey *ecdsa.PublicKey) Keyring {
+
+	k := newKeyring(svcName, "")
+	k.keys.Store(&keySet{current: newKey(svcName, "", pubKey)})
+
+	return k
+}
+
+// NewKeyring creates a Keyring loading its keys from a path, which is either:
+//   - a directory holding current.pem and, during a rollover, next.pem, or
+//   - a file holding the current key's pem block followed by the next key's.
+//
+// Every block must be an ecdsa PUBLIC KEY with a Kid header.
+func NewKeyring(svcName, path string) (Keyring, error) {
+
+	k := newKeyring(svcName, path)
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// newKeyring creates a keyring without any keys loaded.
+func newKeyring(svcName, path string) *keyring {
+	return &keyring{
+		svcName: svcName,
+		path:    path,
+
+		logger: slog.Default().
+			With(slog.String(definitions.PackageKey, definitions.PackageKeyring)).
+			With(slog.String(definitions.ComponentKey, definitions.ComponentKeyring)),
+	}
+}
+
+var _ Keyring = (*keyring)(nil)
+
+// keyring is the concrete implementation of the Keyring interface.
+type keyring struct {
+	svcName string
+	path    string // empty for a static keyring
+
+	keys atomic.Pointer[keySet]
+
+	// fingerprints of the source last loaded and last rejected, so an unchanged source
+	// is not parsed again, nor a bad one reported every interval.  Only used by the watch goroutine.
+	loaded   [sha256.Size]byte
+	rejected [sha256.Size]byte
+
+	logger *slog.Logger
+}
+
+// keySet is the keys loaded from the source at one time.  It is replaced whole on reload.
+type keySet struct {
+	current *key
+	next    *key // nil outside a rollover
+}
+
+// key is a single verifying key and a count of the signatures it has verified.
+type key struct {
+	id       string
+	pubKey   *ecdsa.PublicKey
+	verifier jwt.Verifier
+	uses     atomic.Uint64
+}
+
+// newKey creates a key with a carapace verifier for the service.
+func newKey(svcName, id string, pubKey *ecdsa.PublicKey) *key {
+	return &key{
+		id:       id,
+		pubKey:   pubKey,
+		verifier: jwt.NewVerifier(svcName, pubKey),
+	}
+}
+
+// VerifySignature implements the jwt.Verifier interface.
+func (k *keyring) VerifySignature(msg string, sig []byte) error {
+	_, err := k.VerifySignatureKey(msg, sig)
+	return err
+}
+
+// VerifySignatureKey verifies a signature with the key selected by the kid in the message's header segment.
+func (k *keyring) VerifySignatureKey(msg string, sig []byte) (string, error) {
+
+	candidates, err := k.candidates(msg)
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range candidates {
+		if err = c.verifier.VerifySignature(msg, sig); err == nil {
+			c.uses.Add(1)
+			return c.id, nil
+		}
+	}
+
+	return "", err
+}
+
+// BuildAuthorized implements the jwt.Verifier interface.
+func (k *keyring) BuildAuthorized(allowedScopes []string, token string) (*jwt.Token, error) {
+	jot, _, err := k.BuildAuthorizedKey(allowedScopes, token)
+	return jot, err
+}
+
+// BuildAuthorizedKey builds an authorized jwt with the key selected by the token's kid header.
+func (k *keyring) BuildAuthorizedKey(allowedScopes []string, token string) (*jwt.Token, string, error) {
+
+	candidates, err := k.candidates(strings.TrimPrefix(strings.TrimSpace(token), "Bearer "))
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, c := range candidates {
+		jot, buildErr := c.verifier.BuildAuthorized(allowedScopes, token)
+		if buildErr == nil {
+			c.uses.Add(1)
+			return jot, c.id, nil
+		}
+		err = buildErr
+	}
+
+	return nil, "", err
+}
+
+// candidates returns the keys which may have signed a token, or a token's base string, in the order to try them.
+// A kid selects the key with that id; a static key without an id is tried for any kid.
+func (k *keyring) candidates(token string) ([]*key, error) {
+
+	kid, err := parseKid(token)
+	if err != nil {
+		return nil, err
+	}
+
+	set := k.keys.Load()
+
+	var candidates []*key
+	for _, c := range []*key{set.current, set.next} {
+		if c == nil {
+			continue
+		}
+		if kid == "" || c.id == "" || c.id == kid {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("unauthorized: unknown signing key id %q", kid)
+	}
+
+	return candidates, nil
+}
+
+// parseKid returns the kid header of a token, or of a token's base string, which is empty if it has none.
+// Carapace does not parse the kid, so the header segment is decoded here.
+func parseKid(token string) (string, error) {
+
+	segment, _, _ := strings.Cut(token, ".")
+
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return "", fmt.Errorf("unauthorized: failed to decode token header: %v", err)
+	}
+
+	var header struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return "", fmt.Errorf("unauthorized: failed to parse token header: %v", err)
+	}
+
+	return header.Kid, nil
+}
+
+// Watch polls the key source for changes until the context is cancelled.
+func (k *keyring) Watch(ctx context.Context, interval time.Duration) {
+
+	if k.path == "" {
+		return
+	}
+
+	go func() {
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := k.reload(); err != nil {
+					k.logger.Error(fmt.Sprintf("failed to reload verifying keys from %s, keeping current keys", k.path), "err", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// reload loads the keys from the source if it has changed since it was last loaded.
+// Keys which are still present keep their verification counts, and keys which were dropped are logged
+// with theirs, so an operator can see a retired key was no longer in use.
+func (k *keyring) reload() error {
+
+	files, err := readSource(k.path)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := sha256.Sum256(bytes.Join(files, []byte("\n")))
+	if k.keys.Load() != nil && (fingerprint == k.loaded || fingerprint == k.rejected) {
+		return nil
+	}
+
+	loaded, err := parseKeys(k.svcName, files)
+	if err != nil {
+		k.rejected = fingerprint
+		return fmt.Errorf("failed to parse verifying keys from %s: %v", k.path, err)
+	}
+
+	// carry over keys which did not change so their counts continue
+	previous := k.keys.Load()
+	if previous != nil {
+		loaded.current = carryOver(loaded.current, previous)
+		loaded.next = carryOver(loaded.next, previous)
+	}
+
+	k.keys.Store(loaded)
+	k.loaded = fingerprint
+
+	if previous != nil {
+		for _, old := range []*key{previous.current, previous.next} {
+			if old != nil && old != loaded.current && old != loaded.next {
+				k.logger.Info(fmt.Sprintf("retired verifying key %s", old.id), "verifications", old.uses.Load())
+			}
+		}
+	}
+
+	var next string
+	if loaded.next != nil {
+		next = loaded.next.id
+	}
+	k.logger.Info(fmt.Sprintf("loaded verifying keys from %s", k.path), "current_key", loaded.current.id, "next_key", next)
+
+	return nil
+}
+
+// carryOver returns the previously loaded key with the same id and public key, if any, in place of a newly loaded one.
+func carryOver(loaded *key, previous *keySet) *key {
+
+	if loaded == nil {
+		return nil
+	}
+
+	for _, old := range []*key{previous.current, previous.next} {
+		if old != nil && old.id == loaded.id && old.pubKey.Equal(loaded.pubKey) {
+			return old
+		}
+	}
+
+	return loaded
+}
+
+// readSource reads the key files at a path: the file itself, or a directory's current.pem and, if present, next.pem.
+func readSource(path string) ([][]byte, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat verifying keys path %s: %v", path, err)
+	}
+
+	if !info.IsDir() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read verifying keys file %s: %v", path, err)
+		}
+		return [][]byte{source}, nil
+	}
+
+	current, err := os.ReadFile(filepath.Join(path, currentKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current verifying key in %s: %v", path, err)
+	}
+
+	next, err := os.ReadFile(filepath.Join(path, nextKeyFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read next verifying key in %s: %v", path, err)
+	}
+
+	if next == nil {
+		return [][]byte{current}, nil
+	}
+
+	return [][]byte{current, next}, nil
+}
+
+// decodeBlocks decodes the pem blocks of the key files.  A single file may hold both keys,
+// but when a directory's current.pem and next.pem are read, each must hold exactly one.
+func decodeBlocks(files [][]byte) ([]*pem.Block, error) {
+
+	var blocks []*pem.Block
+	for _, file := range files {
+
+		var n int
+		for block, rest := pem.Decode(file); block != nil; block, rest = pem.Decode(rest) {
+			blocks = append(blocks, block)
+			n++
+		}
+
+		if len(files) > 1 && n != 1 {
+			return nil, fmt.Errorf("each key file must hold exactly one key, found %d", n)
+		}
+	}
+
+	return blocks, nil
+}
+
+// parseKeys parses the current key and, if present, the next key from the key files, in that order.
+func parseKeys(svcName string, files [][]byte) (*keySet, error) {
+
+	blocks, err := decodeBlocks(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*key
+	for _, block := range blocks {
+
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("unexpected pem block type %q", block.Type)
+		}
+
+		id := strings.TrimSpace(block.Headers[kidHeader])
+		if id == "" {
+			return nil, fmt.Errorf("pem block %d is missing its %s header", len(keys)+1, kidHeader)
+		}
+
+		generic, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %v", id, err)
+		}
+
+		pubKey, ok := generic.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %s is not an ecdsa public key", id)
+		}
+
+		keys = append(keys, newKey(svcName, id, pubKey))
+	}
+
+	switch {
+	case len(keys) == 0:
+		return nil, errors.New("no keys found")
+	case len(keys) > 2:
+		return nil, fmt.Errorf("found %d keys, at most a current and a next key are allowed", len(keys))
+	case len(keys) == 2 && keys[0].id == keys[1].id:
+		return nil, fmt.Errorf("current and next keys share the id %s", keys[0].id)
+	}
+
+	set := &keySet{current: keys[0]}
+	if len(keys) == 2 {
+		set.next = keys[1]
+	}
+
+	return set, nil
+}
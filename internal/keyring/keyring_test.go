@@ -0,0 +1,343 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKey generates an ecdsa key pair for the tests.
+func testKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return private
+}
+
+// pemKey encodes a public key as a PUBLIC KEY pem block with a Kid header, omitted if the id is empty.
+func pemKey(t *testing.T, id string, pubKey any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	block := &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	if id != "" {
+		block.Headers = map[string]string{kidHeader: id}
+	}
+
+	return pem.EncodeToMemory(block)
+}
+
+// tokenWithHeader builds a token's base string with the given json header.
+func tokenWithHeader(header string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + ".eyJzdWIiOiJ0ZXN0In0"
+}
+
+func TestParseKid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{"kid", tokenWithHeader(`{"alg":"ES512","typ":"JWT","kid":"2026-10"}`), "2026-10", false},
+		{"no kid", tokenWithHeader(`{"alg":"ES512","typ":"JWT"}`), "", false},
+		{"signed token", tokenWithHeader(`{"alg":"ES512","kid":"2026-10"}`) + ".c2lnbmF0dXJl", "2026-10", false},
+		{"header only", base64.RawURLEncoding.EncodeToString([]byte(`{"kid":"2026-10"}`)), "2026-10", false},
+		{"header is not base64", "not base64!.eyJzdWIiOiJ0ZXN0In0", "", true},
+		{"header is not json", tokenWithHeader(`kid=2026-10`), "", true},
+		{"kid is not a string", tokenWithHeader(`{"kid":42}`), "", true},
+		{"empty token", "", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseKid(tc.token)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseKid() err = %v, want error %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("parseKid() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCandidates(t *testing.T) {
+
+	current := newKey("test", "current", &testKey(t).PublicKey)
+	next := newKey("test", "next", &testKey(t).PublicKey)
+
+	rollover := newKeyring("test", "")
+	rollover.keys.Store(&keySet{current: current, next: next})
+
+	single := newKeyring("test", "")
+	single.keys.Store(&keySet{current: current})
+
+	static := NewStaticKeyring("test", &testKey(t).PublicKey).(*keyring)
+
+	tests := []struct {
+		name    string
+		keyring *keyring
+		kid     string
+		want    []string
+		wantErr bool
+	}{
+		{"kid selects the current key", rollover, "current", []string{"current"}, false},
+		{"kid selects the next key", rollover, "next", []string{"next"}, false},
+		{"no kid tries current, then next", rollover, "", []string{"current", "next"}, false},
+		{"no kid outside a rollover", single, "", []string{"current"}, false},
+		{"unknown kid", rollover, "retired", nil, true},
+		{"next kid before the rollover", single, "next", nil, true},
+		{"static key is tried for any kid", static, "anything", []string{""}, false},
+		{"static key is tried without a kid", static, "", []string{""}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			header := `{"alg":"ES512","typ":"JWT"}`
+			if tc.kid != "" {
+				header = `{"alg":"ES512","typ":"JWT","kid":"` + tc.kid + `"}`
+			}
+
+			got, err := tc.keyring.candidates(tokenWithHeader(header))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("candidates() err = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if !strings.Contains(err.Error(), tc.kid) {
+					t.Errorf("candidates() err = %v, want it to name the kid %q", err, tc.kid)
+				}
+				return
+			}
+
+			var ids []string
+			for _, c := range got {
+				ids = append(ids, c.id)
+			}
+			if strings.Join(ids, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("candidates() = %v, want %v", ids, tc.want)
+			}
+		})
+	}
+
+	if _, err := rollover.candidates("not base64!"); err == nil {
+		t.Error("expected candidates() to fail on a malformed header")
+	}
+}
+
+func TestDecodeBlocks(t *testing.T) {
+
+	a := pemKey(t, "a", &testKey(t).PublicKey)
+	b := pemKey(t, "b", &testKey(t).PublicKey)
+
+	tests := []struct {
+		name    string
+		files   [][]byte
+		want    int
+		wantErr bool
+	}{
+		{"single file, one key", [][]byte{a}, 1, false},
+		{"single file, both keys", [][]byte{append(append([]byte{}, a...), b...)}, 2, false},
+		{"single file, no keys", [][]byte{[]byte("not pem")}, 0, false},
+		{"two files, one key each", [][]byte{a, b}, 2, false},
+		{"two files, two keys in one", [][]byte{append(append([]byte{}, a...), b...), b}, 0, true},
+		{"two files, no key in one", [][]byte{a, []byte("not pem")}, 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			blocks, err := decodeBlocks(tc.files)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("decodeBlocks() err = %v, want error %v", err, tc.wantErr)
+			}
+			if len(blocks) != tc.want {
+				t.Errorf("decodeBlocks() = %d blocks, want %d", len(blocks), tc.want)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+
+	a := pemKey(t, "a", &testKey(t).PublicKey)
+	b := pemKey(t, "b", &testKey(t).PublicKey)
+	c := pemKey(t, "c", &testKey(t).PublicKey)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	join := func(files ...[]byte) []byte {
+		var joined []byte
+		for _, f := range files {
+			joined = append(joined, f...)
+		}
+		return joined
+	}
+
+	tests := []struct {
+		name     string
+		files    [][]byte
+		wantNext string
+		wantErr  string
+	}{
+		{"current only", [][]byte{a}, "", ""},
+		{"current and next in one file", [][]byte{join(a, b)}, "b", ""},
+		{"current and next files", [][]byte{a, b}, "b", ""},
+		{"no keys", [][]byte{[]byte("not pem")}, "", "no keys found"},
+		{"more than two keys", [][]byte{join(a, b, c)}, "", "found 3 keys"},
+		{"shared id", [][]byte{join(a, a)}, "", "share the id a"},
+		{"decode error", [][]byte{join(a, b), c}, "", "exactly one key"},
+		{"not a public key", [][]byte{pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: map[string]string{kidHeader: "a"}, Bytes: []byte("x")})}, "", `unexpected pem block type "PRIVATE KEY"`},
+		{"missing kid", [][]byte{pemKey(t, "", &testKey(t).PublicKey)}, "", "missing its Kid header"},
+		{"blank kid", [][]byte{pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{kidHeader: " "}, Bytes: []byte("x")})}, "", "missing its Kid header"},
+		{"malformed key", [][]byte{pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{kidHeader: "a"}, Bytes: []byte("x")})}, "", "failed to parse key a"},
+		{"not an ecdsa key", [][]byte{pemKey(t, "ed", edPub)}, "", "key ed is not an ecdsa public key"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			set, err := parseKeys("test", tc.files)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("parseKeys() err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseKeys() err = %v", err)
+			}
+
+			if set.current.id != "a" {
+				t.Errorf("parseKeys() current = %s, want a", set.current.id)
+			}
+			var next string
+			if set.next != nil {
+				next = set.next.id
+			}
+			if next != tc.wantNext {
+				t.Errorf("parseKeys() next = %q, want %q", next, tc.wantNext)
+			}
+		})
+	}
+}
+
+func TestReloadRollover(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	oldSigner, newSigner := testKey(t), testKey(t)
+	write(currentKeyFile, pemKey(t, "old", &oldSigner.PublicKey))
+
+	kr, err := NewKeyring("test", dir)
+	if err != nil {
+		t.Fatalf("NewKeyring() err = %v", err)
+	}
+	k := kr.(*keyring)
+
+	old := k.keys.Load().current
+	old.uses.Add(3)
+
+	// an unchanged source is not parsed again
+	unchanged := k.keys.Load()
+	if err := k.reload(); err != nil || k.keys.Load() != unchanged {
+		t.Fatalf("reload() of an unchanged source err = %v, replaced keys %v", err, k.keys.Load() != unchanged)
+	}
+
+	// 1. add the new key as next: the current key keeps its count
+	write(nextKeyFile, pemKey(t, "new", &newSigner.PublicKey))
+	if err := k.reload(); err != nil {
+		t.Fatalf("reload() adding next err = %v", err)
+	}
+
+	set := k.keys.Load()
+	if set.current != old || set.current.uses.Load() != 3 {
+		t.Errorf("current key was not carried over: %s with %d uses", set.current.id, set.current.uses.Load())
+	}
+	if set.next == nil || set.next.id != "new" {
+		t.Fatalf("next key = %+v, want new", set.next)
+	}
+	next := set.next
+	next.uses.Add(5)
+
+	// a bad source is rejected and the loaded keys are kept
+	write(nextKeyFile, []byte("not pem"))
+	if err := k.reload(); err == nil {
+		t.Error("expected reload() of a bad source to fail")
+	}
+	if k.keys.Load() != set {
+		t.Error("keys were replaced by a bad source")
+	}
+	if err := k.reload(); err != nil {
+		t.Errorf("expected a rejected source not to be reported again, got %v", err)
+	}
+
+	// 3. promote the new key and drop the old: the promoted key keeps its count
+	write(currentKeyFile, pemKey(t, "new", &newSigner.PublicKey))
+	if err := os.Remove(filepath.Join(dir, nextKeyFile)); err != nil {
+		t.Fatalf("failed to remove next key: %v", err)
+	}
+	if err := k.reload(); err != nil {
+		t.Fatalf("reload() promoting next err = %v", err)
+	}
+
+	set = k.keys.Load()
+	if set.current != next || set.current.uses.Load() != 5 || set.next != nil {
+		t.Errorf("keys after promotion = %s with %d uses, next %v, want new with 5 uses and no next", set.current.id, set.current.uses.Load(), set.next)
+	}
+}
+
+func TestCarryOver(t *testing.T) {
+
+	pubKey := &testKey(t).PublicKey
+	previous := &keySet{
+		current: newKey("test", "current", pubKey),
+		next:    newKey("test", "next", &testKey(t).PublicKey),
+	}
+
+	same := newKey("test", "current", pubKey)
+	if got := carryOver(same, previous); got != previous.current {
+		t.Error("expected a key with the same id and public key to be carried over")
+	}
+
+	moved := newKey("test", "next", previous.next.pubKey)
+	if got := carryOver(moved, previous); got != previous.next {
+		t.Error("expected the next key to be carried over when promoted")
+	}
+
+	// a reused id with another public key is a new key, and starts its count again
+	replaced := newKey("test", "current", &testKey(t).PublicKey)
+	if got := carryOver(replaced, previous); got != replaced {
+		t.Error("expected a key with the same id but another public key not to be carried over")
+	}
+
+	if got := carryOver(nil, previous); got != nil {
+		t.Errorf("carryOver(nil) = %+v, want nil", got)
+	}
+}
@@ -3,6 +3,7 @@ package phone
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,6 +12,7 @@ import (
 	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
 	api "github.com/tdeslauriers/silhouette/api/v1"
 	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
 	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -50,12 +52,10 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
-		// prepare req fields for use
+	// prepare req fields for use
 	username := strings.TrimSpace(req.GetUsername())
 
 	// authorize the request
@@ -64,8 +64,9 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 		return nil, status.Error(codes.PermissionDenied, "access denied")
 	}
 
-	// validate fields
-	if err := ValidateCmd(req); err != nil {
+	// validate fields and parse the number
+	number, err := NormalizeCmd(req)
+	if err != nil {
 		log.Error("failed to validate create phone command", "err", err.Error())
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -78,6 +79,22 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to look up profile for %s", username))
 	}
 
+	// reject a number the user already has, however it was formatted, so it does not use up their quota
+	extension := normalizeExtension(strings.TrimSpace(req.GetExtension()))
+	existing, err := ps.phoneStore.FindDuplicatePhone(ctx, username, &sqlc.Phone{
+		CountryCode: sql.NullString{String: number.CallingCode, Valid: true},
+		PhoneNumber: sql.NullString{String: number.National, Valid: true},
+		Extension:   sql.NullString{String: extension, Valid: extension != ""},
+	})
+	switch {
+	case err == nil:
+		log.Error(fmt.Sprintf("duplicate phone record for %s - existing slug %s", username, existing.Slug))
+		return nil, alreadyExistsStatus(existing.Slug)
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Error(fmt.Sprintf("failed to check for duplicate phone records for %s", username), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check for duplicate phone records for %s", username))
+	}
+
 	// count of how many phone records exist for the user
 	phoneCount, err := ps.phoneStore.CountPhones(ctx, username)
 	if err != nil {
@@ -85,9 +102,9 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get phone count for %s", username))
 	}
 
-	if phoneCount >= 3 {
-		log.Error(fmt.Sprintf("phone record count for %s is %d - cannot create more than 3 phone records per user", username, phoneCount))
-		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("phone record count for %s is %d - cannot create more than 3 phone records per user", username, phoneCount))
+	if phoneCount >= storage.RecordQuota {
+		log.Error(fmt.Sprintf("phone record count for %s is %d - cannot create more than %d phone records per user", username, phoneCount, storage.RecordQuota))
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("phone record count for %s is %d - cannot create more than %d phone records per user", username, phoneCount, storage.RecordQuota))
 	}
 
 	// create phone record
@@ -109,14 +126,9 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 	now := time.Now().UTC()
 
 	// prepare fields
-	countryCode := normalizeCountryCode(strings.TrimSpace(req.GetCountryCode()))
-	phoneNumber := normalizePhoneNumber(strings.TrimSpace(req.GetPhoneNumber()))
-	phoneType := strings.TrimSpace(req.GetPhoneType().String())
-
-	var extension string
-	if len(req.GetExtension()) > 0 {
-		extension = normalizeExtension(strings.TrimSpace(req.GetExtension()))
-	}
+	countryCode := number.CallingCode
+	phoneNumber := number.National
+	phoneType := resolvePhoneType(req, number).String()
 
 	record := &sqlc.Phone{
 		Uuid:        id.String(),
@@ -158,7 +170,7 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 	}
 
 	// persist phone record
-	if err := ps.phoneStore.CreatePhone(ctx, record); err != nil {
+	if err := ps.phoneStore.CreatePhone(ctx, username, record); err != nil {
 		log.Error(fmt.Sprintf("failed to create phone record for %s", username), "err", err.Error())
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create phone record for %s", username))
 	}
@@ -179,14 +191,17 @@ func (ps *phoneServer) CreatePhone(ctx context.Context, req *api.CreatePhoneRequ
 	// return the created phone record
 	// NOTE: cant return record because the model is encrypted on save.
 	return &api.Phone{
-		PhoneUuid:   id.String(),
-		Slug:        slug.String(),
-		CountryCode: countryCode,
-		PhoneNumber: phoneNumber,
-		Extension:   proto.String(extension),
-		PhoneType:   ConvertPhoneType(phoneType),
-		IsCurrent:   record.IsCurrent,
-		UpdatedAt:   timestamppb.New(record.UpdatedAt),
-		CreatedAt:   timestamppb.New(record.CreatedAt),
+		PhoneUuid:           id.String(),
+		Slug:                slug.String(),
+		CountryCode:         countryCode,
+		PhoneNumber:         phoneNumber,
+		Extension:           proto.String(extension),
+		PhoneType:           ConvertPhoneType(phoneType),
+		IsCurrent:           record.IsCurrent,
+		UpdatedAt:           timestamppb.New(record.UpdatedAt),
+		CreatedAt:           timestamppb.New(record.CreatedAt),
+		E164:                number.E164(),
+		NationalFormat:      number.NationalFormat(),
+		InternationalFormat: number.InternationalFormat(),
 	}, nil
 }
@@ -16,7 +16,8 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-// DeletePhone deletes a phone record by its slug.
+// DeletePhone soft deletes a phone record by its slug.
+// The record can be restored with RestorePhone until the restore window passes.
 func (ps *phoneServer) DeletePhone(ctx context.Context, req *api.DeletePhoneRequest) (*emptypb.Empty, error) {
 
 	// get telemetry context
@@ -48,10 +49,8 @@ func (ps *phoneServer) DeletePhone(ctx context.Context, req *api.DeletePhoneRequ
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
 	// authorize the request
 	if err := auth.AuthorizeRequest(authCtx, req.GetUsername()); err != nil {
@@ -85,25 +84,14 @@ func (ps *phoneServer) DeletePhone(ctx context.Context, req *api.DeletePhoneRequ
 		}
 	}
 
-	// delete the xref record
-	if err := ps.xrefStore.RemovePhoneXrefByPhone(ctx, phone.Uuid); err != nil {
-		log.Error("failed to delete phone xref record", "err", err.Error())
-		return nil, status.Error(codes.Internal, "failed to delete phone xref record")
-	}
-
-	log.Info(
-		fmt.Sprintf("successfully deleted phone xref record for phone slug %s and user %s",
-			req.GetPhoneSlug(),
-			req.GetUsername()),
-	)
-
-	// delete the phone record
+	// tombstone the phone record: the xref is kept so the record can be restored
+	// within the restore window, after which the purge job removes both
 	if err := ps.phoneStore.DeletePhone(ctx, phone.Uuid); err != nil {
 		log.Error("failed to delete phone record", "err", err.Error())
 		return nil, status.Error(codes.Internal, "failed to delete phone record")
 	}
 
-	log.Info(fmt.Sprintf("successfully deleted phone record for phone slug %s", req.GetPhoneSlug()))
+	log.Info(fmt.Sprintf("successfully tombstoned phone record for phone slug %s and user %s", req.GetPhoneSlug(), req.GetUsername()))
 
 	return &emptypb.Empty{}, nil
 }
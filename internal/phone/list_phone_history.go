@@ -0,0 +1,118 @@
+package phone
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListPhoneHistory returns the decrypted prior versions of a user's phone record, newest first.
+func (ps *phoneServer) ListPhoneHistory(ctx context.Context, req *api.ListPhoneHistoryRequest) (*api.ListPhoneHistoryResponse, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		ps.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := ps.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetPhoneSlug())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid phone slug", "err", "phone slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "phone slug must be a valid UUID")
+	}
+
+	// confirm the record exists and belongs to the user so an unknown slug is
+	// not mistaken for a record that has never been updated
+	if _, err := ps.phoneStore.GetPhone(ctx, slug, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("phone slug %s record not found for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("phone record not found for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to get phone record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get phone record for slug: %s", slug))
+	}
+
+	// get the decrypted prior versions
+	history, err := ps.phoneStore.GetPhoneHistory(ctx, slug, username)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to get phone history for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get phone history for slug: %s", slug))
+	}
+
+	versions := make([]*api.PhoneVersion, 0, len(history))
+	for _, h := range history {
+		number := FormatNumber(h.CountryCode.String, h.PhoneNumber.String)
+		versions = append(versions, &api.PhoneVersion{
+			Version: h.Uuid,
+			Phone: &api.Phone{
+				Uuid:                h.PhoneUuid,
+				Slug:                h.Slug,
+				CountryCode:         h.CountryCode.String,
+				PhoneNumber:         h.PhoneNumber.String,
+				Extension:           proto.String(h.Extension.String),
+				PhoneType:           ConvertPhoneType(h.PhoneType.String),
+				IsCurrent:           h.IsCurrent,
+				IsPrimary:           h.IsPrimary,
+				UpdatedAt:           timestamppb.New(h.UpdatedAt),
+				CreatedAt:           timestamppb.New(h.CreatedAt),
+				E164:                number.E164(),
+				NationalFormat:      number.NationalFormat(),
+				InternationalFormat: number.InternationalFormat(),
+			},
+			SupersededAt: timestamppb.New(h.SupersededAt),
+		})
+	}
+
+	log.Info(fmt.Sprintf("successfully retrieved %d phone versions - slug %s for %s", len(versions), slug, username))
+
+	return &api.ListPhoneHistoryResponse{
+		Versions: versions,
+	}, nil
+}
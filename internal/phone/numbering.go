@@ -0,0 +1,297 @@
+package phone
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+)
+
+// regionsJson is the phone numbering metadata, keyed by country calling code.
+// Numbers with a calling code that is not listed are only checked against the generic E.164 limits.
+//
+//go:embed regions.json
+var regionsJson []byte
+
+// maxE164Digits is the most digits an E.164 number can have, calling code included.
+const maxE164Digits = 15
+
+// NumberingPlan is the numbering metadata for a country calling code.
+type NumberingPlan struct {
+	// CallingCode is set from the key of the metadata table.
+	CallingCode string `json:"-"`
+
+	// Regions are the ISO 3166-1 alpha-2 codes sharing the calling code.
+	Regions []string `json:"regions"`
+
+	// NationalPrefix is the trunk prefix dialed before a number within the country, eg, "0".
+	// It is not part of the number, so it is removed if entered.
+	NationalPrefix string `json:"national_prefix"`
+
+	// Lengths are the valid lengths of the national significant number.
+	Lengths []int `json:"lengths"`
+
+	// Prefix is matched against the start of the national significant number.
+	Prefix string `json:"prefix"`
+
+	// Mobile and Fixed are matched against the start of the national significant number to infer its type.
+	// Either may be empty when the plan does not distinguish them, eg, the North American plan.
+	Mobile string `json:"mobile,omitempty"`
+	Fixed  string `json:"fixed,omitempty"`
+
+	// Formats are tried in order; the first whose pattern matches the national significant number is used.
+	Formats []NumberFormat `json:"formats"`
+
+	prefix *regexp.Regexp
+	mobile *regexp.Regexp
+	fixed  *regexp.Regexp
+}
+
+// NumberFormat renders a national significant number for display.
+// National and International are regexp replacement templates for Pattern's groups;
+// the international template does not include the calling code, which is prepended.
+type NumberFormat struct {
+	Pattern       string `json:"pattern"`
+	National      string `json:"national"`
+	International string `json:"international"`
+
+	pattern *regexp.Regexp
+}
+
+// numberingPlans is the parsed metadata table, keyed by calling code.
+var numberingPlans map[string]*NumberingPlan
+
+func init() {
+	var err error
+	if numberingPlans, err = loadNumberingPlans(regionsJson); err != nil {
+		// the table is embedded at build time, so this is a programming error
+		panic(fmt.Sprintf("failed to load embedded phone numbering metadata: %v", err))
+	}
+}
+
+// loadNumberingPlans parses the metadata table and compiles its patterns.
+func loadNumberingPlans(data []byte) (map[string]*NumberingPlan, error) {
+
+	var plans map[string]*NumberingPlan
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return nil, err
+	}
+
+	compile := func(code, name, expr string) (*regexp.Regexp, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern for calling code %s: %v", name, code, err)
+		}
+		return re, nil
+	}
+
+	for code, p := range plans {
+		if err := validate.ValidateCountryCode(code); err != nil {
+			return nil, fmt.Errorf("invalid calling code %q: %v", code, err)
+		}
+		p.CallingCode = code
+
+		var err error
+		if p.prefix, err = compile(code, "prefix", p.Prefix); err != nil {
+			return nil, err
+		}
+		if p.mobile, err = compile(code, "mobile", p.Mobile); err != nil {
+			return nil, err
+		}
+		if p.fixed, err = compile(code, "fixed", p.Fixed); err != nil {
+			return nil, err
+		}
+
+		for i := range p.Formats {
+			if p.Formats[i].pattern, err = compile(code, "format", p.Formats[i].Pattern); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return plans, nil
+}
+
+// Number is a phone number split into its E.164 parts.
+type Number struct {
+	// CallingCode is the country calling code, digits only.
+	CallingCode string
+
+	// National is the national significant number: digits only, without any trunk prefix.
+	National string
+
+	// plan is nil when the calling code has no numbering metadata
+	plan *NumberingPlan
+}
+
+// ParseNumber parses a phone number into its E.164 parts and validates it against the numbering plan
+// of its calling code.  The number may be entered in international form, eg, "+44 20 7946 0000",
+// in which case the calling code is taken from it and country code may be left empty,
+// or in national form, with or without the trunk prefix, together with the country code.
+func ParseNumber(countryCode, phoneNumber string) (*Number, error) {
+
+	countryCode = normalizeCountryCode(countryCode)
+	digits := normalizePhoneNumber(phoneNumber)
+
+	if strings.HasPrefix(strings.TrimSpace(phoneNumber), "+") {
+
+		callingCode := countryCode
+		if callingCode == "" {
+			callingCode = matchCallingCode(digits)
+			if callingCode == "" {
+				return nil, errors.New("phone number has a calling code without numbering metadata: provide the country code")
+			}
+		}
+
+		national, ok := strings.CutPrefix(digits, callingCode)
+		if !ok {
+			return nil, fmt.Errorf("phone number does not begin with country code +%s", callingCode)
+		}
+
+		countryCode, digits = callingCode, national
+	}
+
+	if err := validate.ValidateCountryCode(countryCode); err != nil {
+		return nil, err
+	}
+
+	if err := validate.ValidatePhoneNumber(digits); err != nil {
+		return nil, err
+	}
+
+	plan, ok := numberingPlans[countryCode]
+	if !ok {
+		// no metadata: the number can only be checked against the E.164 limits
+		if len(countryCode)+len(digits) > maxE164Digits {
+			return nil, fmt.Errorf("phone number must be at most %d digits including the country code", maxE164Digits)
+		}
+		return &Number{CallingCode: countryCode, National: digits}, nil
+	}
+
+	// remove the trunk prefix if it was entered, ie, the number is only valid without it.
+	// The length alone cannot tell, since plans with several lengths often allow both.
+	if plan.NationalPrefix != "" && !plan.valid(digits) {
+		if national, ok := strings.CutPrefix(digits, plan.NationalPrefix); ok && plan.valid(national) {
+			digits = national
+		}
+	}
+
+	if !slices.Contains(plan.Lengths, len(digits)) {
+		return nil, fmt.Errorf("phone number for +%s (%s) must be %s digits", countryCode, strings.Join(plan.Regions, "/"), joinLengths(plan.Lengths))
+	}
+
+	if plan.prefix != nil && !plan.prefix.MatchString(digits) {
+		return nil, fmt.Errorf("phone number is not a valid number for +%s (%s)", countryCode, strings.Join(plan.Regions, "/"))
+	}
+
+	return &Number{CallingCode: countryCode, National: digits, plan: plan}, nil
+}
+
+// FormatNumber returns a stored phone number as a Number for display.
+// A record stored before numbering validation may not parse, in which case its digits are used as they are.
+func FormatNumber(countryCode, phoneNumber string) *Number {
+
+	number, err := ParseNumber(countryCode, phoneNumber)
+	if err != nil {
+		return &Number{CallingCode: normalizeCountryCode(countryCode), National: normalizePhoneNumber(phoneNumber)}
+	}
+
+	return number
+}
+
+// valid reports whether a national significant number has a valid length and prefix for the plan.
+func (p *NumberingPlan) valid(national string) bool {
+	return slices.Contains(p.Lengths, len(national)) && (p.prefix == nil || p.prefix.MatchString(national))
+}
+
+// matchCallingCode returns the calling code with numbering metadata that the digits begin with, if any.
+// Calling codes are prefix free, so at most one can match.
+func matchCallingCode(digits string) string {
+	for i := 1; i <= 3 && i < len(digits); i++ {
+		if _, ok := numberingPlans[digits[:i]]; ok {
+			return digits[:i]
+		}
+	}
+	return ""
+}
+
+// joinLengths lists valid lengths for an error message, eg, "9 or 10".
+func joinLengths(lengths []int) string {
+	s := make([]string, 0, len(lengths))
+	for _, l := range lengths {
+		s = append(s, strconv.Itoa(l))
+	}
+	if len(s) == 1 {
+		return s[0]
+	}
+	return strings.Join(s[:len(s)-1], ", ") + " or " + s[len(s)-1]
+}
+
+// E164 returns the number in E.164 form, eg, "+442079460000".
+func (n *Number) E164() string {
+	return "+" + n.CallingCode + n.National
+}
+
+// NationalFormat returns the number as it is dialed and written within its country, eg, "020 7946 0000".
+func (n *Number) NationalFormat() string {
+	if f := n.format(); f != nil {
+		return f.pattern.ReplaceAllString(n.National, f.National)
+	}
+	if n.plan != nil {
+		return n.plan.NationalPrefix + n.National
+	}
+	return n.National
+}
+
+// InternationalFormat returns the number as it is written for dialing from abroad, eg, "+44 20 7946 0000".
+func (n *Number) InternationalFormat() string {
+	if f := n.format(); f != nil {
+		return "+" + n.CallingCode + " " + f.pattern.ReplaceAllString(n.National, f.International)
+	}
+	return "+" + n.CallingCode + " " + n.National
+}
+
+// InferType infers whether the number is a mobile or a fixed line from its numbering plan.
+// A fixed line is taken to be a home phone.  Unspecified is returned when the plan does not tell them apart.
+func (n *Number) InferType() api.PhoneType {
+
+	if n.plan == nil {
+		return api.PhoneType_PHONE_TYPE_UNSPECIFIED
+	}
+
+	// mobile ranges are checked first since fixed ranges can be broader
+	switch {
+	case n.plan.mobile != nil && n.plan.mobile.MatchString(n.National):
+		return api.PhoneType_PHONE_TYPE_MOBILE
+	case n.plan.fixed != nil && n.plan.fixed.MatchString(n.National):
+		return api.PhoneType_PHONE_TYPE_HOME
+	default:
+		return api.PhoneType_PHONE_TYPE_UNSPECIFIED
+	}
+}
+
+// format returns the first display format matching the number, if any.
+func (n *Number) format() *NumberFormat {
+
+	if n.plan == nil {
+		return nil
+	}
+
+	for i := range n.plan.Formats {
+		if n.plan.Formats[i].pattern.MatchString(n.National) {
+			return &n.plan.Formats[i]
+		}
+	}
+
+	return nil
+}
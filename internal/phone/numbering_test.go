@@ -0,0 +1,217 @@
+package phone
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+)
+
+func TestParseNumber(t *testing.T) {
+
+	// input is in national form, with the trunk prefix where the plan has one
+	tests := []struct {
+		name              string
+		countryCode       string
+		input             string
+		wantNational      string
+		wantNationalFmt   string
+		wantInternational string
+		wantType          api.PhoneType
+	}{
+		{"US", "1", "1 (212) 555-0123", "2125550123", "(212) 555-0123", "+1 212-555-0123", api.PhoneType_PHONE_TYPE_UNSPECIFIED},
+		{"NL mobile", "31", "06 12345678", "612345678", "06 12345678", "+31 6 12345678", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"NL fixed", "31", "020 1234567", "201234567", "020 1234567", "+31 20 1234567", api.PhoneType_PHONE_TYPE_HOME},
+		{"FR mobile", "33", "06 12 34 56 78", "612345678", "06 12 34 56 78", "+33 6 12 34 56 78", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"FR fixed", "33", "01 42 68 53 00", "142685300", "01 42 68 53 00", "+33 1 42 68 53 00", api.PhoneType_PHONE_TYPE_HOME},
+		{"ES mobile", "34", "612 345 678", "612345678", "612 345 678", "+34 612 345 678", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"ES fixed", "34", "912 345 678", "912345678", "912 345 678", "+34 912 345 678", api.PhoneType_PHONE_TYPE_HOME},
+		{"IT mobile", "39", "312 345 6789", "3123456789", "312 345 6789", "+39 312 345 6789", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"IT fixed keeps its leading zero", "39", "06 1234 5678", "0612345678", "06 1234 5678", "+39 06 1234 5678", api.PhoneType_PHONE_TYPE_HOME},
+		{"GB mobile", "44", "07911 123456", "7911123456", "07911 123456", "+44 7911 123456", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"GB fixed", "44", "020 7946 0000", "2079460000", "020 7946 0000", "+44 20 7946 0000", api.PhoneType_PHONE_TYPE_HOME},
+		{"DE mobile", "49", "0151 23456789", "15123456789", "0151 23456789", "+49 151 23456789", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"DE fixed", "49", "030 123456", "30123456", "030 123456", "+49 30 123456", api.PhoneType_PHONE_TYPE_HOME},
+		{"MX", "52", "55 1234 5678", "5512345678", "55 1234 5678", "+52 55 1234 5678", api.PhoneType_PHONE_TYPE_UNSPECIFIED},
+		{"BR mobile", "55", "0 (11) 91234-5678", "11912345678", "(11) 91234-5678", "+55 11 91234-5678", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"BR fixed", "55", "0 (11) 3123-4567", "1131234567", "(11) 3123-4567", "+55 11 3123-4567", api.PhoneType_PHONE_TYPE_HOME},
+		{"AU mobile", "61", "0412 345 678", "412345678", "0412 345 678", "+61 412 345 678", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"AU fixed", "61", "(02) 9876 5432", "298765432", "(02) 9876 5432", "+61 2 9876 5432", api.PhoneType_PHONE_TYPE_HOME},
+		{"NZ mobile", "64", "021 123 4567", "211234567", "021 123 4567", "+64 21 123 4567", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"NZ fixed", "64", "09 123 4567", "91234567", "09 123 4567", "+64 9 123 4567", api.PhoneType_PHONE_TYPE_HOME},
+		{"JP mobile", "81", "090-1234-5678", "9012345678", "090-1234-5678", "+81 90-1234-5678", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"JP fixed", "81", "03-1234-5678", "312345678", "03-1234-5678", "+81 3-1234-5678", api.PhoneType_PHONE_TYPE_HOME},
+		{"IN mobile", "91", "098765 43210", "9876543210", "098765 43210", "+91 98765 43210", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"IN fixed", "91", "0112 3456789", "1123456789", "0112 3456789", "+91 112 3456789", api.PhoneType_PHONE_TYPE_HOME},
+		{"IE mobile", "353", "087 123 4567", "871234567", "087 123 4567", "+353 87 123 4567", api.PhoneType_PHONE_TYPE_MOBILE},
+		{"IE fixed", "353", "01 234 5678", "12345678", "01 234 5678", "+353 1 234 5678", api.PhoneType_PHONE_TYPE_HOME},
+	}
+
+	covered := make(map[string]bool)
+	for _, tc := range tests {
+		covered[tc.countryCode] = true
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			inputs := map[string][2]string{
+				"national":                       {tc.countryCode, tc.input},
+				"national without trunk prefix":  {tc.countryCode, tc.wantNational},
+				"international":                  {"", "+" + tc.countryCode + " " + tc.wantNational},
+				"international with the country": {"+" + tc.countryCode, "+" + tc.countryCode + tc.wantNational},
+			}
+
+			for form, in := range inputs {
+				number, err := ParseNumber(in[0], in[1])
+				if err != nil {
+					t.Fatalf("ParseNumber(%q, %q) %s err = %v", in[0], in[1], form, err)
+				}
+
+				if number.CallingCode != tc.countryCode || number.National != tc.wantNational {
+					t.Errorf("ParseNumber(%q, %q) %s = +%s %s, want +%s %s", in[0], in[1], form, number.CallingCode, number.National, tc.countryCode, tc.wantNational)
+				}
+				if got := number.E164(); got != "+"+tc.countryCode+tc.wantNational {
+					t.Errorf("E164() = %s, want +%s%s", got, tc.countryCode, tc.wantNational)
+				}
+				if got := number.NationalFormat(); got != tc.wantNationalFmt {
+					t.Errorf("NationalFormat() = %q, want %q", got, tc.wantNationalFmt)
+				}
+				if got := number.InternationalFormat(); got != tc.wantInternational {
+					t.Errorf("InternationalFormat() = %q, want %q", got, tc.wantInternational)
+				}
+				if got := number.InferType(); got != tc.wantType {
+					t.Errorf("InferType() = %v, want %v", got, tc.wantType)
+				}
+			}
+		})
+	}
+
+	for code := range numberingPlans {
+		if !covered[code] {
+			t.Errorf("numbering plan +%s has no test case", code)
+		}
+	}
+}
+
+func TestParseNumberErrors(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		countryCode string
+		input       string
+		wantErr     string
+	}{
+		{"too short", "44", "020 7946", "must be 9 or 10 digits"},
+		{"too long", "1", "212 555 01234", "must be 10 digits"},
+		{"trunk prefix without a valid length", "1", "1 212 555 01", "must be 10 digits"},
+		{"invalid prefix without a trunk prefix", "1", "(012) 555-0123", "not a valid number"},
+		{"invalid prefix", "61", "512 345 678", "not a valid number"},
+		{"trunk prefix before an invalid prefix", "61", "0512 345 678", "must be 9 digits"},
+		{"missing country code", "", "212 555 0123", "country code is required"},
+		{"calling code does not match", "44", "+1 212 555 0123", "does not begin with country code +44"},
+		{"unknown calling code without a country code", "", "+7 916 123 4567", "without numbering metadata"},
+		{"no metadata beyond the E.164 limit", "7", "916123456789012", "at most 15 digits"},
+		{"empty number", "1", "", "phone number is required"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseNumber(tc.countryCode, tc.input)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ParseNumber(%q, %q) err = %v, want %q", tc.countryCode, tc.input, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseNumberWithoutMetadata(t *testing.T) {
+
+	// calling codes without a plan are kept as entered, and neither formatted nor typed
+	for _, in := range [][2]string{{"7", "916 123 4567"}, {"7", "+7 916 123 4567"}} {
+		number, err := ParseNumber(in[0], in[1])
+		if err != nil {
+			t.Fatalf("ParseNumber(%q, %q) err = %v", in[0], in[1], err)
+		}
+
+		if number.E164() != "+79161234567" {
+			t.Errorf("E164() = %s, want +79161234567", number.E164())
+		}
+		if number.NationalFormat() != "9161234567" || number.InternationalFormat() != "+7 9161234567" {
+			t.Errorf("formats = %q, %q, want the digits as they are", number.NationalFormat(), number.InternationalFormat())
+		}
+		if number.InferType() != api.PhoneType_PHONE_TYPE_UNSPECIFIED {
+			t.Errorf("InferType() = %v, want unspecified", number.InferType())
+		}
+	}
+}
+
+func TestMatchCallingCode(t *testing.T) {
+
+	tests := []struct {
+		digits string
+		want   string
+	}{
+		{"12125550123", "1"},
+		{"447911123456", "44"},
+		{"353871234567", "353"},
+		{"3531", "353"},
+		{"35", ""},
+		{"79161234567", ""},
+		{"1", ""},
+		{"", ""},
+	}
+
+	for _, tc := range tests {
+		if got := matchCallingCode(tc.digits); got != tc.want {
+			t.Errorf("matchCallingCode(%q) = %q, want %q", tc.digits, got, tc.want)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+
+	// a valid stored number is formatted by its plan
+	if got := FormatNumber("44", "2079460000").NationalFormat(); got != "020 7946 0000" {
+		t.Errorf("FormatNumber() national = %q, want 020 7946 0000", got)
+	}
+
+	// a number stored before numbering validation keeps its digits
+	number := FormatNumber("1", "555-0123")
+	if number.CallingCode != "1" || number.National != "5550123" || number.NationalFormat() != "5550123" {
+		t.Errorf("FormatNumber() = %+v, want the stored digits", number)
+	}
+}
+
+func TestLoadNumberingPlans(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"valid", `{"44": {"regions": ["GB"], "lengths": [10], "prefix": "^[1-9]", "formats": [{"pattern": "^(\\d{2})(\\d{8})$"}]}}`, false},
+		{"malformed json", `{"44": `, true},
+		{"calling code is not numeric", `{"GB": {"regions": ["GB"], "lengths": [10]}}`, true},
+		{"calling code too long", `{"4444": {"regions": ["GB"], "lengths": [10]}}`, true},
+		{"invalid prefix", `{"44": {"regions": ["GB"], "lengths": [10], "prefix": "^[1-9"}}`, true},
+		{"invalid mobile", `{"44": {"regions": ["GB"], "lengths": [10], "mobile": "(7"}}`, true},
+		{"invalid format", `{"44": {"regions": ["GB"], "lengths": [10], "formats": [{"pattern": "^(\\d{2}"}]}}`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			plans, err := loadNumberingPlans([]byte(tc.json))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("loadNumberingPlans() err = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			gb := plans["44"]
+			if gb.CallingCode != "44" || gb.prefix == nil || gb.Formats[0].pattern == nil {
+				t.Errorf("loadNumberingPlans() did not compile the plan: %+v", gb)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package phone
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RestorePhone restores a phone record deleted within the restore window.
+// The restored record is not primary, counts against the user's phone limit,
+// and is rejected as AlreadyExists if the user has since added the same number again.
+func (ps *phoneServer) RestorePhone(ctx context.Context, req *api.RestorePhoneRequest) (*api.Phone, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		ps.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := ps.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetPhoneSlug())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid phone slug", "err", "phone slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "phone slug must be a valid UUID")
+	}
+
+	// get the tombstone, to check it against the user's live records before it is restored
+	deletedAfter := time.Now().UTC().Add(-ps.restoreWindow)
+	deleted, err := ps.phoneStore.GetDeletedPhone(ctx, slug, username, deletedAfter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("no deleted phone slug %s found within the restore window for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("no deleted phone record found within the restore window for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to get deleted phone record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get deleted phone record for slug: %s", slug))
+	}
+
+	// reject restoring a number the user has since added again
+	existing, err := ps.phoneStore.FindDuplicatePhone(ctx, username, deleted)
+	switch {
+	case err == nil:
+		log.Error(fmt.Sprintf("duplicate phone record for %s - cannot restore slug %s over existing slug %s", username, slug, existing.Slug))
+		return nil, alreadyExistsStatus(existing.Slug)
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Error(fmt.Sprintf("failed to check for duplicate phone records for %s", username), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check for duplicate phone records for %s", username))
+	}
+
+	// the restored record counts against the phone limit like a new record would
+	phoneCount, err := ps.phoneStore.CountPhones(ctx, username)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to get phone count for %s", username), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get phone count for %s", username))
+	}
+
+	if phoneCount >= storage.RecordQuota {
+		log.Error(fmt.Sprintf("phone record count for %s is %d - cannot restore more than %d phone records per user", username, phoneCount, storage.RecordQuota))
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("phone record count for %s is %d - cannot restore more than %d phone records per user", username, phoneCount, storage.RecordQuota))
+	}
+
+	// restore the record if it was deleted within the restore window
+	phone, err := ps.phoneStore.RestorePhone(ctx, slug, username, deletedAfter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("no deleted phone slug %s found within the restore window for user %s", slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("no deleted phone record found within the restore window for slug: %s", slug))
+		}
+		log.Error(fmt.Sprintf("failed to restore phone record for slug %s", slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to restore phone record for slug: %s", slug))
+	}
+
+	log.Info(fmt.Sprintf("successfully restored phone record - slug %s for %s", slug, username))
+
+	number := FormatNumber(phone.CountryCode.String, phone.PhoneNumber.String)
+
+	return &api.Phone{
+		Uuid:                phone.Uuid,
+		Slug:                phone.Slug,
+		CountryCode:         phone.CountryCode.String,
+		PhoneNumber:         phone.PhoneNumber.String,
+		Extension:           proto.String(phone.Extension.String),
+		PhoneType:           ConvertPhoneType(phone.PhoneType.String),
+		IsCurrent:           phone.IsCurrent,
+		IsPrimary:           phone.IsPrimary,
+		UpdatedAt:           timestamppb.New(phone.UpdatedAt),
+		CreatedAt:           timestamppb.New(phone.CreatedAt),
+		E164:                number.E164(),
+		NationalFormat:      number.NationalFormat(),
+		InternationalFormat: number.InternationalFormat(),
+	}, nil
+}
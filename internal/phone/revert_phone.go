@@ -0,0 +1,110 @@
+package phone
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// RevertPhone reverts a phone record to one of its prior versions.  The version is applied
+// through UpdatePhone, so it is held to the same validation and primary rules as any other update,
+// and the state it replaces is kept in the record's history.
+func (ps *phoneServer) RevertPhone(ctx context.Context, req *api.RevertPhoneRequest) (*api.Phone, error) {
+
+	// get telemetry context
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		ps.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := ps.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// prepare req fields for use
+	username := strings.TrimSpace(req.GetUsername())
+	slug := strings.TrimSpace(req.GetPhoneSlug())
+	version := strings.TrimSpace(req.GetVersion())
+
+	// authorize the request
+	if err := auth.AuthorizeRequest(authCtx, username); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the slug
+	if err := validate.ValidateUuid(slug); err != nil {
+		log.Error("invalid phone slug", "err", "phone slug must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "phone slug must be a valid UUID")
+	}
+
+	// validate the version
+	if err := validate.ValidateUuid(version); err != nil {
+		log.Error("invalid phone version", "err", "phone version must be a valid UUID")
+		return nil, status.Error(codes.InvalidArgument, "phone version must be a valid UUID")
+	}
+
+	// get the version, which must belong to the user's phone
+	prior, err := ps.phoneStore.GetPhoneVersion(ctx, slug, username, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error(fmt.Sprintf("phone version %s not found for slug %s and user %s", version, slug, username))
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("phone version not found: %s", version))
+		}
+		log.Error(fmt.Sprintf("failed to get phone version %s for slug %s", version, slug), "err", err.Error())
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get phone version: %s", version))
+	}
+
+	// apply the version as an ordinary update
+	// errors are already logged and mapped to status codes by UpdatePhone
+	phone, err := ps.UpdatePhone(ctx, &api.UpdatePhoneRequest{
+		Username:    username,
+		PhoneSlug:   slug,
+		CountryCode: prior.CountryCode.String,
+		PhoneNumber: prior.PhoneNumber.String,
+		Extension:   proto.String(prior.Extension.String),
+		PhoneType:   ConvertPhoneType(prior.PhoneType.String),
+		IsCurrent:   prior.IsCurrent,
+		IsPrimary:   prior.IsPrimary,
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to revert phone slug %s to version %s", slug, version), "err", err.Error())
+		return nil, err
+	}
+
+	log.Info(fmt.Sprintf("successfully reverted phone slug %s to version %s for %s", slug, version, username))
+
+	return phone, nil
+}
@@ -2,14 +2,19 @@ package phone
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/tdeslauriers/carapace/pkg/validate"
 	api "github.com/tdeslauriers/silhouette/api/v1"
 	"github.com/tdeslauriers/silhouette/internal/definitions"
 	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // phoneServer is the gRPC server implementation for the Phone service.
@@ -18,6 +23,9 @@ type phoneServer struct {
 	profileStore storage.ProfileStore
 	xrefStore    storage.XrefStore
 
+	// restoreWindow is how long a deleted record can be restored
+	restoreWindow time.Duration
+
 	logger *slog.Logger
 
 	api.UnimplementedPhonesServer
@@ -29,6 +37,7 @@ func NewPhoneServer(
 	phoneSql storage.PhoneStore,
 	profileSql storage.ProfileStore,
 	xrefSql storage.XrefStore,
+	restoreWindow time.Duration,
 ) api.PhonesServer {
 
 	return &phoneServer{
@@ -36,6 +45,8 @@ func NewPhoneServer(
 		profileStore: profileSql,
 		xrefStore:    xrefSql,
 
+		restoreWindow: restoreWindow,
+
 		logger: slog.Default().
 			With(slog.String(definitions.ComponentKey, definitions.ComponentPhoneServer)).
 			With(slog.String(definitions.PackageKey, definitions.PackagePhone)),
@@ -97,36 +108,46 @@ type PhoneUpsert interface {
 	GetPhoneNumber() string
 	GetPhoneType() api.PhoneType
 	GetUsername() string
+	GetInferPhoneType() bool
 }
 
-// ValidateCmd validates the fields of a PhoneUpsert request model.
-func ValidateCmd(cmd PhoneUpsert) error {
+// NormalizeCmd validates the fields of a PhoneUpsert request model and returns its number
+// parsed into E.164 parts and validated against the numbering plan of its country code.
+func NormalizeCmd(cmd PhoneUpsert) (*Number, error) {
 
 	if err := validate.ValidateEmail(cmd.GetUsername()); err != nil {
-		return err
-	}
-
-	if err := validate.ValidateCountryCode(normalizeCountryCode(cmd.GetCountryCode())); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := validate.ValidatePhoneNumber(normalizePhoneNumber(cmd.GetPhoneNumber())); err != nil {
-		return err
+	number, err := ParseNumber(cmd.GetCountryCode(), cmd.GetPhoneNumber())
+	if err != nil {
+		return nil, err
 	}
 
 	// check for extension and if present, validate
 	if len(cmd.GetExtension()) > 0 {
 		if err := validate.ValidateExtension(normalizeExtension(cmd.GetExtension())); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	_, ok := api.PhoneType_name[int32(cmd.GetPhoneType())]
 	if !ok {
-		return errors.New("invalid phone type")
+		return nil, errors.New("invalid phone type")
 	}
 
-	return nil
+	return number, nil
+}
+
+// resolvePhoneType returns the requested phone type, or, if it is unspecified and
+// inference was requested, the type inferred from the number.
+func resolvePhoneType(cmd PhoneUpsert, number *Number) api.PhoneType {
+
+	if cmd.GetPhoneType() == api.PhoneType_PHONE_TYPE_UNSPECIFIED && cmd.GetInferPhoneType() {
+		return number.InferType()
+	}
+
+	return cmd.GetPhoneType()
 }
 
 // ConvertPhoneType converts a string representation of a phone type to the corresponding v1.PhoneType enum value.
@@ -160,3 +181,22 @@ func ConvertToSqlString(pt api.PhoneType) string {
 
 	return phonetype
 }
+
+// alreadyExistsStatus builds an AlreadyExists status error for a duplicate phone record.  The slug of the
+// existing record is in the message and in ResourceInfo details so callers can use it in place of the duplicate.
+func alreadyExistsStatus(slug string) error {
+
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("phone record already exists - slug: %s", slug))
+
+	detailed, err := st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "phone",
+		ResourceName: slug,
+		Description:  "duplicate of an existing phone record",
+	})
+	if err != nil {
+		// the message still carries the slug
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
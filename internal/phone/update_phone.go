@@ -52,12 +52,10 @@ func (ps *phoneServer) UpdatePhone(ctx context.Context, req *api.UpdatePhoneRequ
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
-		// clean up request fields for use
+	// clean up request fields for use
 	username := strings.TrimSpace(req.GetUsername())
 	slug := strings.TrimSpace(req.GetPhoneSlug())
 
@@ -67,8 +65,9 @@ func (ps *phoneServer) UpdatePhone(ctx context.Context, req *api.UpdatePhoneRequ
 		return nil, status.Error(codes.PermissionDenied, "access denied")
 	}
 
-	// validate the command
-	if err := ValidateCmd(req); err != nil {
+	// validate the command and parse the number
+	number, err := NormalizeCmd(req)
+	if err != nil {
 		log.Error("invalid update phone request", "err", err.Error())
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -97,9 +96,9 @@ func (ps *phoneServer) UpdatePhone(ctx context.Context, req *api.UpdatePhoneRequ
 	}
 
 	// prepare fields
-	countryCode := normalizeCountryCode(strings.TrimSpace(req.GetCountryCode()))
-	phoneNumber := normalizePhoneNumber(strings.TrimSpace(req.GetPhoneNumber()))
-	phoneType := strings.TrimSpace(req.GetPhoneType().String())
+	countryCode := number.CallingCode
+	phoneNumber := number.National
+	phoneType := resolvePhoneType(req, number).String()
 
 	var extension string
 	if len(req.GetExtension()) > 0 {
@@ -116,19 +115,44 @@ func (ps *phoneServer) UpdatePhone(ctx context.Context, req *api.UpdatePhoneRequ
 
 		log.Warn(fmt.Sprintf("no update necessary, no changed to phone record - slug: %s", slug))
 		return &api.Phone{
-			Uuid:        record.Uuid,
-			Slug:        record.Slug,
-			CountryCode: record.CountryCode.String,
-			PhoneNumber: record.PhoneNumber.String,
-			Extension:   proto.String(record.Extension.String),
-			PhoneType:   api.PhoneType(api.PhoneType_value[record.PhoneType.String]),
-			IsCurrent:   record.IsCurrent,
-			IsPrimary:   record.IsPrimary,
-			UpdatedAt:   timestamppb.New(record.UpdatedAt),
-			CreatedAt:   timestamppb.New(record.CreatedAt),
+			Uuid:                record.Uuid,
+			Slug:                record.Slug,
+			CountryCode:         record.CountryCode.String,
+			PhoneNumber:         record.PhoneNumber.String,
+			Extension:           proto.String(record.Extension.String),
+			PhoneType:           api.PhoneType(api.PhoneType_value[record.PhoneType.String]),
+			IsCurrent:           record.IsCurrent,
+			IsPrimary:           record.IsPrimary,
+			UpdatedAt:           timestamppb.New(record.UpdatedAt),
+			CreatedAt:           timestamppb.New(record.CreatedAt),
+			E164:                number.E164(),
+			NationalFormat:      number.NationalFormat(),
+			InternationalFormat: number.InternationalFormat(),
 		}, nil
 	}
 
+	// reject changing the record to a number the user already has, however it was formatted.
+	// only the fields in the fingerprint can make it a duplicate, so other updates are not checked.
+	if countryCode != record.CountryCode.String ||
+		phoneNumber != record.PhoneNumber.String ||
+		extension != record.Extension.String {
+
+		existing, err := ps.phoneStore.FindDuplicatePhone(ctx, username, &sqlc.Phone{
+			Uuid:        record.Uuid,
+			CountryCode: sql.NullString{String: countryCode, Valid: true},
+			PhoneNumber: sql.NullString{String: phoneNumber, Valid: true},
+			Extension:   sql.NullString{String: extension, Valid: extension != ""},
+		})
+		switch {
+		case err == nil:
+			log.Error(fmt.Sprintf("duplicate phone record for %s - cannot update slug %s to match existing slug %s", username, slug, existing.Slug))
+			return nil, alreadyExistsStatus(existing.Slug)
+		case !errors.Is(err, sql.ErrNoRows):
+			log.Error(fmt.Sprintf("failed to check for duplicate phone records for %s during update of slug %s", username, slug), "err", err.Error())
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check for duplicate phone records for %s", username))
+		}
+	}
+
 	// build updated record
 	updated := &sqlc.Phone{
 		Uuid: record.Uuid,
@@ -178,7 +202,7 @@ func (ps *phoneServer) UpdatePhone(ctx context.Context, req *api.UpdatePhoneRequ
 	}
 
 	// update persistence layer
-	if err := ps.phoneStore.UpdatePhone(ctx, updated); err != nil {
+	if err := ps.phoneStore.UpdatePhone(ctx, username, updated); err != nil {
 		log.Error(fmt.Sprintf("failed to update phone record for slug %s", slug), "err", err.Error())
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update phone record - slug: %s", slug))
 	}
@@ -233,15 +257,18 @@ func (ps *phoneServer) UpdatePhone(ctx context.Context, req *api.UpdatePhoneRequ
 	log.Info(fmt.Sprintf("successfully updated phone record - slug: %s", slug))
 
 	return &api.Phone{
-		Uuid:        record.Uuid,
-		Slug:        record.Slug,
-		CountryCode: countryCode,
-		PhoneNumber: phoneNumber,
-		Extension:   proto.String(extension),
-		PhoneType:   api.PhoneType(api.PhoneType_value[phoneType]),
-		IsCurrent:   updated.IsCurrent,
-		IsPrimary:   updated.IsPrimary,
-		UpdatedAt:   timestamppb.New(updated.UpdatedAt),
-		CreatedAt:   timestamppb.New(record.CreatedAt),
+		Uuid:                record.Uuid,
+		Slug:                record.Slug,
+		CountryCode:         countryCode,
+		PhoneNumber:         phoneNumber,
+		Extension:           proto.String(extension),
+		PhoneType:           api.PhoneType(api.PhoneType_value[phoneType]),
+		IsCurrent:           updated.IsCurrent,
+		IsPrimary:           updated.IsPrimary,
+		UpdatedAt:           timestamppb.New(updated.UpdatedAt),
+		CreatedAt:           timestamppb.New(record.CreatedAt),
+		E164:                number.E164(),
+		NationalFormat:      number.NationalFormat(),
+		InternationalFormat: number.InternationalFormat(),
 	}, nil
 }
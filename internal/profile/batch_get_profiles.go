@@ -0,0 +1,134 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBatchProfiles is the most usernames a single BatchGetProfiles request may ask for.
+const maxBatchProfiles = 100
+
+// BatchGetProfiles retrieves the profiles of several users for a calling service, returning a result per
+// distinct username: its profile, restricted to the read mask, or why it could not be returned.
+func (s *profileServer) BatchGetProfiles(ctx context.Context, req *api.BatchGetProfilesRequest) (*api.BatchGetProfilesResponse, error) {
+
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add s2s to audit log, and the user if the service is acting on behalf of one
+	log = log.With(authCtx.AuditFields()...)
+
+	// validate the batch size
+	if len(req.GetUsernames()) == 0 {
+		log.Error("invalid batch-get-profiles request: no usernames")
+		return nil, status.Error(codes.InvalidArgument, "at least one username is required")
+	}
+
+	if len(req.GetUsernames()) > maxBatchProfiles {
+		log.Error(fmt.Sprintf("invalid batch-get-profiles request: %d usernames exceeds the limit of %d", len(req.GetUsernames()), maxBatchProfiles))
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("at most %d usernames may be requested at once", maxBatchProfiles))
+	}
+
+	// validate the read mask
+	mask, err := newReadMask(req.GetReadMask())
+	if err != nil {
+		log.Error("invalid batch-get-profiles request", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// dedupe the usernames, keeping request order, and set aside the invalid ones
+	// so they are reported without a lookup
+	results := make([]*api.BatchProfileResult, 0, len(req.GetUsernames()))
+	lookups := make([]string, 0, len(req.GetUsernames()))
+	positions := make(map[string]int, len(req.GetUsernames()))
+	for _, username := range req.GetUsernames() {
+
+		username = strings.TrimSpace(username)
+		if _, ok := positions[username]; ok {
+			continue
+		}
+		positions[username] = len(results)
+
+		if err := validate.ValidateEmail(username); err != nil {
+			results = append(results, batchError(username, api.BatchProfileErrorCode_BATCH_PROFILE_ERROR_CODE_INVALID_USERNAME, err.Error()))
+			continue
+		}
+
+		results = append(results, &api.BatchProfileResult{Username: username})
+		lookups = append(lookups, username)
+	}
+
+	records, err := s.profileStore.GetCompleteProfiles(ctx, lookups, mask.sections())
+	if err != nil {
+		log.Error("failed to get profile records", "err", err.Error())
+		return nil, status.Error(codes.Internal, "failed to get profile records")
+	}
+
+	var found, notFound, failed int
+	for _, record := range records {
+
+		i := positions[record.Username]
+		switch {
+		case record.Err == nil:
+			profile := buildProfile(record.Profile)
+			mask.apply(profile)
+			results[i].Result = &api.BatchProfileResult_Profile{Profile: profile}
+			found++
+		case errors.Is(record.Err, sql.ErrNoRows):
+			results[i] = batchError(record.Username, api.BatchProfileErrorCode_BATCH_PROFILE_ERROR_CODE_NOT_FOUND, "profile record not found")
+			notFound++
+		default:
+			log.Error(fmt.Sprintf("failed to get profile record for %s", record.Username), "err", record.Err.Error())
+			results[i] = batchError(record.Username, api.BatchProfileErrorCode_BATCH_PROFILE_ERROR_CODE_INTERNAL, "failed to get profile record")
+			failed++
+		}
+	}
+
+	log.Info(fmt.Sprintf("successfully retrieved batch of %d profile records", len(results)),
+		"found", found,
+		"not_found", notFound,
+		"invalid", len(results)-len(lookups),
+		"failed", failed,
+	)
+
+	return &api.BatchGetProfilesResponse{Results: results}, nil
+}
+
+// batchError builds the result for a username whose profile could not be returned.
+func batchError(username string, code api.BatchProfileErrorCode, msg string) *api.BatchProfileResult {
+	return &api.BatchProfileResult{
+		Username: username,
+		Result: &api.BatchProfileResult_Error{
+			Error: &api.BatchProfileError{Code: code, Message: msg},
+		},
+	}
+}
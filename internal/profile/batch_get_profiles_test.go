@@ -0,0 +1,162 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchGetProfilesLimit(t *testing.T) {
+
+	store := newFakeProfileStore()
+	s := newTestServer(store, 10)
+
+	usernames := func(n int) []string {
+		u := make([]string, n)
+		for i := range u {
+			u[i] = fmt.Sprintf("user%d@example.com", i)
+		}
+		return u
+	}
+
+	tests := []struct {
+		name      string
+		usernames []string
+		wantCode  codes.Code
+	}{
+		{"none", nil, codes.InvalidArgument},
+		{"one", usernames(1), codes.OK},
+		{"most allowed", usernames(maxBatchProfiles), codes.OK},
+		{"too many", usernames(maxBatchProfiles + 1), codes.InvalidArgument},
+		{"too many even if duplicated", slices.Repeat([]string{"user@example.com"}, maxBatchProfiles+1), codes.InvalidArgument},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store.lookups = nil
+			resp, err := s.BatchGetProfiles(serviceContext("gateway"), &api.BatchGetProfilesRequest{Usernames: tc.usernames})
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("BatchGetProfiles() code = %v, want %v: %v", code, tc.wantCode, err)
+			}
+			if err != nil && store.lookups != nil {
+				t.Error("expected a rejected batch not to read the store")
+			}
+			if err == nil && len(resp.GetResults()) != len(tc.usernames) {
+				t.Errorf("BatchGetProfiles() returned %d results, want %d", len(resp.GetResults()), len(tc.usernames))
+			}
+		})
+	}
+}
+
+func TestBatchGetProfilesResults(t *testing.T) {
+
+	store := newFakeProfileStore()
+	store.add("first@example.com", nil, nil)
+	store.add("second@example.com", nil, nil)
+	s := newTestServer(store, 10)
+
+	resp, err := s.BatchGetProfiles(serviceContext("gateway"), &api.BatchGetProfilesRequest{
+		Usernames: []string{
+			"second@example.com",
+			"missing@example.com",
+			" first@example.com ",
+			"not-an-email",
+			"second@example.com",
+			"first@example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("BatchGetProfiles() err = %v", err)
+	}
+
+	// one result per distinct username, in request order, and only valid usernames looked up once each
+	want := []struct {
+		username string
+		found    bool
+		code     api.BatchProfileErrorCode
+	}{
+		{"second@example.com", true, 0},
+		{"missing@example.com", false, api.BatchProfileErrorCode_BATCH_PROFILE_ERROR_CODE_NOT_FOUND},
+		{"first@example.com", true, 0},
+		{"not-an-email", false, api.BatchProfileErrorCode_BATCH_PROFILE_ERROR_CODE_INVALID_USERNAME},
+	}
+
+	if len(resp.GetResults()) != len(want) {
+		t.Fatalf("BatchGetProfiles() returned %d results, want %d: %v", len(resp.GetResults()), len(want), resp.GetResults())
+	}
+	for i, w := range want {
+		result := resp.GetResults()[i]
+		if result.GetUsername() != w.username {
+			t.Errorf("result %d username = %q, want %q", i, result.GetUsername(), w.username)
+		}
+		if w.found && result.GetProfile().GetUsername() != w.username {
+			t.Errorf("result %d profile = %v, want the profile of %s", i, result.GetProfile(), w.username)
+		}
+		if !w.found && result.GetError().GetCode() != w.code {
+			t.Errorf("result %d error = %v, want %v", i, result.GetError(), w.code)
+		}
+	}
+
+	if wantLookups := []string{"second@example.com", "missing@example.com", "first@example.com"}; !slices.Equal(store.lookups, wantLookups) {
+		t.Errorf("looked up %v, want %v", store.lookups, wantLookups)
+	}
+}
+
+// erringProfileStore fails the reads of some usernames of a batch, as a decryption failure would.
+type erringProfileStore struct {
+	*fakeProfileStore
+	failed map[string]bool
+}
+
+func (e *erringProfileStore) GetCompleteProfiles(ctx context.Context, usernames []string, sections storage.ProfileSections) ([]storage.ProfileResult, error) {
+
+	results, err := e.fakeProfileStore.GetCompleteProfiles(ctx, usernames, sections)
+	for i := range results {
+		if e.failed[results[i].Username] {
+			results[i] = storage.ProfileResult{Username: results[i].Username, Err: errors.New("failed to decrypt")}
+		}
+	}
+	return results, err
+}
+
+func TestBatchGetProfilesPartialFailure(t *testing.T) {
+
+	fake := newFakeProfileStore()
+	fake.add("ok@example.com", nil, nil)
+	fake.add("broken@example.com", nil, nil)
+	store := &erringProfileStore{fakeProfileStore: fake, failed: map[string]bool{"broken@example.com": true}}
+	s := NewProfileServer(store, nil, nil).(*profileServer)
+
+	resp, err := s.BatchGetProfiles(serviceContext("gateway"), &api.BatchGetProfilesRequest{Usernames: []string{"broken@example.com", "ok@example.com"}})
+	if err != nil {
+		t.Fatalf("BatchGetProfiles() err = %v", err)
+	}
+
+	results := resp.GetResults()
+	if len(results) != 2 {
+		t.Fatalf("BatchGetProfiles() returned %d results, want 2", len(results))
+	}
+	if code := results[0].GetError().GetCode(); code != api.BatchProfileErrorCode_BATCH_PROFILE_ERROR_CODE_INTERNAL {
+		t.Errorf("failed profile error = %v, want INTERNAL", code)
+	}
+	if msg := results[0].GetError().GetMessage(); msg == "failed to decrypt" {
+		t.Error("expected the store error not to be returned to the caller")
+	}
+	if results[1].GetProfile().GetUsername() != "ok@example.com" {
+		t.Errorf("second result = %v, want the profile of ok@example.com", results[1])
+	}
+
+	// a failed batch read fails the whole request
+	fake.err = errors.New("db down")
+	if _, err := s.BatchGetProfiles(serviceContext("gateway"), &api.BatchGetProfilesRequest{Usernames: []string{"ok@example.com"}}); status.Code(err) != codes.Internal {
+		t.Errorf("BatchGetProfiles() with a failed read code = %v, want Internal", status.Code(err))
+	}
+}
@@ -39,7 +39,7 @@ func (ps *profileServer) CreateProfile(ctx context.Context, req *api.CreateProfi
 	}
 
 	// add s2s to audit log
-	log = log.With("requesting_service", authCtx.SvcClaims.Subject)
+	log = log.With(authCtx.AuditFields()...)
 
 	// validate fields
 	if err := ValidateCmd(req); err != nil {
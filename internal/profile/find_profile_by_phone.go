@@ -0,0 +1,98 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	ph "github.com/tdeslauriers/silhouette/internal/phone"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FindProfileByPhone identifies the user a phone number belongs to for a calling service,
+// returning only the profile uuid and username.
+// Every call is audited with its outcome; the number itself is only logged masked.
+func (s *profileServer) FindProfileByPhone(ctx context.Context, req *api.FindProfileByPhoneRequest) (*api.FindProfileByPhoneResponse, error) {
+
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add s2s to audit log, and the user if the service is acting on behalf of one
+	log = log.With(authCtx.AuditFields()...)
+
+	// limit lookups per calling service before any work is done, so malformed
+	// numbers count against the limit too and the index cannot be enumerated
+	if !s.phoneLookups.Allow(authCtx.SvcClaims.Subject) {
+		log.Warn("phone lookup denied", "outcome", "rate_limited")
+		return nil, status.Error(codes.ResourceExhausted, "phone lookup rate limit exceeded")
+	}
+
+	// validate and normalize the number so it matches the stored lookup index
+	number, err := ph.ParseNumber(req.GetCountryCode(), req.GetPhoneNumber())
+	if err != nil {
+		log.Error("invalid find-profile-by-phone request", "outcome", "invalid_argument", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid phone number: %s", err.Error()))
+	}
+
+	log = log.With("phone", maskNumber(number))
+
+	profile, err := s.profileStore.FindProfileByPhone(ctx, number.CallingCode, number.National)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			log.Info("phone lookup found no profile", "outcome", "not_found")
+			return nil, status.Error(codes.NotFound, "no profile found for phone number")
+		case errors.Is(err, storage.ErrSharedPhone):
+			log.Warn("phone lookup matched more than one profile", "outcome", "shared_number")
+			return nil, status.Error(codes.FailedPrecondition, "phone number does not identify a single profile")
+		default:
+			log.Error("failed to look up profile by phone", "outcome", "error", "err", err.Error())
+			return nil, status.Error(codes.Internal, "failed to look up profile by phone")
+		}
+	}
+
+	log.Info(fmt.Sprintf("phone lookup identified profile %s for %s", profile.Uuid, profile.Username), "outcome", "found")
+
+	return &api.FindProfileByPhoneResponse{
+		Uuid:     profile.Uuid,
+		Username: profile.Username,
+	}, nil
+}
+
+// maskNumber returns a phone number for the audit log with all but its calling code and
+// last four digits hidden, eg, "+44 ******0000".
+func maskNumber(number *ph.Number) string {
+
+	national := number.National
+	if len(national) <= 4 {
+		return "+" + number.CallingCode + " " + strings.Repeat("*", len(national))
+	}
+
+	return "+" + number.CallingCode + " " + strings.Repeat("*", len(national)-4) + national[len(national)-4:]
+}
@@ -0,0 +1,137 @@
+package profile
+
+import (
+	"errors"
+	"testing"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	ph "github.com/tdeslauriers/silhouette/internal/phone"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFindProfileByPhone(t *testing.T) {
+
+	store := newFakeProfileStore()
+	store.add("user@example.com", nil, nil)
+	store.add("partner@example.com", nil, nil)
+	store.phones["44 2079460000"] = []string{"user@example.com"}
+	store.phones["1 2125550123"] = []string{"user@example.com", "partner@example.com"}
+
+	tests := []struct {
+		name         string
+		req          *api.FindProfileByPhoneRequest
+		wantCode     codes.Code
+		wantUsername string
+		wantLookup   string
+	}{
+		{"national form", &api.FindProfileByPhoneRequest{CountryCode: "44", PhoneNumber: "020 7946 0000"}, codes.OK, "user@example.com", "44 2079460000"},
+		{"international form", &api.FindProfileByPhoneRequest{PhoneNumber: "+44 20 7946 0000"}, codes.OK, "user@example.com", "44 2079460000"},
+		{"not found", &api.FindProfileByPhoneRequest{CountryCode: "44", PhoneNumber: "07911 123456"}, codes.NotFound, "", "44 7911123456"},
+		{"shared number", &api.FindProfileByPhoneRequest{CountryCode: "1", PhoneNumber: "(212) 555-0123"}, codes.FailedPrecondition, "", "1 2125550123"},
+		{"invalid number is not looked up", &api.FindProfileByPhoneRequest{CountryCode: "44", PhoneNumber: "not a number"}, codes.InvalidArgument, "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store.lookups = nil
+			s := newTestServer(store, 10)
+
+			resp, err := s.FindProfileByPhone(serviceContext("sms"), tc.req)
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("FindProfileByPhone() code = %v, want %v: %v", code, tc.wantCode, err)
+			}
+			if resp.GetUsername() != tc.wantUsername {
+				t.Errorf("FindProfileByPhone() username = %q, want %q", resp.GetUsername(), tc.wantUsername)
+			}
+			if tc.wantUsername != "" && resp.GetUuid() != "uuid-"+tc.wantUsername {
+				t.Errorf("FindProfileByPhone() uuid = %q, want the profile's", resp.GetUuid())
+			}
+
+			lookup := ""
+			if len(store.lookups) > 0 {
+				lookup = store.lookups[0]
+			}
+			if lookup != tc.wantLookup {
+				t.Errorf("looked up %q, want %q", lookup, tc.wantLookup)
+			}
+		})
+	}
+
+	// a failed lookup does not leak the store error
+	store.err = errors.New("db down")
+	_, err := newTestServer(store, 10).FindProfileByPhone(serviceContext("sms"), &api.FindProfileByPhoneRequest{CountryCode: "44", PhoneNumber: "020 7946 0000"})
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() == "db down" {
+		t.Errorf("FindProfileByPhone() with a failed lookup = %v, want a generic Internal error", err)
+	}
+}
+
+func TestFindProfileByPhoneRateLimit(t *testing.T) {
+
+	store := newFakeProfileStore()
+	s := newTestServer(store, 2)
+
+	valid := &api.FindProfileByPhoneRequest{CountryCode: "44", PhoneNumber: "020 7946 0000"}
+	invalid := &api.FindProfileByPhoneRequest{CountryCode: "44", PhoneNumber: "not a number"}
+
+	// malformed numbers count against the limit too, so the index cannot be probed for free
+	if _, err := s.FindProfileByPhone(serviceContext("sms"), invalid); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("FindProfileByPhone() code = %v, want InvalidArgument", status.Code(err))
+	}
+	if _, err := s.FindProfileByPhone(serviceContext("sms"), valid); status.Code(err) != codes.NotFound {
+		t.Fatalf("FindProfileByPhone() code = %v, want NotFound", status.Code(err))
+	}
+
+	store.lookups = nil
+	if _, err := s.FindProfileByPhone(serviceContext("sms"), valid); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("FindProfileByPhone() over the limit code = %v, want ResourceExhausted", status.Code(err))
+	}
+	if store.lookups != nil {
+		t.Error("expected a rate limited request not to be looked up")
+	}
+
+	// each calling service has its own limit
+	if _, err := s.FindProfileByPhone(serviceContext("billing"), valid); status.Code(err) != codes.NotFound {
+		t.Errorf("FindProfileByPhone() for another service code = %v, want NotFound", status.Code(err))
+	}
+}
+
+func TestMaskNumber(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		countryCode string
+		number      string
+		want        string
+	}{
+		{"gb fixed", "44", "020 7946 0000", "+44 ******0000"},
+		{"us", "1", "(212) 555-0123", "+1 ******0123"},
+		{"de fixed", "49", "030 123456", "+49 ****3456"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			number, err := ph.ParseNumber(tc.countryCode, tc.number)
+			if err != nil {
+				t.Fatalf("ParseNumber() err = %v", err)
+			}
+			if got := maskNumber(number); got != tc.want {
+				t.Errorf("maskNumber() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// numbers of four digits or fewer are hidden entirely
+	for _, tc := range []struct {
+		national string
+		want     string
+	}{
+		{"1234", "+1 ****"},
+		{"12", "+1 **"},
+	} {
+		if got := maskNumber(&ph.Number{CallingCode: "1", National: tc.national}); got != tc.want {
+			t.Errorf("maskNumber(%q) = %q, want %q", tc.national, got, tc.want)
+		}
+	}
+}
@@ -8,8 +8,11 @@ import (
 
 	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
 	api "github.com/tdeslauriers/silhouette/api/v1"
+	addr "github.com/tdeslauriers/silhouette/internal/address"
 	"github.com/tdeslauriers/silhouette/internal/auth"
 	ph "github.com/tdeslauriers/silhouette/internal/phone"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
@@ -49,10 +52,8 @@ func (s *profileServer) GetProfile(ctx context.Context, req *api.GetProfileReque
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
 	// authorize the request
 	if err := auth.AuthorizeRequest(authCtx, req.GetUsername()); err != nil {
@@ -60,8 +61,29 @@ func (s *profileServer) GetProfile(ctx context.Context, req *api.GetProfileReque
 		return nil, status.Error(codes.PermissionDenied, "access denied")
 	}
 
-	// get the profile record by username
-	record, err := s.profileStore.GetCompleteProfile(ctx, req.GetUsername())
+	// validate the requested record order
+	if _, ok := api.RecordOrder_name[int32(req.GetOrder())]; !ok {
+		log.Error(fmt.Sprintf("invalid record order requested: %d", req.GetOrder()))
+		return nil, status.Error(codes.InvalidArgument, "invalid record order")
+	}
+
+	// validate the as of time, if present
+	if req.GetAsOf() != nil {
+		if err := req.GetAsOf().CheckValid(); err != nil {
+			log.Error("invalid as_of requested", "err", err.Error())
+			return nil, status.Error(codes.InvalidArgument, "invalid as_of")
+		}
+	}
+
+	// validate the read mask
+	mask, err := newReadMask(req.GetReadMask())
+	if err != nil {
+		log.Error("invalid read mask requested", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// get the profile record by username, reading only the sections the mask selects
+	record, err := s.profileStore.GetCompleteProfile(ctx, req.GetUsername(), mask.sections())
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.Error(fmt.Sprintf("profile record not found for %s", req.GetUsername()))
@@ -72,7 +94,50 @@ func (s *profileServer) GetProfile(ctx context.Context, req *api.GetProfileReque
 		}
 	}
 
+	// rebuild the addresses as they stood at the requested time from their history,
+	// and narrow them to those current then
+	if req.GetAsOf() != nil && mask.has("address") {
+		asOf := req.GetAsOf().AsTime()
+
+		history, err := s.addressStore.GetAddressHistorySince(ctx, req.GetUsername(), asOf)
+		if err != nil {
+			log.Error("failed to get address history", "err", err.Error())
+			return nil, status.Error(codes.Internal, "failed to get profile record")
+		}
+
+		versions := make(map[string][]*sqlc.AddressHistory, len(record.Addresses))
+		for _, h := range history {
+			versions[h.AddressUuid] = append(versions[h.AddressUuid], h)
+		}
+
+		current := make([]*sqlc.Address, 0, len(record.Addresses))
+		for _, a := range record.Addresses {
+			then := addr.AddressAt(a, versions[a.Uuid], asOf)
+			if then != nil && addr.CurrentAt(then, asOf) {
+				then.IsCurrent = true
+				current = append(current, then)
+			}
+		}
+		record.Addresses = current
+	}
+
+	// apply the requested order: the store returns the default order,
+	// but sorting here keeps the response order defined regardless of the source
+	SortAddresses(record.Addresses, req.GetOrder())
+	SortPhones(record.Phones, req.GetOrder())
+
 	// build the response profile record
+	profile := buildProfile(record)
+	mask.apply(profile)
+
+	log.Info(fmt.Sprintf("successfully retrieved %s profile record", req.GetUsername()))
+
+	return profile, nil
+}
+
+// buildProfile converts a decrypted complete profile record, in the order its records should be returned, to the api type.
+func buildProfile(record *storage.CompleteProfile) *api.Profile {
+
 	profile := &api.Profile{
 		Uuid:      record.Profile.Uuid,
 		Username:  record.Profile.Username,
@@ -98,6 +163,10 @@ func (s *profileServer) GetProfile(ctx context.Context, req *api.GetProfileReque
 			Country:         address.Country.String,
 			UpdatedAt:       timestamppb.New(address.UpdatedAt),
 			CreatedAt:       timestamppb.New(address.CreatedAt),
+			ValidFrom:       addr.NullTimestamp(address.ValidFrom),
+			ValidTo:         addr.NullTimestamp(address.ValidTo),
+			PromoteOnStart:  address.PromoteOnStart,
+			AddressType:     addr.ConvertAddressType(address.AddressType),
 		})
 	}
 
@@ -110,17 +179,21 @@ func (s *profileServer) GetProfile(ctx context.Context, req *api.GetProfileReque
 	phones := make([]*api.Phone, 0, len(record.Phones))
 	for _, phone := range record.Phones {
 
+		number := ph.FormatNumber(phone.CountryCode.String, phone.PhoneNumber.String)
 		phones = append(phones, &api.Phone{
-			Uuid:        phone.Uuid,
-			Slug:        phone.Slug,
-			CountryCode: phone.CountryCode.String,
-			PhoneNumber: phone.PhoneNumber.String,
-			Extension:   proto.String(phone.Extension.String),
-			PhoneType:   api.PhoneType(ph.ConvertPhoneType(phone.PhoneType.String)),
-			IsCurrent:   phone.IsCurrent,
-			IsPrimary:   phone.IsPrimary,
-			UpdatedAt:   timestamppb.New(phone.UpdatedAt),
-			CreatedAt:   timestamppb.New(phone.CreatedAt),
+			Uuid:                phone.Uuid,
+			Slug:                phone.Slug,
+			CountryCode:         phone.CountryCode.String,
+			PhoneNumber:         phone.PhoneNumber.String,
+			Extension:           proto.String(phone.Extension.String),
+			PhoneType:           api.PhoneType(ph.ConvertPhoneType(phone.PhoneType.String)),
+			IsCurrent:           phone.IsCurrent,
+			IsPrimary:           phone.IsPrimary,
+			UpdatedAt:           timestamppb.New(phone.UpdatedAt),
+			CreatedAt:           timestamppb.New(phone.CreatedAt),
+			E164:                number.E164(),
+			NationalFormat:      number.NationalFormat(),
+			InternationalFormat: number.InternationalFormat(),
 		})
 	}
 
@@ -129,7 +202,5 @@ func (s *profileServer) GetProfile(ctx context.Context, req *api.GetProfileReque
 		profile.Phone = phones
 	}
 
-	log.Info(fmt.Sprintf("successfully retrieved %s profile record", req.GetUsername()))
-
-	return profile, nil
+	return profile
 }
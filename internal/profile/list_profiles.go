@@ -0,0 +1,209 @@
+package profile
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// defaultPageSize is the page size of a ListProfiles request which does not set one.
+	defaultPageSize = 50
+
+	// maxPageSize is the largest page a ListProfiles request may ask for.
+	maxPageSize = 200
+)
+
+// ListProfiles returns a page of profiles matching the request's filters for an administrator.
+func (s *profileServer) ListProfiles(ctx context.Context, req *api.ListProfilesRequest) (*api.ListProfilesResponse, error) {
+
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate user claims exist in the auth context
+	if authCtx.UserClaims == nil {
+		log.Error("auth context missing user claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing user claims")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
+
+	// authorize the request: self access is not allowed, so scopes are required
+	if err := auth.AuthorizeRequest(authCtx, authCtx.UserClaims.Subject); err != nil {
+		log.Error("failed to authorize request", "err", err.Error())
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+
+	// validate the page size
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0 || pageSize > maxPageSize:
+		log.Error(fmt.Sprintf("invalid list-profiles request: page size %d", pageSize))
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("page size must be between 1 and %d", maxPageSize))
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	}
+
+	// validate the page token
+	var cursor *storage.ProfileCursor
+	if req.GetPageToken() != "" {
+		cursor, err = decodePageToken(req.GetPageToken())
+		if err != nil {
+			log.Error("invalid list-profiles request", "err", err.Error())
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	// validate the filters
+	filter, err := buildFilter(req)
+	if err != nil {
+		log.Error("invalid list-profiles request", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// validate the read mask
+	mask, err := newReadMask(req.GetReadMask())
+	if err != nil {
+		log.Error("invalid list-profiles request", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// read one extra profile to learn whether there is a next page
+	records, err := s.profileStore.ListProfiles(ctx, *filter, cursor, pageSize+1, mask.sections())
+	if err != nil {
+		log.Error("failed to list profile records", "err", err.Error())
+		return nil, status.Error(codes.Internal, "failed to list profile records")
+	}
+
+	var next string
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		last := records[len(records)-1].Profile
+		next = encodePageToken(&storage.ProfileCursor{CreatedAt: last.CreatedAt, Uuid: last.Uuid})
+	}
+
+	profiles := make([]*api.Profile, 0, len(records))
+	for _, record := range records {
+		profile := buildProfile(record)
+		mask.apply(profile)
+		profiles = append(profiles, profile)
+	}
+
+	log.Info(fmt.Sprintf("successfully listed %d profile records", len(profiles)))
+
+	return &api.ListProfilesResponse{
+		Profiles:      profiles,
+		NextPageToken: next,
+	}, nil
+}
+
+// buildFilter validates the filters of a ListProfiles request and converts them to a storage filter.
+func buildFilter(req *api.ListProfilesRequest) (*storage.ProfileFilter, error) {
+
+	filter := &storage.ProfileFilter{
+		DarkMode:   req.DarkMode,
+		HasAddress: req.HasAddress,
+		HasPhone:   req.HasPhone,
+	}
+
+	var err error
+	if filter.CreatedFrom, err = optionalTime("created_from", req.GetCreatedFrom()); err != nil {
+		return nil, err
+	}
+	if filter.CreatedTo, err = optionalTime("created_to", req.GetCreatedTo()); err != nil {
+		return nil, err
+	}
+	if filter.UpdatedFrom, err = optionalTime("updated_from", req.GetUpdatedFrom()); err != nil {
+		return nil, err
+	}
+	if filter.UpdatedTo, err = optionalTime("updated_to", req.GetUpdatedTo()); err != nil {
+		return nil, err
+	}
+
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return nil, errors.New("created_from must be before created_to")
+	}
+
+	if filter.UpdatedFrom != nil && filter.UpdatedTo != nil && !filter.UpdatedFrom.Before(*filter.UpdatedTo) {
+		return nil, errors.New("updated_from must be before updated_to")
+	}
+
+	return filter, nil
+}
+
+// optionalTime validates an optional timestamp filter, returning nil if it is not set.
+func optionalTime(field string, ts *timestamppb.Timestamp) (*time.Time, error) {
+
+	if ts == nil {
+		return nil, nil
+	}
+
+	if err := ts.CheckValid(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", field, err)
+	}
+
+	t := ts.AsTime()
+	return &t, nil
+}
+
+// encodePageToken encodes a cursor as an opaque page token.
+func encodePageToken(cursor *storage.ProfileCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.Uuid))
+}
+
+// decodePageToken decodes and validates a page token returned by encodePageToken.
+func decodePageToken(token string) (*storage.ProfileCursor, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode page token: %v", err)
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("malformed page token")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token time: %v", err)
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid page token uuid: %v", err)
+	}
+
+	return &storage.ProfileCursor{CreatedAt: t, Uuid: id}, nil
+}
@@ -0,0 +1,271 @@
+package profile
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		cursor *storage.ProfileCursor
+	}{
+		{"whole second", &storage.ProfileCursor{CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), Uuid: "0d6c2f4e-4f5a-4c55-9a57-8f1a3f0e7b21"}},
+		{"sub-second", &storage.ProfileCursor{CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 123456789, time.UTC), Uuid: "0d6c2f4e-4f5a-4c55-9a57-8f1a3f0e7b21"}},
+		{"non utc zone", &storage.ProfileCursor{CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*60*60)), Uuid: "0d6c2f4e-4f5a-4c55-9a57-8f1a3f0e7b21"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodePageToken(encodePageToken(tc.cursor))
+			if err != nil {
+				t.Fatalf("decodePageToken() err = %v", err)
+			}
+			if !got.CreatedAt.Equal(tc.cursor.CreatedAt) || got.Uuid != tc.cursor.Uuid {
+				t.Errorf("decodePageToken() = %+v, want %+v", got, tc.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodePageTokenInvalid(t *testing.T) {
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	valid := encodePageToken(&storage.ProfileCursor{CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), Uuid: "0d6c2f4e-4f5a-4c55-9a57-8f1a3f0e7b21"})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "not a token!"},
+		{"padded base64", valid + "=="},
+		{"truncated", valid[:len(valid)-4]},
+		{"no separator", encode("2026-10-01T12:00:00Z")},
+		{"invalid time", encode("yesterday|0d6c2f4e-4f5a-4c55-9a57-8f1a3f0e7b21")},
+		{"invalid uuid", encode("2026-10-01T12:00:00Z|not-a-uuid")},
+		{"injected uuid", encode("2026-10-01T12:00:00Z|' OR 1=1 --")},
+		{"empty uuid", encode("2026-10-01T12:00:00Z|")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if cursor, err := decodePageToken(tc.token); err == nil {
+				t.Errorf("decodePageToken(%q) = %+v, want error", tc.token, cursor)
+			}
+		})
+	}
+}
+
+func TestBuildFilter(t *testing.T) {
+
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		req     *api.ListProfilesRequest
+		want    storage.ProfileFilter
+		wantErr bool
+	}{
+		{"no filters", &api.ListProfilesRequest{}, storage.ProfileFilter{}, false},
+		{
+			name: "every filter",
+			req: &api.ListProfilesRequest{
+				DarkMode:    proto.Bool(true),
+				HasAddress:  proto.Bool(false),
+				HasPhone:    proto.Bool(true),
+				CreatedFrom: timestamppb.New(t0),
+				CreatedTo:   timestamppb.New(t1),
+				UpdatedFrom: timestamppb.New(t0),
+				UpdatedTo:   timestamppb.New(t1),
+			},
+			want: storage.ProfileFilter{DarkMode: proto.Bool(true), HasAddress: proto.Bool(false), HasPhone: proto.Bool(true), CreatedFrom: &t0, CreatedTo: &t1, UpdatedFrom: &t0, UpdatedTo: &t1},
+		},
+		{"open ended range", &api.ListProfilesRequest{CreatedFrom: timestamppb.New(t1)}, storage.ProfileFilter{CreatedFrom: &t1}, false},
+		{"created from after created to", &api.ListProfilesRequest{CreatedFrom: timestamppb.New(t1), CreatedTo: timestamppb.New(t0)}, storage.ProfileFilter{}, true},
+		{"created from equal to created to", &api.ListProfilesRequest{CreatedFrom: timestamppb.New(t0), CreatedTo: timestamppb.New(t0)}, storage.ProfileFilter{}, true},
+		{"updated from after updated to", &api.ListProfilesRequest{UpdatedFrom: timestamppb.New(t1), UpdatedTo: timestamppb.New(t0)}, storage.ProfileFilter{}, true},
+		{"invalid timestamp", &api.ListProfilesRequest{UpdatedTo: &timestamppb.Timestamp{Nanos: -1}}, storage.ProfileFilter{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			got, err := buildFilter(tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("buildFilter() err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			if fmt.Sprint(filterFields(*got)) != fmt.Sprint(filterFields(tc.want)) {
+				t.Errorf("buildFilter() = %v, want %v", filterFields(*got), filterFields(tc.want))
+			}
+		})
+	}
+}
+
+// filterFields returns the values of a filter's set fields, so filters can be compared by value.
+func filterFields(f storage.ProfileFilter) []string {
+
+	var fields []string
+	for name, b := range map[string]*bool{"dark_mode": f.DarkMode, "has_address": f.HasAddress, "has_phone": f.HasPhone} {
+		if b != nil {
+			fields = append(fields, fmt.Sprintf("%s=%v", name, *b))
+		}
+	}
+	for name, t := range map[string]*time.Time{"created_from": f.CreatedFrom, "created_to": f.CreatedTo, "updated_from": f.UpdatedFrom, "updated_to": f.UpdatedTo} {
+		if t != nil {
+			fields = append(fields, fmt.Sprintf("%s=%s", name, t.Format(time.RFC3339Nano)))
+		}
+	}
+
+	slices.Sort(fields)
+	return fields
+}
+
+func TestListProfilesPageSize(t *testing.T) {
+
+	store := newFakeProfileStore()
+	s := newTestServer(store, 10)
+
+	tests := []struct {
+		name      string
+		pageSize  int32
+		wantCode  codes.Code
+		wantLimit int
+	}{
+		{"default", 0, codes.OK, defaultPageSize + 1},
+		{"smallest", 1, codes.OK, 2},
+		{"largest", maxPageSize, codes.OK, maxPageSize + 1},
+		{"too large", maxPageSize + 1, codes.InvalidArgument, 0},
+		{"negative", -1, codes.InvalidArgument, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			store.limit = 0
+			_, err := s.ListProfiles(adminContext("r:silhouette:admin:*"), &api.ListProfilesRequest{PageSize: tc.pageSize})
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("ListProfiles() code = %v, want %v: %v", code, tc.wantCode, err)
+			}
+
+			// one more profile than the page is read, to learn whether there is a next page
+			if store.limit != tc.wantLimit {
+				t.Errorf("store read %d profiles, want %d", store.limit, tc.wantLimit)
+			}
+		})
+	}
+}
+
+func TestListProfilesRequest(t *testing.T) {
+
+	store := newFakeProfileStore()
+	s := newTestServer(store, 10)
+
+	tests := []struct {
+		name     string
+		scopes   string
+		req      *api.ListProfilesRequest
+		wantCode codes.Code
+	}{
+		{"authorized", "r:silhouette:admin:*", &api.ListProfilesRequest{}, codes.OK},
+		{"missing the admin scope", "r:silhouette:profile:*", &api.ListProfilesRequest{}, codes.PermissionDenied},
+		{"tampered page token", "r:silhouette:admin:*", &api.ListProfilesRequest{PageToken: "tampered"}, codes.InvalidArgument},
+		{"invalid range", "r:silhouette:admin:*", &api.ListProfilesRequest{CreatedFrom: timestamppb.Now(), CreatedTo: timestamppb.New(time.Now().Add(-time.Hour))}, codes.InvalidArgument},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := s.ListProfiles(adminContext(tc.scopes), tc.req); status.Code(err) != tc.wantCode {
+				t.Errorf("ListProfiles() code = %v, want %v: %v", status.Code(err), tc.wantCode, err)
+			}
+		})
+	}
+
+	// a failed read does not leak the store error
+	store.err = errors.New("db down")
+	if _, err := s.ListProfiles(adminContext("r:silhouette:admin:*"), &api.ListProfilesRequest{}); status.Code(err) != codes.Internal {
+		t.Errorf("ListProfiles() with a failed read code = %v, want Internal", status.Code(err))
+	}
+}
+
+// TestListProfilesPaging pages through profiles several of which were created at the same time,
+// so a page boundary falls between profiles only their uuids order.
+func TestListProfilesPaging(t *testing.T) {
+
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	tie := t0.Add(time.Hour)
+
+	store := newFakeProfileStore()
+	for i, createdAt := range []time.Time{t0, tie, tie, tie, tie, tie.Add(time.Hour)} {
+		store.listed = append(store.listed, &storage.CompleteProfile{Profile: &sqlc.Profile{
+			Uuid:      fmt.Sprintf("00000000-0000-4000-8000-%012d", i),
+			Username:  fmt.Sprintf("user%d@example.com", i),
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}})
+	}
+	s := newTestServer(store, 10)
+
+	tests := []struct {
+		name      string
+		pageSize  int32
+		wantPages [][]int
+	}{
+		{"boundary inside the tie", 2, [][]int{{0, 1}, {2, 3}, {4, 5}}},
+		{"boundary after the first tied profile", 3, [][]int{{0, 1, 2}, {3, 4, 5}}},
+		{"last page exactly full", 6, [][]int{{0, 1, 2, 3, 4, 5}}},
+		{"one page", 10, [][]int{{0, 1, 2, 3, 4, 5}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			var (
+				token string
+				pages [][]int
+			)
+			for {
+				resp, err := s.ListProfiles(adminContext("r:silhouette:admin:*"), &api.ListProfilesRequest{PageSize: tc.pageSize, PageToken: token})
+				if err != nil {
+					t.Fatalf("ListProfiles() err = %v", err)
+				}
+
+				var page []int
+				for _, p := range resp.GetProfiles() {
+					var i int
+					fmt.Sscanf(p.GetUsername(), "user%d@example.com", &i)
+					page = append(page, i)
+				}
+				pages = append(pages, page)
+
+				if token = resp.GetNextPageToken(); token == "" {
+					break
+				}
+				if len(pages) > len(store.listed) {
+					t.Fatal("ListProfiles() did not stop paging")
+				}
+			}
+
+			if fmt.Sprint(pages) != fmt.Sprint(tc.wantPages) {
+				t.Errorf("pages = %v, want %v", pages, tc.wantPages)
+			}
+		})
+	}
+}
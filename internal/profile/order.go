@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// orderFields are the fields shared by address and phone records that determine their sort order.
+type orderFields struct {
+	uuid      string
+	isPrimary bool
+	isCurrent bool
+	updatedAt time.Time
+	createdAt time.Time
+}
+
+// compareRecords compares two records' order fields according to the requested order.
+// uuid is always the final tie-breaker so the result is deterministic.
+func compareRecords(order api.RecordOrder, a, b orderFields) int {
+
+	var c int
+	switch order {
+	case api.RecordOrder_RECORD_ORDER_CREATED_AT_ASC:
+		c = a.createdAt.Compare(b.createdAt)
+	case api.RecordOrder_RECORD_ORDER_CREATED_AT_DESC:
+		c = b.createdAt.Compare(a.createdAt)
+	case api.RecordOrder_RECORD_ORDER_UPDATED_AT_DESC:
+		c = b.updatedAt.Compare(a.updatedAt)
+	default:
+		// primary first, then current, then oldest first
+		c = cmp.Or(
+			compareTrueFirst(a.isPrimary, b.isPrimary),
+			compareTrueFirst(a.isCurrent, b.isCurrent),
+			a.createdAt.Compare(b.createdAt),
+		)
+	}
+
+	return cmp.Or(c, strings.Compare(a.uuid, b.uuid))
+}
+
+// compareTrueFirst orders true before false.
+func compareTrueFirst(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// SortAddresses sorts address records in place according to the requested order.
+func SortAddresses(addresses []*sqlc.Address, order api.RecordOrder) {
+	slices.SortFunc(addresses, func(a, b *sqlc.Address) int {
+		return compareRecords(order,
+			orderFields{a.Uuid, a.IsPrimary, a.IsCurrent, a.UpdatedAt, a.CreatedAt},
+			orderFields{b.Uuid, b.IsPrimary, b.IsCurrent, b.UpdatedAt, b.CreatedAt},
+		)
+	})
+}
+
+// SortPhones sorts phone records in place according to the requested order.
+func SortPhones(phones []*sqlc.Phone, order api.RecordOrder) {
+	slices.SortFunc(phones, func(a, b *sqlc.Phone) int {
+		return compareRecords(order,
+			orderFields{a.Uuid, a.IsPrimary, a.IsCurrent, a.UpdatedAt, a.CreatedAt},
+			orderFields{b.Uuid, b.IsPrimary, b.IsCurrent, b.UpdatedAt, b.CreatedAt},
+		)
+	})
+}
@@ -0,0 +1,138 @@
+package profile
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+func TestSortAddresses(t *testing.T) {
+
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// listed in no particular order: a and b share their timestamps, so only their uuids order them
+	addresses := func() []*sqlc.Address {
+		return []*sqlc.Address{
+			{Uuid: "d", IsCurrent: true, CreatedAt: t0.Add(3 * time.Hour), UpdatedAt: t0.Add(3 * time.Hour)},
+			{Uuid: "b", CreatedAt: t0, UpdatedAt: t0.Add(5 * time.Hour)},
+			{Uuid: "c", IsPrimary: true, IsCurrent: true, CreatedAt: t0.Add(4 * time.Hour), UpdatedAt: t0.Add(4 * time.Hour)},
+			{Uuid: "a", CreatedAt: t0, UpdatedAt: t0.Add(5 * time.Hour)},
+			{Uuid: "e", IsCurrent: true, CreatedAt: t0.Add(time.Hour), UpdatedAt: t0.Add(6 * time.Hour)},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		order api.RecordOrder
+		want  []string
+	}{
+		{"default is primary, then current, then oldest", api.RecordOrder_RECORD_ORDER_UNSPECIFIED, []string{"c", "e", "d", "a", "b"}},
+		{"created at ascending", api.RecordOrder_RECORD_ORDER_CREATED_AT_ASC, []string{"a", "b", "e", "d", "c"}},
+		{"created at descending", api.RecordOrder_RECORD_ORDER_CREATED_AT_DESC, []string{"c", "d", "e", "a", "b"}},
+		{"updated at descending", api.RecordOrder_RECORD_ORDER_UPDATED_AT_DESC, []string{"e", "a", "b", "c", "d"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			got := addresses()
+			SortAddresses(got, tc.order)
+
+			if uuids := addressUuids(got); !slices.Equal(uuids, tc.want) {
+				t.Errorf("SortAddresses() = %v, want %v", uuids, tc.want)
+			}
+
+			// the order does not depend on the input order
+			reversed := addresses()
+			slices.Reverse(reversed)
+			SortAddresses(reversed, tc.order)
+			if uuids := addressUuids(reversed); !slices.Equal(uuids, tc.want) {
+				t.Errorf("SortAddresses() of reversed input = %v, want %v", uuids, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortPhones(t *testing.T) {
+
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		phones []*sqlc.Phone
+		order  api.RecordOrder
+		want   []string
+	}{
+		{
+			name: "primary first even if older and not current",
+			phones: []*sqlc.Phone{
+				{Uuid: "current", IsCurrent: true, CreatedAt: t0},
+				{Uuid: "primary", IsPrimary: true, CreatedAt: t0.Add(time.Hour)},
+			},
+			want: []string{"primary", "current"},
+		},
+		{
+			name: "current before past",
+			phones: []*sqlc.Phone{
+				{Uuid: "past", CreatedAt: t0},
+				{Uuid: "current", IsCurrent: true, CreatedAt: t0.Add(time.Hour)},
+			},
+			want: []string{"current", "past"},
+		},
+		{
+			name: "equal timestamps fall back to uuid",
+			phones: []*sqlc.Phone{
+				{Uuid: "y", CreatedAt: t0, UpdatedAt: t0},
+				{Uuid: "x", CreatedAt: t0, UpdatedAt: t0},
+				{Uuid: "z", CreatedAt: t0, UpdatedAt: t0},
+			},
+			order: api.RecordOrder_RECORD_ORDER_UPDATED_AT_DESC,
+			want:  []string{"x", "y", "z"},
+		},
+		{
+			name: "requested order ignores primary",
+			phones: []*sqlc.Phone{
+				{Uuid: "primary", IsPrimary: true, IsCurrent: true, CreatedAt: t0},
+				{Uuid: "newer", CreatedAt: t0.Add(time.Hour)},
+			},
+			order: api.RecordOrder_RECORD_ORDER_CREATED_AT_DESC,
+			want:  []string{"newer", "primary"},
+		},
+		{
+			name: "unknown order falls back to the default",
+			phones: []*sqlc.Phone{
+				{Uuid: "newer", CreatedAt: t0.Add(time.Hour)},
+				{Uuid: "primary", IsPrimary: true, CreatedAt: t0.Add(2 * time.Hour)},
+			},
+			order: api.RecordOrder(99),
+			want:  []string{"primary", "newer"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			SortPhones(tc.phones, tc.order)
+
+			got := make([]string, len(tc.phones))
+			for i, p := range tc.phones {
+				got[i] = p.Uuid
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("SortPhones() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// addressUuids returns the uuids of the addresses in order.
+func addressUuids(addresses []*sqlc.Address) []string {
+	uuids := make([]string, len(addresses))
+	for i, a := range addresses {
+		uuids[i] = a.Uuid
+	}
+	return uuids
+}
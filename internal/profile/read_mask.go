@@ -0,0 +1,65 @@
+package profile
+
+import (
+	"fmt"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// readMask is the set of top level Profile fields a caller asked for.
+// A nil readMask selects every field.
+type readMask map[protoreflect.Name]bool
+
+// newReadMask validates a read mask against the Profile message.  Only top level fields may be selected,
+// since address and phone records are read whole.  An empty mask selects every field.
+func newReadMask(mask *fieldmaskpb.FieldMask) (readMask, error) {
+
+	if len(mask.GetPaths()) == 0 {
+		return nil, nil
+	}
+
+	fields := (&api.Profile{}).ProtoReflect().Descriptor().Fields()
+
+	selected := make(readMask, len(mask.GetPaths()))
+	for _, path := range mask.GetPaths() {
+		fd := fields.ByName(protoreflect.Name(path))
+		if fd == nil {
+			return nil, fmt.Errorf("read mask path %q is not a profile field", path)
+		}
+		selected[fd.Name()] = true
+	}
+
+	return selected, nil
+}
+
+// has reports whether the mask selects a field.
+func (m readMask) has(field protoreflect.Name) bool {
+	return m == nil || m[field]
+}
+
+// sections returns the profile sections the store needs to read to fill the selected fields.
+func (m readMask) sections() storage.ProfileSections {
+	return storage.ProfileSections{
+		Addresses: m.has("address"),
+		Phones:    m.has("phone"),
+	}
+}
+
+// apply clears every field of the profile the mask does not select.
+func (m readMask) apply(profile *api.Profile) {
+
+	if m == nil {
+		return
+	}
+
+	msg := profile.ProtoReflect()
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !m[fd.Name()] {
+			msg.Clear(fd)
+		}
+		return true
+	})
+}
@@ -0,0 +1,167 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNewReadMask(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		mask    *fieldmaskpb.FieldMask
+		want    readMask
+		wantErr bool
+	}{
+		{"nil mask selects everything", nil, nil, false},
+		{"empty mask selects everything", &fieldmaskpb.FieldMask{}, nil, false},
+		{"top level fields", &fieldmaskpb.FieldMask{Paths: []string{"username", "address"}}, readMask{"username": true, "address": true}, false},
+		{"repeated path", &fieldmaskpb.FieldMask{Paths: []string{"phone", "phone"}}, readMask{"phone": true}, false},
+		{"unknown field", &fieldmaskpb.FieldMask{Paths: []string{"username", "password"}}, nil, true},
+		{"nested path", &fieldmaskpb.FieldMask{Paths: []string{"address.city"}}, nil, true},
+		{"json name", &fieldmaskpb.FieldMask{Paths: []string{"nickName"}}, nil, true},
+		{"empty path", &fieldmaskpb.FieldMask{Paths: []string{""}}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			got, err := newReadMask(tc.mask)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newReadMask() err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			if (got == nil) != (tc.want == nil) || len(got) != len(tc.want) {
+				t.Fatalf("newReadMask() = %v, want %v", got, tc.want)
+			}
+			for field := range tc.want {
+				if !got[field] {
+					t.Errorf("newReadMask() = %v, want it to select %s", got, field)
+				}
+			}
+		})
+	}
+}
+
+func TestReadMaskSections(t *testing.T) {
+
+	tests := []struct {
+		name string
+		mask readMask
+		want storage.ProfileSections
+	}{
+		{"everything", nil, storage.AllProfileSections},
+		{"profile fields only", readMask{"username": true, "dark_mode": true}, storage.ProfileSections{}},
+		{"addresses", readMask{"username": true, "address": true}, storage.ProfileSections{Addresses: true}},
+		{"phones", readMask{"phone": true}, storage.ProfileSections{Phones: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.mask.sections(); got != tc.want {
+				t.Errorf("sections() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadMaskApply(t *testing.T) {
+
+	ts := timestamppb.New(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	full := func() *api.Profile {
+		return &api.Profile{
+			Uuid:      "uuid",
+			Username:  "user@example.com",
+			NickName:  proto.String("nick"),
+			DarkMode:  true,
+			UpdatedAt: ts,
+			CreatedAt: ts,
+			Address:   []*api.Address{{Slug: "home"}},
+			Phone:     []*api.Phone{{Slug: "mobile"}},
+		}
+	}
+
+	// the empty mask leaves the profile whole
+	profile := full()
+	readMask(nil).apply(profile)
+	if !proto.Equal(profile, full()) {
+		t.Errorf("apply() with an empty mask = %v, want the whole profile", profile)
+	}
+
+	// a mask clears every field it does not select
+	mask, err := newReadMask(&fieldmaskpb.FieldMask{Paths: []string{"username", "phone"}})
+	if err != nil {
+		t.Fatalf("newReadMask() err = %v", err)
+	}
+	profile = full()
+	mask.apply(profile)
+
+	want := &api.Profile{Username: "user@example.com", Phone: []*api.Phone{{Slug: "mobile"}}}
+	if !proto.Equal(profile, want) {
+		t.Errorf("apply() = %v, want %v", profile, want)
+	}
+	if profile.NickName != nil {
+		t.Error("expected the unselected optional nick name to be unset, not empty")
+	}
+}
+
+// TestReadMaskSkipsSections checks a mask without a section's field stops the store from reading that section.
+func TestReadMaskSkipsSections(t *testing.T) {
+
+	store := newFakeProfileStore()
+	store.add("user@example.com", []*sqlc.Address{{Uuid: "address"}}, []*sqlc.Phone{{Uuid: "phone"}})
+	s := newTestServer(store, 10)
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  storage.ProfileSections
+	}{
+		{"no mask", nil, storage.AllProfileSections},
+		{"profile fields only", []string{"username", "nick_name"}, storage.ProfileSections{}},
+		{"addresses only", []string{"address"}, storage.ProfileSections{Addresses: true}},
+		{"phones only", []string{"uuid", "phone"}, storage.ProfileSections{Phones: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			req := &api.BatchGetProfilesRequest{Usernames: []string{"user@example.com"}}
+			if tc.paths != nil {
+				req.ReadMask = &fieldmaskpb.FieldMask{Paths: tc.paths}
+			}
+
+			if _, err := s.BatchGetProfiles(serviceContext("gateway"), req); err != nil {
+				t.Fatalf("BatchGetProfiles() err = %v", err)
+			}
+			if store.sections != tc.want {
+				t.Errorf("store read sections %+v, want %+v", store.sections, tc.want)
+			}
+		})
+	}
+
+	// an invalid mask is rejected before the store is read
+	store.lookups = nil
+	_, err := s.BatchGetProfiles(serviceContext("gateway"), &api.BatchGetProfilesRequest{
+		Usernames: []string{"user@example.com"},
+		ReadMask:  &fieldmaskpb.FieldMask{Paths: []string{"address.city"}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("BatchGetProfiles() with an invalid mask code = %v, want InvalidArgument", status.Code(err))
+	}
+	if store.lookups != nil {
+		t.Error("expected an invalid mask not to read the store")
+	}
+}
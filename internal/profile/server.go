@@ -10,6 +10,7 @@ import (
 	"github.com/tdeslauriers/carapace/pkg/validate"
 	api "github.com/tdeslauriers/silhouette/api/v1"
 	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/ratelimit"
 	"github.com/tdeslauriers/silhouette/internal/storage"
 )
 
@@ -17,15 +18,23 @@ import (
 type profileServer struct {
 	profileStore storage.ProfileStore
 
+	// addressStore reads address history to answer as_of requests
+	addressStore storage.AddressStore
+
+	// phoneLookups limits FindProfileByPhone calls per calling service
+	phoneLookups ratelimit.Limiter
+
 	logger *slog.Logger
 
 	api.UnimplementedProfilesServer
 }
 
-func NewProfileServer(profileStore storage.ProfileStore) api.ProfilesServer {
+func NewProfileServer(profileStore storage.ProfileStore, addressStore storage.AddressStore, phoneLookups ratelimit.Limiter) api.ProfilesServer {
 
 	return &profileServer{
 		profileStore: profileStore,
+		addressStore: addressStore,
+		phoneLookups: phoneLookups,
 		logger: slog.Default().
 			With(slog.String(definitions.ComponentKey, definitions.ComponentProfileServer)).
 			With(slog.String(definitions.PackageKey, definitions.PackageProfile)),
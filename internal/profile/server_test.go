@@ -0,0 +1,158 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/connect"
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/auth/authtest"
+	"github.com/tdeslauriers/silhouette/internal/ratelimit"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// fakeProfileStore is an in-memory storage.ProfileStore which records the arguments of its reads.
+type fakeProfileStore struct {
+	storage.ProfileStore
+
+	profiles map[string]*storage.CompleteProfile // by username
+	phones   map[string][]string                 // usernames by "<calling code> <national number>"
+	err      error                               // returned by every read if set
+
+	// the arguments of the last read
+	lookups  []string
+	sections storage.ProfileSections
+	filter   storage.ProfileFilter
+	after    *storage.ProfileCursor
+	limit    int
+
+	// listed is the profiles ListProfiles pages through, ordered by created_at, then uuid, as the store orders them
+	listed []*storage.CompleteProfile
+}
+
+func newFakeProfileStore() *fakeProfileStore {
+	return &fakeProfileStore{
+		profiles: make(map[string]*storage.CompleteProfile),
+		phones:   make(map[string][]string),
+	}
+}
+
+// add stores a profile with its sections.
+func (f *fakeProfileStore) add(username string, addresses []*sqlc.Address, phones []*sqlc.Phone) *storage.CompleteProfile {
+
+	created := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	record := &storage.CompleteProfile{
+		Profile: &sqlc.Profile{
+			Uuid:      "uuid-" + username,
+			Username:  username,
+			NickName:  sql.NullString{String: "nick", Valid: true},
+			UpdatedAt: created,
+			CreatedAt: created,
+		},
+		Addresses: addresses,
+		Phones:    phones,
+	}
+	f.profiles[username] = record
+
+	return record
+}
+
+func (f *fakeProfileStore) GetCompleteProfiles(ctx context.Context, usernames []string, sections storage.ProfileSections) ([]storage.ProfileResult, error) {
+
+	f.lookups = usernames
+	f.sections = sections
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	results := make([]storage.ProfileResult, 0, len(usernames))
+	for _, username := range usernames {
+		if record, ok := f.profiles[username]; ok {
+			results = append(results, storage.ProfileResult{Username: username, Profile: record})
+		} else {
+			results = append(results, storage.ProfileResult{Username: username, Err: sql.ErrNoRows})
+		}
+	}
+
+	return results, nil
+}
+
+func (f *fakeProfileStore) ListProfiles(ctx context.Context, filter storage.ProfileFilter, after *storage.ProfileCursor, limit int, sections storage.ProfileSections) ([]*storage.CompleteProfile, error) {
+
+	f.filter = filter
+	f.after = after
+	f.limit = limit
+	f.sections = sections
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	// start after the cursor, as the query does
+	page := f.listed
+	if after != nil {
+		page = nil
+		for _, record := range f.listed {
+			c := record.Profile.CreatedAt.Compare(after.CreatedAt)
+			if c > 0 || (c == 0 && record.Profile.Uuid > after.Uuid) {
+				page = append(page, record)
+			}
+		}
+	}
+
+	if len(page) > limit {
+		return page[:limit], nil
+	}
+	return page, nil
+}
+
+func (f *fakeProfileStore) FindProfileByPhone(ctx context.Context, countryCode, phoneNumber string) (*sqlc.Profile, error) {
+
+	f.lookups = []string{countryCode + " " + phoneNumber}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	usernames := f.phones[countryCode+" "+phoneNumber]
+	switch len(usernames) {
+	case 0:
+		return nil, sql.ErrNoRows
+	case 1:
+		return f.profiles[usernames[0]].Profile, nil
+	default:
+		return nil, storage.ErrSharedPhone
+	}
+}
+
+// newTestServer returns a profile server backed by the store, which allows each calling service
+// phoneLookups phone lookups a minute.
+func newTestServer(store *fakeProfileStore, phoneLookups int) *profileServer {
+	return NewProfileServer(store, nil, ratelimit.NewLimiter(phoneLookups, time.Minute)).(*profileServer)
+}
+
+// serviceContext returns a request context for a calling service acting on its own behalf,
+// as the auth and telemetry interceptors would build it.
+func serviceContext(service string, scopes ...string) context.Context {
+
+	ctx := context.WithValue(context.Background(), connect.TelemetryKey, &exo.GrpcTelemetry{})
+
+	return authtest.NewContext(ctx, &auth.AuthContext{
+		RequiredScopes: scopes,
+		SvcClaims:      &jwt.Claims{Subject: service},
+	})
+}
+
+// adminContext returns a request context for an administrator calling through the gateway.
+func adminContext(scopes string) context.Context {
+
+	ctx := context.WithValue(context.Background(), connect.TelemetryKey, &exo.GrpcTelemetry{})
+
+	return authtest.NewContext(ctx, &auth.AuthContext{
+		RequiredScopes: []string{"r:silhouette:admin:*"},
+		UserClaims:     &jwt.Claims{Subject: "admin@example.com", Scopes: scopes},
+		SvcClaims:      &jwt.Claims{Subject: "gateway"},
+	})
+}
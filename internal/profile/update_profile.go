@@ -51,10 +51,8 @@ func (ps *profileServer) UpdateProfile(ctx context.Context, req *api.UpdateProfi
 		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
 	}
 
-	// add actors to audit log
-	log = log.
-		With("actor", authCtx.UserClaims.Subject).
-		With("requesting_service", authCtx.SvcClaims.Subject)
+	// add actors to audit log, including the user acted for if the actor is impersonating
+	log = log.With(authCtx.AuditFields()...)
 
 	// authorize the request
 	if err := auth.AuthorizeRequest(authCtx, req.GetUsername()); err != nil {
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter limits how often a caller, identified by a key, may perform an operation.
+type Limiter interface {
+
+	// Allow reports whether the caller may perform the operation now, consuming one of its tokens if so.
+	Allow(key string) bool
+}
+
+// NewLimiter creates a new instance of Limiter, returning a pointer to the concrete implementation.
+// Each key may perform limit operations per window, in bursts of up to limit, with
+// tokens refilling continuously over the window.
+func NewLimiter(limit int, window time.Duration) Limiter {
+
+	return &limiter{
+		capacity: float64(limit),
+		rate:     float64(limit) / window.Seconds(),
+		idle:     window,
+		buckets:  make(map[string]*bucket),
+		now:      time.Now,
+	}
+}
+
+var _ Limiter = (*limiter)(nil)
+
+// limiter is the concrete implementation of the Limiter interface: a token bucket per key.
+type limiter struct {
+	capacity float64
+	rate     float64       // tokens refilled per second
+	idle     time.Duration // a bucket untouched for this long is full, so it can be dropped
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// bucket is a single key's tokens as of its last update.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Allow reports whether the key has a token left, consuming it if so.
+func (l *limiter) Allow(key string) bool {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+	}
+
+	// refill for the time elapsed since the last update
+	b.tokens += now.Sub(b.updated).Seconds() * l.rate
+	if b.tokens > l.capacity {
+		b.tokens = l.capacity
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep drops the buckets which have been idle long enough to refill, at most once per idle period,
+// so keys which stop calling do not accumulate.
+func (l *limiter) sweep(now time.Time) {
+
+	if now.Sub(l.lastSweep) < l.idle {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.idle {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/validate"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxTokenIds is the most token ids a single RevokeTokens request may revoke.
+	maxTokenIds = 100
+
+	// maxTokenIdLength is the longest token id which can be stored.
+	maxTokenIdLength = 128
+
+	// clockSkew is how far in the future a revoked-after time may be, to allow for clock differences
+	// between services.  A later time would lock the user out until it passes.
+	clockSkew = time.Minute
+)
+
+// RevokeTokens adds tokens to the deny list by id and/or revokes a user's tokens issued before a time,
+// for the identity service, eg, when a user logs out or is disabled.
+func (s *revocationServer) RevokeTokens(ctx context.Context, req *api.RevokeTokensRequest) (*api.RevokeTokensResponse, error) {
+
+	telemetry, ok := exo.GetTelemetryFromContext(ctx)
+	if !ok {
+		// this should not be possible since the interceptor will have generated new if missing
+		s.logger.Warn("failed to get telmetry from incoming context")
+	}
+
+	// append telemetry fields
+	log := s.logger.With(telemetry.TelemetryFields()...)
+
+	// get authz context
+	authCtx, err := auth.GetAuthContext(ctx)
+	if err != nil {
+		log.Error("failed to get auth context", "err", err.Error())
+		return nil, status.Error(codes.Unauthenticated, "failed to get auth context")
+	}
+
+	// validate service claims exist in the auth context
+	if authCtx.SvcClaims == nil {
+		log.Error("auth context missing service claims")
+		return nil, status.Error(codes.Unauthenticated, "auth context missing service claims")
+	}
+
+	// add s2s to audit log, and the user if the service is acting on behalf of one
+	log = log.With(authCtx.AuditFields()...)
+
+	tokenIds, err := validateTokenIds(req)
+	if err != nil {
+		log.Error("invalid revoke-tokens request", "err", err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	username := strings.TrimSpace(req.GetUsername())
+	if len(tokenIds) == 0 && username == "" {
+		log.Error("invalid revoke-tokens request: no token ids or username")
+		return nil, status.Error(codes.InvalidArgument, "token ids or a username is required")
+	}
+
+	var revokedAfter time.Time
+	if username != "" {
+
+		// reject the whole request rather than revoke its token ids but not the user
+		if !s.revocations.UserRevocationEnabled() {
+			log.Error("invalid revoke-tokens request: user revocation is disabled")
+			return nil, status.Error(codes.FailedPrecondition, "user revocation is disabled")
+		}
+
+		if revokedAfter, err = validateUser(username, req); err != nil {
+			log.Error("invalid revoke-tokens request", "err", err.Error())
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if len(tokenIds) > 0 {
+		if err := s.revocations.RevokeTokens(ctx, tokenIds, req.GetExpiresAt().AsTime()); err != nil {
+			log.Error("failed to revoke tokens", "err", err.Error())
+			return nil, status.Error(codes.Internal, "failed to revoke tokens")
+		}
+		log.Info(fmt.Sprintf("successfully revoked %d token ids until %s", len(tokenIds), req.GetExpiresAt().AsTime().Format(time.RFC3339)))
+	}
+
+	if username != "" {
+		if err := s.revocations.RevokeUser(ctx, username, revokedAfter); err != nil {
+			log.Error(fmt.Sprintf("failed to revoke tokens of %s", username), "err", err.Error())
+			return nil, status.Error(codes.Internal, "failed to revoke user tokens")
+		}
+		log.Info(fmt.Sprintf("successfully revoked tokens of %s issued before %s", username, revokedAfter.Format(time.RFC3339)))
+	}
+
+	return &api.RevokeTokensResponse{
+		RevokedTokenIds: int32(len(tokenIds)),
+		UserRevoked:     username != "",
+	}, nil
+}
+
+// validateTokenIds validates and dedupes the token ids of a request, and checks their expiry is set.
+func validateTokenIds(req *api.RevokeTokensRequest) ([]string, error) {
+
+	if len(req.GetTokenIds()) == 0 {
+		return nil, nil
+	}
+
+	if len(req.GetTokenIds()) > maxTokenIds {
+		return nil, fmt.Errorf("at most %d token ids may be revoked at once", maxTokenIds)
+	}
+
+	seen := make(map[string]bool, len(req.GetTokenIds()))
+	tokenIds := make([]string, 0, len(req.GetTokenIds()))
+	for _, id := range req.GetTokenIds() {
+
+		id = strings.TrimSpace(id)
+		if id == "" || len(id) > maxTokenIdLength || strings.ContainsFunc(id, unicode.IsControl) {
+			return nil, fmt.Errorf("token ids must be between 1 and %d printable characters", maxTokenIdLength)
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			tokenIds = append(tokenIds, id)
+		}
+	}
+
+	if req.GetExpiresAt() == nil {
+		return nil, fmt.Errorf("expires_at is required to revoke token ids")
+	}
+
+	if err := req.GetExpiresAt().CheckValid(); err != nil {
+		return nil, fmt.Errorf("invalid expires_at: %v", err)
+	}
+
+	if !req.GetExpiresAt().AsTime().After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	return tokenIds, nil
+}
+
+// validateUser validates the username of a request and returns its revoked-after time, which defaults to now.
+// The time is truncated to the second, the precision of tokens' issued at times and of the stored time,
+// which would otherwise round it up and revoke a token issued later in the same second.
+func validateUser(username string, req *api.RevokeTokensRequest) (time.Time, error) {
+
+	if err := validate.ValidateEmail(username); err != nil {
+		return time.Time{}, fmt.Errorf("invalid username: %v", err)
+	}
+
+	if req.GetRevokedAfter() == nil {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+
+	if err := req.GetRevokedAfter().CheckValid(); err != nil {
+		return time.Time{}, fmt.Errorf("invalid revoked_after: %v", err)
+	}
+
+	revokedAfter := req.GetRevokedAfter().AsTime()
+	if revokedAfter.After(time.Now().Add(clockSkew)) {
+		return time.Time{}, fmt.Errorf("revoked_after must not be in the future")
+	}
+
+	return revokedAfter.Truncate(time.Second), nil
+}
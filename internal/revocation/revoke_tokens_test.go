@@ -0,0 +1,174 @@
+package revocation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/connect"
+	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/auth/authtest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestValidateTokenIds(t *testing.T) {
+
+	future := timestamppb.New(time.Now().Add(time.Hour))
+
+	tooMany := make([]string, maxTokenIds+1)
+	for i := range tooMany {
+		tooMany[i] = "jti"
+	}
+
+	tests := []struct {
+		name    string
+		req     *api.RevokeTokensRequest
+		want    []string
+		wantErr bool
+	}{
+		{"none", &api.RevokeTokensRequest{}, nil, false},
+		{"trimmed and deduped", &api.RevokeTokensRequest{TokenIds: []string{" jti ", "sid", "jti"}, ExpiresAt: future}, []string{"jti", "sid"}, false},
+		{"most allowed", &api.RevokeTokensRequest{TokenIds: tooMany[:maxTokenIds], ExpiresAt: future}, []string{"jti"}, false},
+		{"too many", &api.RevokeTokensRequest{TokenIds: tooMany, ExpiresAt: future}, nil, true},
+		{"empty id", &api.RevokeTokensRequest{TokenIds: []string{"jti", " "}, ExpiresAt: future}, nil, true},
+		{"too long", &api.RevokeTokensRequest{TokenIds: []string{strings.Repeat("a", maxTokenIdLength+1)}, ExpiresAt: future}, nil, true},
+		{"longest allowed", &api.RevokeTokensRequest{TokenIds: []string{strings.Repeat("a", maxTokenIdLength)}, ExpiresAt: future}, []string{strings.Repeat("a", maxTokenIdLength)}, false},
+		{"control character", &api.RevokeTokensRequest{TokenIds: []string{"jti\x00"}, ExpiresAt: future}, nil, true},
+		{"missing expiry", &api.RevokeTokensRequest{TokenIds: []string{"jti"}}, nil, true},
+		{"invalid expiry", &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: &timestamppb.Timestamp{Nanos: -1}}, nil, true},
+		{"past expiry", &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: timestamppb.New(time.Now().Add(-time.Second))}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := validateTokenIds(tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validateTokenIds() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("validateTokenIds() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+
+	past := time.Date(2026, 10, 18, 12, 0, 0, 700_000_000, time.UTC)
+
+	tests := []struct {
+		name    string
+		user    string
+		req     *api.RevokeTokensRequest
+		want    time.Time
+		wantErr bool
+	}{
+		{"truncated to the second", "user@example.com", &api.RevokeTokensRequest{RevokedAfter: timestamppb.New(past)}, past.Truncate(time.Second), false},
+		{"within the clock skew", "user@example.com", &api.RevokeTokensRequest{RevokedAfter: timestamppb.New(time.Now().Add(clockSkew / 2))}, time.Time{}, false},
+		{"future", "user@example.com", &api.RevokeTokensRequest{RevokedAfter: timestamppb.New(time.Now().Add(2 * clockSkew))}, time.Time{}, true},
+		{"invalid time", "user@example.com", &api.RevokeTokensRequest{RevokedAfter: &timestamppb.Timestamp{Nanos: -1}}, time.Time{}, true},
+		{"invalid username", "not-an-email", &api.RevokeTokensRequest{}, time.Time{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := validateUser(tc.user, tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validateUser() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.want.IsZero() && !got.Equal(tc.want) {
+				t.Errorf("validateUser() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// revoked_after defaults to now, truncated to the second
+	before := time.Now().Truncate(time.Second)
+	got, err := validateUser("user@example.com", &api.RevokeTokensRequest{})
+	if err != nil {
+		t.Fatalf("validateUser() error = %v", err)
+	}
+	if got.Nanosecond() != 0 || got.Before(before) || got.After(time.Now()) {
+		t.Errorf("validateUser() = %v, want now truncated to the second", got)
+	}
+}
+
+// fakeRevocations records the revocations made through it.
+type fakeRevocations struct {
+	auth.Revocations
+
+	userRevocation bool
+	tokenIds       []string
+	users          []string
+}
+
+func (f *fakeRevocations) UserRevocationEnabled() bool {
+	return f.userRevocation
+}
+
+func (f *fakeRevocations) RevokeTokens(ctx context.Context, tokenIds []string, expiresAt time.Time) error {
+	f.tokenIds = append(f.tokenIds, tokenIds...)
+	return nil
+}
+
+func (f *fakeRevocations) RevokeUser(ctx context.Context, username string, revokedAfter time.Time) error {
+	f.users = append(f.users, username)
+	return nil
+}
+
+func TestRevokeTokens(t *testing.T) {
+
+	// as the auth and telemetry interceptors would build it
+	telemetryCtx := context.WithValue(context.Background(), connect.TelemetryKey, &exo.GrpcTelemetry{})
+	ctx := authtest.NewContext(telemetryCtx, &auth.AuthContext{SvcClaims: &jwt.Claims{Subject: "shaw"}})
+	future := timestamppb.New(time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name           string
+		userRevocation bool
+		req            *api.RevokeTokensRequest
+		wantCode       codes.Code
+		wantTokenIds   int
+		wantUsers      int
+	}{
+		{"token ids", true, &api.RevokeTokensRequest{TokenIds: []string{"jti", "sid"}, ExpiresAt: future}, codes.OK, 2, 0},
+		{"user", true, &api.RevokeTokensRequest{Username: "user@example.com"}, codes.OK, 0, 1},
+		{"token ids and user", true, &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: future, Username: "user@example.com"}, codes.OK, 1, 1},
+		{"nothing to revoke", true, &api.RevokeTokensRequest{Username: " "}, codes.InvalidArgument, 0, 0},
+		{"invalid token ids", true, &api.RevokeTokensRequest{TokenIds: []string{"jti"}}, codes.InvalidArgument, 0, 0},
+		{"invalid user revokes nothing", true, &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: future, Username: "not-an-email"}, codes.InvalidArgument, 0, 0},
+		{"token ids while user revocation is disabled", false, &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: future}, codes.OK, 1, 0},
+		{"user while user revocation is disabled revokes nothing", false, &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: future, Username: "user@example.com"}, codes.FailedPrecondition, 0, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			revocations := &fakeRevocations{userRevocation: tc.userRevocation}
+			s := NewRevocationServer(revocations)
+
+			resp, err := s.RevokeTokens(ctx, tc.req)
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("RevokeTokens() code = %v, want %v: %v", code, tc.wantCode, err)
+			}
+			if len(revocations.tokenIds) != tc.wantTokenIds || len(revocations.users) != tc.wantUsers {
+				t.Errorf("revoked %d token ids and %d users, want %d and %d", len(revocations.tokenIds), len(revocations.users), tc.wantTokenIds, tc.wantUsers)
+			}
+			if err == nil && (int(resp.GetRevokedTokenIds()) != tc.wantTokenIds || resp.GetUserRevoked() != (tc.wantUsers == 1)) {
+				t.Errorf("RevokeTokens() = %v", resp)
+			}
+		})
+	}
+
+	// only services may revoke tokens
+	s := NewRevocationServer(&fakeRevocations{userRevocation: true})
+	if _, err := s.RevokeTokens(telemetryCtx, &api.RevokeTokensRequest{TokenIds: []string{"jti"}, ExpiresAt: future}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("RevokeTokens() without an auth context = %v, want Unauthenticated", err)
+	}
+}
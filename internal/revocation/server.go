@@ -0,0 +1,30 @@
+package revocation
+
+import (
+	"log/slog"
+
+	api "github.com/tdeslauriers/silhouette/api/v1"
+	"github.com/tdeslauriers/silhouette/internal/auth"
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+)
+
+// revocationServer is the gRPC server implementation for the Revocations service.
+type revocationServer struct {
+	revocations auth.Revocations
+
+	logger *slog.Logger
+
+	api.UnimplementedRevocationsServer
+}
+
+// NewRevocationServer creates a new instance of the Revocations gRPC server.
+// It shares the revocations instance with the auth interceptor, so its revocations are enforced at once.
+func NewRevocationServer(revocations auth.Revocations) api.RevocationsServer {
+
+	return &revocationServer{
+		revocations: revocations,
+		logger: slog.Default().
+			With(slog.String(definitions.ComponentKey, definitions.ComponentRevocationServer)).
+			With(slog.String(definitions.PackageKey, definitions.PackageRevocation)),
+	}
+}
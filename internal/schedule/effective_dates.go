@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+// EffectiveDates keeps dated address records in line with their effective ranges, and promotes
+// future dated addresses scheduled to become primary once they start.
+type EffectiveDates interface {
+
+	// Addresses starts a background job which applies address effective dates every interval
+	// until ctx is cancelled.
+	Addresses(ctx context.Context)
+}
+
+// NewEffectiveDates creates a new instance of the EffectiveDates interface, returning a pointer to the concrete implementation.
+func NewEffectiveDates(addresses storage.AddressStore, interval time.Duration) EffectiveDates {
+	return &effectiveDates{
+		addresses: addresses,
+		interval:  interval,
+
+		logger: slog.Default().
+			With(slog.String(definitions.PackageKey, definitions.PackageSchedule)).
+			With(slog.String(definitions.ComponentKey, definitions.ComponentEffectiveDates)),
+	}
+}
+
+var _ EffectiveDates = (*effectiveDates)(nil)
+
+// effectiveDates is the concrete implementation of the EffectiveDates interface.
+type effectiveDates struct {
+	addresses storage.AddressStore
+	interval  time.Duration
+
+	logger *slog.Logger
+}
+
+// Addresses starts the background effective dates job.
+func (e *effectiveDates) Addresses(ctx context.Context) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	go func(ctx context.Context) {
+
+		// run once at startup so a restart does not hold back a due promotion by an interval
+		e.runAddresses(ctx)
+
+		for {
+			// jitter so replicas do not all run at the same moment
+			next := time.Now().Add(e.interval + time.Duration(rng.Int63n(int64(e.interval)/10+1)))
+			e.logger.Info("scheduling address effective dates", slog.Time("run_at", next))
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			e.runAddresses(ctx)
+		}
+	}(ctx)
+}
+
+// runAddresses applies address effective dates as of now.
+func (e *effectiveDates) runAddresses(ctx context.Context) {
+
+	changes, err := e.addresses.ApplyEffectiveDates(ctx, time.Now().UTC())
+	if err != nil {
+		e.logger.Error("failed to apply address effective dates", "err", err.Error())
+		return
+	}
+
+	if changes.Started > 0 || changes.Ended > 0 || changes.Promoted > 0 {
+		e.logger.Info(fmt.Sprintf("applied address effective dates - %d started, %d ended, %d promoted to primary",
+			changes.Started, changes.Ended, changes.Promoted))
+	}
+}
@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/storage"
+)
+
+// Purge hard deletes tombstoned address and phone records once their restore window has passed.
+type Purge interface {
+
+	// Tombstones starts a background job which purges expired tombstones every interval
+	// until ctx is cancelled.
+	Tombstones(ctx context.Context)
+}
+
+// NewPurge creates a new instance of the Purge interface, returning a pointer to the concrete implementation.
+// Records tombstoned longer than window ago are purged.
+func NewPurge(addresses storage.AddressStore, phones storage.PhoneStore, window, interval time.Duration) Purge {
+	return &purge{
+		addresses: addresses,
+		phones:    phones,
+		window:    window,
+		interval:  interval,
+
+		logger: slog.Default().
+			With(slog.String(definitions.PackageKey, definitions.PackageSchedule)).
+			With(slog.String(definitions.ComponentKey, definitions.ComponentPurge)),
+	}
+}
+
+var _ Purge = (*purge)(nil)
+
+// purge is the concrete implementation of the Purge interface.
+type purge struct {
+	addresses storage.AddressStore
+	phones    storage.PhoneStore
+	window    time.Duration
+	interval  time.Duration
+
+	logger *slog.Logger
+}
+
+// Tombstones starts the background purge job.
+func (p *purge) Tombstones(ctx context.Context) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	go func(ctx context.Context) {
+		for {
+			// jitter so replicas do not all purge at the same moment
+			next := time.Now().Add(p.interval + time.Duration(rng.Int63n(int64(p.interval)/10+1)))
+			p.logger.Info("scheduling tombstone purge", slog.Time("run_at", next))
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			p.runTombstones(ctx)
+		}
+	}(ctx)
+}
+
+// runTombstones purges address and phone records tombstoned before the restore window.
+func (p *purge) runTombstones(ctx context.Context) {
+
+	cutoff := time.Now().UTC().Add(-p.window)
+
+	addresses, err := p.addresses.PurgeAddresses(ctx, cutoff)
+	if err != nil {
+		p.logger.Error("failed to purge tombstoned address records", "err", err.Error())
+	} else if addresses > 0 {
+		p.logger.Info(fmt.Sprintf("purged %d tombstoned address records deleted before %s", addresses, cutoff.Format(time.RFC3339)))
+	}
+
+	phones, err := p.phones.PurgePhones(ctx, cutoff)
+	if err != nil {
+		p.logger.Error("failed to purge tombstoned phone records", "err", err.Error())
+	} else if phones > 0 {
+		p.logger.Info(fmt.Sprintf("purged %d tombstoned phone records deleted before %s", phones, cutoff.Format(time.RFC3339)))
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"encoding/base64"
@@ -16,15 +17,21 @@ import (
 	"github.com/tdeslauriers/carapace/pkg/connect"
 	exo "github.com/tdeslauriers/carapace/pkg/connect/grpc"
 	"github.com/tdeslauriers/carapace/pkg/data"
-	"github.com/tdeslauriers/carapace/pkg/jwt"
 	"github.com/tdeslauriers/carapace/pkg/sign"
 	api "github.com/tdeslauriers/silhouette/api/v1"
 	"github.com/tdeslauriers/silhouette/internal/address"
+	"github.com/tdeslauriers/silhouette/internal/admin"
 	"github.com/tdeslauriers/silhouette/internal/auth"
 	"github.com/tdeslauriers/silhouette/internal/definitions"
+	"github.com/tdeslauriers/silhouette/internal/keyring"
 	"github.com/tdeslauriers/silhouette/internal/phone"
 	"github.com/tdeslauriers/silhouette/internal/profile"
+	"github.com/tdeslauriers/silhouette/internal/ratelimit"
+	"github.com/tdeslauriers/silhouette/internal/revocation"
+	"github.com/tdeslauriers/silhouette/internal/schedule"
 	"github.com/tdeslauriers/silhouette/internal/storage"
+	"github.com/tdeslauriers/silhouette/internal/storage/migrate"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/migrations"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
@@ -33,7 +40,16 @@ type Server interface {
 	Run() error
 }
 
-func New(cfg *config.Config) (Server, error) {
+func New(cfg *config.Config, settings *Settings) (Server, error) {
+
+	logger := slog.Default().
+		With(slog.String(definitions.PackageKey, definitions.PackageServer)).
+		With(slog.String(definitions.ComponentKey, definitions.ComponentServer))
+
+	// service tokens must be bound to client certificates unless binding is explicitly disabled
+	if len(settings.CertBindings) == 0 && !settings.CertBindingDisabled {
+		return nil, fmt.Errorf("no client certificate bindings configured: set SILHOUETTE_CERT_BINDINGS, or SILHOUETTE_CERT_BINDING_DISABLED=true to run without them")
+	}
 
 	// server certs
 	serverPki := &connect.Pki{
@@ -47,6 +63,108 @@ func New(cfg *config.Config) (Server, error) {
 		return nil, fmt.Errorf("failed to configure server tls: %v", err)
 	}
 
+	db, err := ConnectDb(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the database schema matches the migrations embedded in this binary
+	migrator, err := migrate.NewMigrator(db, migrations.Files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema migrations: %v", err)
+	}
+
+	newer, err := migrator.Verify(context.Background(), settings.StrictSchema)
+	if err != nil {
+		if settings.RequireCurrentSchema {
+			return nil, fmt.Errorf("database schema is not current, run `silhouette migrate up`: %v", err)
+		}
+		logger.Warn("database schema is not current", "err", err.Error())
+	}
+
+	// a newer release has migrated the database, eg, during a rolling update or after a rollback
+	for _, s := range newer {
+		logger.Warn(fmt.Sprintf("migration %d_%s was applied by a newer release and is not embedded in this binary", s.Version, s.Name))
+	}
+
+	// set up indexer to create blind indexes for encrypted data tables
+	indexer, err := NewIndexer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// set up field level encryption
+	cryptor, err := NewCryptor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// s2s jwt verifing keys
+	s2sKeyring, err := NewKeyring(cfg.ServiceName, settings.S2sVerifyingKeysPath, cfg.Jwt.S2sVerifyingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load s2s jwt verifying keys: %v", err)
+	}
+
+	// iam jwt verifying keys
+	iamKeyring, err := NewKeyring(cfg.ServiceName, settings.UserVerifyingKeysPath, cfg.Jwt.UserVerifyingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load iam jwt verifying keys: %v", err)
+	}
+
+	// users are only notified of impersonation if a webhook is configured
+	var notifier auth.ImpersonationNotifier
+	if settings.ImpersonationNotifyUrl != "" {
+		s2sClient, err := NewS2sClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifier = auth.NewWebhookNotifier(settings.ImpersonationNotifyUrl, s2sClient, settings.ImpersonationNotifyWindow)
+	}
+
+	return &server{
+		cfg:             cfg,
+		settings:        settings,
+		serverTls:       serverTlsConfig,
+		db:              db,
+		addressStore:    storage.NewAddressStore(db, indexer, cryptor, settings.AddressPrimaryPerType),
+		phoneStore:      storage.NewPhoneStore(db, indexer, cryptor),
+		profileStore:    storage.NewProfileStore(db, indexer, cryptor),
+		xrefStore:       storage.NewXrefStore(db),
+		integrity:       storage.NewIntegrityChecker(db, indexer, cryptor, settings.AddressPrimaryPerType),
+		revocations:     auth.NewRevocations(storage.NewRevocationStore(db, indexer), settings.RevocationCacheTTL, settings.UserRevocation),
+		emergencyGrants: auth.NewEmergencyGrants(storage.NewEmergencyAccessStore(db, indexer), settings.EmergencyAccessCacheTTL),
+		notifier:        notifier,
+		s2sKeyring:      s2sKeyring,
+		iamKeyring:      iamKeyring,
+
+		logger: logger,
+	}, nil
+}
+
+// NewS2sClient creates the mutual tls client for calls to other services, from the s2s client certs.
+func NewS2sClient(cfg *config.Config) (connect.TlsClient, error) {
+
+	if cfg.Certs.ClientCert == nil || cfg.Certs.ClientKey == nil || cfg.Certs.ClientCa == nil {
+		return nil, fmt.Errorf("s2s client certs are not configured")
+	}
+
+	s2sClientPki := &connect.Pki{
+		CertFile: *cfg.Certs.ClientCert,
+		KeyFile:  *cfg.Certs.ClientKey,
+		CaFiles:  []string{*cfg.Certs.ClientCa},
+	}
+
+	s2sClient, err := connect.NewTlsClient(connect.NewTlsClientConfig(s2sClientPki))
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure s2s client tls: %v", err)
+	}
+
+	return s2sClient, nil
+}
+
+// ConnectDb opens the mutual tls connection to the service database.
+func ConnectDb(cfg *config.Config) (*sql.DB, error) {
+
 	// db client certs
 	dbClientPki := &connect.Pki{
 		CertFile: *cfg.Certs.DbClientCert,
@@ -72,13 +190,23 @@ func New(cfg *config.Config) (Server, error) {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	// set up indexer to create blind indexes for encrypted data tables
+	return db, nil
+}
+
+// NewIndexer creates the blind indexer for encrypted data tables from the index secret.
+func NewIndexer(cfg *config.Config) (data.Indexer, error) {
+
 	indexer, err := data.NewIndexer([]byte(cfg.Database.IndexSecret))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create indexer: %v", err)
 	}
 
-	// set up field level encryption
+	return indexer, nil
+}
+
+// NewCryptor creates the field level encryption cryptor from the base64 encoded aes secret.
+func NewCryptor(cfg *config.Config) (data.Cryptor, error) {
+
 	aes, err := base64.StdEncoding.DecodeString(cfg.Database.FieldSecret)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode field level encryption key Env var: %v", err)
@@ -89,47 +217,42 @@ func New(cfg *config.Config) (Server, error) {
 		return nil, fmt.Errorf("failed to create field level encryption cryptor: %v", err)
 	}
 
-	// s2s jwt verifing key
-	s2sPublicKey, err := sign.ParsePublicEcdsaCert(cfg.Jwt.S2sVerifyingKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse s2s jwt verifying key: %v", err)
+	return cryptor, nil
+}
+
+// NewKeyring creates the jwt verifying keyring for a token type: from the keys path, reloaded when it changes,
+// or if no path is set, from the single base64 encoded key in the service config.
+func NewKeyring(svcName, path, configKey string) (keyring.Keyring, error) {
+
+	if path != "" {
+		return keyring.NewKeyring(svcName, path)
 	}
 
-	// jwt iamVerifier
-	iamPublicKey, err := sign.ParsePublicEcdsaCert(cfg.Jwt.UserVerifyingKey)
+	pubKey, err := sign.ParsePublicEcdsaCert(configKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse iam verifying public key: %v", err)
+		return nil, fmt.Errorf("failed to parse verifying key: %v", err)
 	}
 
-	return &server{
-		cfg:          cfg,
-		serverTls:    serverTlsConfig,
-		db:           db,
-		addressStore: storage.NewAddressStore(db, indexer, cryptor),
-		phoneStore:   storage.NewPhoneStore(db, indexer, cryptor),
-		profileStore: storage.NewProfileStore(db, indexer, cryptor),
-		xrefStore:    storage.NewXrefStore(db),
-		s2sVerifier:  jwt.NewVerifier(cfg.ServiceName, s2sPublicKey),
-		iamVerifier:  jwt.NewVerifier(cfg.ServiceName, iamPublicKey),
-
-		logger: slog.Default().
-			With(slog.String(definitions.PackageKey, definitions.PackageServer)).
-			With(slog.String(definitions.ComponentKey, definitions.ComponentServer)),
-	}, nil
+	return keyring.NewStaticKeyring(svcName, pubKey), nil
 }
 
 var _ Server = (*server)(nil)
 
 type server struct {
-	cfg          *config.Config
-	serverTls    *tls.Config
-	db           *sql.DB
-	addressStore storage.AddressStore
-	phoneStore   storage.PhoneStore
-	profileStore storage.ProfileStore
-	xrefStore    storage.XrefStore
-	s2sVerifier  jwt.Verifier
-	iamVerifier  jwt.Verifier
+	cfg             *config.Config
+	settings        *Settings
+	serverTls       *tls.Config
+	db              *sql.DB
+	addressStore    storage.AddressStore
+	phoneStore      storage.PhoneStore
+	profileStore    storage.ProfileStore
+	xrefStore       storage.XrefStore
+	integrity       storage.IntegrityChecker
+	revocations     auth.Revocations
+	emergencyGrants auth.EmergencyGrants
+	notifier        auth.ImpersonationNotifier // nil if users are not notified of impersonation
+	s2sKeyring      keyring.Keyring
+	iamKeyring      keyring.Keyring
 
 	logger *slog.Logger
 }
@@ -140,16 +263,30 @@ func (s *server) Run() error {
 	s.serverTls.MinVersion = tls.VersionTLS13
 	tlsCreds := credentials.NewTLS(s.serverTls)
 
+	// service tokens are only left unbound from client certificates if binding is explicitly disabled
+	if s.settings.CertBindingDisabled {
+		s.logger.Warn("client certificate binding is disabled: service tokens will not be bound to the client certificate")
+	}
+
 	// instantiate auth interceptor
-	authInterceptor := auth.NewAuthInterceptor(s.s2sVerifier, s.iamVerifier)
+	authInterceptor := auth.NewAuthInterceptor(s.s2sKeyring, s.iamKeyring, s.revocations, s.settings.CertBindings, s.settings.ServiceSubjects, s.notifier, s.emergencyGrants)
+
+	interceptors := []grpc.UnaryServerInterceptor{
+		exo.UnaryServerWithTelemetry(s.logger),
+		authInterceptor.Unary(),
+	}
+
+	// instantiate redact interceptor: it needs the auth context, so it is chained after the auth interceptor
+	if s.settings.RedactSensitiveFields {
+		interceptors = append(interceptors, auth.NewRedactInterceptor().Unary())
+	} else {
+		s.logger.Warn("sensitive field redaction is off: every calling service receives full addresses and phone numbers")
+	}
 
 	// isntantiate grpc server
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
-		grpc.ChainUnaryInterceptor(
-			exo.UnaryServerWithTelemetry(s.logger),
-			authInterceptor.Unary(),
-		),
+		grpc.ChainUnaryInterceptor(interceptors...),
 	)
 
 	// instantiate and register servers with grpc server
@@ -158,6 +295,8 @@ func (s *server) Run() error {
 		s.addressStore,
 		s.profileStore,
 		s.xrefStore,
+		s.settings.RestoreWindow,
+		s.settings.AddressPrimaryPerType,
 	))
 
 	// phone server
@@ -165,13 +304,34 @@ func (s *server) Run() error {
 		s.phoneStore,
 		s.profileStore,
 		s.xrefStore,
+		s.settings.RestoreWindow,
 	))
 
 	// profile server
 	api.RegisterProfilesServer(grpcServer, profile.NewProfileServer(
 		s.profileStore,
+		s.addressStore,
+		ratelimit.NewLimiter(s.settings.PhoneLookupLimit, s.settings.PhoneLookupWindow),
+	))
+
+	// admin server
+	api.RegisterAdminServer(grpcServer, admin.NewAdminServer(
+		s.integrity,
+		s.emergencyGrants,
+		s.settings.EmergencyAccessMaxDuration,
+	))
+
+	// revocation server
+	api.RegisterRevocationsServer(grpcServer, revocation.NewRevocationServer(
+		s.revocations,
 	))
 
+	// refuse to start if any registered method is missing or misconfigures its auth_config,
+	// since the auth interceptor would otherwise only fail on the method at request time
+	if err := auth.ValidateAuthConfigs(grpcServer.GetServiceInfo(), s.settings.ServiceSubjects); err != nil {
+		return fmt.Errorf("invalid auth configuration: %v", err)
+	}
+
 	listener, err := net.Listen("tcp", s.cfg.ServicePort)
 	if err != nil {
 		s.logger.Error("failed to create listener", "err", err.Error())
@@ -187,12 +347,33 @@ func (s *server) Run() error {
 		}
 	}()
 
+	// start background jobs, stopped on shutdown
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// reload verifying keys during a rollover without a restart
+	s.s2sKeyring.Watch(jobs, s.settings.KeyReloadInterval)
+	s.iamKeyring.Watch(jobs, s.settings.KeyReloadInterval)
+
+	schedule.NewPurge(
+		s.addressStore,
+		s.phoneStore,
+		s.settings.RestoreWindow,
+		s.settings.PurgeInterval,
+	).Tombstones(jobs)
+
+	schedule.NewEffectiveDates(
+		s.addressStore,
+		s.settings.EffectiveDatesInterval,
+	).Addresses(jobs)
+
 	// wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	s.logger.Info("shutting down gRPC server...")
+	stopJobs()
 
 	// Graceful stop with timeout
 	stopped := make(chan struct{})
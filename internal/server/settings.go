@@ -0,0 +1,272 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/auth"
+)
+
+// Settings holds silhouette specific configuration which is not part of the shared carapace service config.
+type Settings struct {
+
+	// RequireCurrentSchema refuses to start the server unless every embedded migration has been applied unmodified.
+	RequireCurrentSchema bool
+
+	// StrictSchema also treats migrations applied by a newer release as a schema which is not current.
+	// It is off by default, since a previous release keeps running against the migrated schema during a
+	// rolling update or rollback, and must be able to restart.
+	StrictSchema bool
+
+	// RestoreWindow is how long a deleted address or phone record can be restored before it is purged.
+	RestoreWindow time.Duration
+
+	// AddressPrimaryPerType allows a user one primary address of each address type, eg, a primary
+	// shipping and a primary billing address.  If false, a user has one primary address in all.
+	AddressPrimaryPerType bool
+
+	// PurgeInterval is how often tombstoned records past the restore window are purged.
+	PurgeInterval time.Duration
+
+	// EffectiveDatesInterval is how often dated addresses are brought in line with their ranges,
+	// which is also how late a scheduled promotion to primary can be applied.
+	EffectiveDatesInterval time.Duration
+
+	// PhoneLookupLimit is how many FindProfileByPhone calls each calling service may make per PhoneLookupWindow.
+	PhoneLookupLimit int
+
+	// PhoneLookupWindow is the period PhoneLookupLimit applies to.
+	PhoneLookupWindow time.Duration
+
+	// S2sVerifyingKeysPath is a file or directory of s2s jwt verifying keys, reloaded when it changes.
+	// If empty, the single s2s verifying key in the service config is used.
+	S2sVerifyingKeysPath string
+
+	// UserVerifyingKeysPath is a file or directory of user jwt verifying keys, reloaded when it changes.
+	// If empty, the single user verifying key in the service config is used.
+	UserVerifyingKeysPath string
+
+	// KeyReloadInterval is how often the verifying keys paths are checked for changes.
+	KeyReloadInterval time.Duration
+
+	// RevocationCacheTTL is how long token revocation lookups are cached, ie, how long a revocation
+	// made on another replica can take to be enforced.
+	RevocationCacheTTL time.Duration
+
+	// UserRevocation enforces users' revoked-after times, which adds a cached lookup per user to every
+	// request with a user token.  While it is off, RevokeTokens rejects requests that revoke a user.
+	UserRevocation bool
+
+	// RedactSensitiveFields redacts fields with a sensitive_scope option from responses to calling services
+	// without the field's scope.  It is off by default, so the pii scopes can be granted to the services which
+	// need full values before any response is redacted.
+	RedactSensitiveFields bool
+
+	// CertBindings maps client certificate identities to the service token subjects they may present.
+	// It is required unless CertBindingDisabled is set.
+	CertBindings auth.CertBindings
+
+	// CertBindingDisabled lets the server start without CertBindings, so service tokens are not bound
+	// to the client certificate and a stolen token can be replayed from any client with a valid certificate.
+	CertBindingDisabled bool
+
+	// ServiceSubjects maps the service names methods list in allowed_services, eg, "identity",
+	// to the service token subjects those services use.  The server will not start if a listed name is unmapped.
+	ServiceSubjects auth.ServiceSubjects
+
+	// ImpersonationNotifyUrl is the https webhook users are notified through when an actor acts for them.
+	// It is called with the s2s client certs.  If empty, users are not notified.
+	ImpersonationNotifyUrl string
+
+	// ImpersonationNotifyWindow is how long after notifying a user that an actor acted for them
+	// further impersonations of the user by the same actor are not notified.
+	ImpersonationNotifyWindow time.Duration
+
+	// EmergencyAccessMaxDuration is the longest break-glass grant which may be made.
+	EmergencyAccessMaxDuration time.Duration
+
+	// EmergencyAccessCacheTTL is how long break-glass grant lookups are cached, ie, how long a grant
+	// made on another replica can take to be honored.
+	EmergencyAccessCacheTTL time.Duration
+}
+
+// LoadSettings reads silhouette specific settings from environment variables.
+// Every setting is optional and falls back to a default.
+func LoadSettings() (*Settings, error) {
+
+	requireSchema, err := envBool("SILHOUETTE_REQUIRE_CURRENT_SCHEMA", false)
+	if err != nil {
+		return nil, err
+	}
+
+	strictSchema, err := envBool("SILHOUETTE_STRICT_SCHEMA", false)
+	if err != nil {
+		return nil, err
+	}
+
+	restoreWindow, err := envDuration("SILHOUETTE_RESTORE_WINDOW", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	addressPrimaryPerType, err := envBool("SILHOUETTE_ADDRESS_PRIMARY_PER_TYPE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	purgeInterval, err := envDuration("SILHOUETTE_PURGE_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveDatesInterval, err := envDuration("SILHOUETTE_EFFECTIVE_DATES_INTERVAL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	phoneLookupLimit, err := envInt("SILHOUETTE_PHONE_LOOKUP_LIMIT", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	phoneLookupWindow, err := envDuration("SILHOUETTE_PHONE_LOOKUP_WINDOW", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	keyReloadInterval, err := envDuration("SILHOUETTE_KEY_RELOAD_INTERVAL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	revocationCacheTTL, err := envDuration("SILHOUETTE_REVOCATION_CACHE_TTL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	userRevocation, err := envBool("SILHOUETTE_USER_REVOCATION_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	redactSensitiveFields, err := envBool("SILHOUETTE_REDACT_SENSITIVE_FIELDS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	certBindings, err := auth.ParseCertBindings(os.Getenv("SILHOUETTE_CERT_BINDINGS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SILHOUETTE_CERT_BINDINGS value: %v", err)
+	}
+
+	certBindingDisabled, err := envBool("SILHOUETTE_CERT_BINDING_DISABLED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if certBindingDisabled && len(certBindings) > 0 {
+		return nil, fmt.Errorf("SILHOUETTE_CERT_BINDINGS must be empty when SILHOUETTE_CERT_BINDING_DISABLED is set")
+	}
+
+	serviceSubjects, err := auth.ParseServiceSubjects(os.Getenv("SILHOUETTE_SERVICE_SUBJECTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SILHOUETTE_SERVICE_SUBJECTS value: %v", err)
+	}
+
+	impersonationNotifyWindow, err := envDuration("SILHOUETTE_IMPERSONATION_NOTIFY_WINDOW", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	emergencyAccessMaxDuration, err := envDuration("SILHOUETTE_EMERGENCY_ACCESS_MAX_DURATION", 4*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	emergencyAccessCacheTTL, err := envDuration("SILHOUETTE_EMERGENCY_ACCESS_CACHE_TTL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	notifyUrl := os.Getenv("SILHOUETTE_IMPERSONATION_NOTIFY_URL")
+	if notifyUrl != "" {
+		if u, err := url.ParseRequestURI(notifyUrl); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid SILHOUETTE_IMPERSONATION_NOTIFY_URL value: must be an absolute https url")
+		}
+	}
+
+	return &Settings{
+		RequireCurrentSchema:       requireSchema,
+		StrictSchema:               strictSchema,
+		RestoreWindow:              restoreWindow,
+		AddressPrimaryPerType:      addressPrimaryPerType,
+		PurgeInterval:              purgeInterval,
+		EffectiveDatesInterval:     effectiveDatesInterval,
+		PhoneLookupLimit:           phoneLookupLimit,
+		PhoneLookupWindow:          phoneLookupWindow,
+		S2sVerifyingKeysPath:       os.Getenv("SILHOUETTE_S2S_VERIFYING_KEYS_PATH"),
+		UserVerifyingKeysPath:      os.Getenv("SILHOUETTE_USER_VERIFYING_KEYS_PATH"),
+		KeyReloadInterval:          keyReloadInterval,
+		RevocationCacheTTL:         revocationCacheTTL,
+		UserRevocation:             userRevocation,
+		RedactSensitiveFields:      redactSensitiveFields,
+		CertBindings:               certBindings,
+		CertBindingDisabled:        certBindingDisabled,
+		ServiceSubjects:            serviceSubjects,
+		ImpersonationNotifyUrl:     notifyUrl,
+		ImpersonationNotifyWindow:  impersonationNotifyWindow,
+		EmergencyAccessMaxDuration: emergencyAccessMaxDuration,
+		EmergencyAccessCacheTTL:    emergencyAccessCacheTTL,
+	}, nil
+}
+
+// envBool reads a boolean environment variable, returning the fallback if it is not set.
+func envBool(key string, fallback bool) (bool, error) {
+
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q: must be a boolean", key, v)
+	}
+
+	return b, nil
+}
+
+// envInt reads a positive integer environment variable, returning the fallback if it is not set.
+func envInt(key string, fallback int) (int, error) {
+
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must be a positive integer", key, v)
+	}
+
+	return i, nil
+}
+
+// envDuration reads a positive duration environment variable, ie, 720h, returning the fallback if it is not set.
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must be a positive duration, ie, 720h", key, v)
+	}
+
+	return d, nil
+}
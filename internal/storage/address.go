@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tdeslauriers/carapace/pkg/data"
@@ -20,32 +21,83 @@ type AddressStore interface {
 	GetAddress(ctx context.Context, slug, username string) (*sqlc.Address, error)
 
 	// GetAddressesByUser retrieves all address records for a given user, and decrypts the records.
+	// Records are ordered primary first, then current, then by created_at ascending.
 	GetAddressesByUser(ctx context.Context, username string) ([]*sqlc.Address, error)
 
 	// CountAddresses retrieves a count of how many address records exist for a given user.
 	CountAddresses(ctx context.Context, username string) (int64, error)
 
 	// CountPrimaryAddresses retrieves a count of how many primary address records exist for a given user.
-	CountPrimaryAddresses(ctx context.Context, username string) (int64, error)
+	// If primary is tracked per address type, only records of the given type, in its stored form, are counted.
+	CountPrimaryAddresses(ctx context.Context, username, addressType string) (int64, error)
 
-	// CreateAddress creates a new address record in the database, encrypting the fields before storage.
-	CreateAddress(ctx context.Context, address *sqlc.Address) error
+	// FindDuplicateAddress retrieves the user's live address with the same fingerprint as the given plaintext
+	// address, ie, the same street lines, postal code, and country once case, spacing, and punctuation are ignored,
+	// and decrypts it.  The given address itself, by uuid, is not a duplicate, so an existing record can be checked
+	// before it is updated or restored.  Returns sql.ErrNoRows if the user has no such address.
+	FindDuplicateAddress(ctx context.Context, username string, address *sqlc.Address) (*sqlc.Address, error)
 
-	// UpdateAddress updates an existing address record in the database, encrypting the fields before storage.
-	UpdateAddress(ctx context.Context, address *sqlc.Address) error
+	// CreateAddress creates a new address record for the user in the database, encrypting the fields before storage.
+	// The record's fingerprint is computed from its plaintext fields and the username.
+	CreateAddress(ctx context.Context, username string, address *sqlc.Address) error
 
-	// DeleteAddress deletes an address record from the database.
+	// UpdateAddress updates an existing address record of the user in the database, encrypting the fields before storage.
+	// The previous encrypted state of the record is written to its history in the same transaction.
+	UpdateAddress(ctx context.Context, username string, address *sqlc.Address) error
+
+	// GetAddressHistory retrieves the prior versions of a user's address record, newest first, and decrypts them.
+	GetAddressHistory(ctx context.Context, slug, username string) ([]*sqlc.AddressHistory, error)
+
+	// GetAddressVersion retrieves a single prior version of a user's address record, and decrypts it.
+	// Returns sql.ErrNoRows if the version does not belong to the user's address.
+	GetAddressVersion(ctx context.Context, slug, username, version string) (*sqlc.AddressHistory, error)
+
+	// GetAddressHistorySince retrieves the prior versions of all of a user's live address records which were superseded
+	// after since, oldest first for each record, and decrypts them.  They are what is needed to rebuild the records as
+	// they stood at since.
+	GetAddressHistorySince(ctx context.Context, username string, since time.Time) ([]*sqlc.AddressHistory, error)
+
+	// DeleteAddress tombstones an address record so it is hidden from every lookup but can be restored
+	// until it is purged.  The primary flag is cleared.  Returns sql.ErrNoRows if no live record exists.
 	DeleteAddress(ctx context.Context, uuid string) error
+
+	// GetDeletedAddress retrieves a user's tombstoned address record if it was deleted after deletedAfter,
+	// ie, if it can still be restored, and decrypts it.  Returns sql.ErrNoRows if there is no such tombstone.
+	GetDeletedAddress(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Address, error)
+
+	// RestoreAddress restores a user's tombstoned address record if it was deleted after deletedAfter,
+	// returning the decrypted record.  Returns sql.ErrNoRows if there is no such tombstone.
+	RestoreAddress(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Address, error)
+
+	// PurgeAddresses shreds and hard deletes address records, and their history and xrefs, tombstoned before deletedBefore.
+	// Returns the number of records purged.
+	PurgeAddresses(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	// ApplyEffectiveDates brings dated address records in line with their ranges as of asOf.  Records whose
+	// range has started become current, records whose range has ended lose their current and primary flags,
+	// and records scheduled for promotion that have started become their user's primary address, of their type if
+	// primary is tracked per address type.  The previous state of every changed record is written to its history in the same transaction.
+	ApplyEffectiveDates(ctx context.Context, asOf time.Time) (*EffectiveDateChanges, error)
+}
+
+// EffectiveDateChanges counts the address records changed when effective dates are applied.
+type EffectiveDateChanges struct {
+	Started  int64
+	Ended    int64
+	Promoted int64
 }
 
 // NewAddressStore creates a new instance of AddressStore and
-// returns a pointer to an underlying implementation
-func NewAddressStore(db *sql.DB, i data.Indexer, c data.Cryptor) AddressStore {
+// returns a pointer to an underlying implementation.
+// If primaryPerType is true, a user may have one primary address of each address type, otherwise one in all.
+func NewAddressStore(db *sql.DB, i data.Indexer, c data.Cryptor, primaryPerType bool) AddressStore {
 
 	return &addressStore{
-		sql:     sqlc.New(db),
-		indexer: i,
-		cryptor: crypt.NewAddressCryptor(c),
+		db:             db,
+		sql:            sqlc.New(db),
+		indexer:        i,
+		cryptor:        crypt.NewAddressCryptor(c),
+		primaryPerType: primaryPerType,
 	}
 }
 
@@ -54,9 +106,13 @@ var _ AddressStore = (*addressStore)(nil)
 // addressStore is the concrete implementation of the AddressStore interface, providing
 // persistence operations for addresses
 type addressStore struct {
+	db      *sql.DB
 	sql     *sqlc.Queries
 	indexer data.Indexer
 	cryptor crypt.AddressCryptor
+
+	// primaryPerType tracks the primary address per address type rather than per user
+	primaryPerType bool
 }
 
 // GetAddress retrieves a user's address from the database, and decrypts the record
@@ -104,8 +160,9 @@ func (s *addressStore) CountAddresses(ctx context.Context, username string) (int
 	return s.sql.CountAddressesForUser(ctx, userIndex)
 }
 
-// CountPrimaryAddresses retrieves a count of how many primary address records exist for a given user.
-func (s *addressStore) CountPrimaryAddresses(ctx context.Context, username string) (int64, error) {
+// CountPrimaryAddresses retrieves a count of how many primary address records exist for a given user,
+// of the given type if primary is tracked per address type.
+func (s *addressStore) CountPrimaryAddresses(ctx context.Context, username, addressType string) (int64, error) {
 
 	// get username index
 	userIndex, err := s.indexer.ObtainBlindIndex(username)
@@ -114,9 +171,47 @@ func (s *addressStore) CountPrimaryAddresses(ctx context.Context, username strin
 	}
 
 	// fetch count from the db
+	if s.primaryPerType {
+		return s.sql.CountPrimaryAddressesOfTypeForUser(ctx, sqlc.CountPrimaryAddressesOfTypeForUserParams{
+			UserIndex:   userIndex,
+			AddressType: addressType,
+		})
+	}
+
 	return s.sql.CountPrimaryAddressesForUser(ctx, userIndex)
 }
 
+// FindDuplicateAddress retrieves the user's live address, other than the given address itself, with the same
+// fingerprint as the given plaintext address, and decrypts it.
+func (s *addressStore) FindDuplicateAddress(ctx context.Context, username string, address *sqlc.Address) (*sqlc.Address, error) {
+
+	// get username index
+	userIndex, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := s.indexer.ObtainBlindIndex(addressFingerprint(username, address))
+	if err != nil {
+		return nil, err
+	}
+
+	duplicate, err := s.sql.FindAddressByFingerprint(ctx, sqlc.FindAddressByFingerprintParams{
+		Fingerprint: sql.NullString{String: fingerprint, Valid: true},
+		UserIndex:   userIndex,
+		ExcludeUuid: address.Uuid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cryptor.DecryptAddress(&duplicate); err != nil {
+		return nil, err
+	}
+
+	return &duplicate, nil
+}
+
 // GetAddressesByUser retrieves all address records for a given user, and decrypts the records
 func (s *addressStore) GetAddressesByUser(ctx context.Context, username string) ([]*sqlc.Address, error) {
 
@@ -132,6 +227,12 @@ func (s *addressStore) GetAddressesByUser(ctx context.Context, username string)
 		return nil, err
 	}
 
+	return decryptAddresses(s.cryptor, records)
+}
+
+// decryptAddresses decrypts a slice of address records, concurrently if there is more than one.
+func decryptAddresses(cryptor crypt.AddressCryptor, records []sqlc.Address) ([]*sqlc.Address, error) {
+
 	// handle case where no records found
 	addresses := make([]*sqlc.Address, 0, len(records))
 	if len(records) < 1 {
@@ -142,7 +243,7 @@ func (s *addressStore) GetAddressesByUser(ctx context.Context, username string)
 	if len(records) == 1 {
 
 		// decrypt the address record's encrypted fields
-		if err := s.cryptor.DecryptAddress(&records[0]); err != nil {
+		if err := cryptor.DecryptAddress(&records[0]); err != nil {
 			return nil, err
 		}
 
@@ -150,31 +251,27 @@ func (s *addressStore) GetAddressesByUser(ctx context.Context, username string)
 	}
 
 	// handle multiple records -> decrypt concurrently
+	// records are decrypted in place so the query's sort order is preserved
 	var (
-		wg          sync.WaitGroup
-		addressesCh = make(chan *sqlc.Address, len(records))
-		errCh       = make(chan error, len(records))
+		wg    sync.WaitGroup
+		errCh = make(chan error, len(records))
 	)
-	for _, record := range records {
+	for i := range records {
 
 		wg.Add(1)
 
-		go func(record sqlc.Address) {
+		go func(record *sqlc.Address) {
 			defer wg.Done()
 
 			// decrypt the address record's encrypted fields
-			if err := s.cryptor.DecryptAddress(&record); err != nil {
+			if err := cryptor.DecryptAddress(record); err != nil {
 				errCh <- err
-				return
 			}
-
-			addressesCh <- &record
-		}(record)
+		}(&records[i])
 	}
 
 	// wait for all decryption goroutines to finish
 	wg.Wait()
-	close(addressesCh)
 	close(errCh)
 
 	// check for errs
@@ -186,16 +283,16 @@ func (s *addressStore) GetAddressesByUser(ctx context.Context, username string)
 		return nil, fmt.Errorf("failed to decrypt one or more address records: %v", errors.Join(errs...))
 	}
 
-	// build slice of decrypted records
-	for address := range addressesCh {
-		addresses = append(addresses, address)
+	// build slice of decrypted records in query order
+	for i := range records {
+		addresses = append(addresses, &records[i])
 	}
 
 	return addresses, nil
 }
 
 // CreateAddress creates a new address record in the database, encrypting the fields before storage.
-func (s *addressStore) CreateAddress(ctx context.Context, address *sqlc.Address) error {
+func (s *addressStore) CreateAddress(ctx context.Context, username string, address *sqlc.Address) error {
 
 	// if no uuid, create one
 	// this should never happen since the service layer should create prior to calling
@@ -223,6 +320,12 @@ func (s *addressStore) CreateAddress(ctx context.Context, address *sqlc.Address)
 		return err
 	}
 
+	// create the fingerprint from the plaintext fields
+	fingerprint, err := s.indexer.ObtainBlindIndex(addressFingerprint(username, address))
+	if err != nil {
+		return err
+	}
+
 	// encrypt the address record's fields
 	if err := s.cryptor.EncryptAddress(address); err != nil {
 		return err
@@ -233,43 +336,474 @@ func (s *addressStore) CreateAddress(ctx context.Context, address *sqlc.Address)
 		Uuid:           address.Uuid,
 		Slug:           address.Slug,
 		SlugIndex:      index,
+		Fingerprint:    sql.NullString{String: fingerprint, Valid: true},
 		StreetAddress:  address.AddressLine1,
 		StreetAddress2: address.AddressLine2,
 		City:           address.City,
 		State:          address.State,
 		Zip:            address.Zip,
 		Country:        address.Country,
+		AddressType:    address.AddressType,
 		IsCurrent:      address.IsCurrent,
 		IsPrimary:      address.IsPrimary,
+		ValidFrom:      address.ValidFrom,
+		ValidTo:        address.ValidTo,
+		PromoteOnStart: address.PromoteOnStart,
 		UpdatedAt:      address.UpdatedAt,
 		CreatedAt:      address.CreatedAt,
 	})
 }
 
 // UpdateAddress updates an existing address record in the database, encrypting the fields before storage.
-func (s *addressStore) UpdateAddress(ctx context.Context, address *sqlc.Address) error {
+// The previous encrypted state is copied to the record's history in the same transaction.
+func (s *addressStore) UpdateAddress(ctx context.Context, username string, address *sqlc.Address) error {
+
+	// create the history entry's uuid
+	version, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	// recompute the fingerprint from the plaintext fields
+	fingerprint, err := s.indexer.ObtainBlindIndex(addressFingerprint(username, address))
+	if err != nil {
+		return err
+	}
 
 	// encrypt the address record's fields
 	if err := s.cryptor.EncryptAddress(address); err != nil {
 		return err
 	}
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin address update transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	q := s.sql.WithTx(tx)
+
+	// copy the previous state into the history before it is overwritten
+	if err := q.SaveAddressHistory(ctx, sqlc.SaveAddressHistoryParams{
+		Uuid:         version.String(),
+		SupersededAt: address.UpdatedAt,
+		AddressUuid:  address.Uuid,
+	}); err != nil {
+		return fmt.Errorf("failed to save address history: %v", err)
+	}
+
 	// update the record in the db
-	return s.sql.UpdateAddress(ctx, sqlc.UpdateAddressParams{
+	if err := q.UpdateAddress(ctx, sqlc.UpdateAddressParams{
+		Fingerprint:    sql.NullString{String: fingerprint, Valid: true},
 		StreetAddress:  address.AddressLine1,
 		StreetAddress2: address.AddressLine2,
 		City:           address.City,
 		State:          address.State,
 		Zip:            address.Zip,
 		Country:        address.Country,
+		AddressType:    address.AddressType,
 		IsCurrent:      address.IsCurrent,
 		IsPrimary:      address.IsPrimary,
+		ValidFrom:      address.ValidFrom,
+		ValidTo:        address.ValidTo,
+		PromoteOnStart: address.PromoteOnStart,
 		UpdatedAt:      address.UpdatedAt,
 		Uuid:           address.Uuid,
+	}); err != nil {
+		return fmt.Errorf("failed to update address record: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit address update transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetAddressHistory retrieves the prior versions of a user's address record, newest first, and decrypts them.
+func (s *addressStore) GetAddressHistory(ctx context.Context, slug, username string) ([]*sqlc.AddressHistory, error) {
+
+	// get slug index
+	slugIndex, err := s.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch versions from the db
+	records, err := s.sql.FindAddressHistoryByUser(ctx, sqlc.FindAddressHistoryByUserParams{
+		SlugIndex: slugIndex,
+		UserIndex: userIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptAddressHistory(s.cryptor, records)
+}
+
+// GetAddressVersion retrieves a single prior version of a user's address record, and decrypts it.
+func (s *addressStore) GetAddressVersion(ctx context.Context, slug, username, version string) (*sqlc.AddressHistory, error) {
+
+	// get slug index
+	slugIndex, err := s.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch version from the db
+	record, err := s.sql.FindAddressVersionByUser(ctx, sqlc.FindAddressVersionByUserParams{
+		Version:   version,
+		SlugIndex: slugIndex,
+		UserIndex: userIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := decryptAddressHistory(s.cryptor, []sqlc.AddressHistory{record})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions[0], nil
+}
+
+// GetAddressHistorySince retrieves the prior versions of a user's live address records superseded after since,
+// oldest first for each record, and decrypts them.
+func (s *addressStore) GetAddressHistorySince(ctx context.Context, username string, since time.Time) ([]*sqlc.AddressHistory, error) {
+
+	// get username index
+	userIndex, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch versions from the db
+	records, err := s.sql.FindAddressHistorySince(ctx, sqlc.FindAddressHistorySinceParams{
+		UserIndex: userIndex,
+		Since:     since.UTC(),
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptAddressHistory(s.cryptor, records)
 }
 
-// DeleteAddress deletes an address record from the database.
+// decryptAddressHistory decrypts prior versions of an address record.  A version holds the
+// record's encrypted state verbatim, so it is decrypted as an address record.
+func decryptAddressHistory(cryptor crypt.AddressCryptor, records []sqlc.AddressHistory) ([]*sqlc.AddressHistory, error) {
+
+	addresses := make([]sqlc.Address, len(records))
+	for i, r := range records {
+		addresses[i] = sqlc.Address{
+			Uuid:         r.AddressUuid,
+			Slug:         r.Slug,
+			AddressLine1: r.AddressLine1,
+			AddressLine2: r.AddressLine2,
+			City:         r.City,
+			State:        r.State,
+			Zip:          r.Zip,
+			Country:      r.Country,
+		}
+	}
+
+	decrypted, err := decryptAddresses(cryptor, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// decryption preserves order, so the decrypted fields map back by position
+	versions := make([]*sqlc.AddressHistory, 0, len(records))
+	for i, a := range decrypted {
+		records[i].Slug = a.Slug
+		records[i].AddressLine1 = a.AddressLine1
+		records[i].AddressLine2 = a.AddressLine2
+		records[i].City = a.City
+		records[i].State = a.State
+		records[i].Zip = a.Zip
+		records[i].Country = a.Country
+		versions = append(versions, &records[i])
+	}
+
+	return versions, nil
+}
+
+// DeleteAddress tombstones an address record, clearing its primary flag.
 func (s *addressStore) DeleteAddress(ctx context.Context, uuid string) error {
-	return s.sql.DeleteAddress(ctx, uuid)
+
+	now := time.Now().UTC()
+	rows, err := s.sql.TombstoneAddress(ctx, sqlc.TombstoneAddressParams{
+		DeletedAt: sql.NullTime{Time: now, Valid: true},
+		UpdatedAt: now,
+		Uuid:      uuid,
+	})
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetDeletedAddress retrieves a user's tombstoned address record if it can still be restored, and decrypts it.
+func (s *addressStore) GetDeletedAddress(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Address, error) {
+
+	// get slug index
+	slugIndex, err := s.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := s.sql.FindDeletedAddressBySlugAndUser(ctx, sqlc.FindDeletedAddressBySlugAndUserParams{
+		SlugIndex:    slugIndex,
+		UserIndex:    userIndex,
+		DeletedAfter: sql.NullTime{Time: deletedAfter, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt the address record's encrypted fields
+	if err := s.cryptor.DecryptAddress(&address); err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// RestoreAddress restores a user's tombstoned address record if it was deleted after deletedAfter.
+func (s *addressStore) RestoreAddress(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Address, error) {
+
+	// get slug index
+	slugIndex, err := s.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user and window checks are part of the update so a tombstone
+	// cannot be restored by another user or after the window has passed
+	rows, err := s.sql.RestoreAddress(ctx, sqlc.RestoreAddressParams{
+		UpdatedAt:    time.Now().UTC(),
+		SlugIndex:    slugIndex,
+		UserIndex:    userIndex,
+		DeletedAfter: sql.NullTime{Time: deletedAfter, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.GetAddress(ctx, slug, username)
+}
+
+// PurgeAddresses shreds and hard deletes address records, and their history and xrefs, tombstoned before deletedBefore.
+// The encrypted fields are overwritten before the rows are deleted, all in one transaction.
+func (s *addressStore) PurgeAddresses(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin address purge transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	q := s.sql.WithTx(tx)
+	before := sql.NullTime{Time: deletedBefore, Valid: true}
+
+	if _, err := q.ShredTombstonedAddresses(ctx, before); err != nil {
+		return 0, fmt.Errorf("failed to shred tombstoned address records: %v", err)
+	}
+
+	if _, err := q.DeleteTombstonedAddressHistory(ctx, before); err != nil {
+		return 0, fmt.Errorf("failed to delete tombstoned address history: %v", err)
+	}
+
+	if _, err := q.DeleteTombstonedAddressXrefs(ctx, before); err != nil {
+		return 0, fmt.Errorf("failed to delete tombstoned address xrefs: %v", err)
+	}
+
+	purged, err := q.DeleteTombstonedAddresses(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tombstoned address records: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit address purge transaction: %v", err)
+	}
+
+	return purged, nil
+}
+
+// ApplyEffectiveDates brings dated address records in line with their ranges as of asOf, all in one transaction.
+// The state each changed record had before the run is written to its history, as UpdateAddress does, so
+// past states can be rebuilt from the history.
+func (s *addressStore) ApplyEffectiveDates(ctx context.Context, asOf time.Time) (*EffectiveDateChanges, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin effective dates transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	q := s.sql.WithTx(tx)
+	now := time.Now().UTC()
+	at := sql.NullTime{Time: asOf, Valid: true}
+
+	// a record changed more than once in a run, eg, started and then promoted, gets one version:
+	// its state before the run
+	versioned := make(map[string]bool)
+	saveVersion := func(addressUuid string) error {
+		if versioned[addressUuid] {
+			return nil
+		}
+		if err := saveAddressVersion(ctx, q, addressUuid, now); err != nil {
+			return err
+		}
+		versioned[addressUuid] = true
+		return nil
+	}
+
+	var changes EffectiveDateChanges
+
+	// ended first so a record cannot be promoted after its range is over
+	ending, err := q.FindAddressesToEnd(ctx, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find address records to end: %v", err)
+	}
+
+	for _, id := range ending {
+		if err := saveVersion(id); err != nil {
+			return nil, err
+		}
+
+		ended, err := q.EndAddress(ctx, sqlc.EndAddressParams{UpdatedAt: now, Uuid: id})
+		if err != nil {
+			return nil, fmt.Errorf("failed to end address record %s: %v", id, err)
+		}
+		changes.Ended += ended
+	}
+
+	starting, err := q.FindAddressesToStart(ctx, sqlc.FindAddressesToStartParams{AsOf: at})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find address records to start: %v", err)
+	}
+
+	for _, id := range starting {
+		if err := saveVersion(id); err != nil {
+			return nil, err
+		}
+
+		started, err := q.StartAddress(ctx, sqlc.StartAddressParams{UpdatedAt: now, Uuid: id})
+		if err != nil {
+			return nil, fmt.Errorf("failed to start address record %s: %v", id, err)
+		}
+		changes.Started += started
+	}
+
+	due, err := q.FindAddressesDueForPromotion(ctx, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find address records due for promotion: %v", err)
+	}
+
+	// a user has at most one primary address, or one per type, so the previous primary is cleared first
+	for _, d := range due {
+		previous, err := s.otherPrimaryAddresses(ctx, q, d)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find primary address for profile %s: %v", d.ProfileUuid, err)
+		}
+
+		for _, id := range previous {
+			if err := saveVersion(id); err != nil {
+				return nil, err
+			}
+
+			if err := q.ClearAddressPrimary(ctx, sqlc.ClearAddressPrimaryParams{UpdatedAt: now, Uuid: id}); err != nil {
+				return nil, fmt.Errorf("failed to clear primary address %s for profile %s: %v", id, d.ProfileUuid, err)
+			}
+		}
+
+		if err := saveVersion(d.Uuid); err != nil {
+			return nil, err
+		}
+
+		promoted, err := q.PromoteAddress(ctx, sqlc.PromoteAddressParams{UpdatedAt: now, Uuid: d.Uuid})
+		if err != nil {
+			return nil, fmt.Errorf("failed to promote address record %s: %v", d.Uuid, err)
+		}
+		changes.Promoted += promoted
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit effective dates transaction: %v", err)
+	}
+
+	return &changes, nil
+}
+
+// otherPrimaryAddresses returns the uuids of the primary addresses which a record due for promotion replaces:
+// the profile's other primary addresses, or only those of the record's type if primary is tracked per type.
+func (s *addressStore) otherPrimaryAddresses(ctx context.Context, q *sqlc.Queries, due sqlc.FindAddressesDueForPromotionRow) ([]string, error) {
+
+	if s.primaryPerType {
+		return q.FindOtherPrimaryAddressesOfType(ctx, sqlc.FindOtherPrimaryAddressesOfTypeParams{
+			ProfileUuid: due.ProfileUuid,
+			AddressType: due.AddressType,
+			Uuid:        due.Uuid,
+		})
+	}
+
+	return q.FindOtherPrimaryAddresses(ctx, sqlc.FindOtherPrimaryAddressesParams{
+		ProfileUuid: due.ProfileUuid,
+		Uuid:        due.Uuid,
+	})
+}
+
+// saveAddressVersion copies the current, still encrypted, state of an address record into its history
+// before it is changed, recording it as superseded at supersededAt.
+func saveAddressVersion(ctx context.Context, q *sqlc.Queries, addressUuid string, supersededAt time.Time) error {
+
+	version, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to create uuid for address history of %s: %v", addressUuid, err)
+	}
+
+	if err := q.SaveAddressHistory(ctx, sqlc.SaveAddressHistoryParams{
+		Uuid:         version.String(),
+		SupersededAt: supersededAt,
+		AddressUuid:  addressUuid,
+	}); err != nil {
+		return fmt.Errorf("failed to save address history of %s: %v", addressUuid, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// EmergencyGrant is a time-boxed break-glass grant of read access to every profile to a named operator.
+type EmergencyGrant struct {
+	Id                string
+	Operator          string
+	Justification     string
+	GrantedBy         string
+	RequestingService string
+	ExpiresAt         time.Time
+}
+
+// EmergencyAccessStore defines the interface for persisting break-glass grants, so every replica honors
+// the same grants.  Grants are kept after they expire as a record of the access.
+type EmergencyAccessStore interface {
+
+	// SaveGrant persists a new grant, setting its id.
+	SaveGrant(ctx context.Context, grant *EmergencyGrant) error
+
+	// GetActiveGrant returns an operator's unexpired grant which lasts longest, or nil if they have none.
+	GetActiveGrant(ctx context.Context, operator string) (*EmergencyGrant, error)
+}
+
+// NewEmergencyAccessStore creates a new instance of EmergencyAccessStore interface, returning
+// a pointer to a concrete implementation of the EmergencyAccessStore.
+func NewEmergencyAccessStore(db *sql.DB, i data.Indexer) EmergencyAccessStore {
+	return &emergencyAccessStore{
+		sql:     sqlc.New(db),
+		indexer: i,
+	}
+}
+
+var _ EmergencyAccessStore = (*emergencyAccessStore)(nil)
+
+// emergencyAccessStore is a concrete implementation of the EmergencyAccessStore interface.
+// Usernames are stored as blind indexes, as in the profile table.
+type emergencyAccessStore struct {
+	sql     *sqlc.Queries
+	indexer data.Indexer
+}
+
+// SaveGrant persists a new grant, setting its id.
+func (s *emergencyAccessStore) SaveGrant(ctx context.Context, grant *EmergencyGrant) error {
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to create uuid for emergency grant to %s: %v", grant.Operator, err)
+	}
+
+	operatorIndex, err := s.indexer.ObtainBlindIndex(grant.Operator)
+	if err != nil {
+		return err
+	}
+
+	grantedByIndex, err := s.indexer.ObtainBlindIndex(grant.GrantedBy)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sql.SaveEmergencyGrant(ctx, sqlc.SaveEmergencyGrantParams{
+		Uuid:              id.String(),
+		OperatorIndex:     operatorIndex,
+		Justification:     grant.Justification,
+		GrantedByIndex:    grantedByIndex,
+		RequestingService: grant.RequestingService,
+		ExpiresAt:         grant.ExpiresAt.UTC(),
+		CreatedAt:         time.Now().UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to save emergency grant: %v", err)
+	}
+
+	grant.Id = id.String()
+
+	return nil
+}
+
+// GetActiveGrant returns an operator's unexpired grant which lasts longest, or nil if they have none.
+// Only the fields needed to use and audit the grant are returned.
+func (s *emergencyAccessStore) GetActiveGrant(ctx context.Context, operator string) (*EmergencyGrant, error) {
+
+	index, err := s.indexer.ObtainBlindIndex(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := s.sql.FindActiveEmergencyGrant(ctx, sqlc.FindActiveEmergencyGrantParams{
+		OperatorIndex: index,
+		Now:           time.Now().UTC(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find emergency grant: %v", err)
+	}
+
+	return &EmergencyGrant{
+		Id:            row.Uuid,
+		Operator:      operator,
+		Justification: row.Justification,
+		ExpiresAt:     row.ExpiresAt,
+	}, nil
+}
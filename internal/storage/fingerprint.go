@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// addressFingerprint returns the material of an address's fingerprint: its owner and its
+// normalized street lines, postal code, and country.  The fingerprint is stored as a blind index of it,
+// so addresses differing only in case, spacing, or punctuation have the same fingerprint.
+// Fields are expected in plaintext, ie, before encryption.
+func addressFingerprint(username string, address *sqlc.Address) string {
+	return strings.Join([]string{
+		"address",
+		username,
+		foldFingerprint(address.AddressLine1.String),
+		foldFingerprint(address.AddressLine2.String),
+		foldFingerprint(address.Zip.String),
+		foldFingerprint(address.Country.String),
+	}, "|")
+}
+
+// phoneFingerprint returns the material of a phone's fingerprint: its owner and its E.164 number and extension.
+// Fields are expected in plaintext, ie, before encryption.
+func phoneFingerprint(username string, phone *sqlc.Phone) string {
+	return strings.Join([]string{
+		"phone",
+		username,
+		"+" + foldFingerprint(phone.CountryCode.String) + foldFingerprint(phone.PhoneNumber.String),
+		foldFingerprint(phone.Extension.String),
+	}, "|")
+}
+
+// phoneIndexMaterial returns the material of a phone's lookup index: its E.164 number alone, without the
+// owner or extension, so a number can be looked up without knowing whose it is.
+// Fields are expected in plaintext, ie, before encryption.
+func phoneIndexMaterial(countryCode, phoneNumber string) string {
+	return "phone_index|+" + foldFingerprint(countryCode) + foldFingerprint(phoneNumber)
+}
+
+// foldFingerprint reduces a field to its upper case letters and digits.
+func foldFingerprint(s string) string {
+	var folded strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			folded.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return folded.String()
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+func TestFoldFingerprint(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"1 Main St.", "1MAINST"},
+		{"  1   main   st  ", "1MAINST"},
+		{"Apt #4-B", "APT4B"},
+		{"SW1A 2AA", "SW1A2AA"},
+		{"62701-1234", "627011234"},
+		{"(212) 555-0123", "2125550123"},
+		{"Straße", "STRAßE"},
+		{"Österreich", "ÖSTERREICH"},
+		{"!@#$%^&*()", ""},
+	}
+
+	for _, tc := range tests {
+		if got := foldFingerprint(tc.in); got != tc.want {
+			t.Errorf("foldFingerprint(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestAddressFingerprint(t *testing.T) {
+
+	address := func(line1, line2, city, zip, country string) *sqlc.Address {
+		return &sqlc.Address{
+			AddressLine1: sql.NullString{String: line1, Valid: line1 != ""},
+			AddressLine2: sql.NullString{String: line2, Valid: line2 != ""},
+			City:         sql.NullString{String: city, Valid: city != ""},
+			Zip:          sql.NullString{String: zip, Valid: zip != ""},
+			Country:      sql.NullString{String: country, Valid: country != ""},
+		}
+	}
+	base := addressFingerprint("user@example.com", address("1 Main St", "Apt 4", "Springfield", "62701", "US"))
+
+	tests := []struct {
+		name     string
+		username string
+		address  *sqlc.Address
+		wantSame bool
+	}{
+		{"case, spacing, and punctuation are ignored", "user@example.com", address("1 MAIN  ST.", "apt. 4", "Springfield", "62701", "us"), true},
+		{"city and state are not part of it", "user@example.com", address("1 Main St", "Apt 4", "Shelbyville", "62701", "US"), true},
+		{"another street", "user@example.com", address("2 Main St", "Apt 4", "Springfield", "62701", "US"), false},
+		{"another unit", "user@example.com", address("1 Main St", "Apt 5", "Springfield", "62701", "US"), false},
+		{"no unit", "user@example.com", address("1 Main St", "", "Springfield", "62701", "US"), false},
+		{"another postal code", "user@example.com", address("1 Main St", "Apt 4", "Springfield", "62702", "US"), false},
+		{"another country", "user@example.com", address("1 Main St", "Apt 4", "Springfield", "62701", "CA"), false},
+		{"another user", "other@example.com", address("1 Main St", "Apt 4", "Springfield", "62701", "US"), false},
+		// the fields are separated, so text cannot move from one field to the next and still match
+		{"unit moved into the street", "user@example.com", address("1 Main St Apt", "4", "Springfield", "62701", "US"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := addressFingerprint(tc.username, tc.address); (got == base) != tc.wantSame {
+				t.Errorf("addressFingerprint() = %q, base %q, want same %v", got, base, tc.wantSame)
+			}
+		})
+	}
+}
+
+func TestPhoneFingerprint(t *testing.T) {
+
+	phone := func(countryCode, number, extension string) *sqlc.Phone {
+		return &sqlc.Phone{
+			CountryCode: sql.NullString{String: countryCode, Valid: countryCode != ""},
+			PhoneNumber: sql.NullString{String: number, Valid: number != ""},
+			Extension:   sql.NullString{String: extension, Valid: extension != ""},
+		}
+	}
+	base := phoneFingerprint("user@example.com", phone("1", "2125550123", "12"))
+
+	tests := []struct {
+		name     string
+		username string
+		phone    *sqlc.Phone
+		wantSame bool
+	}{
+		{"formatting is ignored", "user@example.com", phone("+1", "(212) 555-0123", "12"), true},
+		{"another number", "user@example.com", phone("1", "2125550124", "12"), false},
+		{"another extension", "user@example.com", phone("1", "2125550123", "13"), false},
+		{"no extension", "user@example.com", phone("1", "2125550123", ""), false},
+		{"another calling code", "user@example.com", phone("44", "2125550123", "12"), false},
+		{"another user", "other@example.com", phone("1", "2125550123", "12"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := phoneFingerprint(tc.username, tc.phone); (got == base) != tc.wantSame {
+				t.Errorf("phoneFingerprint() = %q, base %q, want same %v", got, base, tc.wantSame)
+			}
+		})
+	}
+
+	// the lookup index is the number alone, so it is the same for every owner and extension, and never a fingerprint
+	index := phoneIndexMaterial("1", "2125550123")
+	if index != phoneIndexMaterial("+1", "(212) 555-0123") {
+		t.Errorf("phoneIndexMaterial() depends on formatting: %q", index)
+	}
+	if index == phoneIndexMaterial("44", "2125550123") {
+		t.Error("phoneIndexMaterial() ignores the calling code")
+	}
+	if index == base || index == phoneFingerprint("user@example.com", phone("1", "2125550123", "")) {
+		t.Error("phoneIndexMaterial() collides with a fingerprint")
+	}
+}
+
+func TestFindDuplicateExcludesTheRecord(t *testing.T) {
+
+	indexer, cryptor := setupTestCrypto(t)
+
+	tests := []struct {
+		name  string
+		query string
+		find  func(db *sql.DB) error
+	}{
+		{
+			name:  "address",
+			query: "FindAddressByFingerprint",
+			find: func(db *sql.DB) error {
+				_, err := NewAddressStore(db, indexer, cryptor, false).FindDuplicateAddress(context.Background(), "user@example.com", &sqlc.Address{
+					Uuid:         "record-uuid",
+					AddressLine1: sql.NullString{String: "1 Main St", Valid: true},
+				})
+				return err
+			},
+		},
+		{
+			name:  "phone",
+			query: "FindPhoneByFingerprint",
+			find: func(db *sql.DB) error {
+				_, err := NewPhoneStore(db, indexer, cryptor).FindDuplicatePhone(context.Background(), "user@example.com", &sqlc.Phone{
+					Uuid:        "record-uuid",
+					CountryCode: sql.NullString{String: "1", Valid: true},
+					PhoneNumber: sql.NullString{String: "2125550123", Valid: true},
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db, recorder := newSqlRecorder(t)
+
+			if err := tc.find(db); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("find duplicate err = %v, want sql.ErrNoRows", err)
+			}
+
+			args, ok := recorder.call(tc.query)
+			if !ok {
+				t.Fatalf("expected %s, got %v", tc.query, recorder.names())
+			}
+			if len(args) != 3 || args[2] != driver.Value("record-uuid") {
+				t.Errorf("%s args = %v, want the record's own uuid excluded", tc.query, args)
+			}
+		})
+	}
+}
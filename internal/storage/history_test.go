@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/crypt"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+func TestUpdateAddressSavesHistory(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		errs      map[string]error
+		wantCalls []string
+		wantErr   bool
+	}{
+		{"history saved before update", nil, []string{"begin", "SaveAddressHistory", "UpdateAddress", "commit"}, false},
+		{"history fails", map[string]error{"SaveAddressHistory": errors.New("disk full")}, []string{"begin", "SaveAddressHistory", "rollback"}, true},
+		{"update fails", map[string]error{"UpdateAddress": errors.New("deadlock")}, []string{"begin", "SaveAddressHistory", "UpdateAddress", "rollback"}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			indexer, cryptor := setupTestCrypto(t)
+			db, recorder := newSqlRecorder(t)
+			for name, err := range tc.errs {
+				recorder.errs[name] = err
+			}
+
+			updatedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			err := NewAddressStore(db, indexer, cryptor, true).UpdateAddress(context.Background(), "user@example.com", &sqlc.Address{
+				Uuid:         "address-uuid",
+				Slug:         "address-slug",
+				AddressLine1: sql.NullString{String: "1 Main St", Valid: true},
+				City:         sql.NullString{String: "Springfield", Valid: true},
+				State:        sql.NullString{String: "IL", Valid: true},
+				Zip:          sql.NullString{String: "12345", Valid: true},
+				Country:      sql.NullString{String: "US", Valid: true},
+				AddressType:  "home",
+				IsCurrent:    true,
+				UpdatedAt:    updatedAt,
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("UpdateAddress() err = %v, want err %v", err, tc.wantErr)
+			}
+
+			if got := recorder.names(); !slices.Equal(got, tc.wantCalls) {
+				t.Fatalf("UpdateAddress() calls = %v, want %v", got, tc.wantCalls)
+			}
+
+			// the version is superseded when the update is made, and copies the record's current row
+			args, _ := recorder.call("SaveAddressHistory")
+			if len(args) != 3 || args[0] == "" || args[1] != updatedAt || args[2] != "address-uuid" {
+				t.Errorf("SaveAddressHistory args = %v, want a version uuid, %v, and the address uuid", args, updatedAt)
+			}
+		})
+	}
+}
+
+func TestUpdatePhoneSavesHistory(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		errs      map[string]error
+		wantCalls []string
+		wantErr   bool
+	}{
+		{"history saved before update", nil, []string{"begin", "SavePhoneHistory", "UpdatePhone", "commit"}, false},
+		{"history fails", map[string]error{"SavePhoneHistory": errors.New("disk full")}, []string{"begin", "SavePhoneHistory", "rollback"}, true},
+		{"update fails", map[string]error{"UpdatePhone": errors.New("deadlock")}, []string{"begin", "SavePhoneHistory", "UpdatePhone", "rollback"}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			indexer, cryptor := setupTestCrypto(t)
+			db, recorder := newSqlRecorder(t)
+			for name, err := range tc.errs {
+				recorder.errs[name] = err
+			}
+
+			updatedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			err := NewPhoneStore(db, indexer, cryptor).UpdatePhone(context.Background(), "user@example.com", &sqlc.Phone{
+				Uuid:        "phone-uuid",
+				Slug:        "phone-slug",
+				CountryCode: sql.NullString{String: "1", Valid: true},
+				PhoneNumber: sql.NullString{String: "2025550123", Valid: true},
+				PhoneType:   sql.NullString{String: "MOBILE", Valid: true},
+				IsCurrent:   true,
+				UpdatedAt:   updatedAt,
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("UpdatePhone() err = %v, want err %v", err, tc.wantErr)
+			}
+
+			if got := recorder.names(); !slices.Equal(got, tc.wantCalls) {
+				t.Fatalf("UpdatePhone() calls = %v, want %v", got, tc.wantCalls)
+			}
+
+			args, _ := recorder.call("SavePhoneHistory")
+			if len(args) != 3 || args[0] == "" || args[1] != updatedAt || args[2] != "phone-uuid" {
+				t.Errorf("SavePhoneHistory args = %v, want a version uuid, %v, and the phone uuid", args, updatedAt)
+			}
+		})
+	}
+}
+
+// encryptedAddressVersion returns a history row holding the encrypted state of an address.
+func encryptedAddressVersion(t *testing.T, c crypt.AddressCryptor, version, street string, supersededAt time.Time) []driver.Value {
+
+	address := &sqlc.Address{
+		Uuid:         "address-uuid",
+		Slug:         "address-slug",
+		AddressLine1: sql.NullString{String: street, Valid: true},
+		City:         sql.NullString{String: "Springfield", Valid: true},
+		State:        sql.NullString{String: "IL", Valid: true},
+		Zip:          sql.NullString{String: "12345", Valid: true},
+		Country:      sql.NullString{String: "US", Valid: true},
+	}
+	if err := c.EncryptAddress(address); err != nil {
+		t.Fatal(err)
+	}
+
+	return modelRow(t, sqlc.AddressHistory{
+		Uuid:         version,
+		AddressUuid:  address.Uuid,
+		Slug:         address.Slug,
+		AddressLine1: address.AddressLine1,
+		AddressLine2: address.AddressLine2,
+		City:         address.City,
+		State:        address.State,
+		Zip:          address.Zip,
+		Country:      address.Country,
+		IsCurrent:    true,
+		AddressType:  "home",
+		UpdatedAt:    supersededAt.Add(-time.Hour),
+		CreatedAt:    supersededAt.Add(-48 * time.Hour),
+		SupersededAt: supersededAt,
+	})
+}
+
+func TestGetAddressHistory(t *testing.T) {
+
+	indexer, cryptor := setupTestCrypto(t)
+	db, recorder := newSqlRecorder(t)
+	addressCryptor := crypt.NewAddressCryptor(cryptor)
+
+	// the query returns the newest version first
+	newest := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	recorder.rows["FindAddressHistoryByUser"] = [][]driver.Value{
+		encryptedAddressVersion(t, addressCryptor, "version-2", "2 Elm St", newest),
+		encryptedAddressVersion(t, addressCryptor, "version-1", "1 Main St", newest.Add(-24*time.Hour)),
+	}
+
+	history, err := NewAddressStore(db, indexer, cryptor, true).GetAddressHistory(context.Background(), "address-slug", "user@example.com")
+	if err != nil {
+		t.Fatalf("GetAddressHistory() err = %v", err)
+	}
+
+	if len(history) != 2 {
+		t.Fatalf("GetAddressHistory() returned %d versions, want 2", len(history))
+	}
+
+	for i, want := range []struct{ version, street string }{{"version-2", "2 Elm St"}, {"version-1", "1 Main St"}} {
+		got := history[i]
+		if got.Uuid != want.version || got.AddressLine1.String != want.street || got.Slug != "address-slug" || got.Country.String != "US" {
+			t.Errorf("version %d = %s %q %q %q, want %s %q decrypted", i, got.Uuid, got.Slug, got.AddressLine1.String, got.Country.String, want.version, want.street)
+		}
+		if got.AddressType != "home" || !got.IsCurrent {
+			t.Errorf("version %d lost its unencrypted fields: %+v", i, got)
+		}
+	}
+	if !history[0].SupersededAt.Equal(newest) {
+		t.Errorf("expected the superseded time to be kept, got %v", history[0].SupersededAt)
+	}
+
+	// the versions are looked up by blind index, never by plaintext
+	slugIndex, _ := indexer.ObtainBlindIndex("address-slug")
+	userIndex, _ := indexer.ObtainBlindIndex("user@example.com")
+	if args, _ := recorder.call("FindAddressHistoryByUser"); !slices.Equal(args, []driver.Value{slugIndex, userIndex}) {
+		t.Errorf("FindAddressHistoryByUser args = %v, want the slug and user blind indexes", args)
+	}
+}
+
+func TestGetAddressVersionNotFound(t *testing.T) {
+
+	indexer, cryptor := setupTestCrypto(t)
+	db, _ := newSqlRecorder(t)
+
+	_, err := NewAddressStore(db, indexer, cryptor, true).GetAddressVersion(context.Background(), "address-slug", "user@example.com", "version-1")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetAddressVersion() err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestApplyEffectiveDatesSavesHistory(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		primaryPerType bool
+		findPrimaries  string
+	}{
+		{"primary per user", false, "FindOtherPrimaryAddresses"},
+		{"primary per type", true, "FindOtherPrimaryAddressesOfType"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			indexer, cryptor := setupTestCrypto(t)
+			db, recorder := newSqlRecorder(t)
+
+			// ended-1 has ended; started-1 has started and is due for promotion over primary-1
+			recorder.rows["FindAddressesToEnd"] = [][]driver.Value{{"ended-1"}}
+			recorder.rows["FindAddressesToStart"] = [][]driver.Value{{"started-1"}}
+			recorder.rows["FindAddressesDueForPromotion"] = [][]driver.Value{{"started-1", "HOME", "profile-1"}}
+			recorder.rows[tc.findPrimaries] = [][]driver.Value{{"primary-1"}}
+
+			changes, err := NewAddressStore(db, indexer, cryptor, tc.primaryPerType).ApplyEffectiveDates(context.Background(), time.Now().UTC())
+			if err != nil {
+				t.Fatalf("ApplyEffectiveDates() err = %v", err)
+			}
+
+			if changes.Ended != 1 || changes.Started != 1 || changes.Promoted != 1 {
+				t.Errorf("ApplyEffectiveDates() = %+v, want one of each change", changes)
+			}
+
+			// every change is preceded by a version of the record, and started-1 gets one version for both of its changes
+			want := []string{
+				"begin",
+				"FindAddressesToEnd", "SaveAddressHistory", "EndAddress",
+				"FindAddressesToStart", "SaveAddressHistory", "StartAddress",
+				"FindAddressesDueForPromotion", tc.findPrimaries, "SaveAddressHistory", "ClearAddressPrimary", "PromoteAddress",
+				"commit",
+			}
+			if got := recorder.names(); !slices.Equal(got, want) {
+				t.Fatalf("ApplyEffectiveDates() calls = %v, want %v", got, want)
+			}
+
+			var versioned []driver.Value
+			for _, c := range recorder.calls {
+				if c.name == "SaveAddressHistory" {
+					versioned = append(versioned, c.args[2])
+				}
+			}
+			if !slices.Equal(versioned, []driver.Value{"ended-1", "started-1", "primary-1"}) {
+				t.Errorf("versions saved for %v, want ended-1, started-1, and primary-1", versioned)
+			}
+		})
+	}
+}
+
+func TestCountPrimaryAddresses(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		primaryPerType bool
+		wantQuery      string
+		wantArgs       int
+	}{
+		{"primary per user ignores the type", false, "CountPrimaryAddressesForUser", 1},
+		{"primary per type", true, "CountPrimaryAddressesOfTypeForUser", 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			indexer, cryptor := setupTestCrypto(t)
+			db, recorder := newSqlRecorder(t)
+			recorder.rows[tc.wantQuery] = [][]driver.Value{{int64(1)}}
+
+			count, err := NewAddressStore(db, indexer, cryptor, tc.primaryPerType).CountPrimaryAddresses(context.Background(), "user@example.com", "HOME")
+			if err != nil {
+				t.Fatalf("CountPrimaryAddresses() err = %v", err)
+			}
+			if count != 1 {
+				t.Errorf("CountPrimaryAddresses() = %d, want 1", count)
+			}
+
+			args, ok := recorder.call(tc.wantQuery)
+			if !ok {
+				t.Fatalf("expected %s, got %v", tc.wantQuery, recorder.names())
+			}
+			if len(args) != tc.wantArgs {
+				t.Errorf("%s args = %v, want %d", tc.wantQuery, args, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestApplyEffectiveDatesRollsBack(t *testing.T) {
+
+	indexer, cryptor := setupTestCrypto(t)
+	db, recorder := newSqlRecorder(t)
+
+	recorder.rows["FindAddressesToEnd"] = [][]driver.Value{{"ended-1"}}
+	recorder.errs["SaveAddressHistory"] = errors.New("disk full")
+
+	if _, err := NewAddressStore(db, indexer, cryptor, true).ApplyEffectiveDates(context.Background(), time.Now().UTC()); err == nil {
+		t.Fatal("expected an error when the history cannot be saved")
+	}
+
+	// the record must not change without its history
+	want := []string{"begin", "FindAddressesToEnd", "SaveAddressHistory", "rollback"}
+	if got := recorder.names(); !slices.Equal(got, want) {
+		t.Errorf("ApplyEffectiveDates() calls = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,525 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/silhouette/internal/storage/crypt"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// FindingKind identifies the type of integrity problem found in the database.
+type FindingKind string
+
+const (
+	FindingOrphanAddress     FindingKind = "orphan_address"      // address row with no profile_address link
+	FindingOrphanPhone       FindingKind = "orphan_phone"        // phone row with no profile_phone link
+	FindingDuplicatePrimary  FindingKind = "duplicate_primary"   // more than one primary address or phone for a user
+	FindingPrimaryNotCurrent FindingKind = "primary_not_current" // primary address or phone which is not current
+	FindingDecryptFailure    FindingKind = "decrypt_failure"     // row with fields that fail to decrypt
+	FindingOverQuota         FindingKind = "over_quota"          // user with more address or phone records than allowed
+	FindingUserIndexMismatch FindingKind = "user_index_mismatch" // profile user_index does not match its decrypted username
+	FindingFingerprintStale  FindingKind = "fingerprint_stale"   // address or phone fingerprint missing or not matching its decrypted fields
+	FindingPhoneIndexStale   FindingKind = "phone_index_stale"   // phone lookup index missing or not matching its decrypted number
+)
+
+const (
+	// RecordQuota is the number of address and phone records allowed per user, including non-current records.
+	// The create and restore handlers enforce it, and the integrity checker reports users over it.
+	RecordQuota = 3
+
+	// orphanGracePeriod is how old an orphaned row must be before repair deletes it,
+	// so rows whose xref is still being written by an in-flight create are not removed.
+	orphanGracePeriod = time.Hour
+)
+
+// Finding is a single integrity problem.  It never includes decrypted values.
+type Finding struct {
+	Kind        FindingKind
+	Table       string // table of the offending row: profile, address, or phone
+	Uuid        string // uuid of the offending row
+	ProfileUuid string // uuid of the owning profile, if known
+	Detail      string
+	Repaired    bool // true if repair mode fixed the problem
+}
+
+// IntegrityReport is the result of an integrity check.
+type IntegrityReport struct {
+	Findings         []Finding
+	ProfilesScanned  int
+	AddressesScanned int
+	PhonesScanned    int
+	Repair           bool // true if repair mode was requested
+	CheckedAt        time.Time
+}
+
+// Unrepaired returns the number of findings which still need attention.
+func (r *IntegrityReport) Unrepaired() int {
+	var count int
+	for _, f := range r.Findings {
+		if !f.Repaired {
+			count++
+		}
+	}
+	return count
+}
+
+// IntegrityChecker scans the database for orphaned rows and violated invariants.
+type IntegrityChecker interface {
+
+	// CheckIntegrity scans every profile, address, and phone row and reports problems.
+	// If repair is true, safe fixes are applied:
+	//   - orphaned address and phone rows older than the grace period are deleted
+	//   - extra primary flags are cleared, keeping the most recently updated current primary (of each address type,
+	//     if primary addresses are tracked per type)
+	//   - primary flags on non-current records are cleared
+	//   - mismatched user_index values are recomputed from the decrypted username
+	//   - missing or stale address and phone fingerprints are recomputed from the decrypted fields
+	//   - missing or stale phone lookup indexes are recomputed from the decrypted number
+	// Decryption failures and over quota users are only reported since they need a human decision.
+	CheckIntegrity(ctx context.Context, repair bool) (*IntegrityReport, error)
+}
+
+// NewIntegrityChecker creates a new instance of IntegrityChecker, returning
+// a pointer to the concrete implementation.
+// addressPrimaryPerType must match the address store's, so only the primaries it would not allow are reported.
+func NewIntegrityChecker(db *sql.DB, i data.Indexer, c data.Cryptor, addressPrimaryPerType bool) IntegrityChecker {
+
+	return &integrityChecker{
+		sql:                   sqlc.New(db),
+		indexer:               i,
+		profileCryptor:        crypt.NewProfileCryptor(c),
+		addressCryptor:        crypt.NewAddressCryptor(c),
+		phoneCryptor:          crypt.NewPhoneCryptor(c),
+		addressPrimaryPerType: addressPrimaryPerType,
+	}
+}
+
+var _ IntegrityChecker = (*integrityChecker)(nil)
+
+// integrityChecker is the concrete implementation of the IntegrityChecker interface.
+type integrityChecker struct {
+	sql            *sqlc.Queries
+	indexer        data.Indexer
+	profileCryptor crypt.ProfileCryptor
+	addressCryptor crypt.AddressCryptor
+	phoneCryptor   crypt.PhoneCryptor
+
+	// addressPrimaryPerType allows a primary address of each address type
+	addressPrimaryPerType bool
+}
+
+// recordFlags are the primary/current flags of an address or phone linked to a profile.
+type recordFlags struct {
+	profileUuid string
+	uuid        string
+	isCurrent   bool
+	isPrimary   bool
+
+	// primaryScope groups the records a profile may have one primary of, eg, the address type
+	primaryScope string
+}
+
+// CheckIntegrity scans the database and reports problems, optionally repairing the safe ones.
+func (ic *integrityChecker) CheckIntegrity(ctx context.Context, repair bool) (*IntegrityReport, error) {
+
+	report := &IntegrityReport{
+		Repair:    repair,
+		CheckedAt: time.Now().UTC(),
+	}
+
+	usernames, err := ic.checkProfiles(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ic.checkAddresses(ctx, report, usernames); err != nil {
+		return nil, err
+	}
+
+	if err := ic.checkPhones(ctx, report, usernames); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// checkProfiles decrypts every profile and compares its user_index to the blind index of the username.
+// Returns the decrypted usernames by profile uuid.
+func (ic *integrityChecker) checkProfiles(ctx context.Context, report *IntegrityReport) (map[string]string, error) {
+
+	profiles, err := ic.sql.FindAllProfiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve profile records: %v", err)
+	}
+	report.ProfilesScanned = len(profiles)
+
+	usernames := make(map[string]string, len(profiles))
+
+	for i := range profiles {
+		profile := &profiles[i]
+
+		if err := ic.profileCryptor.DecryptProfile(profile); err != nil {
+			report.Findings = append(report.Findings, Finding{
+				Kind:        FindingDecryptFailure,
+				Table:       "profile",
+				Uuid:        profile.Uuid,
+				ProfileUuid: profile.Uuid,
+				Detail:      err.Error(),
+			})
+			continue
+		}
+		usernames[profile.Uuid] = profile.Username
+
+		index, err := ic.indexer.ObtainBlindIndex(profile.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain blind index for profile %s: %v", profile.Uuid, err)
+		}
+
+		if index == profile.UserIndex {
+			continue
+		}
+
+		finding := Finding{
+			Kind:        FindingUserIndexMismatch,
+			Table:       "profile",
+			Uuid:        profile.Uuid,
+			ProfileUuid: profile.Uuid,
+			Detail:      "user_index does not match the blind index of the decrypted username",
+		}
+
+		if report.Repair {
+			// fails on the unique index if another profile already holds the username's index,
+			// which is a duplicate profile and needs a human decision
+			if err := ic.sql.UpdateProfileUserIndex(ctx, sqlc.UpdateProfileUserIndexParams{
+				UserIndex: index,
+				Uuid:      profile.Uuid,
+			}); err != nil {
+				finding.Detail = fmt.Sprintf("%s; repair failed: %v", finding.Detail, err)
+			} else {
+				finding.Repaired = true
+			}
+		}
+
+		report.Findings = append(report.Findings, finding)
+	}
+
+	return usernames, nil
+}
+
+// checkAddresses checks address rows for decryption failures, orphans, stale fingerprints, and primary/quota violations.
+func (ic *integrityChecker) checkAddresses(ctx context.Context, report *IntegrityReport, usernames map[string]string) error {
+
+	addresses, err := ic.sql.FindAllAddresses(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve address records: %v", err)
+	}
+	report.AddressesScanned = len(addresses)
+
+	decrypted := make(map[string]*sqlc.Address, len(addresses))
+	for i := range addresses {
+		if err := ic.addressCryptor.DecryptAddress(&addresses[i]); err != nil {
+			report.Findings = append(report.Findings, Finding{
+				Kind:   FindingDecryptFailure,
+				Table:  "address",
+				Uuid:   addresses[i].Uuid,
+				Detail: err.Error(),
+			})
+			continue
+		}
+		decrypted[addresses[i].Uuid] = &addresses[i]
+	}
+
+	orphans, err := ic.sql.FindOrphanAddresses(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve orphaned address records: %v", err)
+	}
+
+	for _, orphan := range orphans {
+		report.Findings = append(report.Findings, ic.repairOrphan(ctx, report.Repair, Finding{
+			Kind:   FindingOrphanAddress,
+			Table:  "address",
+			Uuid:   orphan.Uuid,
+			Detail: "address record is not linked to a profile",
+		}, orphan.CreatedAt, ic.sql.DeleteAddress))
+	}
+
+	rows, err := ic.sql.FindAddressFlagsByProfile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve address flags by profile: %v", err)
+	}
+
+	flags := make([]recordFlags, 0, len(rows))
+	for _, row := range rows {
+
+		// a profile has one primary address, unless primary is tracked per address type
+		var scope string
+		if ic.addressPrimaryPerType {
+			scope = row.AddressType
+		}
+		flags = append(flags, recordFlags{row.ProfileUuid, row.Uuid, row.IsCurrent, row.IsPrimary, scope})
+
+		// fingerprints can only be checked for linked records which decrypted, with a profile which decrypted
+		address, ok := decrypted[row.Uuid]
+		username, known := usernames[row.ProfileUuid]
+		if !ok || !known {
+			continue
+		}
+
+		finding, err := ic.checkBlindIndex(ctx, report.Repair, FindingFingerprintStale, "fingerprint", "address", row.Uuid, row.ProfileUuid, address.Fingerprint,
+			addressFingerprint(username, address),
+			func(ctx context.Context, fingerprint sql.NullString, uuid string) error {
+				return ic.sql.UpdateAddressFingerprint(ctx, sqlc.UpdateAddressFingerprintParams{Fingerprint: fingerprint, Uuid: uuid})
+			})
+		if err != nil {
+			return err
+		}
+		if finding != nil {
+			report.Findings = append(report.Findings, *finding)
+		}
+	}
+
+	report.Findings = append(report.Findings, ic.checkFlags(ctx, report.Repair, "address", flags, func(ctx context.Context, uuid string) error {
+		return ic.sql.ClearAddressPrimary(ctx, sqlc.ClearAddressPrimaryParams{UpdatedAt: time.Now().UTC(), Uuid: uuid})
+	})...)
+
+	return nil
+}
+
+// checkPhones checks phone rows for decryption failures, orphans, stale fingerprints and lookup indexes,
+// and primary/quota violations.
+func (ic *integrityChecker) checkPhones(ctx context.Context, report *IntegrityReport, usernames map[string]string) error {
+
+	phones, err := ic.sql.FindAllPhones(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve phone records: %v", err)
+	}
+	report.PhonesScanned = len(phones)
+
+	decrypted := make(map[string]*sqlc.Phone, len(phones))
+	for i := range phones {
+		if err := ic.phoneCryptor.DecryptPhone(&phones[i]); err != nil {
+			report.Findings = append(report.Findings, Finding{
+				Kind:   FindingDecryptFailure,
+				Table:  "phone",
+				Uuid:   phones[i].Uuid,
+				Detail: err.Error(),
+			})
+			continue
+		}
+		decrypted[phones[i].Uuid] = &phones[i]
+	}
+
+	orphans, err := ic.sql.FindOrphanPhones(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve orphaned phone records: %v", err)
+	}
+
+	for _, orphan := range orphans {
+		report.Findings = append(report.Findings, ic.repairOrphan(ctx, report.Repair, Finding{
+			Kind:   FindingOrphanPhone,
+			Table:  "phone",
+			Uuid:   orphan.Uuid,
+			Detail: "phone record is not linked to a profile",
+		}, orphan.CreatedAt, ic.sql.DeletePhone))
+	}
+
+	rows, err := ic.sql.FindPhoneFlagsByProfile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve phone flags by profile: %v", err)
+	}
+
+	flags := make([]recordFlags, 0, len(rows))
+	for _, row := range rows {
+		flags = append(flags, recordFlags{row.ProfileUuid, row.Uuid, row.IsCurrent, row.IsPrimary, ""})
+
+		// lookup indexes can only be checked for linked records which decrypted
+		phone, ok := decrypted[row.Uuid]
+		if !ok {
+			continue
+		}
+
+		finding, err := ic.checkBlindIndex(ctx, report.Repair, FindingPhoneIndexStale, "phone_index", "phone", row.Uuid, row.ProfileUuid, phone.PhoneIndex,
+			phoneIndexMaterial(phone.CountryCode.String, phone.PhoneNumber.String),
+			func(ctx context.Context, index sql.NullString, uuid string) error {
+				return ic.sql.UpdatePhoneIndex(ctx, sqlc.UpdatePhoneIndexParams{PhoneIndex: index, Uuid: uuid})
+			})
+		if err != nil {
+			return err
+		}
+		if finding != nil {
+			report.Findings = append(report.Findings, *finding)
+		}
+
+		// fingerprints can only be checked for records with a profile which decrypted
+		username, known := usernames[row.ProfileUuid]
+		if !known {
+			continue
+		}
+
+		finding, err = ic.checkBlindIndex(ctx, report.Repair, FindingFingerprintStale, "fingerprint", "phone", row.Uuid, row.ProfileUuid, phone.Fingerprint,
+			phoneFingerprint(username, phone),
+			func(ctx context.Context, fingerprint sql.NullString, uuid string) error {
+				return ic.sql.UpdatePhoneFingerprint(ctx, sqlc.UpdatePhoneFingerprintParams{Fingerprint: fingerprint, Uuid: uuid})
+			})
+		if err != nil {
+			return err
+		}
+		if finding != nil {
+			report.Findings = append(report.Findings, *finding)
+		}
+	}
+
+	report.Findings = append(report.Findings, ic.checkFlags(ctx, report.Repair, "phone", flags, func(ctx context.Context, uuid string) error {
+		return ic.sql.ClearPhonePrimary(ctx, sqlc.ClearPhonePrimaryParams{UpdatedAt: time.Now().UTC(), Uuid: uuid})
+	})...)
+
+	return nil
+}
+
+// checkBlindIndex compares a record's stored derived blind index, eg, its fingerprint, to the blind index of the
+// material computed from its decrypted fields, recomputing it in repair mode.  Records written before the index
+// was added have none.  Returns nil if the index is current.
+func (ic *integrityChecker) checkBlindIndex(
+	ctx context.Context,
+	repair bool,
+	kind FindingKind,
+	column, table, uuid, profileUuid string,
+	stored sql.NullString,
+	material string,
+	updateIndex func(ctx context.Context, index sql.NullString, uuid string) error,
+) (*Finding, error) {
+
+	index, err := ic.indexer.ObtainBlindIndex(material)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain %s for %s %s: %v", column, table, uuid, err)
+	}
+
+	if stored.Valid && stored.String == index {
+		return nil, nil
+	}
+
+	finding := &Finding{
+		Kind:        kind,
+		Table:       table,
+		Uuid:        uuid,
+		ProfileUuid: profileUuid,
+		Detail:      fmt.Sprintf("%s %s is missing or does not match its decrypted fields", table, column),
+	}
+
+	if repair {
+		if err := updateIndex(ctx, sql.NullString{String: index, Valid: true}, uuid); err != nil {
+			finding.Detail = fmt.Sprintf("%s; repair failed: %v", finding.Detail, err)
+		} else {
+			finding.Repaired = true
+		}
+	}
+
+	return finding, nil
+}
+
+// repairOrphan deletes an orphaned row in repair mode if it is older than the grace period.
+func (ic *integrityChecker) repairOrphan(
+	ctx context.Context,
+	repair bool,
+	finding Finding,
+	createdAt time.Time,
+	deleteRow func(ctx context.Context, uuid string) error,
+) Finding {
+
+	if !repair {
+		return finding
+	}
+
+	if time.Since(createdAt) < orphanGracePeriod {
+		finding.Detail = fmt.Sprintf("%s; not deleted since it was created less than %s ago", finding.Detail, orphanGracePeriod)
+		return finding
+	}
+
+	if err := deleteRow(ctx, finding.Uuid); err != nil {
+		finding.Detail = fmt.Sprintf("%s; repair failed: %v", finding.Detail, err)
+		return finding
+	}
+
+	finding.Repaired = true
+	return finding
+}
+
+// checkFlags checks the primary/current invariants and quota for the records linked to each profile.
+// flags must be grouped by profile uuid and ordered most recently updated first within each profile.
+func (ic *integrityChecker) checkFlags(
+	ctx context.Context,
+	repair bool,
+	table string,
+	flags []recordFlags,
+	clearPrimary func(ctx context.Context, uuid string) error,
+) []Finding {
+
+	var findings []Finding
+	for start := 0; start < len(flags); {
+
+		// find the end of this profile's group
+		end := start
+		for end < len(flags) && flags[end].profileUuid == flags[start].profileUuid {
+			end++
+		}
+		group := flags[start:end]
+		profileUuid := group[0].profileUuid
+		start = end
+
+		if len(group) > RecordQuota {
+			findings = append(findings, Finding{
+				Kind:        FindingOverQuota,
+				Table:       table,
+				ProfileUuid: profileUuid,
+				Detail:      fmt.Sprintf("profile has %d %s records, the limit is %d", len(group), table, RecordQuota),
+			})
+		}
+
+		// the most recently updated current primary in each scope is kept, every other primary flag is a violation
+		kept := make(map[string]bool)
+		for _, record := range group {
+			if !record.isPrimary {
+				continue
+			}
+
+			var finding Finding
+			switch {
+			case !record.isCurrent:
+				finding = Finding{
+					Kind:        FindingPrimaryNotCurrent,
+					Table:       table,
+					Uuid:        record.uuid,
+					ProfileUuid: profileUuid,
+					Detail:      fmt.Sprintf("primary %s record is not current", table),
+				}
+			case kept[record.primaryScope]:
+				finding = Finding{
+					Kind:        FindingDuplicatePrimary,
+					Table:       table,
+					Uuid:        record.uuid,
+					ProfileUuid: profileUuid,
+					Detail:      fmt.Sprintf("profile has more than one primary %s record; a more recently updated one is kept", table),
+				}
+			default:
+				kept[record.primaryScope] = true
+				continue
+			}
+
+			if repair {
+				if err := clearPrimary(ctx, record.uuid); err != nil {
+					finding.Detail = fmt.Sprintf("%s; repair failed: %v", finding.Detail, err)
+				} else {
+					finding.Repaired = true
+				}
+			}
+
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// clearRecorder records the uuids passed to a repair function, failing for the uuids in fail.
+type clearRecorder struct {
+	cleared []string
+	fail    map[string]bool
+}
+
+func (c *clearRecorder) clear(ctx context.Context, uuid string) error {
+	if c.fail[uuid] {
+		return errors.New("database unavailable")
+	}
+	c.cleared = append(c.cleared, uuid)
+	return nil
+}
+
+// findingsOf returns the uuids of the findings of a kind, in order.
+func findingsOf(findings []Finding, kind FindingKind) []string {
+	var uuids []string
+	for _, f := range findings {
+		if f.Kind == kind {
+			uuids = append(uuids, f.Uuid)
+		}
+	}
+	return uuids
+}
+
+func TestCheckFlags(t *testing.T) {
+
+	// flags are grouped by profile and ordered most recently updated first, as the flag queries return them
+	tests := []struct {
+		name            string
+		flags           []recordFlags
+		wantOverQuota   []string // profile uuids
+		wantDuplicate   []string
+		wantNotCurrent  []string
+		wantFindings    int
+		wantPrimaryKept []string // uuids which must not be cleared
+	}{
+		{
+			name: "clean",
+			flags: []recordFlags{
+				{"p1", "a1", true, true, "home"},
+				{"p1", "a2", true, false, "home"},
+				{"p2", "a3", true, true, "home"},
+			},
+			wantPrimaryKept: []string{"a1", "a3"},
+		},
+		{
+			name: "duplicate primary keeps most recently updated",
+			flags: []recordFlags{
+				{"p1", "a1", true, true, "home"},
+				{"p1", "a2", true, true, "home"},
+				{"p1", "a3", true, true, "home"},
+			},
+			wantDuplicate:   []string{"a2", "a3"},
+			wantFindings:    2,
+			wantPrimaryKept: []string{"a1"},
+		},
+		{
+			name: "one primary per scope",
+			flags: []recordFlags{
+				{"p1", "a1", true, true, "home"},
+				{"p1", "a2", true, true, "work"},
+			},
+			wantPrimaryKept: []string{"a1", "a2"},
+		},
+		{
+			name: "primary not current",
+			flags: []recordFlags{
+				{"p1", "a1", false, true, "home"},
+				{"p1", "a2", true, true, "home"},
+			},
+			wantNotCurrent:  []string{"a1"},
+			wantFindings:    1,
+			wantPrimaryKept: []string{"a2"},
+		},
+		{
+			name: "non-current primary does not take the scope",
+			flags: []recordFlags{
+				{"p1", "a1", false, true, "home"},
+				{"p1", "a2", true, true, "home"},
+				{"p1", "a3", true, true, "home"},
+			},
+			wantNotCurrent:  []string{"a1"},
+			wantDuplicate:   []string{"a3"},
+			wantFindings:    2,
+			wantPrimaryKept: []string{"a2"},
+		},
+		{
+			name: "over quota",
+			flags: []recordFlags{
+				{"p1", "a1", true, false, "home"},
+				{"p1", "a2", true, false, "home"},
+				{"p1", "a3", false, false, "home"},
+				{"p1", "a4", false, false, "home"},
+				{"p2", "a5", true, false, "home"},
+				{"p2", "a6", true, false, "home"},
+				{"p2", "a7", true, false, "home"},
+			},
+			wantOverQuota: []string{"p1"},
+			wantFindings:  1,
+		},
+		{
+			name: "groups are per profile",
+			flags: []recordFlags{
+				{"p1", "a1", true, true, ""},
+				{"p2", "a2", true, true, ""},
+				{"p2", "a3", true, true, ""},
+			},
+			wantDuplicate:   []string{"a3"},
+			wantFindings:    1,
+			wantPrimaryKept: []string{"a1", "a2"},
+		},
+	}
+
+	ic := &integrityChecker{}
+	for _, tc := range tests {
+		for _, repair := range []bool{false, true} {
+			t.Run(tc.name, func(t *testing.T) {
+
+				recorder := &clearRecorder{}
+				findings := ic.checkFlags(context.Background(), repair, "address", tc.flags, recorder.clear)
+
+				if len(findings) != tc.wantFindings {
+					t.Fatalf("checkFlags() returned %d findings, want %d: %+v", len(findings), tc.wantFindings, findings)
+				}
+
+				var overQuota []string
+				for _, f := range findings {
+					if f.Kind == FindingOverQuota {
+						overQuota = append(overQuota, f.ProfileUuid)
+					}
+					if f.Repaired != (repair && f.Kind != FindingOverQuota) {
+						t.Errorf("finding %s %s: repaired = %v with repair %v", f.Kind, f.Uuid, f.Repaired, repair)
+					}
+				}
+				if !slices.Equal(overQuota, tc.wantOverQuota) {
+					t.Errorf("over quota profiles = %v, want %v", overQuota, tc.wantOverQuota)
+				}
+				if got := findingsOf(findings, FindingDuplicatePrimary); !slices.Equal(got, tc.wantDuplicate) {
+					t.Errorf("duplicate primaries = %v, want %v", got, tc.wantDuplicate)
+				}
+				if got := findingsOf(findings, FindingPrimaryNotCurrent); !slices.Equal(got, tc.wantNotCurrent) {
+					t.Errorf("non-current primaries = %v, want %v", got, tc.wantNotCurrent)
+				}
+
+				if !repair && len(recorder.cleared) > 0 {
+					t.Errorf("expected nothing cleared without repair, cleared %v", recorder.cleared)
+				}
+				for _, uuid := range tc.wantPrimaryKept {
+					if slices.Contains(recorder.cleared, uuid) {
+						t.Errorf("expected primary %s to be kept", uuid)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCheckFlagsRepairFailure(t *testing.T) {
+
+	flags := []recordFlags{
+		{"p1", "a1", true, true, ""},
+		{"p1", "a2", true, true, ""},
+		{"p1", "a3", true, true, ""},
+	}
+
+	recorder := &clearRecorder{fail: map[string]bool{"a2": true}}
+	findings := (&integrityChecker{}).checkFlags(context.Background(), true, "phone", flags, recorder.clear)
+
+	if len(findings) != 2 {
+		t.Fatalf("checkFlags() returned %d findings, want 2", len(findings))
+	}
+	if findings[0].Repaired || findings[0].Uuid != "a2" {
+		t.Errorf("expected the failed repair of a2 to be reported unrepaired, got %+v", findings[0])
+	}
+	if !findings[1].Repaired || findings[1].Uuid != "a3" {
+		t.Errorf("expected a3 to still be repaired, got %+v", findings[1])
+	}
+
+	report := &IntegrityReport{Findings: findings}
+	if report.Unrepaired() != 1 {
+		t.Errorf("Unrepaired() = %d, want 1", report.Unrepaired())
+	}
+}
+
+func TestRepairOrphan(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		repair       bool
+		age          time.Duration
+		fail         bool
+		wantRepaired bool
+		wantDeleted  bool
+	}{
+		{"report only", false, 2 * orphanGracePeriod, false, false, false},
+		{"old orphan deleted", true, 2 * orphanGracePeriod, false, true, true},
+		{"orphan within grace period kept", true, orphanGracePeriod / 2, false, false, false},
+		{"delete fails", true, 2 * orphanGracePeriod, true, false, false},
+	}
+
+	ic := &integrityChecker{}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			recorder := &clearRecorder{fail: map[string]bool{"orphan": tc.fail}}
+			finding := ic.repairOrphan(context.Background(), tc.repair, Finding{
+				Kind:   FindingOrphanAddress,
+				Table:  "address",
+				Uuid:   "orphan",
+				Detail: "address record is not linked to a profile",
+			}, time.Now().Add(-tc.age), recorder.clear)
+
+			if finding.Repaired != tc.wantRepaired {
+				t.Errorf("repairOrphan() repaired = %v, want %v", finding.Repaired, tc.wantRepaired)
+			}
+			if deleted := slices.Contains(recorder.cleared, "orphan"); deleted != tc.wantDeleted {
+				t.Errorf("orphan deleted = %v, want %v", deleted, tc.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestCheckBlindIndex(t *testing.T) {
+
+	indexer, err := data.NewIndexer([]byte("12345678901234567890123456789012"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	material := "user@example.com|1 Main St"
+	current, err := indexer.ObtainBlindIndex(material)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		stored       sql.NullString
+		repair       bool
+		fail         bool
+		wantFinding  bool
+		wantRepaired bool
+	}{
+		{"current", sql.NullString{String: current, Valid: true}, true, false, false, false},
+		{"missing", sql.NullString{}, false, false, true, false},
+		{"stale", sql.NullString{String: "stale", Valid: true}, false, false, true, false},
+		{"stale repaired", sql.NullString{String: "stale", Valid: true}, true, false, true, true},
+		{"missing repaired", sql.NullString{}, true, false, true, true},
+		{"repair fails", sql.NullString{String: "stale", Valid: true}, true, true, true, false},
+	}
+
+	ic := &integrityChecker{indexer: indexer}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			var updated sql.NullString
+			finding, err := ic.checkBlindIndex(context.Background(), tc.repair, FindingFingerprintStale, "fingerprint", "address", "a1", "p1", tc.stored, material,
+				func(ctx context.Context, index sql.NullString, uuid string) error {
+					if tc.fail {
+						return errors.New("database unavailable")
+					}
+					updated = index
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("checkBlindIndex() err = %v", err)
+			}
+
+			if (finding != nil) != tc.wantFinding {
+				t.Fatalf("checkBlindIndex() finding = %+v, want finding %v", finding, tc.wantFinding)
+			}
+			if finding == nil {
+				return
+			}
+
+			if finding.Kind != FindingFingerprintStale || finding.Uuid != "a1" || finding.ProfileUuid != "p1" {
+				t.Errorf("checkBlindIndex() finding = %+v", finding)
+			}
+			if finding.Repaired != tc.wantRepaired {
+				t.Errorf("checkBlindIndex() repaired = %v, want %v", finding.Repaired, tc.wantRepaired)
+			}
+			if tc.wantRepaired && (!updated.Valid || updated.String != current) {
+				t.Errorf("expected the index to be recomputed from the material, got %+v", updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage describes the migrate subcommand.
+const Usage = `usage: silhouette migrate <command> [steps]
+
+commands:
+  up [n]     apply all pending migrations, or the next n
+  down [n]   roll back the most recent migration, or the last n
+  status     list every migration and whether it is applied
+  verify     exit non-zero unless the schema exactly matches this binary`
+
+// RunCommand runs a migrate subcommand, ie, the arguments after `silhouette migrate`,
+// writing human readable output to out.
+func RunCommand(ctx context.Context, m Migrator, args []string, out io.Writer) error {
+
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(Usage)
+	}
+
+	// optional step count
+	steps := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of steps %q: must be a positive integer", args[1])
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx, steps)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return nil
+
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		rolledBack, err := m.Down(ctx, steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(out, "no migrations to roll back")
+		}
+		return nil
+
+	case "status":
+		if steps != 0 {
+			return errors.New(Usage)
+		}
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", ""
+			if s.Applied {
+				state, appliedAt = "applied", s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if s.Modified {
+				state = "modified"
+			}
+			if s.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		return w.Flush()
+
+	case "verify":
+		if steps != 0 {
+			return errors.New(Usage)
+		}
+		if _, err := m.Verify(ctx, true); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "schema is current")
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], Usage)
+	}
+}
@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// migrationFile matches migration file names, ie, 0001_initial_schema.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single numbered schema change with its up and down scripts.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // hex encoded sha256 of the up script
+}
+
+// Load reads and validates the migrations in the root of fsys, returning them ordered by version.
+// Every version must be unique and have both an up and a down script.
+func Load(fsys fs.FS) ([]Migration, error) {
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		parts := migrationFile.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migration file %s does not match <version>_<name>.<up|down>.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration file %s has an invalid version", entry.Name())
+		}
+
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %v", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration version %d has conflicting names %s and %s", version, m.Name, parts[2])
+		}
+
+		switch parts[3] {
+		case "up":
+			m.Up = string(script)
+			sum := sha256.Sum256(script)
+			m.Checksum = hex.EncodeToString(sum[:])
+		case "down":
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s must have non-empty up and down scripts", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return migrations, nil
+}
+
+// splitStatements splits a script into individual statements on semicolons which are not inside
+// quotes or comments.  The database driver does not allow multiple statements per exec call.
+// Comments are dropped from the output.
+func splitStatements(script string) []string {
+
+	var (
+		statements []string
+		current    strings.Builder
+		quote      rune // the open quote character, or 0
+	)
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if quote != 0 {
+			current.WriteRune(r)
+			switch {
+			case r == '\\' && quote != '`' && i+1 < len(runes):
+				// escaped character inside a string literal
+				i++
+				current.WriteRune(runes[i])
+			case r == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			current.WriteRune(r)
+		case r == '#' || (r == '-' && i+1 < len(runes) && runes[i+1] == '-'):
+			// line comment: skip to end of line
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			// block comment: skip to the closing */
+			for i += 3; i < len(runes) && !(runes[i-1] == '*' && runes[i] == '/'); i++ {
+			}
+			current.WriteRune(' ')
+		case r == ';':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return statements
+}
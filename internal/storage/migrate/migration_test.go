@@ -0,0 +1,184 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/migrations"
+)
+
+func TestSplitStatements(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"whitespace only", " \n\t ", nil},
+		{"single without semicolon", "SELECT 1", []string{"SELECT 1"}},
+		{"single with semicolon", "SELECT 1;", []string{"SELECT 1"}},
+		{"several", "SELECT 1;\nSELECT 2;\n\nSELECT 3;", []string{"SELECT 1", "SELECT 2", "SELECT 3"}},
+		{"empty statements dropped", ";;SELECT 1;;", []string{"SELECT 1"}},
+		{"semicolon in single quotes", "INSERT INTO t VALUES ('a;b');", []string{"INSERT INTO t VALUES ('a;b')"}},
+		{"semicolon in double quotes", `INSERT INTO t VALUES ("a;b");`, []string{`INSERT INTO t VALUES ("a;b")`}},
+		{"semicolon in backticks", "CREATE TABLE `a;b` (id INT);", []string{"CREATE TABLE `a;b` (id INT)"}},
+		{"escaped quote", `INSERT INTO t VALUES ('it\'s;here');`, []string{`INSERT INTO t VALUES ('it\'s;here')`}},
+		{"escaped backslash ends string", `INSERT INTO t VALUES ('a\\');SELECT 2;`, []string{`INSERT INTO t VALUES ('a\\')`, "SELECT 2"}},
+		{"backslash is literal in backticks", "SELECT `a\\`;SELECT 2;", []string{"SELECT `a\\`", "SELECT 2"}},
+		{"other quote inside string", `SELECT 'say "hi";';`, []string{`SELECT 'say "hi";'`}},
+		{"dash comment dropped", "-- a comment; with a semicolon\nSELECT 1;", []string{"SELECT 1"}},
+		{"hash comment dropped", "# a comment;\nSELECT 1;", []string{"SELECT 1"}},
+		{"trailing line comment", "SELECT 1; -- done;", []string{"SELECT 1"}},
+		{"comment between statements", "SELECT 1;\n-- next;\nSELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"block comment dropped", "SELECT /* a; b */ 1;", []string{"SELECT   1"}},
+		{"multiline block comment", "/* header;\n still comment; */\nSELECT 1;", []string{"SELECT 1"}},
+		{"empty block comment", "SELECT /**/1;", []string{"SELECT  1"}},
+		{"comment markers in string", "SELECT '-- # /* not comments */';", []string{"SELECT '-- # /* not comments */'"}},
+		{"unterminated block comment", "SELECT 1; /* never closed; SELECT 2;", []string{"SELECT 1"}},
+		{"unicode", "INSERT INTO t VALUES ('Zürich; ☕');", []string{"INSERT INTO t VALUES ('Zürich; ☕')"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitStatements(tc.script)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tc.script, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	t.Run("ordered by version", func(t *testing.T) {
+
+		fsys := fstest.MapFS{
+			"0010_later.up.sql":    file("CREATE TABLE later (id INT);"),
+			"0010_later.down.sql":  file("DROP TABLE later;"),
+			"0002_second.up.sql":   file("CREATE TABLE second (id INT);"),
+			"0002_second.down.sql": file("DROP TABLE second;"),
+			"0001_first.up.sql":    file("CREATE TABLE first (id INT);"),
+			"0001_first.down.sql":  file("DROP TABLE first;"),
+			"README.md":            file("not a migration"),
+		}
+
+		got, err := Load(fsys)
+		if err != nil {
+			t.Fatalf("Load() err = %v", err)
+		}
+
+		var versions []int64
+		for _, m := range got {
+			versions = append(versions, m.Version)
+		}
+		if !slices.Equal(versions, []int64{1, 2, 10}) {
+			t.Errorf("Load() versions = %v, want [1 2 10]", versions)
+		}
+		if got[1].Name != "second" || got[1].Up != "CREATE TABLE second (id INT);" || got[1].Down != "DROP TABLE second;" {
+			t.Errorf("Load() second migration = %+v", got[1])
+		}
+	})
+
+	t.Run("checksum is of the up script only", func(t *testing.T) {
+
+		up := "CREATE TABLE first (id INT);"
+		fsys := fstest.MapFS{
+			"0001_first.up.sql":   file(up),
+			"0001_first.down.sql": file("DROP TABLE first;"),
+		}
+
+		got, err := Load(fsys)
+		if err != nil {
+			t.Fatalf("Load() err = %v", err)
+		}
+
+		sum := sha256.Sum256([]byte(up))
+		if got[0].Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("Load() checksum = %s, want sha256 of the up script", got[0].Checksum)
+		}
+
+		// changing the down script must not change the checksum, but changing the up script must
+		fsys["0001_first.down.sql"] = file("DROP TABLE IF EXISTS first;")
+		again, err := Load(fsys)
+		if err != nil {
+			t.Fatalf("Load() err = %v", err)
+		}
+		if again[0].Checksum != got[0].Checksum {
+			t.Error("expected the checksum to ignore the down script")
+		}
+
+		fsys["0001_first.up.sql"] = file(up + "\n")
+		again, err = Load(fsys)
+		if err != nil {
+			t.Fatalf("Load() err = %v", err)
+		}
+		if again[0].Checksum == got[0].Checksum {
+			t.Error("expected the checksum to change with the up script")
+		}
+	})
+
+	errorCases := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_first.up.sql": file("CREATE TABLE first (id INT);"),
+		}, "must have non-empty up and down scripts"},
+		{"missing up", fstest.MapFS{
+			"0001_first.down.sql": file("DROP TABLE first;"),
+		}, "must have non-empty up and down scripts"},
+		{"empty down", fstest.MapFS{
+			"0001_first.up.sql":   file("CREATE TABLE first (id INT);"),
+			"0001_first.down.sql": file("  \n"),
+		}, "must have non-empty up and down scripts"},
+		{"conflicting names", fstest.MapFS{
+			"0001_first.up.sql":   file("CREATE TABLE first (id INT);"),
+			"0001_other.down.sql": file("DROP TABLE first;"),
+		}, "conflicting names"},
+		{"bad file name", fstest.MapFS{
+			"first.up.sql": file("CREATE TABLE first (id INT);"),
+		}, "does not match"},
+		{"upper case name", fstest.MapFS{
+			"0001_First.up.sql": file("CREATE TABLE first (id INT);"),
+		}, "does not match"},
+		{"version zero", fstest.MapFS{
+			"0000_zero.up.sql":   file("CREATE TABLE zero (id INT);"),
+			"0000_zero.down.sql": file("DROP TABLE zero;"),
+		}, "invalid version"},
+	}
+
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(tc.fsys)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Load() err = %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestEmbeddedMigrations checks the migrations shipped in the binary load, and are numbered without gaps.
+func TestEmbeddedMigrations(t *testing.T) {
+
+	got, err := Load(migrations.Files)
+	if err != nil {
+		t.Fatalf("Load() err = %v", err)
+	}
+
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: expected version %d", m.Version, m.Name, i+1)
+		}
+		if len(splitStatements(m.Up)) == 0 || len(splitStatements(m.Down)) == 0 {
+			t.Errorf("migration %d_%s: expected up and down scripts to contain statements", m.Version, m.Name)
+		}
+	}
+}
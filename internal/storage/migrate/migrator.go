@@ -0,0 +1,369 @@
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/definitions"
+)
+
+const (
+	// lockName is the advisory lock held while migrations are applied so concurrent
+	// replicas or jobs cannot migrate the same database at the same time.
+	lockName = "silhouette_schema_migrations"
+
+	// lockTimeout is how long to wait for the advisory lock, in seconds.
+	lockTimeout = 60
+)
+
+// createMigrationsTable bootstraps the table that records applied migrations.
+// It cannot be a migration itself since it tracks them.
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`
+
+// Status is the state of a single migration version.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+
+	// Modified is true when the applied checksum does not match the embedded up script.
+	Modified bool
+
+	// Unknown is true when the version is applied in the database but not embedded in this binary,
+	// ie, the database was migrated by a newer release.
+	Unknown bool
+}
+
+// Migrator applies, rolls back and reports on versioned schema migrations.
+type Migrator interface {
+
+	// Up applies up to steps pending migrations in version order.  A steps value <= 0 applies all of them.
+	// It returns the migrations that were applied.
+	Up(ctx context.Context, steps int) ([]Migration, error)
+
+	// Down rolls back up to steps applied migrations, newest first.  A steps value <= 0 is an error
+	// so that an entire schema is never dropped by accident.  It returns the migrations that were rolled back.
+	Down(ctx context.Context, steps int) ([]Migration, error)
+
+	// Status returns the state of every embedded and every applied migration, ordered by version.
+	Status(ctx context.Context) ([]Status, error)
+
+	// Verify returns an error if any embedded migration is pending or modified since it was applied.
+	// Migrations applied but unknown to this binary, ie, by a newer release, are only an error if strict,
+	// since a previous release keeps running against the migrated schema during a rolling update or rollback.
+	// Otherwise they are returned so the caller can warn.
+	Verify(ctx context.Context, strict bool) ([]Status, error)
+}
+
+// NewMigrator creates a new Migrator interface, returning a pointer to the concrete implementation.
+// The migrations are read from the root of fsys, see Load.
+func NewMigrator(db *sql.DB, fsys fs.FS) (Migrator, error) {
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+
+		logger: slog.Default().
+			With(slog.String(definitions.PackageKey, definitions.PackageMigrate)).
+			With(slog.String(definitions.ComponentKey, definitions.ComponentMigrator)),
+	}, nil
+}
+
+var _ Migrator = (*migrator)(nil)
+
+// migrator is the concrete implementation of the Migrator interface.
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+
+	logger *slog.Logger
+}
+
+// appliedMigration is a row in the schema_migrations table.
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Up applies pending migrations in version order.
+// Note: MariaDB commits DDL implicitly, so a migration that fails part way is not rolled back;
+// it stays pending and must be fixed forward or cleaned up by hand before retrying.
+func (m *migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			if err := execScript(ctx, conn, migration.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				migration.Version, migration.Name, migration.Checksum, time.Now().UTC(),
+			); err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+
+			m.logger.Info(fmt.Sprintf("applied migration %d_%s", migration.Version, migration.Name))
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back applied migrations, newest first.
+func (m *migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+
+	if steps <= 0 {
+		return nil, errors.New("number of migrations to roll back must be greater than zero")
+	}
+
+	embedded := make(map[int64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		embedded[migration.Version] = migration
+	}
+
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// a newer release's migrations cannot be rolled back since their down scripts are not embedded
+		for version, a := range done {
+			if _, ok := embedded[version]; !ok {
+				return fmt.Errorf("migration %d_%s is applied but not embedded in this binary; roll it back with the release that added it", version, a.name)
+			}
+		}
+
+		// newest applied first
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			if err := execScript(ctx, conn, migration.Down); err != nil {
+				return fmt.Errorf("failed to roll back migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+				return fmt.Errorf("failed to remove migration record %d_%s: %v", migration.Version, migration.Name, err)
+			}
+
+			m.logger.Info(fmt.Sprintf("rolled back migration %d_%s", migration.Version, migration.Name))
+			rolledBack = append(rolledBack, migration)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status returns the state of every embedded and applied migration.
+// It only reads: if the schema_migrations table does not exist yet, nothing has been applied.
+func (m *migrator) Status(ctx context.Context) ([]Status, error) {
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %v", err)
+	}
+	defer conn.Close()
+
+	exists, err := migrationsTableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]appliedMigration)
+	if exists {
+		if done, err = m.applied(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if a, ok := done[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.appliedAt
+			status.Modified = a.checksum != migration.Checksum
+			delete(done, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// anything left was applied by a release this binary does not know about
+	for _, a := range done {
+		statuses = append(statuses, Status{
+			Version:   a.version,
+			Name:      a.name,
+			Applied:   true,
+			AppliedAt: a.appliedAt,
+			Unknown:   true,
+		})
+	}
+
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return statuses, nil
+}
+
+// Verify checks every embedded migration has been applied unmodified, and, if strict,
+// that no migration unknown to this binary has been applied.
+func (m *migrator) Verify(ctx context.Context, strict bool) ([]Status, error) {
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return verify(statuses, strict)
+}
+
+// verify checks the statuses of the migrations for pending or modified ones, and unknown ones if strict.
+// Unknown migrations which are not an error are returned.
+func verify(statuses []Status, strict bool) ([]Status, error) {
+
+	var (
+		unknown []Status
+		errs    []error
+	)
+	for _, s := range statuses {
+		switch {
+		case s.Unknown && strict:
+			errs = append(errs, fmt.Errorf("migration %d_%s is applied but not embedded in this binary", s.Version, s.Name))
+		case s.Unknown:
+			unknown = append(unknown, s)
+		case !s.Applied:
+			errs = append(errs, fmt.Errorf("migration %d_%s is pending", s.Version, s.Name))
+		case s.Modified:
+			errs = append(errs, fmt.Errorf("migration %d_%s has been modified since it was applied", s.Version, s.Name))
+		}
+	}
+
+	return unknown, errors.Join(errs...)
+}
+
+// withLock runs fn on a single connection while holding the migration advisory lock.
+// The schema_migrations table is created if it does not exist.
+func (m *migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+
+	// advisory locks are per session so every statement must run on the same connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %v", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("timed out after %ds waiting for migration lock %s", lockTimeout, lockName)
+	}
+	defer func() {
+		// use a fresh context so the lock is released even if ctx was cancelled
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+			m.logger.Error("failed to release migration lock", "err", err.Error())
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// migrationsTableExists checks if the schema_migrations table exists in the connected database,
+// without creating it.
+func migrationsTableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+
+	var count int
+	if err := conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'",
+	).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check for schema_migrations table: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+// applied returns the applied migrations keyed by version.
+func (m *migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations row: %v", err)
+		}
+		applied[a.version] = a
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+
+	return applied, nil
+}
+
+// execScript executes each statement in a migration script in order.
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+
+	appliedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	applied := Status{Version: 1, Name: "init", Applied: true, AppliedAt: appliedAt}
+	pending := Status{Version: 2, Name: "add_phone"}
+	modified := Status{Version: 2, Name: "add_phone", Applied: true, AppliedAt: appliedAt, Modified: true}
+	unknown := Status{Version: 3, Name: "from_next_release", Applied: true, AppliedAt: appliedAt, Unknown: true}
+
+	tests := []struct {
+		name        string
+		statuses    []Status
+		strict      bool
+		wantUnknown []int64
+		wantErrs    []string
+	}{
+		{"nothing embedded or applied", nil, true, nil, nil},
+		{"current", []Status{applied}, true, nil, nil},
+		{"pending", []Status{applied, pending}, false, nil, []string{"2_add_phone is pending"}},
+		{"modified", []Status{applied, modified}, false, nil, []string{"2_add_phone has been modified"}},
+		{"newer release is a warning", []Status{applied, unknown}, false, []int64{3}, nil},
+		{"newer release is an error if strict", []Status{applied, unknown}, true, nil, []string{"3_from_next_release is applied but not embedded"}},
+		{"pending alongside a newer release", []Status{applied, pending, unknown}, false, []int64{3}, []string{"2_add_phone is pending"}},
+		{"every problem reported if strict", []Status{applied, modified, unknown}, true, nil, []string{"2_add_phone has been modified", "3_from_next_release is applied but not embedded"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			unknown, err := verify(tc.statuses, tc.strict)
+
+			if len(tc.wantErrs) == 0 && err != nil {
+				t.Errorf("verify() err = %v, want nil", err)
+			}
+			if len(tc.wantErrs) > 0 && err == nil {
+				t.Errorf("verify() err = nil, want %v", tc.wantErrs)
+			}
+			for _, want := range tc.wantErrs {
+				if err != nil && !strings.Contains(err.Error(), want) {
+					t.Errorf("verify() err = %v, want it to contain %q", err, want)
+				}
+			}
+
+			if len(unknown) != len(tc.wantUnknown) {
+				t.Fatalf("verify() returned %d unknown migrations, want %d", len(unknown), len(tc.wantUnknown))
+			}
+			for i, s := range unknown {
+				if s.Version != tc.wantUnknown[i] {
+					t.Errorf("verify() unknown[%d] = %d, want %d", i, s.Version, tc.wantUnknown[i])
+				}
+			}
+		})
+	}
+}
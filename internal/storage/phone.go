@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tdeslauriers/carapace/pkg/data"
@@ -26,16 +27,45 @@ type PhoneStore interface {
 	CountPrimaryPhones(ctx context.Context, username string) (int64, error)
 
 	// GetPhonesByUser retrieves all phone records for a given user, and decrypts the records.
+	// Records are ordered primary first, then current, then by created_at ascending.
 	GetPhonesByUser(ctx context.Context, username string) ([]*sqlc.Phone, error)
 
-	// CreatePhone creates a new phone record in the database, encrypting the fields before storage.
-	CreatePhone(ctx context.Context, phone *sqlc.Phone) error
+	// FindDuplicatePhone retrieves the user's live phone with the same fingerprint as the given plaintext phone,
+	// ie, the same E.164 number and extension, and decrypts it.  The given phone itself, by uuid, is not a duplicate,
+	// so an existing record can be checked before it is updated or restored.
+	// Returns sql.ErrNoRows if the user has no such phone.
+	FindDuplicatePhone(ctx context.Context, username string, phone *sqlc.Phone) (*sqlc.Phone, error)
 
-	// UpdatePhone updates an existing phone record in the database, encrypting the fields before storage.
-	UpdatePhone(ctx context.Context, phone *sqlc.Phone) error
+	// CreatePhone creates a new phone record for the user in the database, encrypting the fields before storage.
+	// The record's fingerprint is computed from its plaintext fields and the username, and its phone index from its number.
+	CreatePhone(ctx context.Context, username string, phone *sqlc.Phone) error
 
-	// DeletePhone deletes a phone record from the database.
+	// UpdatePhone updates an existing phone record of the user in the database, encrypting the fields before storage.
+	// The previous encrypted state of the record is written to its history in the same transaction.
+	UpdatePhone(ctx context.Context, username string, phone *sqlc.Phone) error
+
+	// GetPhoneHistory retrieves the prior versions of a user's phone record, newest first, and decrypts them.
+	GetPhoneHistory(ctx context.Context, slug, username string) ([]*sqlc.PhoneHistory, error)
+
+	// GetPhoneVersion retrieves a single prior version of a user's phone record, and decrypts it.
+	// Returns sql.ErrNoRows if the version does not belong to the user's phone.
+	GetPhoneVersion(ctx context.Context, slug, username, version string) (*sqlc.PhoneHistory, error)
+
+	// DeletePhone tombstones a phone record so it is hidden from every lookup but can be restored
+	// until it is purged.  The primary flag is cleared.  Returns sql.ErrNoRows if no live record exists.
 	DeletePhone(ctx context.Context, uuid string) error
+
+	// GetDeletedPhone retrieves a user's tombstoned phone record if it was deleted after deletedAfter,
+	// ie, if it can still be restored, and decrypts it.  Returns sql.ErrNoRows if there is no such tombstone.
+	GetDeletedPhone(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Phone, error)
+
+	// RestorePhone restores a user's tombstoned phone record if it was deleted after deletedAfter,
+	// returning the decrypted record.  Returns sql.ErrNoRows if there is no such tombstone.
+	RestorePhone(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Phone, error)
+
+	// PurgePhones shreds and hard deletes phone records, and their history and xrefs, tombstoned before deletedBefore.
+	// Returns the number of records purged.
+	PurgePhones(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 // NewPhoneStore creates a new instance of PhoneStore and
@@ -43,6 +73,7 @@ type PhoneStore interface {
 func NewPhoneStore(db *sql.DB, i data.Indexer, c data.Cryptor) PhoneStore {
 
 	return &phoneStore{
+		db:      db,
 		sql:     sqlc.New(db),
 		indexer: i,
 		cryptor: crypt.NewPhoneCryptor(c),
@@ -54,6 +85,7 @@ var _ PhoneStore = (*phoneStore)(nil)
 // phoneStore is the concrete implementation of the PhoneStore interface, providing
 // persistence operations for phone numbers
 type phoneStore struct {
+	db      *sql.DB
 	sql     *sqlc.Queries
 	indexer data.Indexer
 	cryptor crypt.PhoneCryptor
@@ -104,6 +136,37 @@ func (ps *phoneStore) CountPhones(ctx context.Context, username string) (int64,
 	return ps.sql.CountPhonesForUser(ctx, userIndex)
 }
 
+// FindDuplicatePhone retrieves the user's live phone, other than the given phone itself, with the same
+// fingerprint as the given plaintext phone, and decrypts it.
+func (ps *phoneStore) FindDuplicatePhone(ctx context.Context, username string, phone *sqlc.Phone) (*sqlc.Phone, error) {
+
+	// get the blind index for the username
+	userIndex, err := ps.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := ps.indexer.ObtainBlindIndex(phoneFingerprint(username, phone))
+	if err != nil {
+		return nil, err
+	}
+
+	duplicate, err := ps.sql.FindPhoneByFingerprint(ctx, sqlc.FindPhoneByFingerprintParams{
+		Fingerprint: sql.NullString{String: fingerprint, Valid: true},
+		UserIndex:   userIndex,
+		ExcludeUuid: phone.Uuid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ps.cryptor.DecryptPhone(&duplicate); err != nil {
+		return nil, err
+	}
+
+	return &duplicate, nil
+}
+
 // CountPrimaryPhones retrieves a count of how many primary phone records exist for a given user.
 func (ps *phoneStore) CountPrimaryPhones(ctx context.Context, username string) (int64, error) {
 
@@ -132,6 +195,12 @@ func (ps *phoneStore) GetPhonesByUser(ctx context.Context, username string) ([]*
 		return nil, err
 	}
 
+	return decryptPhones(ps.cryptor, records)
+}
+
+// decryptPhones decrypts a slice of phone records, concurrently if there is more than one.
+func decryptPhones(cryptor crypt.PhoneCryptor, records []sqlc.Phone) ([]*sqlc.Phone, error) {
+
 	var phones []*sqlc.Phone
 
 	// return empty if empty result set
@@ -144,7 +213,7 @@ func (ps *phoneStore) GetPhonesByUser(ctx context.Context, username string) ([]*
 
 		phone := records[0]
 
-		if err := ps.cryptor.DecryptPhone(&phone); err != nil {
+		if err := cryptor.DecryptPhone(&phone); err != nil {
 			return nil, err
 		}
 
@@ -152,29 +221,25 @@ func (ps *phoneStore) GetPhonesByUser(ctx context.Context, username string) ([]*
 	}
 
 	// setup concurrency loop to decrypt phone records in parallel if more than one record
+	// records are decrypted in place so the query's sort order is preserved
 	var (
-		wg      sync.WaitGroup
-		phoneCh = make(chan *sqlc.Phone, len(records))
-		errCh   = make(chan error, len(records))
+		wg    sync.WaitGroup
+		errCh = make(chan error, len(records))
 	)
 
-	for _, r := range records {
+	for i := range records {
 		wg.Add(1)
 
-		go func(phone sqlc.Phone) {
+		go func(phone *sqlc.Phone) {
 			defer wg.Done()
 
-			if err := ps.cryptor.DecryptPhone(&phone); err != nil {
+			if err := cryptor.DecryptPhone(phone); err != nil {
 				errCh <- err
-				return
 			}
-
-			phoneCh <- &phone
-		}(r)
+		}(&records[i])
 	}
 
 	wg.Wait()
-	close(phoneCh)
 	close(errCh)
 
 	// check if any errors were returned during decryption
@@ -186,16 +251,16 @@ func (ps *phoneStore) GetPhonesByUser(ctx context.Context, username string) ([]*
 		return nil, fmt.Errorf("encountered errors during decryption: %v", errors.Join(errs...))
 	}
 
-	// compile decrypted records into slice
-	for p := range phoneCh {
-		phones = append(phones, p)
+	// compile decrypted records into slice in query order
+	for i := range records {
+		phones = append(phones, &records[i])
 	}
 
 	return phones, nil
 }
 
 // CreatePhone creates a new phone record in the database, encrypting the fields before storage.
-func (ps *phoneStore) CreatePhone(ctx context.Context, phone *sqlc.Phone) error {
+func (ps *phoneStore) CreatePhone(ctx context.Context, username string, phone *sqlc.Phone) error {
 
 	// if no uuid, create one
 	// this should never happen since the service layer should create prior to calling
@@ -223,6 +288,18 @@ func (ps *phoneStore) CreatePhone(ctx context.Context, phone *sqlc.Phone) error
 		return err
 	}
 
+	// create the fingerprint from the plaintext fields
+	fingerprint, err := ps.indexer.ObtainBlindIndex(phoneFingerprint(username, phone))
+	if err != nil {
+		return err
+	}
+
+	// create the lookup index from the plaintext number
+	phoneIndex, err := ps.indexer.ObtainBlindIndex(phoneIndexMaterial(phone.CountryCode.String, phone.PhoneNumber.String))
+	if err != nil {
+		return err
+	}
+
 	if err := ps.cryptor.EncryptPhone(phone); err != nil {
 		return err
 	}
@@ -231,6 +308,8 @@ func (ps *phoneStore) CreatePhone(ctx context.Context, phone *sqlc.Phone) error
 		Uuid:        phone.Uuid,
 		Slug:        phone.Slug,
 		SlugIndex:   slugIndex,
+		Fingerprint: sql.NullString{String: fingerprint, Valid: true},
+		PhoneIndex:  sql.NullString{String: phoneIndex, Valid: true},
 		CountryCode: phone.CountryCode,
 		PhoneNumber: phone.PhoneNumber,
 		Extension:   phone.Extension,
@@ -243,13 +322,51 @@ func (ps *phoneStore) CreatePhone(ctx context.Context, phone *sqlc.Phone) error
 }
 
 // UpdatePhone updates an existing phone record in the database, encrypting the fields before storage.
-func (ps *phoneStore) UpdatePhone(ctx context.Context, phone *sqlc.Phone) error {
+// The previous encrypted state is copied to the record's history in the same transaction.
+func (ps *phoneStore) UpdatePhone(ctx context.Context, username string, phone *sqlc.Phone) error {
+
+	// create the history entry's uuid
+	version, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	// recompute the fingerprint from the plaintext fields
+	fingerprint, err := ps.indexer.ObtainBlindIndex(phoneFingerprint(username, phone))
+	if err != nil {
+		return err
+	}
+
+	// recompute the lookup index from the plaintext number
+	phoneIndex, err := ps.indexer.ObtainBlindIndex(phoneIndexMaterial(phone.CountryCode.String, phone.PhoneNumber.String))
+	if err != nil {
+		return err
+	}
 
 	if err := ps.cryptor.EncryptPhone(phone); err != nil {
 		return err
 	}
 
-	return ps.sql.UpdatePhone(ctx, sqlc.UpdatePhoneParams{
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin phone update transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	q := ps.sql.WithTx(tx)
+
+	// copy the previous state into the history before it is overwritten
+	if err := q.SavePhoneHistory(ctx, sqlc.SavePhoneHistoryParams{
+		Uuid:         version.String(),
+		SupersededAt: phone.UpdatedAt,
+		PhoneUuid:    phone.Uuid,
+	}); err != nil {
+		return fmt.Errorf("failed to save phone history: %v", err)
+	}
+
+	if err := q.UpdatePhone(ctx, sqlc.UpdatePhoneParams{
+		Fingerprint: sql.NullString{String: fingerprint, Valid: true},
+		PhoneIndex:  sql.NullString{String: phoneIndex, Valid: true},
 		CountryCode: phone.CountryCode,
 		PhoneNumber: phone.PhoneNumber,
 		Extension:   phone.Extension,
@@ -258,10 +375,229 @@ func (ps *phoneStore) UpdatePhone(ctx context.Context, phone *sqlc.Phone) error
 		IsPrimary:   phone.IsPrimary,
 		UpdatedAt:   phone.UpdatedAt,
 		Uuid:        phone.Uuid,
+	}); err != nil {
+		return fmt.Errorf("failed to update phone record: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit phone update transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetPhoneHistory retrieves the prior versions of a user's phone record, newest first, and decrypts them.
+func (ps *phoneStore) GetPhoneHistory(ctx context.Context, slug, username string) ([]*sqlc.PhoneHistory, error) {
+
+	// get slug index
+	slugIndex, err := ps.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := ps.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := ps.sql.FindPhoneHistoryByUser(ctx, sqlc.FindPhoneHistoryByUserParams{
+		SlugIndex: slugIndex,
+		UserIndex: userIndex,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptPhoneHistory(ps.cryptor, records)
 }
 
-// DeletePhone deletes a phone record from the database.
+// GetPhoneVersion retrieves a single prior version of a user's phone record, and decrypts it.
+func (ps *phoneStore) GetPhoneVersion(ctx context.Context, slug, username, version string) (*sqlc.PhoneHistory, error) {
+
+	// get slug index
+	slugIndex, err := ps.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := ps.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := ps.sql.FindPhoneVersionByUser(ctx, sqlc.FindPhoneVersionByUserParams{
+		Version:   version,
+		SlugIndex: slugIndex,
+		UserIndex: userIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := decryptPhoneHistory(ps.cryptor, []sqlc.PhoneHistory{record})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions[0], nil
+}
+
+// decryptPhoneHistory decrypts prior versions of a phone record.  A version holds the
+// record's encrypted state verbatim, so it is decrypted as a phone record.
+func decryptPhoneHistory(cryptor crypt.PhoneCryptor, records []sqlc.PhoneHistory) ([]*sqlc.PhoneHistory, error) {
+
+	phones := make([]sqlc.Phone, len(records))
+	for i, r := range records {
+		phones[i] = sqlc.Phone{
+			Uuid:        r.PhoneUuid,
+			Slug:        r.Slug,
+			CountryCode: r.CountryCode,
+			PhoneNumber: r.PhoneNumber,
+			Extension:   r.Extension,
+			PhoneType:   r.PhoneType,
+		}
+	}
+
+	decrypted, err := decryptPhones(cryptor, phones)
+	if err != nil {
+		return nil, err
+	}
+
+	// decryption preserves order, so the decrypted fields map back by position
+	versions := make([]*sqlc.PhoneHistory, 0, len(records))
+	for i, p := range decrypted {
+		records[i].Slug = p.Slug
+		records[i].CountryCode = p.CountryCode
+		records[i].PhoneNumber = p.PhoneNumber
+		records[i].Extension = p.Extension
+		records[i].PhoneType = p.PhoneType
+		versions = append(versions, &records[i])
+	}
+
+	return versions, nil
+}
+
+// DeletePhone tombstones a phone record, clearing its primary flag.
 func (ps *phoneStore) DeletePhone(ctx context.Context, uuid string) error {
-	return ps.sql.DeletePhone(ctx, uuid)
+
+	now := time.Now().UTC()
+	rows, err := ps.sql.TombstonePhone(ctx, sqlc.TombstonePhoneParams{
+		DeletedAt: sql.NullTime{Time: now, Valid: true},
+		UpdatedAt: now,
+		Uuid:      uuid,
+	})
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetDeletedPhone retrieves a user's tombstoned phone record if it can still be restored, and decrypts it.
+func (ps *phoneStore) GetDeletedPhone(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Phone, error) {
+
+	// get the blind slugIndex for the phone slug
+	slugIndex, err := ps.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the blind index for the username
+	userIndex, err := ps.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	phone, err := ps.sql.FindDeletedPhoneByUser(ctx, sqlc.FindDeletedPhoneByUserParams{
+		SlugIndex:    slugIndex,
+		UserIndex:    userIndex,
+		DeletedAfter: sql.NullTime{Time: deletedAfter, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt the phone record
+	if err := ps.cryptor.DecryptPhone(&phone); err != nil {
+		return nil, err
+	}
+
+	return &phone, nil
+}
+
+// RestorePhone restores a user's tombstoned phone record if it was deleted after deletedAfter.
+func (ps *phoneStore) RestorePhone(ctx context.Context, slug, username string, deletedAfter time.Time) (*sqlc.Phone, error) {
+
+	// get slug index
+	slugIndex, err := ps.indexer.ObtainBlindIndex(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// get username index
+	userIndex, err := ps.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user and window checks are part of the update so a tombstone
+	// cannot be restored by another user or after the window has passed
+	rows, err := ps.sql.RestorePhone(ctx, sqlc.RestorePhoneParams{
+		UpdatedAt:    time.Now().UTC(),
+		SlugIndex:    slugIndex,
+		UserIndex:    userIndex,
+		DeletedAfter: sql.NullTime{Time: deletedAfter, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return ps.GetPhone(ctx, slug, username)
+}
+
+// PurgePhones shreds and hard deletes phone records, and their history and xrefs, tombstoned before deletedBefore.
+// The encrypted fields are overwritten before the rows are deleted, all in one transaction.
+func (ps *phoneStore) PurgePhones(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin phone purge transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	q := ps.sql.WithTx(tx)
+	before := sql.NullTime{Time: deletedBefore, Valid: true}
+
+	if _, err := q.ShredTombstonedPhones(ctx, before); err != nil {
+		return 0, fmt.Errorf("failed to shred tombstoned phone records: %v", err)
+	}
+
+	if _, err := q.DeleteTombstonedPhoneHistory(ctx, before); err != nil {
+		return 0, fmt.Errorf("failed to delete tombstoned phone history: %v", err)
+	}
+
+	if _, err := q.DeleteTombstonedPhoneXrefs(ctx, before); err != nil {
+		return 0, fmt.Errorf("failed to delete tombstoned phone xrefs: %v", err)
+	}
+
+	purged, err := q.DeleteTombstonedPhones(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tombstoned phone records: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit phone purge transaction: %v", err)
+	}
+
+	return purged, nil
 }
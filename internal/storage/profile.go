@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -22,6 +23,50 @@ type CompleteProfile struct {
 	Phones    []*sqlc.Phone
 }
 
+// batchDecryptWorkers bounds how many profiles of a batch are decrypted at once,
+// so a large batch cannot start a goroutine per record.
+const batchDecryptWorkers = 8
+
+// ProfileSections selects the sections of a complete profile to read in addition to the profile record.
+// Sections which are not selected are neither queried nor decrypted.
+type ProfileSections struct {
+	Addresses bool
+	Phones    bool
+}
+
+// AllProfileSections selects every section of a complete profile.
+var AllProfileSections = ProfileSections{Addresses: true, Phones: true}
+
+// ProfileResult is the outcome of reading a single profile of a batch.
+type ProfileResult struct {
+	Username string
+	Profile  *CompleteProfile // nil if Err is set
+	Err      error            // sql.ErrNoRows if no profile exists for the username
+}
+
+// ProfileFilter narrows a profile listing on fields stored in the clear.  Nil fields do not filter.
+// Time ranges include their from time and exclude their to time.
+type ProfileFilter struct {
+	DarkMode    *bool
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	HasAddress  *bool // has at least one live address
+	HasPhone    *bool // has at least one live phone
+}
+
+// ProfileCursor is the position in a profile listing of the last profile of a page:
+// the next page starts after it.
+type ProfileCursor struct {
+	CreatedAt time.Time
+	Uuid      string
+}
+
+// ErrSharedPhone is returned by FindProfileByPhone when a phone number belongs to more than one profile,
+// so the number does not identify a single user.
+var ErrSharedPhone = errors.New("phone number belongs to more than one profile")
+
 // ProfileStore defines the interface for storing and retrieving user profiles.
 type ProfileStore interface {
 
@@ -32,9 +77,26 @@ type ProfileStore interface {
 	// address and phone information.
 	GetProfile(ctx context.Context, username string) (*sqlc.Profile, error)
 
-	// GetCompleteProfile retrieves a slice of rows comprised of a join of the profile record and
-	// it's related address and phone information.
-	GetCompleteProfile(ctx context.Context, username string) (*CompleteProfile, error)
+	// GetCompleteProfile retrieves the profile record and the selected sections of it's related address and phone information.
+	// Sections which are not selected are left nil.
+	// Addresses and phones are ordered primary first, then current, then by created_at ascending.
+	GetCompleteProfile(ctx context.Context, username string, sections ProfileSections) (*CompleteProfile, error)
+
+	// GetCompleteProfiles retrieves the complete profiles of several users at once, reading only the selected sections.
+	// A result is returned for each username, in the order given, with per-username failures, ie,
+	// a missing profile or a record which fails to decrypt, reported in the result rather than failing the batch.
+	// Addresses and phones are ordered primary first, then current, then by created_at ascending.
+	GetCompleteProfiles(ctx context.Context, usernames []string, sections ProfileSections) ([]ProfileResult, error)
+
+	// ListProfiles retrieves up to limit complete profiles matching the filter, reading only the selected sections.
+	// Profiles are ordered by created_at, then uuid, and start after the cursor, if given.
+	ListProfiles(ctx context.Context, filter ProfileFilter, after *ProfileCursor, limit int, sections ProfileSections) ([]*CompleteProfile, error)
+
+	// FindProfileByPhone retrieves the profile with a live phone of the given number, without including
+	// address and phone information.  The number is expected in its normalized form, ie, calling code and
+	// national significant number.  Returns sql.ErrNoRows if no profile has the number, or
+	// ErrSharedPhone if more than one does.
+	FindProfileByPhone(ctx context.Context, countryCode, phoneNumber string) (*sqlc.Profile, error)
 
 	// UpdateProfile updates an existing user profile.
 	UpdateProfile(ctx context.Context, profile *sqlc.Profile) error
@@ -49,6 +111,7 @@ type ProfileStore interface {
 func NewProfileStore(db *sql.DB, i data.Indexer, c data.Cryptor) ProfileStore {
 
 	return &profileStore{
+		db:             db,
 		sql:            sqlc.New(db),
 		indexer:        i,
 		profileCryptor: crypt.NewProfileCryptor(c),
@@ -62,6 +125,7 @@ var _ ProfileStore = (*profileStore)(nil)
 // profileStore is the concrete implementation of ProfileStore, using SQL for storage,
 // an indexer for searching, and a cryptor for encrypting sensitive profile data.
 type profileStore struct {
+	db             *sql.DB
 	sql            *sqlc.Queries
 	indexer        data.Indexer
 	profileCryptor crypt.ProfileCryptor
@@ -125,8 +189,15 @@ func (ps *profileStore) GetProfile(ctx context.Context, username string) (*sqlc.
 	return &profile, nil
 }
 
-// GetCompleteProfile retrieves a user (complete including address and phone) profile by its ID, decrypting sensitive data before returning it.
-func (ps *profileStore) GetCompleteProfile(ctx context.Context, username string) (*CompleteProfile, error) {
+// GetCompleteProfile retrieves a user (complete including address and phone) profile by its username,
+// decrypting sensitive data before returning it.
+//
+// The profile, address, and phone records are read with separate queries rather than a single join,
+// so the number of rows returned grows additively with the number of addresses and phones instead
+// of multiplicatively.  The queries share a read-only, repeatable-read snapshot, and each record set
+// is decrypted concurrently as soon as its query returns, overlapping with the queries which follow.
+// Sections which are not selected are neither queried nor decrypted.
+func (ps *profileStore) GetCompleteProfile(ctx context.Context, username string, sections ProfileSections) (*CompleteProfile, error) {
 
 	// get blind index for username
 	index, err := ps.indexer.ObtainBlindIndex(username)
@@ -134,120 +205,81 @@ func (ps *profileStore) GetCompleteProfile(ctx context.Context, username string)
 		return nil, err
 	}
 
-	// retrieve profile from database using blind index
-	records, err := ps.sql.FindProfileAddressPhoneRows(ctx, index)
+	// open a read-only snapshot for the queries
+	tx, err := ps.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to begin profile read transaction: %v", err)
 	}
+	defer tx.Rollback() // no-op after commit; nothing is written either way
 
-	if len(records) < 1 {
-		return nil, sql.ErrNoRows
-	}
-
-	// build profile
-	profile := sqlc.Profile{
-		Uuid:      records[0].ProfileUuid,
-		Username:  records[0].Username,
-		NickName:  records[0].NickName,
-		DarkMode:  records[0].DarkMode,
-		UpdatedAt: records[0].ProfileUpdatedAt,
-		CreatedAt: records[0].ProfileCreatedAt,
-	}
-
-	// build map of unique addressMap and phones -> efficient decryption
-	// key is the record uuids
-	addressMap := make(map[string]sqlc.Address, len(records))
-	phoneMap := make(map[string]sqlc.Phone, len(records))
-
-	// populate the maps
-	for _, record := range records {
-
-		// addresses
-		if _, ok := addressMap[record.AddressUuid.String]; !ok && record.AddressUuid.Valid {
-
-			addressMap[record.AddressUuid.String] = sqlc.Address{
-				Uuid:         record.AddressUuid.String,
-				Slug:         record.AddressSlug.String,
-				AddressLine1: record.AddressLine1,
-				AddressLine2: record.AddressLine2,
-				City:         record.City,
-				State:        record.State,
-				Zip:          record.Zip,
-				Country:      record.AddressCountry,
-				IsCurrent:    record.AddressIsCurrent.Bool,
-				IsPrimary:    record.AddressIsPrimary.Bool,
-				UpdatedAt:    record.AddressUpdatedAt.Time,
-				CreatedAt:    record.AddressCreatedAt.Time,
-			}
-		}
+	q := ps.sql.WithTx(tx)
 
-		// phones
-		if _, ok := phoneMap[record.PhoneUuid.String]; !ok && record.PhoneUuid.Valid {
-			phoneMap[record.PhoneUuid.String] = sqlc.Phone{
-				Uuid:        record.PhoneUuid.String,
-				Slug:        record.PhoneSlug.String,
-				CountryCode: record.PhoneCountryCode,
-				PhoneNumber: record.PhoneNumber,
-				Extension:   record.Extension,
-				PhoneType:   record.PhoneType,
-				IsCurrent:   record.PhoneIsCurrent.Bool,
-				IsPrimary:   record.PhoneIsPrimary.Bool,
-				UpdatedAt:   record.PhoneUpdatedAt.Time,
-				CreatedAt:   record.PhoneCreatedAt.Time,
-			}
-		}
+	// retrieve the profile record using blind index
+	// a missing profile is returned as is, so callers can check for sql.ErrNoRows
+	record, err := q.FindProfile(ctx, index)
+	if err != nil {
+		return nil, err
 	}
 
 	var (
 		wg        sync.WaitGroup
-		profileCh = make(chan *sqlc.Profile, 1)
-		addressCh = make(chan sqlc.Address, len(addressMap))
-		phoneCh   = make(chan sqlc.Phone, len(phoneMap))
-		errCh     = make(chan error, 1+len(addressMap)+len(phoneMap))
+		profile   = &record
+		addresses []*sqlc.Address
+		phones    []*sqlc.Phone
+		errCh     = make(chan error, 5)
 	)
 
-	// decrypt profile
+	// decrypt the profile while the sections are read
 	wg.Add(1)
-	go func(p sqlc.Profile) {
+	go func() {
 		defer wg.Done()
-		if err := ps.profileCryptor.DecryptProfile(&p); err != nil {
+		if err := ps.profileCryptor.DecryptProfile(profile); err != nil {
 			errCh <- err
-			return
 		}
-		profileCh <- &p
-	}(profile)
+	}()
+
+	// retrieve address records, decrypting them while the phones are read
+	if sections.Addresses {
+		if records, err := q.FindAddressesByUser(ctx, index); err != nil {
+			errCh <- fmt.Errorf("failed to find addresses: %v", err)
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var err error
+				if addresses, err = decryptAddresses(ps.addressCryptor, records); err != nil {
+					errCh <- err
+				}
+			}()
+		}
+	}
 
-	// decrypt addresses
-	for _, address := range addressMap {
-		wg.Add(1)
-		go func(a sqlc.Address) {
-			defer wg.Done()
-			if err := ps.addressCryptor.DecryptAddress(&a); err != nil {
-				errCh <- err
-				return
-			}
-			addressCh <- a
-		}(address)
+	// retrieve phone records
+	if sections.Phones {
+		if records, err := q.FindPhonesByUser(ctx, index); err != nil {
+			errCh <- fmt.Errorf("failed to find phones: %v", err)
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var err error
+				if phones, err = decryptPhones(ps.phoneCryptor, records); err != nil {
+					errCh <- err
+				}
+			}()
+		}
 	}
 
-	// decrypt phones
-	for _, phone := range phoneMap {
-		wg.Add(1)
-		go func(p sqlc.Phone) {
-			defer wg.Done()
-			if err := ps.phoneCryptor.DecryptPhone(&p); err != nil {
-				errCh <- err
-				return
-			}
-			phoneCh <- p
-		}(phone)
+	// release the snapshot: all reads are complete
+	if err := tx.Commit(); err != nil {
+		errCh <- fmt.Errorf("failed to close profile read transaction: %v", err)
 	}
 
-	// wait for all decryption goroutines to finish
+	// wait for decryption to finish
 	wg.Wait()
-	close(profileCh)
-	close(addressCh)
-	close(phoneCh)
 	close(errCh)
 
 	// check for errs
@@ -256,30 +288,315 @@ func (ps *profileStore) GetCompleteProfile(ctx context.Context, username string)
 		for err := range errCh {
 			errs = append(errs, err)
 		}
-		return nil, fmt.Errorf("errors occurred during decryption: %v", errors.Join(errs...))
+		return nil, fmt.Errorf("errors occurred loading complete profile: %v", errors.Join(errs...))
+	}
+
+	return &CompleteProfile{
+		Profile:   profile,
+		Addresses: addresses,
+		Phones:    phones,
+	}, nil
+}
+
+// GetCompleteProfiles retrieves the complete profiles of several users at once, decrypting them through a bounded pool.
+//
+// Blind indexes for every username are computed up front so each table is read with a single IN query
+// rather than a query per user.  The queries share a read-only, repeatable-read snapshot.
+func (ps *profileStore) GetCompleteProfiles(ctx context.Context, usernames []string, sections ProfileSections) ([]ProfileResult, error) {
+
+	results := make([]ProfileResult, len(usernames))
+
+	// compute the blind indexes, mapping each back to the positions of its username
+	positions := make(map[string][]int, len(usernames))
+	indexes := make([]string, 0, len(usernames))
+	for i, username := range usernames {
+		results[i].Username = username
+
+		index, err := ps.indexer.ObtainBlindIndex(username)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if _, ok := positions[index]; !ok {
+			indexes = append(indexes, index)
+		}
+		positions[index] = append(positions[index], i)
 	}
 
-	// collect the decrypted profile, addresses, and phones
-	addresses := make([]*sqlc.Address, 0, len(addressCh))
-	for address := range addressCh {
-		addresses = append(addresses, &address)
+	if len(indexes) == 0 {
+		return results, nil
 	}
 
-	phones := make([]*sqlc.Phone, 0, len(phoneCh))
-	for phone := range phoneCh {
-		phones = append(phones, &phone)
+	// open a read-only snapshot for the queries
+	tx, err := ps.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin batch profile read transaction: %v", err)
 	}
+	defer tx.Rollback() // no-op after commit; nothing is written either way
+
+	q := ps.sql.WithTx(tx)
 
-	profilePtr, ok := <-profileCh
-	if !ok {
-		return nil, errors.New("profile channel closed without delivering a decrypted profile")
+	profiles, err := q.FindProfilesByUserIndexes(ctx, indexes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve profile records: %v", err)
 	}
 
-	return &CompleteProfile{
-		Profile:   profilePtr,
-		Addresses: addresses,
-		Phones:    phones,
-	}, nil
+	addresses, phones, err := findSections(ctx, q, profiles, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	// release the snapshot: all reads are complete
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to close batch profile read transaction: %v", err)
+	}
+
+	decrypted, errs := ps.decryptCompletes(profiles, addresses, phones)
+
+	// map the decrypted profiles back to the requested usernames
+	found := make(map[string]bool, len(profiles))
+	for i, p := range profiles {
+		found[p.UserIndex] = true
+		for _, pos := range positions[p.UserIndex] {
+			results[pos].Profile, results[pos].Err = decrypted[i], errs[i]
+		}
+	}
+
+	for index, pos := range positions {
+		if found[index] {
+			continue
+		}
+		for _, i := range pos {
+			results[i].Err = sql.ErrNoRows
+		}
+	}
+
+	return results, nil
+}
+
+// findSections reads the selected sections of a set of profiles with one query per section,
+// grouped by profile uuid and kept in query order within each profile.
+func findSections(
+	ctx context.Context,
+	q *sqlc.Queries,
+	profiles []sqlc.Profile,
+	sections ProfileSections,
+) (map[string][]sqlc.Address, map[string][]sqlc.Phone, error) {
+
+	profileUuids := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		profileUuids = append(profileUuids, p.Uuid)
+	}
+
+	addresses := make(map[string][]sqlc.Address)
+	if sections.Addresses && len(profileUuids) > 0 {
+		rows, err := q.FindAddressesByProfiles(ctx, profileUuids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve address records: %v", err)
+		}
+		for _, row := range rows {
+			addresses[row.ProfileUuid] = append(addresses[row.ProfileUuid], row.Address)
+		}
+	}
+
+	phones := make(map[string][]sqlc.Phone)
+	if sections.Phones && len(profileUuids) > 0 {
+		rows, err := q.FindPhonesByProfiles(ctx, profileUuids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve phone records: %v", err)
+		}
+		for _, row := range rows {
+			phones[row.ProfileUuid] = append(phones[row.ProfileUuid], row.Phone)
+		}
+	}
+
+	return addresses, phones, nil
+}
+
+// decryptCompletes decrypts each profile and its sections on a bounded pool of workers,
+// returning the decrypted profiles and any error of each, by position.
+func (ps *profileStore) decryptCompletes(
+	profiles []sqlc.Profile,
+	addresses map[string][]sqlc.Address,
+	phones map[string][]sqlc.Phone,
+) ([]*CompleteProfile, []error) {
+
+	var (
+		wg        sync.WaitGroup
+		jobs      = make(chan int)
+		decrypted = make([]*CompleteProfile, len(profiles))
+		errs      = make([]error, len(profiles))
+	)
+
+	for range min(batchDecryptWorkers, len(profiles)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				p := profiles[i]
+				decrypted[i], errs[i] = ps.decryptComplete(p, addresses[p.Uuid], phones[p.Uuid])
+			}
+		}()
+	}
+
+	for i := range profiles {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return decrypted, errs
+}
+
+// decryptComplete decrypts a profile record and its address and phone records in the calling goroutine.
+func (ps *profileStore) decryptComplete(profile sqlc.Profile, addresses []sqlc.Address, phones []sqlc.Phone) (*CompleteProfile, error) {
+
+	if err := ps.profileCryptor.DecryptProfile(&profile); err != nil {
+		return nil, fmt.Errorf("failed to decrypt profile record: %v", err)
+	}
+
+	complete := &CompleteProfile{
+		Profile:   &profile,
+		Addresses: make([]*sqlc.Address, 0, len(addresses)),
+		Phones:    make([]*sqlc.Phone, 0, len(phones)),
+	}
+
+	for i := range addresses {
+		if err := ps.addressCryptor.DecryptAddress(&addresses[i]); err != nil {
+			return nil, fmt.Errorf("failed to decrypt address record %s: %v", addresses[i].Uuid, err)
+		}
+		complete.Addresses = append(complete.Addresses, &addresses[i])
+	}
+
+	for i := range phones {
+		if err := ps.phoneCryptor.DecryptPhone(&phones[i]); err != nil {
+			return nil, fmt.Errorf("failed to decrypt phone record %s: %v", phones[i].Uuid, err)
+		}
+		complete.Phones = append(complete.Phones, &phones[i])
+	}
+
+	return complete, nil
+}
+
+// ListProfiles retrieves a page of complete profiles matching the filter, ordered by created_at, then uuid,
+// starting after the cursor.  The page is read in a single read-only, repeatable-read snapshot and decrypted
+// through the bounded pool used for batches; a record which fails to decrypt fails the page.
+func (ps *profileStore) ListProfiles(ctx context.Context, filter ProfileFilter, after *ProfileCursor, limit int, sections ProfileSections) ([]*CompleteProfile, error) {
+
+	params := sqlc.FindProfilesPageParams{
+		DarkMode:    nullBool(filter.DarkMode),
+		CreatedFrom: nullTime(filter.CreatedFrom),
+		CreatedTo:   nullTime(filter.CreatedTo),
+		UpdatedFrom: nullTime(filter.UpdatedFrom),
+		UpdatedTo:   nullTime(filter.UpdatedTo),
+		HasAddress:  nullFlag(filter.HasAddress),
+		HasPhone:    nullFlag(filter.HasPhone),
+		Limit:       int32(limit),
+	}
+
+	if after != nil {
+		params.AfterCreatedAt = sql.NullTime{Time: after.CreatedAt, Valid: true}
+		params.AfterUuid = after.Uuid
+	}
+
+	// open a read-only snapshot for the queries
+	tx, err := ps.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin profile page read transaction: %v", err)
+	}
+	defer tx.Rollback() // no-op after commit; nothing is written either way
+
+	q := ps.sql.WithTx(tx)
+
+	profiles, err := q.FindProfilesPage(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve profile records: %v", err)
+	}
+
+	addresses, phones, err := findSections(ctx, q, profiles, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	// release the snapshot: all reads are complete
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to close profile page read transaction: %v", err)
+	}
+
+	decrypted, errs := ps.decryptCompletes(profiles, addresses, phones)
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt profile %s: %v", profiles[i].Uuid, err)
+		}
+	}
+
+	return decrypted, nil
+}
+
+// nullBool converts an optional filter value to a query parameter, NULL when it is not set.
+func nullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
+// nullTime converts an optional filter value to a query parameter, NULL when it is not set.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// nullFlag converts an optional filter value to a query parameter compared against an EXISTS subquery,
+// which evaluates to 1 or 0, NULL when it is not set.
+func nullFlag(b *bool) sql.NullInt64 {
+	switch {
+	case b == nil:
+		return sql.NullInt64{}
+	case *b:
+		return sql.NullInt64{Int64: 1, Valid: true}
+	default:
+		return sql.NullInt64{Int64: 0, Valid: true}
+	}
+}
+
+// FindProfileByPhone retrieves the profile with a live phone of the given number using the phone's lookup index.
+func (ps *profileStore) FindProfileByPhone(ctx context.Context, countryCode, phoneNumber string) (*sqlc.Profile, error) {
+
+	// get blind index for the number
+	index, err := ps.indexer.ObtainBlindIndex(phoneIndexMaterial(countryCode, phoneNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := ps.sql.FindProfilesByPhoneIndex(ctx, sql.NullString{String: index, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(profiles) {
+	case 0:
+		return nil, sql.ErrNoRows
+	case 1:
+	default:
+		return nil, ErrSharedPhone
+	}
+
+	profile := profiles[0]
+	if err := ps.profileCryptor.DecryptProfile(&profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
 }
 
 func (ps *profileStore) UpdateProfile(ctx context.Context, profile *sqlc.Profile) error {
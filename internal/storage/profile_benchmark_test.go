@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/silhouette/internal/storage/crypt"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// benchmarks comparing the legacy single LEFT JOIN complete-profile read against the
+// separate profile/address/phone queries used by GetCompleteProfile.
+// The database is an in-memory database/sql driver serving pre-encrypted rows, so the
+// numbers capture row transfer, scanning, de-duplication, and decryption, but not network
+// or query planning costs.
+// Note: this is a benchmark test, not a unit test, and is intended to be run with the -bench flag
+
+// legacyJoinQuery is the cartesian join previously used to load a complete profile.
+const legacyJoinQuery = `SELECT
+    p.uuid, p.username, p.nick_name, p.dark_mode, p.updated_at, p.created_at,
+    a.uuid, a.slug, a.address_line_1, a.address_line_2, a.city, a.state, a.zip, a.country,
+    a.is_current, a.is_primary, a.updated_at, a.created_at,
+    ph.uuid, ph.slug, ph.country_code, ph.phone_number, ph.extension, ph.phone_type,
+    ph.is_current, ph.is_primary, ph.updated_at, ph.created_at
+FROM profile p
+LEFT JOIN profile_address pa ON p.uuid = pa.profile_uuid
+LEFT JOIN address a ON pa.address_uuid = a.uuid
+LEFT JOIN profile_phone pp ON p.uuid = pp.profile_uuid
+LEFT JOIN phone ph ON pp.phone_uuid = ph.uuid
+WHERE p.user_index = ?`
+
+// benchFixture holds the encrypted rows served by the in-memory driver.
+type benchFixture struct {
+	profile   []driver.Value
+	addresses [][]driver.Value
+	phones    [][]driver.Value
+	joined    [][]driver.Value
+}
+
+// setupBenchCryptor creates a cryptor for benchmarking
+func setupBenchCryptor(b *testing.B) data.Cryptor {
+	// Use a fixed key for consistent benchmarking
+	key := []byte("12345678901234567890123456789012") // 32 bytes for AES-256
+	cryptor, err := data.NewServiceAesGcmKey(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return cryptor
+}
+
+// modelRow returns the fields of a sqlc model as a driver row, in field order.  The queries
+// GetCompleteProfile runs return whole models, so their columns are the model's fields, and
+// building rows from the models keeps the fixture in step with the schema as columns are added.
+func modelRow(tb testing.TB, model any) []driver.Value {
+
+	v := reflect.ValueOf(model)
+	row := make([]driver.Value, v.NumField())
+	for i := range row {
+		field := v.Field(i).Interface()
+		if valuer, ok := field.(driver.Valuer); ok {
+			value, err := valuer.Value()
+			if err != nil {
+				tb.Fatal(err)
+			}
+			row[i] = value
+			continue
+		}
+		row[i] = field
+	}
+
+	return row
+}
+
+// newBenchFixture builds a Star Wars themed profile with the given number of
+// addresses and phones, encrypted the same way the stores persist them.
+func newBenchFixture(b *testing.B, c data.Cryptor, addressCount, phoneCount int) *benchFixture {
+
+	now := time.Now().UTC()
+
+	profile := sqlc.Profile{
+		Uuid:      "luke-skywalker-uuid",
+		Username:  "luke@rebellion.org",
+		UserIndex: "user-index",
+		NickName:  sql.NullString{String: "Red Five", Valid: true},
+		DarkMode:  true,
+		UpdatedAt: now,
+		CreatedAt: now,
+	}
+	if err := crypt.NewProfileCryptor(c).EncryptProfile(&profile); err != nil {
+		b.Fatal(err)
+	}
+
+	fx := &benchFixture{profile: modelRow(b, profile)}
+
+	addressCryptor := crypt.NewAddressCryptor(c)
+	addresses := make([]sqlc.Address, 0, addressCount)
+	for i := 0; i < addressCount; i++ {
+		a := sqlc.Address{
+			Uuid:         fmt.Sprintf("address-uuid-%d", i),
+			Slug:         fmt.Sprintf("moisture-farm-%d", i),
+			SlugIndex:    "slug-index",
+			AddressLine1: sql.NullString{String: fmt.Sprintf("%d Lars Homestead", i), Valid: true},
+			AddressLine2: sql.NullString{String: "Igloo 2", Valid: true},
+			City:         sql.NullString{String: "Anchorhead", Valid: true},
+			State:        sql.NullString{String: "Great Chott Salt Flat", Valid: true},
+			Zip:          sql.NullString{String: "TT-001", Valid: true},
+			Country:      sql.NullString{String: "Tatooine", Valid: true},
+			IsCurrent:    true,
+			IsPrimary:    i == 0,
+			UpdatedAt:    now,
+			CreatedAt:    now,
+			AddressType:  "UNSPECIFIED",
+		}
+		if err := addressCryptor.EncryptAddress(&a); err != nil {
+			b.Fatal(err)
+		}
+		addresses = append(addresses, a)
+		fx.addresses = append(fx.addresses, modelRow(b, a))
+	}
+
+	phoneCryptor := crypt.NewPhoneCryptor(c)
+	phones := make([]sqlc.Phone, 0, phoneCount)
+	for i := 0; i < phoneCount; i++ {
+		p := sqlc.Phone{
+			Uuid:        fmt.Sprintf("phone-uuid-%d", i),
+			Slug:        fmt.Sprintf("comlink-%d", i),
+			SlugIndex:   "slug-index",
+			CountryCode: sql.NullString{String: "1", Valid: true},
+			PhoneNumber: sql.NullString{String: fmt.Sprintf("555010%04d", i), Valid: true},
+			Extension:   sql.NullString{String: "42", Valid: true},
+			PhoneType:   sql.NullString{String: "MOBILE", Valid: true},
+			IsCurrent:   true,
+			IsPrimary:   i == 0,
+			UpdatedAt:   now,
+			CreatedAt:   now,
+		}
+		if err := phoneCryptor.EncryptPhone(&p); err != nil {
+			b.Fatal(err)
+		}
+		phones = append(phones, p)
+		fx.phones = append(fx.phones, modelRow(b, p))
+	}
+
+	// build the cartesian product the legacy join returns, in the columns of legacyJoinQuery
+	profileCols := []driver.Value{profile.Uuid, profile.Username, profile.NickName.String, profile.DarkMode, profile.UpdatedAt, profile.CreatedAt}
+	addressCols := [][]driver.Value{make([]driver.Value, 12)}
+	if len(addresses) > 0 {
+		addressCols = addressCols[:0]
+		for _, a := range addresses {
+			addressCols = append(addressCols, []driver.Value{
+				a.Uuid, a.Slug, a.AddressLine1.String, a.AddressLine2.String, a.City.String, a.State.String, a.Zip.String, a.Country.String,
+				a.IsCurrent, a.IsPrimary, a.UpdatedAt, a.CreatedAt,
+			})
+		}
+	}
+	phoneCols := [][]driver.Value{make([]driver.Value, 10)}
+	if len(phones) > 0 {
+		phoneCols = phoneCols[:0]
+		for _, p := range phones {
+			phoneCols = append(phoneCols, []driver.Value{
+				p.Uuid, p.Slug, p.CountryCode.String, p.PhoneNumber.String, p.Extension.String, p.PhoneType.String,
+				p.IsCurrent, p.IsPrimary, p.UpdatedAt, p.CreatedAt,
+			})
+		}
+	}
+	for _, a := range addressCols {
+		for _, p := range phoneCols {
+			row := append(append(append([]driver.Value{}, profileCols...), a...), p...)
+			fx.joined = append(fx.joined, row)
+		}
+	}
+
+	return fx
+}
+
+// getCompleteProfileJoin is the legacy implementation of GetCompleteProfile: a single
+// LEFT JOIN whose rows are de-duplicated through maps before decryption.
+func getCompleteProfileJoin(ctx context.Context, db *sql.DB, ps *profileStore, username string) (*CompleteProfile, error) {
+
+	index, err := ps.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, legacyJoinQuery, index)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		profile    *sqlc.Profile
+		addressMap = make(map[string]sqlc.Address)
+		phoneMap   = make(map[string]sqlc.Phone)
+	)
+	for rows.Next() {
+		var (
+			p sqlc.Profile
+
+			aUuid, aSlug                   sql.NullString
+			aLine1, aLine2, aCity, aState  sql.NullString
+			aZip, aCountry                 sql.NullString
+			aCurrent, aPrimary             sql.NullBool
+			aUpdated, aCreated             sql.NullTime
+			phUuid, phSlug, phCc, phNumber sql.NullString
+			phExt, phType                  sql.NullString
+			phCurrent, phPrimary           sql.NullBool
+			phUpdated, phCreated           sql.NullTime
+		)
+		if err := rows.Scan(
+			&p.Uuid, &p.Username, &p.NickName, &p.DarkMode, &p.UpdatedAt, &p.CreatedAt,
+			&aUuid, &aSlug, &aLine1, &aLine2, &aCity, &aState, &aZip, &aCountry,
+			&aCurrent, &aPrimary, &aUpdated, &aCreated,
+			&phUuid, &phSlug, &phCc, &phNumber, &phExt, &phType,
+			&phCurrent, &phPrimary, &phUpdated, &phCreated,
+		); err != nil {
+			return nil, err
+		}
+
+		if profile == nil {
+			profile = &p
+		}
+
+		if _, ok := addressMap[aUuid.String]; !ok && aUuid.Valid {
+			addressMap[aUuid.String] = sqlc.Address{
+				Uuid:         aUuid.String,
+				Slug:         aSlug.String,
+				AddressLine1: aLine1,
+				AddressLine2: aLine2,
+				City:         aCity,
+				State:        aState,
+				Zip:          aZip,
+				Country:      aCountry,
+				IsCurrent:    aCurrent.Bool,
+				IsPrimary:    aPrimary.Bool,
+				UpdatedAt:    aUpdated.Time,
+				CreatedAt:    aCreated.Time,
+			}
+		}
+
+		if _, ok := phoneMap[phUuid.String]; !ok && phUuid.Valid {
+			phoneMap[phUuid.String] = sqlc.Phone{
+				Uuid:        phUuid.String,
+				Slug:        phSlug.String,
+				CountryCode: phCc,
+				PhoneNumber: phNumber,
+				Extension:   phExt,
+				PhoneType:   phType,
+				IsCurrent:   phCurrent.Bool,
+				IsPrimary:   phPrimary.Bool,
+				UpdatedAt:   phUpdated.Time,
+				CreatedAt:   phCreated.Time,
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if profile == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := ps.profileCryptor.DecryptProfile(profile); err != nil {
+		return nil, err
+	}
+
+	addressRecords := make([]sqlc.Address, 0, len(addressMap))
+	for _, a := range addressMap {
+		addressRecords = append(addressRecords, a)
+	}
+	addresses, err := decryptAddresses(ps.addressCryptor, addressRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	phoneRecords := make([]sqlc.Phone, 0, len(phoneMap))
+	for _, p := range phoneMap {
+		phoneRecords = append(phoneRecords, p)
+	}
+	phones, err := decryptPhones(ps.phoneCryptor, phoneRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompleteProfile{
+		Profile:   profile,
+		Addresses: addresses,
+		Phones:    phones,
+	}, nil
+}
+
+// BenchmarkGetCompleteProfile compares the legacy join against separate queries
+// as the number of addresses and phones per user grows.
+func BenchmarkGetCompleteProfile(b *testing.B) {
+
+	cryptor := setupBenchCryptor(b)
+	indexer, err := data.NewIndexer([]byte("12345678901234567890123456789012"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{1, 3, 10} {
+
+		fx := newBenchFixture(b, cryptor, size, size)
+		db := sql.OpenDB(&benchConnector{fixture: fx})
+		ps := NewProfileStore(db, indexer, cryptor).(*profileStore)
+		ctx := context.Background()
+
+		b.Run(fmt.Sprintf("Join/%dx%d", size, size), func(b *testing.B) {
+			b.ReportMetric(float64(len(fx.joined)), "rows/op")
+			for i := 0; i < b.N; i++ {
+				cp, err := getCompleteProfileJoin(ctx, db, ps, "luke@rebellion.org")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(cp.Addresses) != size || len(cp.Phones) != size {
+					b.Fatalf("expected %d addresses and phones, got %d and %d", size, len(cp.Addresses), len(cp.Phones))
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Separate/%dx%d", size, size), func(b *testing.B) {
+			b.ReportMetric(float64(1+len(fx.addresses)+len(fx.phones)), "rows/op")
+			for i := 0; i < b.N; i++ {
+				cp, err := ps.GetCompleteProfile(ctx, "luke@rebellion.org", AllProfileSections)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(cp.Addresses) != size || len(cp.Phones) != size {
+					b.Fatalf("expected %d addresses and phones, got %d and %d", size, len(cp.Addresses), len(cp.Phones))
+				}
+			}
+		})
+
+		db.Close()
+	}
+}
+
+// benchConnector is a database/sql connector serving a benchFixture's rows.
+type benchConnector struct {
+	fixture *benchFixture
+}
+
+func (c *benchConnector) Connect(context.Context) (driver.Conn, error) {
+	return &benchConn{fixture: c.fixture}, nil
+}
+
+func (c *benchConnector) Driver() driver.Driver { return benchDriver{} }
+
+type benchDriver struct{}
+
+func (benchDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("bench driver must be opened with sql.OpenDB")
+}
+
+// benchConn routes queries to fixture rows by the table they select from.
+type benchConn struct {
+	fixture *benchFixture
+}
+
+func (c *benchConn) Prepare(query string) (driver.Stmt, error) {
+	return &benchStmt{conn: c, query: query}, nil
+}
+
+func (c *benchConn) Close() error { return nil }
+
+func (c *benchConn) Begin() (driver.Tx, error) { return benchTx{}, nil }
+
+// BeginTx is required for database/sql to accept read-only transaction options.
+func (c *benchConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return benchTx{}, nil
+}
+
+type benchTx struct{}
+
+func (benchTx) Commit() error   { return nil }
+func (benchTx) Rollback() error { return nil }
+
+type benchStmt struct {
+	conn  *benchConn
+	query string
+}
+
+func (s *benchStmt) Close() error  { return nil }
+func (s *benchStmt) NumInput() int { return -1 }
+
+func (s *benchStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("bench driver is read only")
+}
+
+func (s *benchStmt) Query([]driver.Value) (driver.Rows, error) {
+
+	fx := s.conn.fixture
+	switch {
+	case strings.Contains(s.query, "LEFT JOIN"):
+		return &benchRows{cols: 28, rows: fx.joined}, nil
+	case strings.Contains(s.query, "FROM profile\n"):
+		return &benchRows{cols: len(fx.profile), rows: [][]driver.Value{fx.profile}}, nil
+	case strings.Contains(s.query, "FROM address a"):
+		return &benchRows{cols: len(fx.addresses[0]), rows: fx.addresses}, nil
+	case strings.Contains(s.query, "FROM phone p"):
+		return &benchRows{cols: len(fx.phones[0]), rows: fx.phones}, nil
+	default:
+		return nil, fmt.Errorf("bench driver does not serve query: %s", s.query)
+	}
+}
+
+type benchRows struct {
+	cols int
+	rows [][]driver.Value
+	next int
+}
+
+func (r *benchRows) Columns() []string { return make([]string, r.cols) }
+func (r *benchRows) Close() error      { return nil }
+
+func (r *benchRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
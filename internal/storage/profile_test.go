@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/silhouette/internal/storage/crypt"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+func TestGetCompleteProfileSnapshot(t *testing.T) {
+
+	indexer, cryptor := setupTestCrypto(t)
+	now := time.Now().UTC()
+
+	profile := sqlc.Profile{Uuid: "profile-uuid", Username: "user@example.com", NickName: sql.NullString{String: "Red Five", Valid: true}, UpdatedAt: now, CreatedAt: now}
+	if err := crypt.NewProfileCryptor(cryptor).EncryptProfile(&profile); err != nil {
+		t.Fatal(err)
+	}
+	address := sqlc.Address{
+		Uuid:         "address-uuid",
+		Slug:         "address-slug",
+		AddressLine1: sql.NullString{String: "1 Main St", Valid: true},
+		City:         sql.NullString{String: "Springfield", Valid: true},
+		State:        sql.NullString{String: "IL", Valid: true},
+		Zip:          sql.NullString{String: "62701", Valid: true},
+		Country:      sql.NullString{String: "US", Valid: true},
+		AddressType:  "HOME",
+		UpdatedAt:    now,
+		CreatedAt:    now,
+	}
+	if err := crypt.NewAddressCryptor(cryptor).EncryptAddress(&address); err != nil {
+		t.Fatal(err)
+	}
+	phone := sqlc.Phone{
+		Uuid:        "phone-uuid",
+		Slug:        "phone-slug",
+		CountryCode: sql.NullString{String: "1", Valid: true},
+		PhoneNumber: sql.NullString{String: "2125550123", Valid: true},
+		PhoneType:   sql.NullString{String: "MOBILE", Valid: true},
+		UpdatedAt:   now,
+		CreatedAt:   now,
+	}
+	if err := crypt.NewPhoneCryptor(cryptor).EncryptPhone(&phone); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		sections  ProfileSections
+		noProfile bool
+		errs      map[string]error
+		wantCalls []string
+		wantErr   error
+	}{
+		{
+			name:      "every section is read in one snapshot",
+			sections:  AllProfileSections,
+			wantCalls: []string{"begin", "FindProfile", "FindAddressesByUser", "FindPhonesByUser", "commit"},
+		},
+		{
+			name:      "unselected sections are not read",
+			sections:  ProfileSections{},
+			wantCalls: []string{"begin", "FindProfile", "commit"},
+		},
+		{
+			name:      "missing profile",
+			sections:  AllProfileSections,
+			noProfile: true,
+			wantCalls: []string{"begin", "FindProfile", "rollback"},
+			wantErr:   sql.ErrNoRows,
+		},
+		{
+			name:      "failed section read",
+			sections:  AllProfileSections,
+			errs:      map[string]error{"FindAddressesByUser": errors.New("deadlock")},
+			wantCalls: []string{"begin", "FindProfile", "FindAddressesByUser", "FindPhonesByUser", "commit"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db, recorder := newSqlRecorder(t)
+			if !tc.noProfile {
+				recorder.rows["FindProfile"] = [][]driver.Value{modelRow(t, profile)}
+			}
+			recorder.rows["FindAddressesByUser"] = [][]driver.Value{modelRow(t, address)}
+			recorder.rows["FindPhonesByUser"] = [][]driver.Value{modelRow(t, phone)}
+			for name, err := range tc.errs {
+				recorder.errs[name] = err
+			}
+
+			cp, err := NewProfileStore(db, indexer, cryptor).GetCompleteProfile(context.Background(), "user@example.com", tc.sections)
+
+			if got := recorder.names(); !slices.Equal(got, tc.wantCalls) {
+				t.Errorf("calls = %v, want %v", got, tc.wantCalls)
+			}
+			if args, _ := recorder.call("begin"); !slices.Equal(args, []driver.Value{int64(sql.LevelRepeatableRead), true}) {
+				t.Errorf("begin args = %v, want a read-only repeatable read snapshot", args)
+			}
+
+			switch {
+			case tc.wantErr != nil:
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("GetCompleteProfile() err = %v, want %v", err, tc.wantErr)
+				}
+				return
+			case len(tc.errs) > 0:
+				if err == nil {
+					t.Error("expected GetCompleteProfile() to fail")
+				}
+				return
+			case err != nil:
+				t.Fatalf("GetCompleteProfile() err = %v", err)
+			}
+
+			if cp.Profile.NickName.String != "Red Five" {
+				t.Errorf("profile nickname = %q, want it decrypted", cp.Profile.NickName.String)
+			}
+			if tc.sections.Addresses && (len(cp.Addresses) != 1 || cp.Addresses[0].AddressLine1.String != "1 Main St") {
+				t.Errorf("addresses = %+v, want the decrypted address", cp.Addresses)
+			}
+			if tc.sections.Phones && (len(cp.Phones) != 1 || cp.Phones[0].PhoneNumber.String != "2125550123") {
+				t.Errorf("phones = %+v, want the decrypted phone", cp.Phones)
+			}
+			if !tc.sections.Addresses && cp.Addresses != nil || !tc.sections.Phones && cp.Phones != nil {
+				t.Errorf("unselected sections were returned: %+v", cp)
+			}
+		})
+	}
+}
+
+// TestListProfilesCursor checks the cursor is bound to the page query, so a page starts after profiles created
+// at the cursor's time with a lower or equal uuid, and at no later profile created at the same time.
+func TestListProfilesCursor(t *testing.T) {
+
+	indexer, cryptor := setupTestCrypto(t)
+	tie := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		after    *ProfileCursor
+		wantArgs []driver.Value // after_created_at three times, then after_uuid
+	}{
+		{"first page", nil, []driver.Value{nil, nil, nil, ""}},
+		{"after a tied profile", &ProfileCursor{CreatedAt: tie, Uuid: "00000000-0000-4000-8000-000000000002"}, []driver.Value{tie, tie, tie, "00000000-0000-4000-8000-000000000002"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db, recorder := newSqlRecorder(t)
+			store := NewProfileStore(db, indexer, cryptor)
+
+			if _, err := store.ListProfiles(context.Background(), ProfileFilter{}, tc.after, 3, ProfileSections{}); err != nil {
+				t.Fatalf("ListProfiles() err = %v", err)
+			}
+
+			args, ok := recorder.call("FindProfilesPage")
+			if !ok {
+				t.Fatalf("expected FindProfilesPage to be called, got %v", recorder.names())
+			}
+			if !slices.Equal(args[:4], tc.wantArgs) {
+				t.Errorf("FindProfilesPage cursor args = %v, want %v", args[:4], tc.wantArgs)
+			}
+			if limit := args[len(args)-1]; limit != int64(3) {
+				t.Errorf("FindProfilesPage limit = %v, want 3", limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// testKey is a fixed 32 byte key for the test cryptor and indexer.
+var testKey = []byte("12345678901234567890123456789012")
+
+// setupTestCrypto creates an indexer and cryptor with a fixed key.
+func setupTestCrypto(t *testing.T) (data.Indexer, data.Cryptor) {
+
+	indexer, err := data.NewIndexer(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cryptor, err := data.NewServiceAesGcmKey(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return indexer, cryptor
+}
+
+// recordedCall is a statement run through the recording driver, named by its sqlc query name,
+// or a transaction event: begin, commit, or rollback.
+type recordedCall struct {
+	name string
+	args []driver.Value
+}
+
+// sqlRecorder is an in-memory database/sql connector which records the statements run through it
+// and serves canned rows and errors by sqlc query name, so stores can be tested without a database.
+type sqlRecorder struct {
+	mu    sync.Mutex
+	calls []recordedCall
+
+	rows map[string][][]driver.Value // rows returned by a query, none if missing
+	errs map[string]error            // error returned by a statement
+}
+
+// newSqlRecorder opens a *sql.DB backed by a new sqlRecorder.
+func newSqlRecorder(t *testing.T) (*sql.DB, *sqlRecorder) {
+
+	r := &sqlRecorder{
+		rows: make(map[string][][]driver.Value),
+		errs: make(map[string]error),
+	}
+
+	db := sql.OpenDB(r)
+	t.Cleanup(func() { db.Close() })
+
+	return db, r
+}
+
+// names returns the names of the recorded calls, in order.
+func (r *sqlRecorder) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.calls))
+	for _, c := range r.calls {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// call returns the arguments of the first recorded call with the name.
+func (r *sqlRecorder) call(name string) ([]driver.Value, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.calls, func(c recordedCall) bool { return c.name == name })
+	if i < 0 {
+		return nil, false
+	}
+	return r.calls[i].args, true
+}
+
+func (r *sqlRecorder) record(name string, args []driver.Value) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, recordedCall{name: name, args: args})
+	return r.errs[name]
+}
+
+func (r *sqlRecorder) Connect(context.Context) (driver.Conn, error) { return &recorderConn{r}, nil }
+
+func (r *sqlRecorder) Driver() driver.Driver { return recorderDriver{} }
+
+type recorderDriver struct{}
+
+func (recorderDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("recording driver must be opened with sql.OpenDB")
+}
+
+type recorderConn struct {
+	r *sqlRecorder
+}
+
+// queryName matches the name sqlc gives each query in the comment it starts with.
+var queryName = regexp.MustCompile(`^-- name: (\w+)`)
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+
+	name := query
+	if m := queryName.FindStringSubmatch(query); m != nil {
+		name = m[1]
+	}
+	return &recorderStmt{r: c.r, name: name}, nil
+}
+
+func (c *recorderConn) Close() error { return nil }
+
+func (c *recorderConn) Begin() (driver.Tx, error) {
+	if err := c.r.record("begin", nil); err != nil {
+		return nil, err
+	}
+	return &recorderTx{c.r}, nil
+}
+
+// BeginTx records the isolation level and read-only flag as the begin call's arguments,
+// so tests can check which reads share a snapshot.
+func (c *recorderConn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.r.record("begin", []driver.Value{int64(opts.Isolation), opts.ReadOnly}); err != nil {
+		return nil, err
+	}
+	return &recorderTx{c.r}, nil
+}
+
+type recorderTx struct {
+	r *sqlRecorder
+}
+
+func (tx *recorderTx) Commit() error   { return tx.r.record("commit", nil) }
+func (tx *recorderTx) Rollback() error { return tx.r.record("rollback", nil) }
+
+type recorderStmt struct {
+	r    *sqlRecorder
+	name string
+}
+
+func (s *recorderStmt) Close() error  { return nil }
+func (s *recorderStmt) NumInput() int { return -1 }
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.r.record(s.name, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.r.record(s.name, args); err != nil {
+		return nil, err
+	}
+
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	rows := s.r.rows[s.name]
+	cols := 0
+	if len(rows) > 0 {
+		cols = len(rows[0])
+	}
+	return &recorderRows{cols: cols, rows: rows}, nil
+}
+
+type recorderRows struct {
+	cols int
+	rows [][]driver.Value
+	next int
+}
+
+func (r *recorderRows) Columns() []string { return make([]string, r.cols) }
+func (r *recorderRows) Close() error      { return nil }
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
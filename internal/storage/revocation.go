@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/silhouette/internal/storage/sql/sqlc"
+)
+
+// RevocationStore defines the interface for persisting revoked tokens and users' revoked-after times,
+// so every replica denies the same tokens.
+type RevocationStore interface {
+
+	// RevokeTokens denies tokens by jti or session id until expiresAt, when they would have expired anyway.
+	// Revocations which have already expired are pruned in the same transaction.
+	RevokeTokens(ctx context.Context, tokenIds []string, expiresAt time.Time) error
+
+	// FindRevokedTokens returns which of the token ids are currently revoked.
+	FindRevokedTokens(ctx context.Context, tokenIds []string) (map[string]bool, error)
+
+	// RevokeUser denies a user's tokens issued before revokedAfter.  A user's revoked-after time
+	// only moves forward: an earlier time than the one stored is ignored.
+	RevokeUser(ctx context.Context, username string, revokedAfter time.Time) error
+
+	// GetUserRevocation returns a user's revoked-after time, or nil if their tokens have never been revoked.
+	GetUserRevocation(ctx context.Context, username string) (*time.Time, error)
+}
+
+// NewRevocationStore creates a new instance of RevocationStore interface, returning
+// a pointer to a concrete implementation of the RevocationStore.
+func NewRevocationStore(db *sql.DB, i data.Indexer) RevocationStore {
+	return &revocationStore{
+		db:      db,
+		sql:     sqlc.New(db),
+		indexer: i,
+	}
+}
+
+var _ RevocationStore = (*revocationStore)(nil)
+
+// revocationStore is a concrete implementation of the RevocationStore interface.
+// Usernames are stored as blind indexes, as in the profile table.
+type revocationStore struct {
+	db      *sql.DB
+	sql     *sqlc.Queries
+	indexer data.Indexer
+}
+
+// RevokeTokens denies tokens by jti or session id until expiresAt.
+func (s *revocationStore) RevokeTokens(ctx context.Context, tokenIds []string, expiresAt time.Time) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin token revocation transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	q := s.sql.WithTx(tx)
+	now := time.Now().UTC()
+
+	if _, err := q.DeleteExpiredRevokedTokens(ctx, now); err != nil {
+		return fmt.Errorf("failed to prune expired token revocations: %v", err)
+	}
+
+	for _, id := range tokenIds {
+		if err := q.SaveRevokedToken(ctx, sqlc.SaveRevokedTokenParams{
+			TokenID:   id,
+			ExpiresAt: expiresAt.UTC(),
+			CreatedAt: now,
+		}); err != nil {
+			return fmt.Errorf("failed to save token revocation: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit token revocation transaction: %v", err)
+	}
+
+	return nil
+}
+
+// FindRevokedTokens returns which of the token ids are currently revoked.
+func (s *revocationStore) FindRevokedTokens(ctx context.Context, tokenIds []string) (map[string]bool, error) {
+
+	revoked := make(map[string]bool, len(tokenIds))
+	if len(tokenIds) == 0 {
+		return revoked, nil
+	}
+
+	ids, err := s.sql.FindRevokedTokens(ctx, sqlc.FindRevokedTokensParams{
+		TokenIds: tokenIds,
+		Now:      time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find revoked tokens: %v", err)
+	}
+
+	for _, id := range ids {
+		revoked[id] = true
+	}
+
+	return revoked, nil
+}
+
+// RevokeUser denies a user's tokens issued before revokedAfter.
+func (s *revocationStore) RevokeUser(ctx context.Context, username string, revokedAfter time.Time) error {
+
+	index, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sql.SaveUserRevocation(ctx, sqlc.SaveUserRevocationParams{
+		UserIndex:    index,
+		RevokedAfter: revokedAfter.UTC(),
+		UpdatedAt:    time.Now().UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to save user revocation: %v", err)
+	}
+
+	return nil
+}
+
+// GetUserRevocation returns a user's revoked-after time, or nil if their tokens have never been revoked.
+func (s *revocationStore) GetUserRevocation(ctx context.Context, username string) (*time.Time, error) {
+
+	index, err := s.indexer.ObtainBlindIndex(username)
+	if err != nil {
+		return nil, err
+	}
+
+	revokedAfter, err := s.sql.FindUserRevocation(ctx, index)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find user revocation: %v", err)
+	}
+
+	return &revokedAfter, nil
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS profile_phone;
+DROP TABLE IF EXISTS profile_address;
+DROP TABLE IF EXISTS phone;
+DROP TABLE IF EXISTS address;
+DROP TABLE IF EXISTS profile;
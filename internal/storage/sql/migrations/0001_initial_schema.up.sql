@@ -1,3 +1,6 @@
+-- initial schema: profile, address and phone tables and their cross references.
+-- written idempotently so databases created before migrations were tracked can adopt it.
+
 CREATE TABLE IF NOT EXISTS profile (
     uuid CHAR(36) PRIMARY KEY,
     username VARCHAR(128) NOT NULL,
@@ -7,14 +10,14 @@ CREATE TABLE IF NOT EXISTS profile (
     updated_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP NOT NULL
 );
-CREATE UNIQUE INDEX idx_profile_blind_index ON profile(user_index);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_profile_blind_index ON profile(user_index);
 
 CREATE TABLE IF NOT EXISTS address (
     uuid CHAR(36) PRIMARY KEY,
     slug VARCHAR(128) NOT NULL,
     slug_index VARCHAR(128) NOT NULL,
     address_line_1 VARCHAR(512),
-    address_line_2 VARCHAR(255), 
+    address_line_2 VARCHAR(255),
     city VARCHAR(128),
     state VARCHAR(128),
     zip VARCHAR(128),
@@ -24,7 +27,7 @@ CREATE TABLE IF NOT EXISTS address (
     updated_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP NOT NULL
 );
-CREATE UNIQUE INDEX idx_address_blind_index ON address(slug_index);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_address_blind_index ON address(slug_index);
 
 CREATE TABLE IF NOT EXISTS phone (
     uuid CHAR(36) PRIMARY KEY,
@@ -39,7 +42,7 @@ CREATE TABLE IF NOT EXISTS phone (
     updated_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP NOT NULL
 );
-CREATE UNIQUE INDEX idx_phone_blind_index ON phone(slug_index);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_phone_blind_index ON phone(slug_index);
 
 CREATE TABLE IF NOT EXISTS profile_address (
     id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
@@ -50,8 +53,8 @@ CREATE TABLE IF NOT EXISTS profile_address (
     CONSTRAINT fk_profile_address_xref FOREIGN KEY (profile_uuid) REFERENCES profile(uuid),
     CONSTRAINT fk_address_profile_xref FOREIGN KEY (address_uuid) REFERENCES address(uuid)
 );
-CREATE INDEX idx_profile_address_xref ON profile_address(profile_uuid);   
-CREATE INDEX idx_address_profile_xref ON profile_address(address_uuid);
+CREATE INDEX IF NOT EXISTS idx_profile_address_xref ON profile_address(profile_uuid);
+CREATE INDEX IF NOT EXISTS idx_address_profile_xref ON profile_address(address_uuid);
 
 CREATE TABLE IF NOT EXISTS profile_phone (
     id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
@@ -62,5 +65,5 @@ CREATE TABLE IF NOT EXISTS profile_phone (
     CONSTRAINT fk_profile_phone_xref FOREIGN KEY (profile_uuid) REFERENCES profile(uuid),
     CONSTRAINT fk_phone_profile_xref FOREIGN KEY (phone_uuid) REFERENCES phone(uuid)
 );
-CREATE INDEX idx_profile_phone_xref ON profile_phone(profile_uuid);   
-CREATE INDEX idx_phone_profile_xref ON profile_phone(phone_uuid);
+CREATE INDEX IF NOT EXISTS idx_profile_phone_xref ON profile_phone(profile_uuid);
+CREATE INDEX IF NOT EXISTS idx_phone_profile_xref ON profile_phone(phone_uuid);
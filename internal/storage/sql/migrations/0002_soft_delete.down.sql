@@ -0,0 +1,10 @@
+-- tombstoned records would reappear as live records once the column is dropped, so remove them first
+DELETE pa FROM profile_address pa JOIN address a ON pa.address_uuid = a.uuid WHERE a.deleted_at IS NOT NULL;
+DELETE FROM address WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_address_deleted_at ON address;
+ALTER TABLE address DROP COLUMN IF EXISTS deleted_at;
+
+DELETE pp FROM profile_phone pp JOIN phone p ON pp.phone_uuid = p.uuid WHERE p.deleted_at IS NOT NULL;
+DELETE FROM phone WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_phone_deleted_at ON phone;
+ALTER TABLE phone DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+-- soft delete: deleted address and phone records are tombstoned and can be restored
+-- until the restore window passes, after which they are purged.
+ALTER TABLE address ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_address_deleted_at ON address(deleted_at);
+
+ALTER TABLE phone ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_phone_deleted_at ON phone(deleted_at);
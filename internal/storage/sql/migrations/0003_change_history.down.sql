@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS phone_history;
+DROP TABLE IF EXISTS address_history;
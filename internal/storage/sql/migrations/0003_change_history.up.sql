@@ -0,0 +1,37 @@
+-- change history: every update copies the previous, still encrypted, state of an address
+-- or phone record into its history table so prior versions can be listed and reverted to.
+CREATE TABLE IF NOT EXISTS address_history (
+    uuid CHAR(36) PRIMARY KEY,
+    address_uuid CHAR(36) NOT NULL,
+    slug VARCHAR(128) NOT NULL,
+    address_line_1 VARCHAR(512),
+    address_line_2 VARCHAR(255),
+    city VARCHAR(128),
+    state VARCHAR(128),
+    zip VARCHAR(128),
+    country VARCHAR(128),
+    is_current BOOLEAN NOT NULL,
+    is_primary BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    superseded_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_address_history FOREIGN KEY (address_uuid) REFERENCES address(uuid)
+);
+CREATE INDEX IF NOT EXISTS idx_address_history_address ON address_history(address_uuid, superseded_at);
+
+CREATE TABLE IF NOT EXISTS phone_history (
+    uuid CHAR(36) PRIMARY KEY,
+    phone_uuid CHAR(36) NOT NULL,
+    slug VARCHAR(128) NOT NULL,
+    country_code VARCHAR(64),
+    phone_number VARCHAR(64),
+    extension VARCHAR(64),
+    phone_type VARCHAR(64),
+    is_current BOOLEAN NOT NULL,
+    is_primary BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    superseded_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_phone_history FOREIGN KEY (phone_uuid) REFERENCES phone(uuid)
+);
+CREATE INDEX IF NOT EXISTS idx_phone_history_phone ON phone_history(phone_uuid, superseded_at);
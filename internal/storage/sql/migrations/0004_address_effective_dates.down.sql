@@ -0,0 +1,9 @@
+ALTER TABLE address_history DROP COLUMN IF EXISTS promote_on_start;
+ALTER TABLE address_history DROP COLUMN IF EXISTS valid_to;
+ALTER TABLE address_history DROP COLUMN IF EXISTS valid_from;
+
+DROP INDEX IF EXISTS idx_address_valid_to ON address;
+DROP INDEX IF EXISTS idx_address_valid_from ON address;
+ALTER TABLE address DROP COLUMN IF EXISTS promote_on_start;
+ALTER TABLE address DROP COLUMN IF EXISTS valid_to;
+ALTER TABLE address DROP COLUMN IF EXISTS valid_from;
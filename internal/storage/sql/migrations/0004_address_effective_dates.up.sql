@@ -0,0 +1,11 @@
+-- effective dating: an address may carry the dates it is valid from and to.  A dated address's is_current
+-- is derived from its range, and promote_on_start makes a future dated address primary once it starts.
+ALTER TABLE address ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE address ADD COLUMN IF NOT EXISTS valid_to TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE address ADD COLUMN IF NOT EXISTS promote_on_start BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_address_valid_from ON address(valid_from);
+CREATE INDEX IF NOT EXISTS idx_address_valid_to ON address(valid_to);
+
+ALTER TABLE address_history ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE address_history ADD COLUMN IF NOT EXISTS valid_to TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE address_history ADD COLUMN IF NOT EXISTS promote_on_start BOOLEAN NOT NULL DEFAULT FALSE;
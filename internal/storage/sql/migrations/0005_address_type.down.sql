@@ -0,0 +1,3 @@
+-- a user may be left with one primary address per former type; run `silhouette check --repair` afterwards
+ALTER TABLE address_history DROP COLUMN IF EXISTS address_type;
+ALTER TABLE address DROP COLUMN IF EXISTS address_type;
@@ -0,0 +1,4 @@
+-- address type: home, mailing, billing or shipping.  Unlike the phone type it is not encrypted, since it
+-- holds no personal data and primary addresses are tracked per type by the queries.
+ALTER TABLE address ADD COLUMN IF NOT EXISTS address_type VARCHAR(64) NOT NULL DEFAULT 'UNSPECIFIED';
+ALTER TABLE address_history ADD COLUMN IF NOT EXISTS address_type VARCHAR(64) NOT NULL DEFAULT 'UNSPECIFIED';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_phone_fingerprint ON phone;
+ALTER TABLE phone DROP COLUMN IF EXISTS fingerprint;
+
+DROP INDEX IF EXISTS idx_address_fingerprint ON address;
+ALTER TABLE address DROP COLUMN IF EXISTS fingerprint;
@@ -0,0 +1,7 @@
+-- fingerprint: blind index of a record's owner and its normalized contents, used to reject duplicates.
+-- Rows written before this migration have none until `silhouette check --repair` backfills them.
+ALTER TABLE address ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(128) NULL;
+CREATE INDEX IF NOT EXISTS idx_address_fingerprint ON address(fingerprint);
+
+ALTER TABLE phone ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(128) NULL;
+CREATE INDEX IF NOT EXISTS idx_phone_fingerprint ON phone(fingerprint);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_phone_phone_index ON phone;
+ALTER TABLE phone DROP COLUMN IF EXISTS phone_index;
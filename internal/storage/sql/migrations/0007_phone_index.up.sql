@@ -0,0 +1,5 @@
+-- phone_index: blind index of a phone's E.164 number alone, used to look up the profile a number belongs to.
+-- It is separate from slug_index and fingerprint, which are per record and per user.
+-- Rows written before this migration have none until `silhouette check --repair` backfills them.
+ALTER TABLE phone ADD COLUMN IF NOT EXISTS phone_index VARCHAR(128) NULL;
+CREATE INDEX IF NOT EXISTS idx_phone_phone_index ON phone(phone_index);
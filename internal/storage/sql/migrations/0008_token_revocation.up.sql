@@ -0,0 +1,16 @@
+-- revoked_token: tokens denied before their expiry, by jti or session id.
+-- A row is only needed until the tokens it denies would have expired anyway, then it is pruned.
+CREATE TABLE IF NOT EXISTS revoked_token (
+    token_id VARCHAR(128) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_token_expires_at ON revoked_token(expires_at);
+
+-- user_revocation: a user's access tokens issued before revoked_after are denied, eg, after they log out everywhere or are disabled.
+-- user_index is the blind index of the username, as in profile.
+CREATE TABLE IF NOT EXISTS user_revocation (
+    user_index VARCHAR(128) PRIMARY KEY,
+    revoked_after TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,13 @@
+-- emergency_grant: time-boxed break-glass grants of read access to every profile to a named operator, for incident response.
+-- Grants are kept after they expire as a record of who granted access to whom and why.
+-- operator_index and granted_by_index are blind indexes of the usernames, as in profile.
+CREATE TABLE IF NOT EXISTS emergency_grant (
+    uuid CHAR(36) PRIMARY KEY,
+    operator_index VARCHAR(128) NOT NULL,
+    justification VARCHAR(1024) NOT NULL,
+    granted_by_index VARCHAR(128) NOT NULL,
+    requesting_service VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_emergency_grant_operator_expires_at ON emergency_grant(operator_index, expires_at);
@@ -0,0 +1,13 @@
+// Package migrations embeds the numbered schema migrations so they ship inside the service binary.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.  Versions must be
+// unique and every up migration must have a matching down migration.  sqlc reads the up
+// migrations in this directory as the schema and ignores the down migrations.
+package migrations
+
+import "embed"
+
+// Files holds the up and down migration scripts.
+//
+//go:embed *.sql
+var Files embed.FS
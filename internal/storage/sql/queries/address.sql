@@ -1,11 +1,13 @@
 -- name: FindAllAddresses :many
 SELECT *
-FROM address;
+FROM address
+WHERE deleted_at IS NULL;
 
 -- name: FindAddressBySlug :one
 SELECT * 
 FROM address
-WHERE slug_index = sqlc.arg("slug_index");
+WHERE slug_index = sqlc.arg("slug_index")
+AND deleted_at IS NULL;
 
 -- name: FindAddressBySlugAndUser :one
 SELECT a.*
@@ -13,21 +15,49 @@ FROM address a
 JOIN profile_address pa ON a.uuid = pa.address_uuid
 JOIN profile p ON pa.profile_uuid = p.uuid
 WHERE a.slug_index = sqlc.arg("slug_index")
-AND p.user_index = sqlc.arg("user_index");
+AND p.user_index = sqlc.arg("user_index")
+AND a.deleted_at IS NULL;
 
 -- name: FindAddressesByUser :many
+-- ordered primary first, then current, then oldest first; uuid breaks ties
+SELECT a.*
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+WHERE p.user_index = sqlc.arg("user_index")
+AND a.deleted_at IS NULL
+ORDER BY a.is_primary DESC, a.is_current DESC, a.created_at ASC, a.uuid ASC;
+
+-- name: FindDeletedAddressBySlugAndUser :one
+-- a tombstone of the user's deleted after deleted_after, ie, one which can still be restored
 SELECT a.*
 FROM address a
 JOIN profile_address pa ON a.uuid = pa.address_uuid
 JOIN profile p ON pa.profile_uuid = p.uuid
-WHERE p.user_index = sqlc.arg("user_index");
+WHERE a.slug_index = sqlc.arg("slug_index")
+AND p.user_index = sqlc.arg("user_index")
+AND a.deleted_at >= sqlc.arg("deleted_after");
+
+-- name: FindAddressByFingerprint :one
+-- a live address of the user's with the same normalized lines and postal code, other than exclude_uuid, if any
+SELECT a.* 
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+WHERE a.fingerprint = sqlc.arg("fingerprint")
+AND p.user_index = sqlc.arg("user_index")
+AND a.uuid <> sqlc.arg("exclude_uuid")
+AND a.deleted_at IS NULL
+ORDER BY a.created_at ASC, a.uuid ASC
+LIMIT 1;
 
 -- name: CountAddressesForUser :one
 SELECT COUNT(*)
 FROM address a
 JOIN profile_address pa ON a.uuid = pa.address_uuid
 JOIN profile p ON pa.profile_uuid = p.uuid
-WHERE p.user_index = sqlc.arg("user_index");
+WHERE p.user_index = sqlc.arg("user_index")
+AND a.deleted_at IS NULL;
 
 -- name: CountPrimaryAddressesForUser :one
 SELECT COUNT(*)
@@ -35,7 +65,19 @@ FROM address a
 JOIN profile_address pa ON a.uuid = pa.address_uuid
 JOIN profile p ON pa.profile_uuid = p.uuid
 WHERE p.user_index = sqlc.arg("user_index")
-AND a.is_primary = true;
+AND a.is_primary = true
+AND a.deleted_at IS NULL;
+
+-- name: CountPrimaryAddressesOfTypeForUser :one
+-- for when primary is tracked per address type
+SELECT COUNT(*)
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+WHERE p.user_index = sqlc.arg("user_index")
+AND a.address_type = sqlc.arg("address_type")
+AND a.is_primary = true
+AND a.deleted_at IS NULL;
 
 -- name: FindPrimaryAddresses :many
 SELECT a.uuid, a.slug, a.is_current, a.is_primary
@@ -43,35 +85,55 @@ FROM address a
 JOIN profile_address pa ON a.uuid = pa.address_uuid
 JOIN profile p ON pa.profile_uuid = p.uuid
 WHERE p.user_index = sqlc.arg("user_index")
-AND a.is_primary = true;
+AND a.is_primary = true
+AND a.deleted_at IS NULL;
+
+-- name: FindAddressesByProfiles :many
+-- grouped by profile, each ordered primary first, then current, then oldest first; uuid breaks ties
+SELECT pa.profile_uuid, sqlc.embed(a)
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+WHERE pa.profile_uuid IN (sqlc.slice("profile_uuids"))
+AND a.deleted_at IS NULL
+ORDER BY pa.profile_uuid, a.is_primary DESC, a.is_current DESC, a.created_at ASC, a.uuid ASC;
 
 -- name: SaveAddress :exec
 INSERT INTO address (
     uuid, 
     slug,
     slug_index,
+    fingerprint,
     address_line_1, 
     address_line_2, 
     city, 
     state, 
     zip, 
     country,
+    address_type,
     is_current,
     is_primary,
+    valid_from,
+    valid_to,
+    promote_on_start,
     updated_at,
     created_at
 ) VALUES (
     sqlc.arg("uuid"), 
     sqlc.arg("slug"),
     sqlc.arg("slug_index"),
+    sqlc.arg("fingerprint"),
     sqlc.arg("street_address"), 
     sqlc.arg("street_address_2"), 
     sqlc.arg("city"), 
     sqlc.arg("state"), 
     sqlc.arg("zip"), 
     sqlc.arg("country"),
+    sqlc.arg("address_type"),
     sqlc.arg("is_current"),
     sqlc.arg("is_primary"),
+    sqlc.arg("valid_from"),
+    sqlc.arg("valid_to"),
+    sqlc.arg("promote_on_start"),
     sqlc.arg("updated_at"),
     sqlc.arg("created_at")
 );
@@ -79,17 +141,155 @@ INSERT INTO address (
 -- name: UpdateAddress :exec
 UPDATE address
 SET 
+    fingerprint = sqlc.arg("fingerprint"),
     address_line_1 = sqlc.arg("street_address"),
     address_line_2 = sqlc.arg("street_address_2"),
     city = sqlc.arg("city"),
     state = sqlc.arg("state"),
     zip = sqlc.arg("zip"),
     country = sqlc.arg("country"),
+    address_type = sqlc.arg("address_type"),
     is_current = sqlc.arg("is_current"),
     is_primary = sqlc.arg("is_primary"),
+    valid_from = sqlc.arg("valid_from"),
+    valid_to = sqlc.arg("valid_to"),
+    promote_on_start = sqlc.arg("promote_on_start"),
     updated_at = sqlc.arg("updated_at")
 WHERE uuid = sqlc.arg("uuid");
 
 -- name: DeleteAddress :exec
 DELETE FROM address
-WHERE uuid = sqlc.arg("uuid");
\ No newline at end of file
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: TombstoneAddress :execrows
+-- a tombstoned record is never primary, so it is restored as non-primary
+UPDATE address
+SET 
+    is_primary = false,
+    deleted_at = sqlc.arg("deleted_at"),
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid")
+AND deleted_at IS NULL;
+
+-- name: RestoreAddress :execrows
+UPDATE address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+SET 
+    a.deleted_at = NULL,
+    a.updated_at = sqlc.arg("updated_at")
+WHERE a.slug_index = sqlc.arg("slug_index")
+AND p.user_index = sqlc.arg("user_index")
+AND a.deleted_at >= sqlc.arg("deleted_after");
+
+-- name: ShredTombstonedAddresses :execrows
+-- overwrites the encrypted fields of expired tombstones before they are deleted
+UPDATE address
+SET 
+    slug = '',
+    slug_index = uuid,
+    fingerprint = NULL,
+    address_line_1 = NULL,
+    address_line_2 = NULL,
+    city = NULL,
+    state = NULL,
+    zip = NULL,
+    country = NULL
+WHERE deleted_at < sqlc.arg("deleted_before");
+
+-- name: DeleteTombstonedAddressXrefs :execrows
+DELETE pa 
+FROM profile_address pa
+JOIN address a ON pa.address_uuid = a.uuid
+WHERE a.deleted_at < sqlc.arg("deleted_before");
+
+-- name: DeleteTombstonedAddresses :execrows
+DELETE FROM address
+WHERE deleted_at < sqlc.arg("deleted_before");
+
+-- name: FindAddressesToEnd :many
+-- dated records whose range has ended, but which are still current, primary, or scheduled for promotion
+SELECT uuid
+FROM address
+WHERE valid_to <= sqlc.arg("as_of")
+AND (is_current = true OR is_primary = true OR promote_on_start = true)
+AND deleted_at IS NULL
+ORDER BY uuid ASC
+FOR UPDATE;
+
+-- name: EndAddress :execrows
+-- a dated record whose range has ended is no longer current, and so can no longer be primary
+UPDATE address
+SET 
+    is_current = false,
+    is_primary = false,
+    promote_on_start = false,
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid")
+AND deleted_at IS NULL;
+
+-- name: FindAddressesToStart :many
+-- dated records whose range has started, and not yet ended, which are not yet current
+SELECT uuid
+FROM address
+WHERE (valid_from IS NOT NULL OR valid_to IS NOT NULL)
+AND (valid_from IS NULL OR valid_from <= sqlc.arg("as_of"))
+AND (valid_to IS NULL OR valid_to > sqlc.arg("as_of"))
+AND is_current = false
+AND deleted_at IS NULL
+ORDER BY uuid ASC
+FOR UPDATE;
+
+-- name: StartAddress :execrows
+UPDATE address
+SET 
+    is_current = true,
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid")
+AND deleted_at IS NULL;
+
+-- name: FindAddressesDueForPromotion :many
+-- oldest start first so the latest start wins when a user has more than one due
+SELECT a.uuid, a.address_type, pa.profile_uuid
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+WHERE a.promote_on_start = true
+AND a.valid_from <= sqlc.arg("as_of")
+AND a.is_current = true
+AND a.deleted_at IS NULL
+ORDER BY a.valid_from ASC, a.uuid ASC;
+
+-- name: FindOtherPrimaryAddresses :many
+-- the profile's other primary addresses, which lose the flag when an address is promoted
+SELECT a.uuid
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+WHERE pa.profile_uuid = sqlc.arg("profile_uuid")
+AND a.is_primary = true
+AND a.uuid <> sqlc.arg("uuid")
+AND a.deleted_at IS NULL
+ORDER BY a.uuid ASC
+FOR UPDATE;
+
+-- name: FindOtherPrimaryAddressesOfType :many
+-- for when primary is tracked per address type, only the other primary addresses of the same type lose the flag
+SELECT a.uuid
+FROM address a
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+WHERE pa.profile_uuid = sqlc.arg("profile_uuid")
+AND a.address_type = sqlc.arg("address_type")
+AND a.is_primary = true
+AND a.uuid <> sqlc.arg("uuid")
+AND a.deleted_at IS NULL
+ORDER BY a.uuid ASC
+FOR UPDATE;
+
+-- name: PromoteAddress :execrows
+UPDATE address
+SET 
+    is_primary = true,
+    promote_on_start = false,
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid")
+AND promote_on_start = true
+AND deleted_at IS NULL;
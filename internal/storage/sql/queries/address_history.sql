@@ -0,0 +1,84 @@
+-- name: SaveAddressHistory :exec
+-- copies the current, still encrypted, state of an address record into its history
+INSERT INTO address_history (
+    uuid,
+    address_uuid,
+    slug,
+    address_line_1,
+    address_line_2,
+    city,
+    state,
+    zip,
+    country,
+    address_type,
+    is_current,
+    is_primary,
+    valid_from,
+    valid_to,
+    promote_on_start,
+    updated_at,
+    created_at,
+    superseded_at
+)
+SELECT 
+    sqlc.arg("uuid"),
+    a.uuid,
+    a.slug,
+    a.address_line_1,
+    a.address_line_2,
+    a.city,
+    a.state,
+    a.zip,
+    a.country,
+    a.address_type,
+    a.is_current,
+    a.is_primary,
+    a.valid_from,
+    a.valid_to,
+    a.promote_on_start,
+    a.updated_at,
+    a.created_at,
+    sqlc.arg("superseded_at")
+FROM address a
+WHERE a.uuid = sqlc.arg("address_uuid");
+
+-- name: FindAddressHistoryByUser :many
+-- newest version first; uuid breaks ties
+SELECT h.*
+FROM address_history h
+JOIN address a ON h.address_uuid = a.uuid
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+WHERE a.slug_index = sqlc.arg("slug_index")
+AND p.user_index = sqlc.arg("user_index")
+AND a.deleted_at IS NULL
+ORDER BY h.superseded_at DESC, h.uuid ASC;
+
+-- name: FindAddressVersionByUser :one
+SELECT h.*
+FROM address_history h
+JOIN address a ON h.address_uuid = a.uuid
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+WHERE h.uuid = sqlc.arg("version")
+AND a.slug_index = sqlc.arg("slug_index")
+AND p.user_index = sqlc.arg("user_index")
+AND a.deleted_at IS NULL;
+
+-- name: FindAddressHistorySince :many
+-- prior versions of the user's live records superseded after since, oldest first for each record
+SELECT h.*
+FROM address_history h
+JOIN address a ON h.address_uuid = a.uuid
+JOIN profile_address pa ON a.uuid = pa.address_uuid
+JOIN profile p ON pa.profile_uuid = p.uuid
+WHERE p.user_index = sqlc.arg("user_index")
+AND h.superseded_at > sqlc.arg("since")
+AND a.deleted_at IS NULL
+ORDER BY h.address_uuid ASC, h.superseded_at ASC, h.uuid ASC;
+
+-- name: DeleteTombstonedAddressHistory :execrows
+DELETE h 
+FROM address_history h
+JOIN address a ON h.address_uuid = a.uuid
+WHERE a.deleted_at < sqlc.arg("deleted_before");
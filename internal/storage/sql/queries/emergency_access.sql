@@ -0,0 +1,30 @@
+-- name: SaveEmergencyGrant :exec
+INSERT INTO emergency_grant (
+    uuid,
+    operator_index,
+    justification,
+    granted_by_index,
+    requesting_service,
+    expires_at,
+    created_at
+) VALUES (
+    sqlc.arg("uuid"),
+    sqlc.arg("operator_index"),
+    sqlc.arg("justification"),
+    sqlc.arg("granted_by_index"),
+    sqlc.arg("requesting_service"),
+    sqlc.arg("expires_at"),
+    sqlc.arg("created_at")
+);
+
+-- name: FindActiveEmergencyGrant :one
+-- if an operator has overlapping grants, the one which lasts longest is used
+SELECT
+    uuid,
+    justification,
+    expires_at
+FROM emergency_grant
+WHERE operator_index = sqlc.arg("operator_index")
+    AND expires_at > sqlc.arg("now")
+ORDER BY expires_at DESC
+LIMIT 1;
@@ -0,0 +1,68 @@
+-- name: FindAllProfiles :many
+SELECT *
+FROM profile;
+
+-- name: FindOrphanAddresses :many
+-- address rows with no profile_address link
+SELECT a.uuid, a.created_at
+FROM address a
+LEFT JOIN profile_address pa ON a.uuid = pa.address_uuid
+WHERE pa.id IS NULL;
+
+-- name: FindOrphanPhones :many
+-- phone rows with no profile_phone link
+SELECT p.uuid, p.created_at
+FROM phone p
+LEFT JOIN profile_phone pp ON p.uuid = pp.phone_uuid
+WHERE pp.id IS NULL;
+
+-- name: FindAddressFlagsByProfile :many
+-- the primary/current flags of every linked address, grouped by profile; primary is tracked per address type
+SELECT pa.profile_uuid, a.uuid, a.address_type, a.is_current, a.is_primary, a.updated_at
+FROM profile_address pa
+JOIN address a ON pa.address_uuid = a.uuid
+WHERE a.deleted_at IS NULL
+ORDER BY pa.profile_uuid, a.updated_at DESC, a.uuid;
+
+-- name: FindPhoneFlagsByProfile :many
+-- the primary/current flags of every linked phone, grouped by profile
+SELECT pp.profile_uuid, p.uuid, p.is_current, p.is_primary, p.updated_at
+FROM profile_phone pp
+JOIN phone p ON pp.phone_uuid = p.uuid
+WHERE p.deleted_at IS NULL
+ORDER BY pp.profile_uuid, p.updated_at DESC, p.uuid;
+
+-- name: ClearAddressPrimary :exec
+UPDATE address
+SET 
+    is_primary = false,
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: ClearPhonePrimary :exec
+UPDATE phone
+SET 
+    is_primary = false,
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: UpdateProfileUserIndex :exec
+UPDATE profile
+SET user_index = sqlc.arg("user_index")
+WHERE uuid = sqlc.arg("uuid");
+
+
+-- name: UpdateAddressFingerprint :exec
+UPDATE address
+SET fingerprint = sqlc.arg("fingerprint")
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: UpdatePhoneFingerprint :exec
+UPDATE phone
+SET fingerprint = sqlc.arg("fingerprint")
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: UpdatePhoneIndex :exec
+UPDATE phone
+SET phone_index = sqlc.arg("phone_index")
+WHERE uuid = sqlc.arg("uuid");
\ No newline at end of file
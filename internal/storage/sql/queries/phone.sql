@@ -1,11 +1,13 @@
 -- name: FindAllPhones :many
 SELECT * 
-FROM phone;
+FROM phone
+WHERE deleted_at IS NULL;
 
 -- name: FindPhoneBySlug :one
 SELECT * 
 FROM phone
-WHERE slug_index = sqlc.arg("slug_index");
+WHERE slug_index = sqlc.arg("slug_index")
+AND deleted_at IS NULL;
 
 -- name: FindPhoneByUser :one
 SELECT p.* 
@@ -13,14 +15,39 @@ FROM phone p
 JOIN profile_phone pp ON p.uuid = pp.phone_uuid
 JOIN profile pr ON pp.profile_uuid = pr.uuid
 WHERE p.slug_index = sqlc.arg("slug_index")
-AND pr.user_index = sqlc.arg("user_index");
+AND pr.user_index = sqlc.arg("user_index")
+AND p.deleted_at IS NULL;
+
+-- name: FindDeletedPhoneByUser :one
+-- a tombstone of the user's deleted after deleted_after, ie, one which can still be restored
+SELECT p.* 
+FROM phone p
+JOIN profile_phone pp ON p.uuid = pp.phone_uuid
+JOIN profile pr ON pp.profile_uuid = pr.uuid
+WHERE p.slug_index = sqlc.arg("slug_index")
+AND pr.user_index = sqlc.arg("user_index")
+AND p.deleted_at >= sqlc.arg("deleted_after");
+
+-- name: FindPhoneByFingerprint :one
+-- a live phone of the user's with the same normalized number, other than exclude_uuid, if any
+SELECT p.* 
+FROM phone p
+JOIN profile_phone pp ON p.uuid = pp.phone_uuid
+JOIN profile pr ON pp.profile_uuid = pr.uuid
+WHERE p.fingerprint = sqlc.arg("fingerprint")
+AND pr.user_index = sqlc.arg("user_index")
+AND p.uuid <> sqlc.arg("exclude_uuid")
+AND p.deleted_at IS NULL
+ORDER BY p.created_at ASC, p.uuid ASC
+LIMIT 1;
 
 -- name: CountPhonesForUser :one
 SELECT COUNT(*)
 FROM phone p
 JOIN profile_phone pp ON p.uuid = pp.phone_uuid
 JOIN profile pr ON pp.profile_uuid = pr.uuid
-WHERE pr.user_index = sqlc.arg("user_index");
+WHERE pr.user_index = sqlc.arg("user_index")
+AND p.deleted_at IS NULL;
 
 -- name: CountPrimaryPhonesForUser :one
 SELECT COUNT(*)
@@ -28,20 +55,35 @@ FROM phone p
 JOIN profile_phone pp ON p.uuid = pp.phone_uuid
 JOIN profile pr ON pp.profile_uuid = pr.uuid
 WHERE pr.user_index = sqlc.arg("user_index")
-AND p.is_primary = true;
+AND p.is_primary = true
+AND p.deleted_at IS NULL;
 
 -- name: FindPhonesByUser :many
+-- ordered primary first, then current, then oldest first; uuid breaks ties
 SELECT p.*
 FROM phone p
 JOIN profile_phone pp ON p.uuid = pp.phone_uuid
 JOIN profile pr ON pp.profile_uuid = pr.uuid
-WHERE pr.user_index = sqlc.arg("user_index");
+WHERE pr.user_index = sqlc.arg("user_index")
+AND p.deleted_at IS NULL
+ORDER BY p.is_primary DESC, p.is_current DESC, p.created_at ASC, p.uuid ASC;
+
+-- name: FindPhonesByProfiles :many
+-- grouped by profile, each ordered primary first, then current, then oldest first; uuid breaks ties
+SELECT pp.profile_uuid, sqlc.embed(p)
+FROM phone p
+JOIN profile_phone pp ON p.uuid = pp.phone_uuid
+WHERE pp.profile_uuid IN (sqlc.slice("profile_uuids"))
+AND p.deleted_at IS NULL
+ORDER BY pp.profile_uuid, p.is_primary DESC, p.is_current DESC, p.created_at ASC, p.uuid ASC;
 
 -- name: SavePhone :exec
 INSERT INTO phone (
     uuid,
     slug,
     slug_index,
+    fingerprint,
+    phone_index,
     country_code,
     phone_number,
     extension,
@@ -54,6 +96,8 @@ INSERT INTO phone (
     sqlc.arg("uuid"),
     sqlc.arg("slug"),
     sqlc.arg("slug_index"),
+    sqlc.arg("fingerprint"),
+    sqlc.arg("phone_index"),
     sqlc.arg("country_code"),
     sqlc.arg("phone_number"),
     sqlc.arg("extension"),
@@ -67,6 +111,8 @@ INSERT INTO phone (
 -- name: UpdatePhone :exec
 UPDATE phone
 SET 
+    fingerprint = sqlc.arg("fingerprint"),
+    phone_index = sqlc.arg("phone_index"),
     country_code = sqlc.arg("country_code"),
     phone_number = sqlc.arg("phone_number"),
     extension = sqlc.arg("extension"),
@@ -78,4 +124,49 @@ WHERE uuid = sqlc.arg("uuid");
 
 -- name: DeletePhone :exec
 DELETE FROM phone
-WHERE uuid = sqlc.arg("uuid");
\ No newline at end of file
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: TombstonePhone :execrows
+-- a tombstoned record is never primary, so it is restored as non-primary
+UPDATE phone
+SET 
+    is_primary = false,
+    deleted_at = sqlc.arg("deleted_at"),
+    updated_at = sqlc.arg("updated_at")
+WHERE uuid = sqlc.arg("uuid")
+AND deleted_at IS NULL;
+
+-- name: RestorePhone :execrows
+UPDATE phone p
+JOIN profile_phone pp ON p.uuid = pp.phone_uuid
+JOIN profile pr ON pp.profile_uuid = pr.uuid
+SET 
+    p.deleted_at = NULL,
+    p.updated_at = sqlc.arg("updated_at")
+WHERE p.slug_index = sqlc.arg("slug_index")
+AND pr.user_index = sqlc.arg("user_index")
+AND p.deleted_at >= sqlc.arg("deleted_after");
+
+-- name: ShredTombstonedPhones :execrows
+-- overwrites the encrypted fields of expired tombstones before they are deleted
+UPDATE phone
+SET 
+    slug = '',
+    slug_index = uuid,
+    fingerprint = NULL,
+    phone_index = NULL,
+    country_code = NULL,
+    phone_number = NULL,
+    extension = NULL,
+    phone_type = NULL
+WHERE deleted_at < sqlc.arg("deleted_before");
+
+-- name: DeleteTombstonedPhoneXrefs :execrows
+DELETE pp 
+FROM profile_phone pp
+JOIN phone p ON pp.phone_uuid = p.uuid
+WHERE p.deleted_at < sqlc.arg("deleted_before");
+
+-- name: DeleteTombstonedPhones :execrows
+DELETE FROM phone
+WHERE deleted_at < sqlc.arg("deleted_before");
\ No newline at end of file
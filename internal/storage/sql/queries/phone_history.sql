@@ -0,0 +1,60 @@
+-- name: SavePhoneHistory :exec
+-- copies the current, still encrypted, state of a phone record into its history
+INSERT INTO phone_history (
+    uuid,
+    phone_uuid,
+    slug,
+    country_code,
+    phone_number,
+    extension,
+    phone_type,
+    is_current,
+    is_primary,
+    updated_at,
+    created_at,
+    superseded_at
+)
+SELECT 
+    sqlc.arg("uuid"),
+    ph.uuid,
+    ph.slug,
+    ph.country_code,
+    ph.phone_number,
+    ph.extension,
+    ph.phone_type,
+    ph.is_current,
+    ph.is_primary,
+    ph.updated_at,
+    ph.created_at,
+    sqlc.arg("superseded_at")
+FROM phone ph
+WHERE ph.uuid = sqlc.arg("phone_uuid");
+
+-- name: FindPhoneHistoryByUser :many
+-- newest version first; uuid breaks ties
+SELECT h.*
+FROM phone_history h
+JOIN phone ph ON h.phone_uuid = ph.uuid
+JOIN profile_phone pp ON ph.uuid = pp.phone_uuid
+JOIN profile pr ON pp.profile_uuid = pr.uuid
+WHERE ph.slug_index = sqlc.arg("slug_index")
+AND pr.user_index = sqlc.arg("user_index")
+AND ph.deleted_at IS NULL
+ORDER BY h.superseded_at DESC, h.uuid ASC;
+
+-- name: FindPhoneVersionByUser :one
+SELECT h.*
+FROM phone_history h
+JOIN phone ph ON h.phone_uuid = ph.uuid
+JOIN profile_phone pp ON ph.uuid = pp.phone_uuid
+JOIN profile pr ON pp.profile_uuid = pr.uuid
+WHERE h.uuid = sqlc.arg("version")
+AND ph.slug_index = sqlc.arg("slug_index")
+AND pr.user_index = sqlc.arg("user_index")
+AND ph.deleted_at IS NULL;
+
+-- name: DeleteTombstonedPhoneHistory :execrows
+DELETE h 
+FROM phone_history h
+JOIN phone ph ON h.phone_uuid = ph.uuid
+WHERE ph.deleted_at < sqlc.arg("deleted_before");
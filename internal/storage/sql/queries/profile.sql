@@ -3,43 +3,6 @@ SELECT *
 FROM profile
 WHERE user_index = sqlc.arg("user_index");
 
--- name: FindProfileAddressPhoneRows :many
-SELECT 
-    p.uuid AS profile_uuid, 
-    p.username,
-    p.nick_name,
-    p.dark_mode,
-    p.updated_at AS profile_updated_at,
-    p.created_at AS profile_created_at,
-    a.uuid AS address_uuid,
-    a.slug AS address_slug,
-    a.address_line_1,
-    a.address_line_2,
-    a.city,
-    a.state,
-    a.zip,
-    a.country AS address_country,
-    a.is_current AS address_is_current,
-    a.is_primary AS address_is_primary,
-    a.updated_at AS address_updated_at,
-    a.created_at AS address_created_at,
-    ph.uuid AS phone_uuid,
-    ph.slug AS phone_slug,
-    ph.country_code AS phone_country_code,
-    ph.phone_number,
-    ph.extension,
-    ph.phone_type,
-    ph.is_current AS phone_is_current,
-    ph.is_primary AS phone_is_primary,
-    ph.updated_at AS phone_updated_at,
-    ph.created_at AS phone_created_at
-FROM profile p
-LEFT JOIN profile_address pa ON p.uuid = pa.profile_uuid
-LEFT JOIN address a ON pa.address_uuid = a.uuid
-LEFT JOIN profile_phone pp ON p.uuid = pp.profile_uuid
-LEFT JOIN phone ph ON pp.phone_uuid = ph.uuid
-WHERE p.user_index = sqlc.arg("user_index");
-
 -- name: SaveProfile :exec
 INSERT INTO profile (
     uuid, 
@@ -68,4 +31,49 @@ WHERE uuid = sqlc.arg("uuid");
 
 -- name: DeleteProfile :exec
 DELETE FROM profile
-WHERE uuid = sqlc.arg("uuid");
\ No newline at end of file
+WHERE uuid = sqlc.arg("uuid");
+
+-- name: FindProfilesByPhoneIndex :many
+-- the profiles with a live phone of the number; more than one means the number is shared
+SELECT DISTINCT pr.*
+FROM profile pr
+JOIN profile_phone pp ON pr.uuid = pp.profile_uuid
+JOIN phone p ON pp.phone_uuid = p.uuid
+WHERE p.phone_index = sqlc.arg("phone_index")
+AND p.deleted_at IS NULL
+ORDER BY pr.uuid ASC
+LIMIT 2;
+
+
+-- name: FindProfilesByUserIndexes :many
+SELECT *
+FROM profile
+WHERE user_index IN (sqlc.slice("user_indexes"));
+
+
+-- name: FindProfilesPage :many
+-- a page of profiles ordered by created_at, then uuid, after the cursor; every filter is optional
+SELECT p.*
+FROM profile p
+WHERE (sqlc.narg("after_created_at") IS NULL 
+    OR p.created_at > sqlc.narg("after_created_at")
+    OR (p.created_at = sqlc.narg("after_created_at") AND p.uuid > sqlc.arg("after_uuid")))
+AND (sqlc.narg("dark_mode") IS NULL OR p.dark_mode = sqlc.narg("dark_mode"))
+AND (sqlc.narg("created_from") IS NULL OR p.created_at >= sqlc.narg("created_from"))
+AND (sqlc.narg("created_to") IS NULL OR p.created_at < sqlc.narg("created_to"))
+AND (sqlc.narg("updated_from") IS NULL OR p.updated_at >= sqlc.narg("updated_from"))
+AND (sqlc.narg("updated_to") IS NULL OR p.updated_at < sqlc.narg("updated_to"))
+AND (sqlc.narg("has_address") IS NULL OR EXISTS (
+    SELECT 1
+    FROM profile_address pa
+    JOIN address a ON pa.address_uuid = a.uuid
+    WHERE pa.profile_uuid = p.uuid
+    AND a.deleted_at IS NULL) = CAST(sqlc.narg("has_address") AS UNSIGNED))
+AND (sqlc.narg("has_phone") IS NULL OR EXISTS (
+    SELECT 1
+    FROM profile_phone pp
+    JOIN phone ph ON pp.phone_uuid = ph.uuid
+    WHERE pp.profile_uuid = p.uuid
+    AND ph.deleted_at IS NULL) = CAST(sqlc.narg("has_phone") AS UNSIGNED))
+ORDER BY p.created_at ASC, p.uuid ASC
+LIMIT ?;
@@ -0,0 +1,42 @@
+-- name: SaveRevokedToken :exec
+-- a token revoked again keeps the later of its expiries
+INSERT INTO revoked_token (
+    token_id,
+    expires_at,
+    created_at
+) VALUES (
+    sqlc.arg("token_id"),
+    sqlc.arg("expires_at"),
+    sqlc.arg("created_at")
+)
+ON DUPLICATE KEY UPDATE expires_at = GREATEST(expires_at, VALUES(expires_at));
+
+-- name: FindRevokedTokens :many
+SELECT token_id
+FROM revoked_token
+WHERE token_id IN (sqlc.slice("token_ids"))
+    AND expires_at > sqlc.arg("now");
+
+-- name: DeleteExpiredRevokedTokens :execrows
+DELETE FROM revoked_token
+WHERE expires_at <= sqlc.arg("now");
+
+-- name: SaveUserRevocation :exec
+-- revoked_after only moves forward, so a delayed or replayed request cannot re-admit tokens
+INSERT INTO user_revocation (
+    user_index,
+    revoked_after,
+    updated_at
+) VALUES (
+    sqlc.arg("user_index"),
+    sqlc.arg("revoked_after"),
+    sqlc.arg("updated_at")
+)
+ON DUPLICATE KEY UPDATE
+    revoked_after = GREATEST(revoked_after, VALUES(revoked_after)),
+    updated_at = VALUES(updated_at);
+
+-- name: FindUserRevocation :one
+SELECT revoked_after
+FROM user_revocation
+WHERE user_index = sqlc.arg("user_index");
@@ -8,9 +8,10 @@ CONFIG_MAP_NAME="cm-silhouette-service"
 SILHOUETTE_URL=$(op read "op://world_site/silhouette_service_container_prod/url")
 SILHOUETTE_PORT=$(op read "op://world_site/silhouette_service_container_prod/port")
 SILHOUETTE_CLIENT_ID=$(op read "op://world_site/silhouette_service_container_prod/client_id")
+SILHOUETTE_CERT_BINDINGS=$(op read "op://world_site/silhouette_service_container_prod/cert_bindings")
 
 # validate values are not empty
-if [[ -z "$SILHOUETTE_URL" || -z "$SILHOUETTE_PORT" || -z "$SILHOUETTE_CLIENT_ID" ]]; then
+if [[ -z "$SILHOUETTE_URL" || -z "$SILHOUETTE_PORT" || -z "$SILHOUETTE_CLIENT_ID" || -z "$SILHOUETTE_CERT_BINDINGS" ]]; then
   echo "Error: failed to get silhouette config vars from 1Password."
   exit 1
 fi
@@ -26,4 +27,5 @@ data:
   silhouette-url: "$SILHOUETTE_URL:$SILHOUETTE_PORT"
   silhouette-port: ":$SILHOUETTE_PORT"
   silhouette-client-id: "$SILHOUETTE_CLIENT_ID"
+  silhouette-cert-bindings: "$SILHOUETTE_CERT_BINDINGS"
 EOF
@@ -28,4 +28,5 @@ docker run -d --rm --name "${CONTAINER_NAME}" -p "${SILHOUETTE_SERVICE_PORT: -4}
     -e SILHOUETTE_FIELD_LEVEL_AES_GCM_SECRET \
     -e SILHOUETTE_S2S_JWT_VERIFYING_KEY \
     -e SILHOUETTE_USER_JWT_VERIFYING_KEY \
+    -e SILHOUETTE_REQUIRE_CURRENT_SCHEMA \
     "${IMAGE_NAME}"